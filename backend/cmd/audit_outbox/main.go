@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/config"
+	"github.com/UAssylbek/central-reporting/internal/database"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/services"
+)
+
+// Очередь доставки журнала аудита во внешние системы: состояние по получателям и возврат в очередь
+// записей, исчерпавших попытки (AUDIT_SINK_MAX_ATTEMPTS). Код выхода 1 - есть недоставленные записи.
+//
+//	audit_outbox
+//	audit_outbox -requeue -sink webhook:https://siem.example/audit
+func main() {
+	requeue := flag.Bool("requeue", false, "вернуть в очередь записи, исчерпавшие попытки")
+	sink := flag.String("sink", "", "только этот получатель (по умолчанию все)")
+	flag.Parse()
+
+	fmt.Println("=== Очередь доставки журнала аудита ===")
+
+	// Load configuration
+	cfg := config.Load()
+
+	// Connect to database
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer db.Close()
+
+	dispatcher := services.NewAuditDispatcher(repositories.NewAuditLogRepository(db), cfg.AuditSinks.MaxAttempts)
+
+	if *requeue {
+		requeued, err := dispatcher.Requeue(*sink)
+		if err != nil {
+			log.Fatal("Failed to requeue audit outbox:", err)
+		}
+		fmt.Printf("Возвращено в очередь: %d\n\n", requeued)
+	}
+
+	status, err := dispatcher.Status()
+	if err != nil {
+		log.Fatal("Failed to get audit outbox status:", err)
+	}
+	if len(status) == 0 {
+		fmt.Println("✅ Все записи доставлены")
+		return
+	}
+
+	exhausted := false
+	for _, s := range status {
+		if *sink != "" && s.Sink != *sink {
+			continue
+		}
+		fmt.Println(s.Sink)
+		fmt.Printf("  Ждут доставки:            %d\n", s.Pending)
+		fmt.Printf("  Исчерпали попытки:        %d\n", s.Exhausted)
+		if s.OldestExhaustedAt != nil {
+			fmt.Printf("  Самая старая из них:      %s\n", s.OldestExhaustedAt.Format(time.RFC3339))
+		}
+		fmt.Printf("  Выгружены в архив:        %d\n", s.Abandoned)
+		if s.Exhausted > 0 {
+			exhausted = true
+		}
+	}
+
+	if exhausted {
+		fmt.Println("\n❌ Есть записи, которые больше не отправляются: верните их в очередь флагом -requeue")
+		os.Exit(1)
+	}
+}
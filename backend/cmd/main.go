@@ -14,7 +14,7 @@ import (
 	"github.com/UAssylbek/central-reporting/internal/database"
 	"github.com/UAssylbek/central-reporting/internal/handlers"
 	"github.com/UAssylbek/central-reporting/internal/middleware"
-	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/policy"
 	"github.com/UAssylbek/central-reporting/internal/repositories"
 	"github.com/UAssylbek/central-reporting/internal/services"
 	"github.com/gin-gonic/gin"
@@ -43,6 +43,9 @@ import (
 func main() {
 	// Load configuration
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Rate limiters для различных операций
 	loginLimiter := middleware.NewRateLimiter(5, time.Minute)           // 5 попыток входа в минуту
@@ -66,15 +69,113 @@ func main() {
 	passwordResetRepo := repositories.NewPasswordResetRepository(db)
 	organizationRepo := repositories.NewOrganizationRepository(db)
 	auditLogRepo := repositories.NewAuditLogRepository(db)
+	userIdentityRepo := repositories.NewUserIdentityRepository(db)
+	apiKeyRepo := repositories.NewAPIKeyRepository(db)
+	signingKeyRepo := repositories.NewSigningKeyRepository(db)
+	roleRepo := repositories.NewRoleRepository(db)
+	accessGrantRepo := repositories.NewAccessGrantRepository(db)
+	orgGrantRepo := repositories.NewOrganizationGrantRepository(db)
+	changeRequestRepo := repositories.NewChangeRequestRepository(db)
+	customFieldRepo := repositories.NewCustomFieldRepository(db)
+	tagRepo := repositories.NewTagRepository(db)
+
+	// Получатели журнала аудита (SIEM): записи доставляются через очередь audit_outbox
+	var auditSinks []repositories.AuditSink
+	if cfg.AuditSinks.SyslogAddr != "" {
+		auditSinks = append(auditSinks, services.NewSyslogSink(cfg.AuditSinks.SyslogNetwork, cfg.AuditSinks.SyslogAddr, cfg.AuditSinks.SyslogAppName))
+	}
+	for _, url := range cfg.AuditSinks.WebhookURLs {
+		auditSinks = append(auditSinks, services.NewWebhookSink(url, cfg.AuditSinks.WebhookSecret))
+	}
+	auditLogRepo.UseSinks(auditSinks...)
+
+	// Права ролей (кешируются в памяти, перечитываются из БД)
+	permissionStore := auth.NewPermissionStore(roleRepo)
+
+	// Ключи подписи JWT (при первом запуске создается ключ)
+	tokenManager, err := auth.NewKeyManager(auth.KeyManagerConfig{
+		Algorithm:        cfg.JWT.Algorithm,
+		Secret:           cfg.JWTSecret,
+		Issuer:           cfg.JWT.Issuer,
+		RotationInterval: cfg.JWT.KeyRotationInterval,
+		GracePeriod:      cfg.JWT.KeyGracePeriod,
+	}, signingKeyRepo)
+	if err != nil {
+		log.Fatal("Failed to initialize JWT signing keys:", err)
+	}
 
 	// Initialize services
 	emailService := services.NewEmailService()
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(userRepo, cfg.JWTSecret, auditLogRepo)
-	userHandler := handlers.NewUserHandler(userRepo, organizationRepo, auditLogRepo)
-	avatarHandler := handlers.NewAvatarHandler(userRepo)
-	passwordResetHandler := handlers.NewPasswordResetHandler(userRepo, passwordResetRepo, emailService)
+	authHandler := handlers.NewAuthHandler(userRepo, tokenManager, auditLogRepo)
+	userHandler := handlers.NewUserHandler(userRepo, organizationRepo, auditLogRepo, permissionStore)
+	avatarHandler := handlers.NewAvatarHandler(userRepo, auditLogRepo, permissionStore)
+	passwordResetHandler := handlers.NewPasswordResetHandler(userRepo, passwordResetRepo, auditLogRepo, emailService)
+	var magicLinkHandler *handlers.MagicLinkHandler
+	if cfg.MagicLink.Enabled {
+		magicLinkHandler = handlers.NewMagicLinkHandler(userRepo, passwordResetRepo, auditLogRepo, emailService, tokenManager, cfg.MagicLink.TTL)
+	}
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyRepo, userRepo, auditLogRepo)
+	jwksHandler := handlers.NewJWKSHandler(tokenManager)
+	impersonationHandler := handlers.NewImpersonationHandler(userRepo, auditLogRepo, tokenManager, permissionStore)
+	roleHandler := handlers.NewRoleHandler(roleRepo, auditLogRepo, permissionStore)
+	accessGrantHandler := handlers.NewAccessGrantHandler(accessGrantRepo, userRepo, organizationRepo, auditLogRepo)
+	orgGrantHandler := handlers.NewOrganizationGrantHandler(orgGrantRepo, userRepo, organizationRepo, auditLogRepo)
+	tagHandler := handlers.NewTagHandler(tagRepo, auditLogRepo)
+	authHandler.UseOrganizationGrants(orgGrantRepo)
+	approvalRules, err := policy.NewApprovalRules(cfg.Approvals.RequiredFor)
+	if err != nil {
+		log.Fatalf("Invalid APPROVAL_REQUIRED_FOR: %v", err)
+	}
+	userHandler.UseApprovals(approvalRules)
+	userHandler.UseEmail(emailService)
+
+	// Описания дополнительных полей профиля (кешируются в памяти, перечитываются из БД)
+	customFieldSchema := policy.NewCustomFieldSchema(customFieldRepo)
+	customFieldHandler := handlers.NewCustomFieldHandler(customFieldRepo, auditLogRepo, customFieldSchema, permissionStore)
+	userHandler.UseCustomFields(customFieldSchema)
+	authHandler.UseCustomFields(customFieldSchema)
+	if magicLinkHandler != nil {
+		magicLinkHandler.UseCustomFields(customFieldSchema)
+	}
+	auditChainService, err := services.NewAuditChainService(auditLogRepo, cfg.Audit.SigningKey)
+	if err != nil {
+		log.Fatalf("Invalid audit signing key: %v", err)
+	}
+	if !auditChainService.SigningEnabled() {
+		log.Println("⚠️  AUDIT_SIGNING_KEY is not set: signed audit checkpoints are disabled")
+	}
+	auditDispatcher := services.NewAuditDispatcher(auditLogRepo, cfg.AuditSinks.MaxAttempts)
+	auditHandler := handlers.NewAuditHandler(auditLogRepo, userRepo, auditChainService, auditDispatcher)
+	changeRequestHandler := handlers.NewChangeRequestHandler(changeRequestRepo, userRepo, auditLogRepo, permissionStore)
+	personalDataService := services.NewPersonalDataService(
+		userRepo, apiKeyRepo, userIdentityRepo, accessGrantRepo, orgGrantRepo, changeRequestRepo, auditLogRepo, handlers.AvatarDir,
+	)
+	personalDataHandler := handlers.NewPersonalDataHandler(personalDataService, auditLogRepo)
+	grantExpiryService := services.NewGrantExpiryService(
+		accessGrantRepo, orgGrantRepo, userRepo, organizationRepo, auditLogRepo, emailService, cfg.AccessGrants.NotifyBefore,
+	)
+
+	// LDAP проверяется первым; пользователи, которых нет в каталоге, входят по локальному паролю
+	var ldapAuthenticator *services.LDAPAuthenticator
+	if cfg.LDAP.Enabled {
+		ldapAuthenticator = services.NewLDAPAuthenticator(cfg.LDAP, services.NewLDAPDirectory(cfg.LDAP), userRepo, organizationRepo, userIdentityRepo, auditLogRepo)
+		authHandler.UseAuthenticators(ldapAuthenticator, auth.NewPasswordAuthenticator(userRepo))
+	}
+
+	// OIDC включается только если задан провайдер; недоступный провайдер не мешает запуску
+	var oidcHandler *handlers.OIDCHandler
+	if cfg.OIDC.Enabled {
+		discoveryCtx, cancelDiscovery := context.WithTimeout(context.Background(), 10*time.Second)
+		oidcService, err := services.NewOIDCService(discoveryCtx, cfg.OIDC, userRepo, organizationRepo, userIdentityRepo)
+		cancelDiscovery()
+		if err != nil {
+			log.Printf("OIDC disabled: %v", err)
+		} else {
+			oidcHandler = handlers.NewOIDCHandler(oidcService, userRepo, auditLogRepo, tokenManager, cfg.FrontendURL)
+		}
+	}
 
 	// Setup router
 	r := gin.Default()
@@ -97,7 +198,7 @@ func main() {
 			c.Header("Access-Control-Allow-Credentials", "true")
 		}
 
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, accept, origin, Cache-Control, X-Requested-With")
 		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
@@ -108,51 +209,163 @@ func main() {
 	})
 
 	// Public routes
+	r.GET("/.well-known/jwks.json", jwksHandler.JWKS)
 	r.POST("/api/auth/login", loginLimiter.Middleware(), authHandler.Login)
 	r.POST("/api/auth/forgot-password", passwordResetLimiter.Middleware(), passwordResetHandler.ForgotPassword)
 	r.POST("/api/auth/reset-password", passwordResetLimiter.Middleware(), passwordResetHandler.ResetPassword)
 
+	if magicLinkHandler != nil {
+		r.POST("/api/auth/magic-link", passwordResetLimiter.Middleware(), magicLinkHandler.RequestLink)
+		r.POST("/api/auth/magic-link/verify", loginLimiter.Middleware(), magicLinkHandler.Verify)
+	}
+
+	if oidcHandler != nil {
+		r.GET("/api/auth/oidc/login", oidcHandler.Login)
+		r.GET("/api/auth/oidc/callback", loginLimiter.Middleware(), oidcHandler.Callback)
+	}
+
 	// Protected routes (доступны всем авторизованным пользователям)
+	// Запросы по API ключу дополнительно ограничены scopes: auth.RequireScope на каждой группе маршрутов
 	protected := r.Group("/api")
-	protected.Use(auth.JWTMiddleware(cfg.JWTSecret, userRepo))
+	protected.Use(auth.JWTMiddleware(tokenManager, userRepo, apiKeyRepo))
 	protected.Use(auth.ActivityMiddleware(userRepo))
+	protected.Use(auth.LoadPermissions(permissionStore))
+	protected.Use(auth.ImpersonationAuditMiddleware(auditLogRepo))
 	protected.Use(generalLimiter.Middleware()) // ✅ Общий rate limit для всех защищенных endpoints
 	{
 		// Auth routes
-		protected.GET("/auth/me", authHandler.Me)
-		protected.POST("/auth/logout", authHandler.Logout)
-		protected.POST("/auth/change-password", changePasswordLimiter.Middleware(), authHandler.ChangePassword)
+		protected.GET("/auth/me", auth.RequireScope(auth.ScopeProfile), authHandler.Me)
+		protected.POST("/auth/logout", auth.DenyAPIKeys(), authHandler.Logout)
+		protected.POST("/auth/change-password", auth.DenyAPIKeys(), auth.DenyImpersonation(), changePasswordLimiter.Middleware(), authHandler.ChangePassword)
 
 		// User routes
-		protected.GET("/users/organizations", userHandler.GetOrganizations)
+		protected.GET("/users/organizations", auth.RequireScope(auth.ScopeUsersRead), userHandler.GetOrganizations)
 
 		// 🔧 КРИТИЧЕСКОЕ ИЗМЕНЕНИЕ: Перенесли сюда из adminModeratorRoutes
 		// Теперь ВСЕ авторизованные пользователи могут обращаться к этому роуту
 		// Проверка прав происходит внутри хендлера UpdateUser
-		protected.PUT("/users/:id", updateUserLimiter.Middleware(), userHandler.UpdateUser)
+		protected.PUT("/users/:id", auth.RequireScope(auth.ScopeUsersWrite), updateUserLimiter.Middleware(), userHandler.UpdateUser)
+		protected.GET("/users/:id/editable-fields", auth.RequireScope(auth.ScopeUsersRead), userHandler.EditableFields)
+		protected.GET("/custom-fields", auth.RequireScope(auth.ScopeUsersRead), customFieldHandler.ListCustomFields)
+		protected.GET("/users/:id/access-grants", auth.RequireScope(auth.ScopeUsersRead), auth.RequirePermission(auth.PermUsersUpdateAccess), accessGrantHandler.ListGrants)
+		protected.GET("/users/:id/organization-grants", auth.RequireScope(auth.ScopeUsersRead), auth.RequirePermission(auth.PermOrgsManage), orgGrantHandler.ListGrants)
+		protected.GET("/access-grants/expiring", auth.RequireScope(auth.ScopeUsersRead), auth.RequirePermission(auth.PermUsersUpdateAccess), accessGrantHandler.ListExpiring)
+		protected.GET("/organization-grants/expiring", auth.RequireScope(auth.ScopeUsersRead), auth.RequirePermission(auth.PermOrgsManage), orgGrantHandler.ListExpiring)
 
 		// Avatar routes (доступны всем авторизованным пользователям)
-		protected.POST("/users/:id/avatar", avatarUploadLimiter.Middleware(), avatarHandler.UploadAvatar)
-		protected.DELETE("/users/:id/avatar", avatarUploadLimiter.Middleware(), avatarHandler.DeleteAvatar)
+		protected.POST("/users/:id/avatar", auth.RequireScope(auth.ScopeUsersWrite), avatarUploadLimiter.Middleware(), avatarHandler.UploadAvatar)
+		protected.DELETE("/users/:id/avatar", auth.RequireScope(auth.ScopeUsersWrite), avatarUploadLimiter.Middleware(), avatarHandler.DeleteAvatar)
+	}
+
+	// API key routes (только интерактивный вход: ключом нельзя выпустить другой ключ)
+	apiKeyRoutes := protected.Group("/")
+	apiKeyRoutes.Use(auth.DenyAPIKeys())
+	apiKeyRoutes.Use(auth.DenyImpersonation())
+	{
+		apiKeyRoutes.GET("/auth/api-keys", apiKeyHandler.ListMyKeys)
+		apiKeyRoutes.POST("/auth/api-keys", apiKeyHandler.CreateMyKey)
+		apiKeyRoutes.DELETE("/auth/api-keys/:keyId", apiKeyHandler.RevokeMyKey)
+
+		// Ключи других пользователей и сервисных учётных записей
+		apiKeyRoutes.GET("/users/:id/api-keys", auth.RequirePermission(auth.PermAPIKeysManage), apiKeyHandler.ListUserKeys)
+		apiKeyRoutes.POST("/users/:id/api-keys", auth.RequirePermission(auth.PermAPIKeysManage), apiKeyHandler.CreateUserKey)
+		apiKeyRoutes.DELETE("/users/:id/api-keys/:keyId", auth.RequirePermission(auth.PermAPIKeysManage), apiKeyHandler.RevokeUserKey)
+
+		// Роли и права (изменение ролей - только при интерактивном входе)
+		apiKeyRoutes.GET("/permissions", auth.RequirePermission(auth.PermRolesManage), roleHandler.ListPermissions)
+		apiKeyRoutes.GET("/roles", auth.RequirePermission(auth.PermRolesManage), roleHandler.ListRoles)
+		apiKeyRoutes.POST("/roles", auth.RequirePermission(auth.PermRolesManage), roleHandler.CreateRole)
+		apiKeyRoutes.PUT("/roles/:id", auth.RequirePermission(auth.PermRolesManage), roleHandler.UpdateRole)
+		apiKeyRoutes.DELETE("/roles/:id", auth.RequirePermission(auth.PermRolesManage), roleHandler.DeleteRole)
+	}
+
+	// Просмотр пользователей (без users.read.all - только доступных)
+	userReadRoutes := r.Group("/api")
+	userReadRoutes.Use(auth.JWTMiddleware(tokenManager, userRepo, apiKeyRepo))
+	userReadRoutes.Use(auth.ActivityMiddleware(userRepo))
+	userReadRoutes.Use(auth.LoadPermissions(permissionStore))
+	userReadRoutes.Use(auth.ImpersonationAuditMiddleware(auditLogRepo))
+	userReadRoutes.Use(auth.RequirePermission(auth.PermUsersRead))
+	userReadRoutes.Use(auth.RequireScope(auth.ScopeUsersRead))
+	{
+		userReadRoutes.GET("/users", userHandler.GetUsers)
+		userReadRoutes.GET("/users/export", userHandler.ExportUsers)
+		userReadRoutes.GET("/users/search", userHandler.SearchUsers)
+		userReadRoutes.GET("/users/:id", userHandler.GetUserByID)
+		userReadRoutes.GET("/tags", tagHandler.ListTags)
+	}
+
+	// Управление пользователями
+	userManageRoutes := protected.Group("/")
+	userManageRoutes.Use(auth.RequireScope(auth.ScopeUsersWrite))
+	{
+		userManageRoutes.POST("/users", auth.RequirePermission(auth.PermUsersCreate), createUserLimiter.Middleware(), userHandler.CreateUser)
+		userManageRoutes.POST("/users/import", auth.RequirePermission(auth.PermUsersCreate), createUserLimiter.Middleware(), userHandler.ImportUsers)
+		userManageRoutes.POST("/users/bulk", updateUserLimiter.Middleware(), userHandler.BulkUpdateUsers)
+		userManageRoutes.DELETE("/users/:id", auth.RequirePermission(auth.PermUsersDelete), deleteUserLimiter.Middleware(), userHandler.DeleteUser)
+		userManageRoutes.GET("/users/trash", auth.RequirePermission(auth.PermUsersDelete), userHandler.ListTrash)
+		userManageRoutes.POST("/users/:id/restore", auth.RequirePermission(auth.PermUsersDelete), deleteUserLimiter.Middleware(), userHandler.RestoreUser)
+		userManageRoutes.POST("/users/:id/impersonate", auth.DenyAPIKeys(), auth.RequirePermission(auth.PermUsersImpersonate), impersonationHandler.Impersonate)
+
+		// Доступы к пользователям, отделам и организациям
+		userManageRoutes.POST("/users/:id/access-grants", auth.RequirePermission(auth.PermUsersUpdateAccess), accessGrantHandler.CreateGrant)
+		userManageRoutes.DELETE("/users/:id/access-grants/:grantId", auth.RequirePermission(auth.PermUsersUpdateAccess), accessGrantHandler.DeleteGrant)
+
+		// Временные доступы к организациям
+		userManageRoutes.POST("/users/:id/organization-grants", auth.RequirePermission(auth.PermOrgsManage), orgGrantHandler.CreateGrant)
+		userManageRoutes.DELETE("/users/:id/organization-grants/:grantId", auth.RequirePermission(auth.PermOrgsManage), orgGrantHandler.DeleteGrant)
+	}
+
+	// Описания дополнительных полей профиля
+	customFieldRoutes := protected.Group("/")
+	customFieldRoutes.Use(auth.RequireScope(auth.ScopeUsersWrite))
+	customFieldRoutes.Use(auth.RequirePermission(auth.PermCustomFieldsManage))
+	{
+		customFieldRoutes.POST("/custom-fields", customFieldHandler.CreateCustomField)
+		customFieldRoutes.PUT("/custom-fields/:id", customFieldHandler.UpdateCustomField)
+		customFieldRoutes.DELETE("/custom-fields/:id", customFieldHandler.DeleteCustomField)
 	}
 
-	// Admin & Moderator routes
-	adminModeratorRoutes := r.Group("/api")
-	adminModeratorRoutes.Use(auth.JWTMiddleware(cfg.JWTSecret, userRepo))
-	adminModeratorRoutes.Use(auth.ActivityMiddleware(userRepo))
-	adminModeratorRoutes.Use(auth.RoleMiddleware([]models.UserRole{models.RoleAdmin, models.RoleModerator}))
+	// Каталог тегов: изменения сразу у всех пользователей
+	tagRoutes := protected.Group("/")
+	tagRoutes.Use(auth.RequireScope(auth.ScopeUsersWrite))
+	tagRoutes.Use(auth.RequirePermission(auth.PermTagsManage))
 	{
-		adminModeratorRoutes.GET("/users", userHandler.GetUsers)
-		adminModeratorRoutes.GET("/users/:id", userHandler.GetUserByID)
-		// 🔧 УБРАЛИ ОТСЮДА: adminModeratorRoutes.PUT("/users/:id", userHandler.UpdateUser)
+		tagRoutes.POST("/tags/rename", tagHandler.RenameTag)
+		tagRoutes.POST("/tags/merge", tagHandler.MergeTags)
+		tagRoutes.DELETE("/tags", tagHandler.DeleteTag)
 	}
 
-	// Admin only routes
-	adminOnly := protected.Group("/")
-	adminOnly.Use(auth.AdminMiddleware())
+	// Журнал аудита
+	auditRoutes := protected.Group("/")
+	auditRoutes.Use(auth.RequireScope(auth.ScopeAuditRead))
+	auditRoutes.Use(auth.RequirePermission(auth.PermAuditRead))
 	{
-		adminOnly.POST("/users", createUserLimiter.Middleware(), userHandler.CreateUser)
-		adminOnly.DELETE("/users/:id", deleteUserLimiter.Middleware(), userHandler.DeleteUser)
+		auditRoutes.GET("/audit", auditHandler.ListAudit)
+		auditRoutes.GET("/audit/export", auditHandler.ExportAudit)
+		auditRoutes.GET("/audit/verify", auditHandler.VerifyAudit)
+		auditRoutes.GET("/audit/outbox", auditHandler.GetAuditOutbox)
+		auditRoutes.GET("/users/:id/audit", auditHandler.ListUserAudit)
+		auditRoutes.GET("/users/:id/audit/export", auditHandler.ExportUserAudit)
+	}
+
+	// Персональные данные уволенных сотрудников (только при интерактивном входе без impersonation)
+	personalDataRoutes := protected.Group("/")
+	personalDataRoutes.Use(auth.DenyAPIKeys(), auth.DenyImpersonation())
+	personalDataRoutes.Use(auth.RequirePermission(auth.PermUsersPersonalData))
+	{
+		personalDataRoutes.GET("/users/:id/personal-data", personalDataHandler.ExportPersonalData)
+		personalDataRoutes.POST("/users/:id/anonymize", personalDataHandler.AnonymizeUser)
+	}
+
+	// Подтверждение изменений вторым администратором (только при интерактивном входе без impersonation)
+	changeRequestRoutes := protected.Group("/")
+	changeRequestRoutes.Use(auth.RequirePermission(auth.PermUsersApproveChanges))
+	{
+		changeRequestRoutes.GET("/change-requests", auth.RequireScope(auth.ScopeUsersRead), changeRequestHandler.ListChangeRequests)
+		changeRequestRoutes.GET("/change-requests/:id", auth.RequireScope(auth.ScopeUsersRead), changeRequestHandler.GetChangeRequest)
+		changeRequestRoutes.POST("/change-requests/:id/approve", auth.DenyAPIKeys(), auth.DenyImpersonation(), changeRequestHandler.ApproveChangeRequest)
+		changeRequestRoutes.POST("/change-requests/:id/reject", auth.DenyAPIKeys(), auth.DenyImpersonation(), changeRequestHandler.RejectChangeRequest)
 	}
 
 	// Serving uploaded files (avatars)
@@ -161,7 +374,7 @@ func main() {
 	// Swagger documentation
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	// Background task для обновления статусов офлайн
+	// Background task для обновления статусов офлайн и окончания временных доступов
 	go func() {
 		ticker := time.NewTicker(1 * time.Minute)
 		defer ticker.Stop()
@@ -173,9 +386,109 @@ func main() {
 			} else {
 				log.Printf("UpdateOfflineUsers completed successfully")
 			}
+
+			// Уведомления и окончание временных доступов
+			if err := grantExpiryService.Run(); err != nil {
+				log.Printf("Error processing access grant expiry: %v", err)
+			}
 		}
 	}()
 
+	// Background task для ротации ключей подписи JWT
+	if tokenManager.Algorithm() != auth.AlgorithmHS256 {
+		go func() {
+			ticker := time.NewTicker(10 * time.Minute)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				if _, err := tokenManager.RotateIfDue(); err != nil {
+					log.Printf("Error rotating JWT signing keys: %v", err)
+				}
+				if err := tokenManager.PruneExpired(); err != nil {
+					log.Printf("Error deleting expired JWT signing keys: %v", err)
+				}
+			}
+		}()
+	}
+
+	// Background task обслуживания: секции журнала аудита и сроки хранения по таблицам
+	maintenanceService := services.NewMaintenanceService(auditLogRepo,
+		services.RetentionPolicy{
+			Table: "audit_log",
+			Apply: services.NewAuditArchiver(auditLogRepo, auditChainService, cfg.Retention.AuditArchiveDir, cfg.Retention.AuditLogMonths).Apply,
+		},
+		services.RetainFor("password_reset_tokens", cfg.Retention.PasswordResetTokens, passwordResetRepo.DeleteExpiredTokens),
+		services.RetainFor("user_change_requests", cfg.Retention.ChangeRequests, changeRequestRepo.DeleteReviewed),
+		services.RetainFor("audit_outbox", cfg.Retention.AuditOutbox, auditDispatcher.DeleteOutbox),
+		services.PurgeDeletedUsers(userRepo, auditLogRepo, cfg.Retention.DeletedUsers),
+	)
+	go func() {
+		ticker := time.NewTicker(cfg.Retention.Interval)
+		defer ticker.Stop()
+
+		// Первый запуск сразу: секции текущего месяца должны существовать до первых записей
+		maintenanceService.Run(time.Now())
+		for range ticker.C {
+			maintenanceService.Run(time.Now())
+		}
+	}()
+
+	// Background task для подписи контрольных точек журнала аудита
+	if auditChainService.SigningEnabled() {
+		go func() {
+			ticker := time.NewTicker(cfg.Audit.CheckpointInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				if _, err := auditChainService.Checkpoint(); err != nil {
+					log.Printf("Error signing audit checkpoint: %v", err)
+				}
+			}
+		}()
+	}
+
+	// Background task доставки журнала аудита: у каждого получателя своя горутина,
+	// чтобы недоступный получатель не задерживал остальных
+	for _, sink := range auditLogRepo.Sinks() {
+		go func(sink repositories.AuditSink) {
+			ticker := time.NewTicker(cfg.AuditSinks.PollInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				if _, err := auditDispatcher.Deliver(sink); err != nil {
+					log.Printf("Error delivering audit log: %v", err)
+				}
+			}
+		}(sink)
+	}
+	// Недоставленные записи больше не отправляются сами: напоминание раз в час, пока их не вернут в очередь
+	if len(auditLogRepo.Sinks()) > 0 {
+		go func() {
+			ticker := time.NewTicker(time.Hour)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				if err := auditDispatcher.WarnExhausted(); err != nil {
+					log.Printf("Error checking audit outbox: %v", err)
+				}
+			}
+		}()
+	}
+
+	// Background task для синхронизации пользователей с LDAP каталогом
+	if ldapAuthenticator != nil && cfg.LDAP.SyncIntervalMinutes > 0 {
+		go func() {
+			ticker := time.NewTicker(time.Duration(cfg.LDAP.SyncIntervalMinutes) * time.Minute)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				if err := ldapAuthenticator.Sync(); err != nil {
+					log.Printf("Error syncing LDAP users: %v", err)
+				}
+			}
+		}()
+	}
+
 	// ✅ GRACEFUL SHUTDOWN: создаем HTTP сервер вместо r.Run()
 	srv := &http.Server{
 		Addr:    ":" + cfg.Port,
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/UAssylbek/central-reporting/internal/config"
+	"github.com/UAssylbek/central-reporting/internal/database"
+	"github.com/UAssylbek/central-reporting/internal/handlers"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/services"
+)
+
+// Персональные данные уволенного сотрудника: выгрузка всех данных в JSON и необратимое обезличивание.
+// Обе операции записываются в журнал аудита как системные.
+//
+//	personal_data -user 42 -export user42.json
+//	personal_data -user 42 -anonymize -confirm 42
+func main() {
+	userID := flag.Int("user", 0, "ID пользователя")
+	exportPath := flag.String("export", "", "выгрузить данные пользователя в файл JSON (- вывод в stdout)")
+	anonymize := flag.Bool("anonymize", false, "обезличить пользователя (необратимо)")
+	confirm := flag.Int("confirm", 0, "повтор ID пользователя для подтверждения обезличивания")
+	flag.Parse()
+
+	if *userID <= 0 || (*exportPath == "" && !*anonymize) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *anonymize && *confirm != *userID {
+		log.Fatal("Обезличивание необратимо: подтвердите его флагом -confirm с ID пользователя")
+	}
+
+	// Load configuration
+	cfg := config.Load()
+
+	// Connect to database
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer db.Close()
+
+	auditLogRepo := repositories.NewAuditLogRepository(db)
+	personalData := services.NewPersonalDataService(
+		repositories.NewUserRepository(db),
+		repositories.NewAPIKeyRepository(db),
+		repositories.NewUserIdentityRepository(db),
+		repositories.NewAccessGrantRepository(db),
+		repositories.NewOrganizationGrantRepository(db),
+		repositories.NewChangeRequestRepository(db),
+		auditLogRepo,
+		handlers.AvatarDir,
+	)
+
+	// Выгрузка до обезличивания: при обоих флагах в файл попадают исходные данные
+	if *exportPath != "" {
+		export, err := personalData.Export(*userID)
+		if err != nil {
+			log.Fatal("Failed to export personal data:", err)
+		}
+		if err := writeExport(*exportPath, export); err != nil {
+			log.Fatal("Failed to write export:", err)
+		}
+		if err := auditLogRepo.LogSystem(repositories.ActionExportPersonalData, userID, map[string]interface{}{
+			"audit_entries": len(export.AuditLog),
+			"source":        "cli",
+		}); err != nil {
+			log.Printf("Failed to write audit log: %v", err)
+		}
+		if *exportPath != "-" {
+			fmt.Fprintf(os.Stderr, "✅ Данные пользователя %d выгружены в %s\n", *userID, *exportPath)
+		}
+	}
+
+	if *anonymize {
+		err := personalData.Anonymize(*userID, 0)
+		switch {
+		case errors.Is(err, services.ErrUserStillActive):
+			log.Fatal("❌ Пользователь активен: сначала заблокируйте или удалите его")
+		case errors.Is(err, services.ErrUserAlreadyAnonymized):
+			fmt.Fprintf(os.Stderr, "Пользователь %d уже обезличен\n", *userID)
+			return
+		case err != nil:
+			log.Fatal("Failed to anonymize user:", err)
+		}
+		if err := auditLogRepo.LogSystem(repositories.ActionAnonymizeUser, userID, map[string]interface{}{
+			"fields": services.AnonymizedFields,
+			"source": "cli",
+		}); err != nil {
+			log.Printf("Failed to write audit log: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "✅ Персональные данные пользователя %d обезличены\n", *userID)
+	}
+}
+
+func writeExport(path string, export *services.PersonalDataExport) error {
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(export)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/UAssylbek/central-reporting/internal/config"
+	"github.com/UAssylbek/central-reporting/internal/database"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/services"
+)
+
+// Проверка целостности журнала аудита: цепочка хешей и подписанные контрольные точки
+// (с -archives - также файлы выгруженных секций).
+// Код выхода 1 - цепочка нарушена.
+func main() {
+	checkpoint := flag.Bool("checkpoint", false, "подписать контрольную точку, если цепочка цела")
+	archives := flag.Bool("archives", false, "сверить файлы архивов с file_sha256 и проверить их записи")
+	flag.Parse()
+
+	fmt.Println("=== Проверка журнала аудита ===")
+
+	// Load configuration
+	cfg := config.Load()
+
+	// Connect to database
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer db.Close()
+
+	auditChain, err := services.NewAuditChainService(repositories.NewAuditLogRepository(db), cfg.Audit.SigningKey)
+	if err != nil {
+		log.Fatal("Invalid audit signing key:", err)
+	}
+
+	verify := auditChain.Verify
+	if *archives {
+		verify = auditChain.VerifyWithArchives
+	}
+	report, err := verify()
+	if err != nil {
+		log.Fatal("Failed to verify audit log:", err)
+	}
+
+	fmt.Printf("Записей без цепочки (до включения): %d\n", report.UnchainedEntries)
+	fmt.Printf("Проверено записей:                  %d\n", report.EntriesChecked)
+	fmt.Printf("Последняя запись:                   %d\n", report.LastEntryID)
+	fmt.Printf("Контрольных точек:                  %d\n", report.CheckpointsChecked)
+	if report.ArchivedThroughEntryID != 0 {
+		fmt.Printf("Выгружено в архив до записи:        %d\n", report.ArchivedThroughEntryID)
+		if *archives {
+			fmt.Printf("Проверено файлов архива:            %d\n", report.ArchiveFilesChecked)
+		} else {
+			fmt.Println("⚠️  Файлы архивов не проверялись (флаг -archives)")
+		}
+	}
+	if report.SignaturesVerified {
+		fmt.Printf("Ключ подписи:                       %s\n", report.KeyID)
+	} else {
+		fmt.Println("⚠️  AUDIT_SIGNING_KEY не задан: подписи контрольных точек не проверялись")
+	}
+
+	if !report.Valid {
+		fmt.Println("\n❌ Цепочка нарушена!")
+		if report.Break.ArchiveID != 0 {
+			fmt.Printf("Архив:             %d\n", report.Break.ArchiveID)
+		}
+		if report.Break.CheckpointID != 0 {
+			fmt.Printf("Контрольная точка: %d\n", report.Break.CheckpointID)
+		}
+		fmt.Printf("Запись:  %d\n", report.Break.EntryID)
+		fmt.Printf("Причина: %s\n", report.Break.Reason)
+		os.Exit(1)
+	}
+	fmt.Println("\n✅ Журнал аудита не изменён")
+
+	if *checkpoint {
+		created, err := auditChain.Checkpoint()
+		if err != nil {
+			log.Fatal("Failed to sign checkpoint:", err)
+		}
+		switch {
+		case !auditChain.SigningEnabled():
+			fmt.Println("⚠️  Контрольная точка не создана: AUDIT_SIGNING_KEY не задан")
+		case created == nil:
+			fmt.Println("Новых записей после последней контрольной точки нет")
+		default:
+			fmt.Printf("Подписана контрольная точка %d (запись %d)\n", created.ID, created.LastEntryID)
+		}
+	}
+}
@@ -9,6 +9,12 @@ import (
 
 func ActivityMiddleware(userRepo *repositories.UserRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Запросы интеграций по API ключу и администратора под чужим именем не делают пользователя "онлайн"
+		if c.GetString("auth_method") == AuthMethodAPIKey || ImpersonatorID(c) != nil {
+			c.Next()
+			return
+		}
+
 		userID, exists := c.Get("user_id")
 		if exists {
 			log.Printf("ActivityMiddleware: Updating activity for user %d", userID.(int))
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, hash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey() error = %v", err)
+	}
+
+	if !IsAPIKey(key) {
+		t.Errorf("key %q should start with %q", key, APIKeyPrefix)
+	}
+	if !strings.HasPrefix(key, prefix) {
+		t.Errorf("prefix %q is not the beginning of key", prefix)
+	}
+	if hash != HashAPIKey(key) || strings.Contains(hash, key) {
+		t.Error("hash must be a SHA-256 of the key")
+	}
+
+	other, _, _, _ := GenerateAPIKey()
+	if other == key {
+		t.Error("GenerateAPIKey() returned the same key twice")
+	}
+}
+
+func setupAPIKeyTest(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	router := gin.New()
+	group := router.Group("/api")
+	group.Use(JWTMiddleware(NewHMACKeyManager("secret"), repositories.NewUserRepository(sqlxDB), repositories.NewAPIKeyRepository(sqlxDB)))
+	group.GET("/users", RequireScope(ScopeUsersRead), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetInt("user_id")})
+	})
+	group.PUT("/users/:id", RequireScope(ScopeUsersWrite), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	group.POST("/auth/change-password", DenyAPIKeys(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	return router, mock
+}
+
+func expectAPIKeyLookup(mock sqlmock.Sqlmock, key string, expiresAt time.Time, revokedAt interface{}) {
+	mock.ExpectQuery("SELECT (.+) FROM api_keys WHERE key_hash = \\$1").
+		WithArgs(HashAPIKey(key)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "prefix", "key_hash", "scopes", "expires_at", "revoked_at"}).
+			AddRow(7, 42, "BI", key[:11], HashAPIKey(key), []byte(`["users:read"]`), expiresAt, revokedAt))
+}
+
+func TestJWTMiddleware_APIKey(t *testing.T) {
+	key, _, _, _ := GenerateAPIKey()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		expiresAt  time.Time
+		revokedAt  interface{}
+		loadsUser  bool
+		wantStatus int
+	}{
+		{"Scope allowed", http.MethodGet, "/api/users", time.Now().Add(time.Hour), nil, true, http.StatusOK},
+		{"Scope missing", http.MethodPut, "/api/users/1", time.Now().Add(time.Hour), nil, true, http.StatusForbidden},
+		{"Interactive only route", http.MethodPost, "/api/auth/change-password", time.Now().Add(time.Hour), nil, true, http.StatusForbidden},
+		{"Expired key", http.MethodGet, "/api/users", time.Now().Add(-time.Hour), nil, false, http.StatusUnauthorized},
+		{"Revoked key", http.MethodGet, "/api/users", time.Now().Add(time.Hour), time.Now(), false, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := setupAPIKeyTest(t)
+			expectAPIKeyLookup(mock, key, tt.expiresAt, tt.revokedAt)
+			if tt.loadsUser {
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").
+					WithArgs(42).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "role", "is_active"}).
+						AddRow(42, "bi-service", "user", true))
+			}
+
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+key)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestJWTMiddleware_UnknownAPIKey(t *testing.T) {
+	router, mock := setupAPIKeyTest(t)
+
+	mock.ExpectQuery("SELECT (.+) FROM api_keys WHERE key_hash = \\$1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/users", nil)
+	req.Header.Set("X-API-Key", APIKeyPrefix+"unknown")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+)
+
+var (
+	// ErrInvalidCredentials неверный логин или пароль
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrUnknownUser пользователь не обслуживается этим способом входа - пробуем следующий
+	ErrUnknownUser = errors.New("user is not managed by this authenticator")
+)
+
+// BlockedError пользователь найден, но заблокирован
+type BlockedError struct {
+	User *models.User
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("user %s is blocked", e.User.Username)
+}
+
+// Reason возвращает причину блокировки для показа пользователю
+func (e *BlockedError) Reason() string {
+	if e.User.BlockedReason.Valid && e.User.BlockedReason.String != "" {
+		return e.User.BlockedReason.String
+	}
+	return "Ваш аккаунт заблокирован"
+}
+
+// Authenticator проверяет учетные данные пользователя (локальный пароль, LDAP и т.д.)
+type Authenticator interface {
+	// Name используется в логах и журнале аудита
+	Name() string
+	// Authenticate возвращает пользователя, ErrUnknownUser, ErrInvalidCredentials или *BlockedError
+	Authenticate(username, password string) (*models.User, error)
+}
+
+// Authenticate перебирает способы входа по порядку, пока один из них не признает пользователя своим
+func Authenticate(authenticators []Authenticator, username, password string) (*models.User, string, error) {
+	for _, a := range authenticators {
+		user, err := a.Authenticate(username, password)
+		if errors.Is(err, ErrUnknownUser) {
+			continue
+		}
+		return user, a.Name(), err
+	}
+	return nil, "", ErrInvalidCredentials
+}
+
+// PasswordAuthenticator проверяет локальный bcrypt пароль из таблицы users
+type PasswordAuthenticator struct {
+	userRepo *repositories.UserRepository
+}
+
+// NewPasswordAuthenticator создает локальный способ входа
+func NewPasswordAuthenticator(userRepo *repositories.UserRepository) *PasswordAuthenticator {
+	return &PasswordAuthenticator{userRepo: userRepo}
+}
+
+func (a *PasswordAuthenticator) Name() string {
+	return "password"
+}
+
+func (a *PasswordAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	user, err := a.userRepo.GetByUsername(username)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if user == nil {
+		log.Printf("User not found: %s", username)
+		return nil, ErrUnknownUser
+	}
+
+	// Сервисные учётные записи работают только по API ключам
+	if user.IsServiceAccount {
+		log.Printf("Interactive login rejected for service account: %s", username)
+		return nil, ErrInvalidCredentials
+	}
+
+	if !user.IsActive {
+		return nil, &BlockedError{User: user}
+	}
+
+	hasPassword := user.Password.Valid && user.Password.String != ""
+	log.Printf("User found - ID: %d, IsFirstLogin: %v, RequirePasswordChange: %v, HasPassword: %v",
+		user.ID, user.IsFirstLogin, user.RequirePasswordChange, hasPassword)
+
+	// Специальная логика для первого входа с требованием смены пароля:
+	// если пароль в БД пустой - пропускаем любой введённый пароль
+	if user.IsFirstLogin && user.RequirePasswordChange && !hasPassword {
+		log.Printf("Password is empty in DB - allowing login without password check")
+		return user, nil
+	}
+
+	isValid, err := a.userRepo.CheckPassword(user.ID, password)
+	if err != nil {
+		return nil, fmt.Errorf("password check failed: %w", err)
+	}
+	if !isValid {
+		log.Printf("Password check failed")
+		return nil, ErrInvalidCredentials
+	}
+
+	log.Printf("Password check passed")
+	return user, nil
+}
+
+// MapGroupsToRole возвращает самую привилегированную встроенную роль среди групп, указанных в mapping,
+// а если встроенных нет - первую по алфавиту пользовательскую роль
+// Сравнение регистронезависимое: DN групп в каталогах не чувствительны к регистру
+func MapGroupsToRole(groups []string, mapping map[string]string) (models.UserRole, bool) {
+	found := map[models.UserRole]bool{}
+	for _, group := range groups {
+		for key, role := range mapping {
+			if strings.EqualFold(group, key) {
+				found[models.UserRole(role)] = true
+			}
+		}
+	}
+	for _, role := range []models.UserRole{models.RoleAdmin, models.RoleModerator, models.RoleUser} {
+		if found[role] {
+			return role, true
+		}
+	}
+
+	var custom []string
+	for role := range found {
+		custom = append(custom, string(role))
+	}
+	if len(custom) == 0 {
+		return "", false
+	}
+	sort.Strings(custom)
+	return models.UserRole(custom[0]), true
+}
+
+// MapGroupsToValues возвращает значения mapping для всех групп пользователя (без повторов)
+func MapGroupsToValues(groups []string, mapping map[string]string) []string {
+	var result []string
+	seen := map[string]bool{}
+	for _, group := range groups {
+		for key, value := range mapping {
+			if strings.EqualFold(group, key) && !seen[value] {
+				seen[value] = true
+				result = append(result, value)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/gin-gonic/gin"
+)
+
+// ImpersonatorID возвращает ID администратора, работающего от имени пользователя (nil вне имперсонации)
+func ImpersonatorID(c *gin.Context) *int {
+	if id := c.GetInt("impersonator_id"); id != 0 {
+		return &id
+	}
+	return nil
+}
+
+// ImpersonationAuditMiddleware записывает в журнал аудита каждый запрос, выполненный под имперсонацией,
+// с атрибуцией и пользователю, и администратору
+func ImpersonationAuditMiddleware(auditLogRepo *repositories.AuditLogRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		impersonatorID := ImpersonatorID(c)
+		if impersonatorID == nil {
+			return
+		}
+
+		userID := c.GetInt("user_id")
+		if err := auditLogRepo.LogImpersonated(impersonatorID, userID, repositories.ActionImpersonatedRequest, nil, map[string]interface{}{
+			"method": c.Request.Method,
+			"path":   c.Request.URL.Path,
+			"status": c.Writer.Status(),
+		}, c.ClientIP(), c.Request.UserAgent()); err != nil {
+			log.Printf("Failed to write impersonation audit log: %v", err)
+		}
+	}
+}
+
+// DenyImpersonation закрывает маршрут при входе под пользователем (смена пароля, API ключи)
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ImpersonatorID(c) != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Действие недоступно при входе под другим пользователем"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
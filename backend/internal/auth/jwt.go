@@ -14,9 +14,19 @@ type Claims struct {
 	FullName     string          `json:"full_name"`
 	Role         models.UserRole `json:"role"`
 	TokenVersion int             `json:"token_version"`
+
+	// Заполняются только в токене входа под пользователем (имперсонации)
+	ImpersonatorID           int    `json:"impersonator_id,omitempty"`
+	ImpersonatorUsername     string `json:"impersonator_username,omitempty"`
+	ImpersonatorTokenVersion int    `json:"impersonator_token_version,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// IsImpersonation проверяет, выпущен ли токен для входа администратора под другим пользователем
+func (c *Claims) IsImpersonation() bool {
+	return c.ImpersonatorID != 0
+}
+
 func GenerateToken(user models.User, secret string) (string, error) {
 	claims := Claims{
 		UserID:       user.ID,
@@ -0,0 +1,479 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Алгоритмы подписи токенов
+const (
+	AlgorithmHS256 = "HS256" // общий секрет (устаревший режим, JWKS пуст)
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// TokenLifetime срок действия JWT токена; период отсрочки ключей не может быть короче
+const TokenLifetime = 24 * time.Hour
+
+// ImpersonationTokenLifetime срок действия токена входа под пользователем
+const ImpersonationTokenLifetime = 30 * time.Minute
+
+// Минимальный интервал между перечитываниями ключей при встрече неизвестного kid
+const unknownKIDReloadInterval = 30 * time.Second
+
+var (
+	// ErrUnknownKey токен подписан ключом, которого нет среди действующих
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrNoSigningKey нет ключа, которым можно подписать токен
+	ErrNoSigningKey = errors.New("no active signing key")
+)
+
+// KeyStore хранилище ключей подписи (repositories.SigningKeyRepository)
+type KeyStore interface {
+	ListValid() ([]repositories.SigningKey, error)
+	Rotate(key *repositories.SigningKey, rotationInterval, gracePeriod time.Duration, force bool) (bool, error)
+	DeleteExpired() (int64, error)
+}
+
+// KeyManagerConfig настройки подписи токенов
+type KeyManagerConfig struct {
+	Algorithm        string
+	Secret           string // для HS256 - ключ подписи, для RS256/EdDSA - ключ шифрования приватных ключей в БД
+	Issuer           string
+	RotationInterval time.Duration
+	GracePeriod      time.Duration
+}
+
+// signingKey загруженный ключ; private == nil, если его не удалось расшифровать (только проверка)
+type signingKey struct {
+	kid       string
+	algorithm string
+	private   crypto.Signer
+	public    crypto.PublicKey
+	retired   bool
+}
+
+// KeyManager подписывает и проверяет JWT токены набором ключей с ротацией
+type KeyManager struct {
+	cfg   KeyManagerConfig
+	store KeyStore
+
+	mu         sync.RWMutex
+	keys       map[string]*signingKey
+	active     *signingKey
+	lastReload time.Time
+}
+
+// NewHMACKeyManager создает менеджер с подписью общим секретом (HS256)
+func NewHMACKeyManager(secret string) *KeyManager {
+	return &KeyManager{
+		cfg:  KeyManagerConfig{Algorithm: AlgorithmHS256, Secret: secret},
+		keys: map[string]*signingKey{},
+	}
+}
+
+// NewKeyManager создает менеджер ключей; для асимметричных алгоритмов загружает ключи
+// из хранилища и создает первый ключ, если действующего нет
+func NewKeyManager(cfg KeyManagerConfig, store KeyStore) (*KeyManager, error) {
+	switch cfg.Algorithm {
+	case AlgorithmHS256:
+		return NewHMACKeyManager(cfg.Secret), nil
+	case AlgorithmRS256, AlgorithmEdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", cfg.Algorithm)
+	}
+
+	if cfg.GracePeriod < TokenLifetime {
+		return nil, fmt.Errorf("JWT key grace period %s is shorter than token lifetime %s", cfg.GracePeriod, TokenLifetime)
+	}
+
+	m := &KeyManager{cfg: cfg, store: store, keys: map[string]*signingKey{}}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	if _, err := m.RotateIfDue(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Algorithm возвращает алгоритм подписи
+func (m *KeyManager) Algorithm() string {
+	return m.cfg.Algorithm
+}
+
+// GenerateToken выпускает токен пользователя, подписанный активным ключом
+func (m *KeyManager) GenerateToken(user models.User) (string, error) {
+	if m.cfg.Algorithm == AlgorithmHS256 {
+		return GenerateToken(user, m.cfg.Secret)
+	}
+	return m.sign(m.newClaims(user, TokenLifetime))
+}
+
+// GenerateImpersonationToken выпускает короткоживущий токен администратора для работы от имени пользователя
+func (m *KeyManager) GenerateImpersonationToken(target, impersonator models.User) (string, time.Time, error) {
+	claims := m.newClaims(target, ImpersonationTokenLifetime)
+	claims.ImpersonatorID = impersonator.ID
+	claims.ImpersonatorUsername = impersonator.Username
+	claims.ImpersonatorTokenVersion = impersonator.TokenVersion
+
+	token, err := m.sign(claims)
+	return token, claims.ExpiresAt.Time, err
+}
+
+func (m *KeyManager) newClaims(user models.User, lifetime time.Duration) Claims {
+	now := time.Now()
+	return Claims{
+		UserID:       user.ID,
+		Username:     user.Username,
+		FullName:     user.FullName,
+		Role:         user.Role,
+		TokenVersion: user.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.cfg.Issuer,
+			Subject:   fmt.Sprintf("%d", user.ID),
+			ExpiresAt: jwt.NewNumericDate(now.Add(lifetime)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+}
+
+// sign подписывает claims общим секретом (HS256) или активным ключом с заголовком kid
+func (m *KeyManager) sign(claims Claims) (string, error) {
+	if m.cfg.Algorithm == AlgorithmHS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(m.cfg.Secret))
+	}
+
+	m.mu.RLock()
+	active := m.active
+	m.mu.RUnlock()
+	if active == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(signingMethod(active.algorithm), claims)
+	token.Header["kid"] = active.kid
+	return token.SignedString(active.private)
+}
+
+// ValidateToken проверяет подпись токена ключом из заголовка kid
+func (m *KeyManager) ValidateToken(tokenString string) (*Claims, error) {
+	if m.cfg.Algorithm == AlgorithmHS256 {
+		return ValidateToken(tokenString, m.cfg.Secret)
+	}
+
+	options := []jwt.ParserOption{jwt.WithValidMethods([]string{AlgorithmRS256, AlgorithmEdDSA})}
+	if m.cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(m.cfg.Issuer))
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, m.keyFunc, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+		return claims, nil
+	}
+	return nil, errors.New("invalid token")
+}
+
+// keyFunc выбирает публичный ключ по kid; алгоритм токена должен совпадать с алгоритмом ключа
+func (m *KeyManager) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, ErrUnknownKey
+	}
+
+	key := m.lookup(kid)
+	if key == nil {
+		// Ключ мог быть только что создан другим экземпляром сервера
+		m.reloadThrottled()
+		key = m.lookup(kid)
+	}
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+
+	if token.Method.Alg() != key.algorithm {
+		return nil, fmt.Errorf("token algorithm %s does not match key %s", token.Method.Alg(), kid)
+	}
+	return key.public, nil
+}
+
+func (m *KeyManager) lookup(kid string) *signingKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.keys[kid]
+}
+
+func (m *KeyManager) reloadThrottled() {
+	m.mu.RLock()
+	recent := time.Since(m.lastReload) < unknownKIDReloadInterval
+	m.mu.RUnlock()
+	if recent {
+		return
+	}
+	if err := m.Reload(); err != nil {
+		log.Printf("Failed to reload JWT signing keys: %v", err)
+	}
+}
+
+// Reload перечитывает ключи из хранилища
+func (m *KeyManager) Reload() error {
+	if m.store == nil {
+		return nil
+	}
+
+	stored, err := m.store.ListValid()
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*signingKey, len(stored))
+	var active *signingKey
+	for _, s := range stored {
+		key, err := m.decodeKey(s)
+		if err != nil {
+			log.Printf("Skipping JWT signing key %s: %v", s.KID, err)
+			continue
+		}
+		keys[key.kid] = key
+		// Ключи отсортированы от новых к старым: активный - первый не выведенный из подписи
+		if active == nil && !key.retired && key.private != nil && key.algorithm == m.cfg.Algorithm {
+			active = key
+		}
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.active = active
+	m.lastReload = time.Now()
+	m.mu.Unlock()
+	return nil
+}
+
+// RotateIfDue создает новый ключ, если активный старше интервала ротации
+// или подписывать нечем (нет ключа, сменился алгоритм или JWT_SECRET)
+func (m *KeyManager) RotateIfDue() (bool, error) {
+	if m.store == nil {
+		return false, nil
+	}
+
+	m.mu.RLock()
+	active := m.active
+	m.mu.RUnlock()
+
+	force := active == nil
+	newKey, err := m.generateKey()
+	if err != nil {
+		return false, err
+	}
+
+	rotated, err := m.store.Rotate(newKey, m.cfg.RotationInterval, m.cfg.GracePeriod, force)
+	if err != nil {
+		return false, err
+	}
+	if rotated {
+		log.Printf("JWT signing key rotated: new kid %s (%s)", newKey.KID, newKey.Algorithm)
+	}
+
+	// Перечитываем в любом случае: ротацию мог выполнить другой экземпляр
+	return rotated, m.Reload()
+}
+
+// PruneExpired удаляет ключи с истёкшим периодом отсрочки
+func (m *KeyManager) PruneExpired() error {
+	if m.store == nil {
+		return nil
+	}
+	deleted, err := m.store.DeleteExpired()
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d expired JWT signing keys", deleted)
+	}
+	return nil
+}
+
+// JWK публичный ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS возвращает публичные ключи, которыми проверяются токены (включая ключи в периоде отсрочки)
+func (m *KeyManager) JWKS() []JWK {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	jwks := []JWK{}
+	for _, key := range m.keys {
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwks = append(jwks, JWK{
+				Kty: "RSA",
+				Kid: key.kid,
+				Alg: key.algorithm,
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks = append(jwks, JWK{
+				Kty: "OKP",
+				Kid: key.kid,
+				Alg: key.algorithm,
+				Use: "sig",
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+	return jwks
+}
+
+// generateKey создает новую пару ключей и шифрует приватную часть для хранения
+func (m *KeyManager) generateKey() (*repositories.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch m.cfg.Algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := m.encrypt(privateDER)
+	if err != nil {
+		return nil, err
+	}
+
+	kidBytes := make([]byte, 8)
+	if _, err := rand.Read(kidBytes); err != nil {
+		return nil, err
+	}
+
+	return &repositories.SigningKey{
+		KID:        time.Now().UTC().Format("20060102") + "-" + hex.EncodeToString(kidBytes),
+		Algorithm:  m.cfg.Algorithm,
+		PrivateKey: encrypted,
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+	}, nil
+}
+
+// decodeKey разбирает сохранённый ключ; если приватную часть не удалось расшифровать
+// (например, сменился JWT_SECRET), ключ остаётся пригодным для проверки токенов
+func (m *KeyManager) decodeKey(stored repositories.SigningKey) (*signingKey, error) {
+	block, _ := pem.Decode([]byte(stored.PublicKey))
+	if block == nil {
+		return nil, errors.New("invalid public key PEM")
+	}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{
+		kid:       stored.KID,
+		algorithm: stored.Algorithm,
+		public:    public,
+		retired:   stored.RetiredAt.Valid,
+	}
+
+	privateDER, err := m.decrypt(stored.PrivateKey)
+	if err != nil {
+		log.Printf("JWT signing key %s cannot be decrypted, using it for verification only: %v", stored.KID, err)
+		return key, nil
+	}
+	private, err := x509.ParsePKCS8PrivateKey(privateDER)
+	if err != nil {
+		return nil, err
+	}
+	if signer, ok := private.(crypto.Signer); ok {
+		key.private = signer
+	}
+	return key, nil
+}
+
+// encrypt шифрует данные AES-256-GCM ключом, производным от секрета
+func (m *KeyManager) encrypt(plaintext []byte) (string, error) {
+	gcm, err := m.cipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+func (m *KeyManager) decrypt(encoded string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := m.cipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+func (m *KeyManager) cipher() (cipher.AEAD, error) {
+	sum := sha256.Sum256([]byte(m.cfg.Secret))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func signingMethod(algorithm string) jwt.SigningMethod {
+	if algorithm == AlgorithmEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
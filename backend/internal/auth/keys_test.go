@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// memoryKeyStore хранилище ключей в памяти вместо jwt_signing_keys
+type memoryKeyStore struct {
+	keys []repositories.SigningKey // новые первыми
+	now  time.Time
+}
+
+func (s *memoryKeyStore) ListValid() ([]repositories.SigningKey, error) {
+	var valid []repositories.SigningKey
+	for _, key := range s.keys {
+		if !key.ExpiresAt.Valid || key.ExpiresAt.Time.After(s.now) {
+			valid = append(valid, key)
+		}
+	}
+	return valid, nil
+}
+
+func (s *memoryKeyStore) Rotate(key *repositories.SigningKey, rotationInterval, gracePeriod time.Duration, force bool) (bool, error) {
+	if !force {
+		for _, k := range s.keys {
+			if !k.RetiredAt.Valid && k.CreatedAt.After(s.now.Add(-rotationInterval)) {
+				return false, nil
+			}
+		}
+	}
+	for i := range s.keys {
+		if !s.keys[i].RetiredAt.Valid {
+			s.keys[i].RetiredAt = sql.NullTime{Time: s.now, Valid: true}
+			s.keys[i].ExpiresAt = sql.NullTime{Time: s.now.Add(gracePeriod), Valid: true}
+		}
+	}
+	key.CreatedAt = s.now
+	s.keys = append([]repositories.SigningKey{*key}, s.keys...)
+	return true, nil
+}
+
+func (s *memoryKeyStore) DeleteExpired() (int64, error) {
+	return 0, nil
+}
+
+func newTestKeyManager(t *testing.T, algorithm string, store *memoryKeyStore) *KeyManager {
+	m, err := NewKeyManager(KeyManagerConfig{
+		Algorithm:        algorithm,
+		Secret:           "test-secret-key-for-key-manager-1234",
+		Issuer:           "central-reporting",
+		RotationInterval: 30 * 24 * time.Hour,
+		GracePeriod:      48 * time.Hour,
+	}, store)
+	if err != nil {
+		t.Fatalf("NewKeyManager() error = %v", err)
+	}
+	return m
+}
+
+var testTokenUser = models.User{ID: 5, Username: "ivanov", Role: models.RoleUser, TokenVersion: 3}
+
+func TestKeyManager_SignAndValidate(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmRS256, AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			m := newTestKeyManager(t, algorithm, &memoryKeyStore{now: time.Now()})
+
+			token, err := m.GenerateToken(testTokenUser)
+			if err != nil {
+				t.Fatalf("GenerateToken() error = %v", err)
+			}
+
+			claims, err := m.ValidateToken(token)
+			if err != nil {
+				t.Fatalf("ValidateToken() error = %v", err)
+			}
+			if claims.UserID != 5 || claims.TokenVersion != 3 || claims.Issuer != "central-reporting" {
+				t.Errorf("unexpected claims: %+v", claims)
+			}
+
+			jwks := m.JWKS()
+			if len(jwks) != 1 || jwks[0].Alg != algorithm {
+				t.Errorf("JWKS() = %+v, want one %s key", jwks, algorithm)
+			}
+		})
+	}
+}
+
+func TestKeyManager_RotationGracePeriod(t *testing.T) {
+	store := &memoryKeyStore{now: time.Now()}
+	m := newTestKeyManager(t, AlgorithmRS256, store)
+
+	oldToken, _ := m.GenerateToken(testTokenUser)
+
+	// Ротация не нужна, пока ключ моложе интервала
+	if rotated, _ := m.RotateIfDue(); rotated {
+		t.Fatal("RotateIfDue() rotated a fresh key")
+	}
+
+	store.now = store.now.Add(31 * 24 * time.Hour)
+	if rotated, err := m.RotateIfDue(); err != nil || !rotated {
+		t.Fatalf("RotateIfDue() = %v, %v, want rotation", rotated, err)
+	}
+
+	newToken, _ := m.GenerateToken(testTokenUser)
+	oldHeader, _, _ := jwt.NewParser().ParseUnverified(oldToken, &Claims{})
+	newHeader, _, _ := jwt.NewParser().ParseUnverified(newToken, &Claims{})
+	if oldHeader.Header["kid"] == newHeader.Header["kid"] {
+		t.Error("new tokens must be signed with the new key")
+	}
+
+	// Старый ключ проверяет токены в течение периода отсрочки и публикуется в JWKS
+	if len(m.JWKS()) != 2 {
+		t.Errorf("JWKS() has %d keys, want 2", len(m.JWKS()))
+	}
+	if _, err := m.ValidateToken(oldToken); err != nil {
+		t.Errorf("ValidateToken(old) during grace period error = %v", err)
+	}
+	if _, err := m.ValidateToken(newToken); err != nil {
+		t.Errorf("ValidateToken(new) error = %v", err)
+	}
+
+	// После периода отсрочки старый ключ исчезает
+	store.now = store.now.Add(49 * time.Hour)
+	if err := m.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(m.JWKS()) != 1 {
+		t.Errorf("JWKS() has %d keys after grace period, want 1", len(m.JWKS()))
+	}
+	if _, err := m.ValidateToken(oldToken); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("ValidateToken(old) error = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestKeyManager_RejectsForeignTokens(t *testing.T) {
+	m := newTestKeyManager(t, AlgorithmRS256, &memoryKeyStore{now: time.Now()})
+	kid := m.JWKS()[0].Kid
+
+	// HS256 токен с kid существующего ключа (подмена алгоритма)
+	hmacToken := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: 1})
+	hmacToken.Header["kid"] = kid
+	signed, _ := hmacToken.SignedString([]byte("test-secret-key-for-key-manager-1234"))
+	if _, err := m.ValidateToken(signed); err == nil {
+		t.Error("ValidateToken() accepted HS256 token")
+	}
+
+	// Токен, подписанный ключом другой установки
+	other := newTestKeyManager(t, AlgorithmRS256, &memoryKeyStore{now: time.Now()})
+	foreign, _ := other.GenerateToken(testTokenUser)
+	if _, err := m.ValidateToken(foreign); err == nil {
+		t.Error("ValidateToken() accepted token signed by unknown key")
+	}
+}
+
+func TestKeyManager_SecretChangeForcesRotation(t *testing.T) {
+	store := &memoryKeyStore{now: time.Now()}
+	first := newTestKeyManager(t, AlgorithmEdDSA, store)
+	token, _ := first.GenerateToken(testTokenUser)
+
+	// Новый секрет: старый ключ нельзя расшифровать, но им ещё можно проверять
+	second, err := NewKeyManager(KeyManagerConfig{
+		Algorithm:        AlgorithmEdDSA,
+		Secret:           "another-secret-key-for-key-manager-99",
+		Issuer:           "central-reporting",
+		RotationInterval: 30 * 24 * time.Hour,
+		GracePeriod:      48 * time.Hour,
+	}, store)
+	if err != nil {
+		t.Fatalf("NewKeyManager() error = %v", err)
+	}
+
+	if len(store.keys) != 2 {
+		t.Fatalf("store has %d keys, want 2 (forced rotation)", len(store.keys))
+	}
+	if _, err := second.ValidateToken(token); err != nil {
+		t.Errorf("ValidateToken() of token signed before secret change error = %v", err)
+	}
+	if _, err := second.GenerateToken(testTokenUser); err != nil {
+		t.Errorf("GenerateToken() error = %v", err)
+	}
+}
+
+func TestNewKeyManager_GracePeriodTooShort(t *testing.T) {
+	_, err := NewKeyManager(KeyManagerConfig{
+		Algorithm:        AlgorithmRS256,
+		RotationInterval: time.Hour,
+		GracePeriod:      time.Hour,
+	}, &memoryKeyStore{now: time.Now()})
+	if err == nil {
+		t.Error("NewKeyManager() should reject grace period shorter than token lifetime")
+	}
+}
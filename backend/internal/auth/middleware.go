@@ -1,16 +1,22 @@
 package auth
 
 import (
+	"log"
 	"net/http"
 	"strings"
 
-	"github.com/UAssylbek/central-reporting/internal/models"
 	"github.com/UAssylbek/central-reporting/internal/repositories"
 	"github.com/gin-gonic/gin"
 )
 
-func JWTMiddleware(secret string, userRepo *repositories.UserRepository) gin.HandlerFunc {
+// JWTMiddleware проверяет JWT токен или API ключ (Authorization: Bearer cr_... либо X-API-Key)
+func JWTMiddleware(tokens *KeyManager, userRepo *repositories.UserRepository, apiKeyRepo *repositories.APIKeyRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			authenticateAPIKey(c, apiKey, userRepo, apiKeyRepo)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
@@ -25,7 +31,12 @@ func JWTMiddleware(secret string, userRepo *repositories.UserRepository) gin.Han
 			return
 		}
 
-		claims, err := ValidateToken(tokenString, secret)
+		if IsAPIKey(tokenString) {
+			authenticateAPIKey(c, tokenString, userRepo, apiKeyRepo)
+			return
+		}
+
+		claims, err := tokens.ValidateToken(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
@@ -70,49 +81,91 @@ func JWTMiddleware(secret string, userRepo *repositories.UserRepository) gin.Han
 			return
 		}
 
+		// Вход под пользователем действителен, пока администратор активен и его сессии не отозваны
+		if claims.IsImpersonation() {
+			impersonator, err := userRepo.GetByID(claims.ImpersonatorID)
+			if err != nil || !impersonator.IsActive || impersonator.TokenVersion != claims.ImpersonatorTokenVersion {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error":        "Impersonation session is no longer valid",
+					"force_logout": true,
+				})
+				c.Abort()
+				return
+			}
+
+			c.Set("impersonator_id", impersonator.ID)
+			c.Set("impersonator_username", impersonator.Username)
+			// Право на вход под пользователем проверяет LoadPermissions
+			c.Set("impersonator_role", impersonator.Role)
+			c.Header("X-Impersonated-By", impersonator.Username)
+		}
+
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("role", claims.Role)
+		c.Set("auth_method", AuthMethodJWT)
 		c.Next()
 	}
 }
 
-// AdminMiddleware проверяет, что пользователь является администратором
-func AdminMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Role not found in context"})
-			c.Abort()
-			return
-		}
+// authenticateAPIKey проверяет API ключ и действует от имени его владельца с ограничением по scopes
+func authenticateAPIKey(c *gin.Context, rawKey string, userRepo *repositories.UserRepository, apiKeyRepo *repositories.APIKeyRepository) {
+	if apiKeyRepo == nil || !IsAPIKey(rawKey) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
 
-		if role != models.RoleAdmin {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
-			c.Abort()
-			return
-		}
+	key, err := apiKeyRepo.GetByHash(HashAPIKey(rawKey))
+	if err != nil {
+		log.Printf("Failed to look up API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		c.Abort()
+		return
+	}
+	if key == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
 
-		c.Next()
+	if key.IsRevoked() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key has been revoked"})
+		c.Abort()
+		return
 	}
-}
 
-// AdminOrModeratorMiddleware проверяет, что пользователь является администратором или модератором
-func AdminOrModeratorMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Role not found in context"})
-			c.Abort()
-			return
-		}
+	if key.IsExpired() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key has expired"})
+		c.Abort()
+		return
+	}
 
-		if role != models.RoleAdmin && role != models.RoleModerator {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin or moderator access required"})
-			c.Abort()
-			return
-		}
+	user, err := userRepo.GetByID(key.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		c.Abort()
+		return
+	}
 
-		c.Next()
+	if !user.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your account has been blocked"})
+		c.Abort()
+		return
 	}
+
+	go func(id int, ip string) {
+		if err := apiKeyRepo.TouchLastUsed(id, ip); err != nil {
+			log.Printf("Failed to update API key %d last use: %v", id, err)
+		}
+	}(key.ID, c.ClientIP())
+
+	// Роль берётся из текущих данных владельца: понижение роли сразу ограничивает ключ
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("auth_method", AuthMethodAPIKey)
+	c.Set("api_key_id", key.ID)
+	c.Set("api_key_scopes", []string(key.Scopes))
+	c.Next()
 }
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Права доступа (коды совпадают с таблицей permissions)
+const (
+	PermUsersRead              = "users.read"
+	PermUsersReadAll           = "users.read.all"
+	PermUsersCreate            = "users.create"
+	PermUsersUpdate            = "users.update"
+	PermUsersUpdateOrgs        = "users.update.orgs"
+	PermUsersUpdateRole        = "users.update.role"
+	PermUsersUpdateCredentials = "users.update.credentials"
+	PermUsersUpdateAccess      = "users.update.access"
+	PermUsersDelete            = "users.delete"
+	PermUsersImpersonate       = "users.impersonate"
+	PermUsersApproveChanges    = "users.approve_changes"
+	PermUsersPersonalData      = "users.personal_data"
+	PermProfileUpdate          = "profile.update"
+	PermAPIKeysManage          = "api_keys.manage"
+	PermRolesManage            = "roles.manage"
+	PermCustomFieldsManage     = "custom_fields.manage"
+	PermTagsManage             = "tags.manage"
+	PermOrgsManage             = "orgs.manage"
+	PermReportsRunPayroll      = "reports.run.payroll"
+	PermAuditRead              = "audit.read"
+)
+
+// Сколько права ролей хранятся в памяти до перечитывания из БД
+const permissionCacheTTL = 30 * time.Second
+
+// PermissionSet набор прав роли
+type PermissionSet map[string]bool
+
+// NewPermissionSet создает набор из списка кодов
+func NewPermissionSet(codes ...string) PermissionSet {
+	set := PermissionSet{}
+	for _, code := range codes {
+		set[code] = true
+	}
+	return set
+}
+
+// Has проверяет, что в наборе есть все указанные права
+func (s PermissionSet) Has(codes ...string) bool {
+	for _, code := range codes {
+		if !s[code] {
+			return false
+		}
+	}
+	return true
+}
+
+// Contains проверяет, что набор включает все права другого набора
+// (нельзя выдать роль или право, которого нет у себя)
+func (s PermissionSet) Contains(other PermissionSet) bool {
+	for code := range other {
+		if !s[code] {
+			return false
+		}
+	}
+	return true
+}
+
+// List возвращает отсортированный список кодов
+func (s PermissionSet) List() []string {
+	codes := make([]string, 0, len(s))
+	for code := range s {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// RolePermissionLoader источник прав ролей (реализуется RoleRepository)
+type RolePermissionLoader interface {
+	LoadRolePermissions() (map[models.UserRole][]string, error)
+}
+
+// PermissionStore кеш прав ролей; перечитывается из БД по истечении permissionCacheTTL
+// или сразу после Invalidate (изменение ролей на этом экземпляре)
+type PermissionStore struct {
+	loader RolePermissionLoader
+
+	mu       sync.RWMutex
+	roles    map[models.UserRole]PermissionSet
+	loadedAt time.Time
+}
+
+// NewPermissionStore создает кеш прав ролей
+func NewPermissionStore(loader RolePermissionLoader) *PermissionStore {
+	return &PermissionStore{loader: loader}
+}
+
+// Permissions возвращает права роли (пустой набор для неизвестной роли)
+func (s *PermissionStore) Permissions(role models.UserRole) PermissionSet {
+	roles := s.current()
+	if perms, ok := roles[role]; ok {
+		return perms
+	}
+	return PermissionSet{}
+}
+
+// RoleExists проверяет, что роль существует
+func (s *PermissionStore) RoleExists(role models.UserRole) bool {
+	_, ok := s.current()[role]
+	return ok
+}
+
+// Invalidate сбрасывает кеш после изменения ролей
+func (s *PermissionStore) Invalidate() {
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.mu.Unlock()
+}
+
+func (s *PermissionStore) current() map[models.UserRole]PermissionSet {
+	s.mu.RLock()
+	roles, loadedAt := s.roles, s.loadedAt
+	s.mu.RUnlock()
+
+	if roles != nil && time.Since(loadedAt) < permissionCacheTTL {
+		return roles
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.roles != nil && time.Since(s.loadedAt) < permissionCacheTTL {
+		return s.roles
+	}
+
+	loaded, err := s.loader.LoadRolePermissions()
+	if err != nil {
+		// При ошибке БД продолжаем работать с прежними правами
+		log.Printf("Failed to load role permissions: %v", err)
+		if s.roles == nil {
+			return map[models.UserRole]PermissionSet{}
+		}
+		return s.roles
+	}
+
+	s.roles = make(map[models.UserRole]PermissionSet, len(loaded))
+	for role, codes := range loaded {
+		s.roles[role] = NewPermissionSet(codes...)
+	}
+	s.loadedAt = time.Now()
+	return s.roles
+}
+
+// LoadPermissions кладёт в контекст права роли текущего пользователя (после JWTMiddleware)
+func LoadPermissions(store *PermissionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, _ := c.Get("role")
+		userRole, _ := role.(models.UserRole)
+
+		// Вход под пользователем действителен, пока у администратора остаётся право на него
+		if impersonatorRole, ok := c.Get("impersonator_role"); ok {
+			if !store.Permissions(impersonatorRole.(models.UserRole)).Has(PermUsersImpersonate) {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error":        "Impersonation session is no longer valid",
+					"force_logout": true,
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Set("permissions", store.Permissions(userRole))
+		c.Next()
+	}
+}
+
+// Permissions возвращает права текущего пользователя из контекста
+func Permissions(c *gin.Context) PermissionSet {
+	if perms, ok := c.Get("permissions"); ok {
+		return perms.(PermissionSet)
+	}
+	return PermissionSet{}
+}
+
+// HasPermission проверяет права текущего пользователя
+func HasPermission(c *gin.Context, codes ...string) bool {
+	return Permissions(c).Has(codes...)
+}
+
+// RequirePermission пропускает запрос, только если у пользователя есть все указанные права
+func RequirePermission(codes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("role"); !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Не авторизован"})
+			c.Abort()
+			return
+		}
+
+		if !HasPermission(c, codes...) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":    "Недостаточно прав доступа",
+				"required": codes,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// countingLoader источник прав в памяти, считающий обращения
+type countingLoader struct {
+	roles map[models.UserRole][]string
+	err   error
+	calls int
+}
+
+func (l *countingLoader) LoadRolePermissions() (map[models.UserRole][]string, error) {
+	l.calls++
+	return l.roles, l.err
+}
+
+func TestPermissionStore_CacheAndInvalidate(t *testing.T) {
+	loader := &countingLoader{roles: map[models.UserRole][]string{
+		models.RoleModerator: {PermUsersRead, PermUsersUpdateOrgs},
+	}}
+	store := NewPermissionStore(loader)
+
+	if !store.Permissions(models.RoleModerator).Has(PermUsersRead, PermUsersUpdateOrgs) {
+		t.Error("moderator should have users.read and users.update.orgs")
+	}
+	if store.Permissions(models.RoleModerator).Has(PermUsersDelete) {
+		t.Error("moderator should not have users.delete")
+	}
+	if store.RoleExists("unknown") || len(store.Permissions("unknown")) != 0 {
+		t.Error("unknown role should have no permissions")
+	}
+	if loader.calls != 1 {
+		t.Errorf("loader calls = %d, want 1 (cached)", loader.calls)
+	}
+
+	// После изменения ролей права перечитываются сразу
+	loader.roles[models.RoleModerator] = []string{PermUsersRead}
+	store.Invalidate()
+	if store.Permissions(models.RoleModerator).Has(PermUsersUpdateOrgs) {
+		t.Error("permissions should be reloaded after Invalidate")
+	}
+
+	// Ошибка БД не сбрасывает загруженные права
+	loader.err = errors.New("connection refused")
+	store.Invalidate()
+	if !store.Permissions(models.RoleModerator).Has(PermUsersRead) {
+		t.Error("permissions should survive a failed reload")
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := NewPermissionStore(&countingLoader{roles: map[models.UserRole][]string{
+		models.RoleAdmin:     {PermUsersRead, PermUsersDelete, PermUsersImpersonate},
+		models.RoleModerator: {PermUsersRead},
+		"auditor":            {PermUsersRead, PermReportsRunPayroll},
+	}})
+
+	tests := []struct {
+		name             string
+		role             models.UserRole
+		impersonatorRole models.UserRole
+		required         []string
+		wantStatus       int
+	}{
+		{"Has permission", models.RoleModerator, "", []string{PermUsersRead}, http.StatusOK},
+		{"Missing permission", models.RoleModerator, "", []string{PermUsersDelete}, http.StatusForbidden},
+		{"Custom role", "auditor", "", []string{PermReportsRunPayroll}, http.StatusOK},
+		{"All permissions required", "auditor", "", []string{PermUsersRead, PermUsersDelete}, http.StatusForbidden},
+		{"Unknown role", "removed", "", []string{PermUsersRead}, http.StatusForbidden},
+		{"Impersonation by admin", models.RoleModerator, models.RoleAdmin, []string{PermUsersRead}, http.StatusOK},
+		{"Impersonator lost permission", models.RoleModerator, models.RoleModerator, []string{PermUsersRead}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/test", func(c *gin.Context) {
+				c.Set("role", tt.role)
+				if tt.impersonatorRole != "" {
+					c.Set("impersonator_role", tt.impersonatorRole)
+				}
+				c.Next()
+			}, LoadPermissions(store), RequirePermission(tt.required...), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest("GET", "/test", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxGrantDays        = 365
+	defaultExpiringDays = 7
+	maxExpiringDays     = 90
+)
+
+// AccessGrantHandler управляет доступами модераторов к пользователям, отделам и организациям
+type AccessGrantHandler struct {
+	grantRepo        *repositories.AccessGrantRepository
+	userRepo         *repositories.UserRepository
+	organizationRepo *repositories.OrganizationRepository
+	auditLogRepo     *repositories.AuditLogRepository
+}
+
+// NewAccessGrantHandler создает новый handler
+func NewAccessGrantHandler(
+	grantRepo *repositories.AccessGrantRepository,
+	userRepo *repositories.UserRepository,
+	organizationRepo *repositories.OrganizationRepository,
+	auditLogRepo *repositories.AuditLogRepository,
+) *AccessGrantHandler {
+	return &AccessGrantHandler{
+		grantRepo:        grantRepo,
+		userRepo:         userRepo,
+		organizationRepo: organizationRepo,
+		auditLogRepo:     auditLogRepo,
+	}
+}
+
+// ListGrants godoc
+// @Summary Доступы пользователя
+// @Description Возвращает доступы пользователя к другим пользователям, отделам и организациям
+// @Tags access-grants
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} map[string]interface{} "Список доступов"
+// @Failure 403 {object} map[string]string "Недостаточно прав"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Router /users/{id}/access-grants [get]
+func (h *AccessGrantHandler) ListGrants(c *gin.Context) {
+	granteeID, ok := h.granteeID(c)
+	if !ok {
+		return
+	}
+
+	grants, err := h.grantRepo.ListByGrantee(granteeID)
+	if err != nil {
+		log.Printf("Failed to list access grants for user %d: %v", granteeID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить список доступов"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"grants": grants})
+}
+
+// CreateGrant godoc
+// @Summary Выдать доступ
+// @Description Выдает пользователю доступ к одному пользователю, отделу или организации, бессрочно или на период valid_from - valid_until
+// @Tags access-grants
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя, получающего доступ"
+// @Param request body models.CreateAccessGrantRequest true "Объект доступа"
+// @Success 201 {object} map[string]interface{} "Доступ выдан"
+// @Failure 400 {object} map[string]string "Неверные параметры"
+// @Failure 403 {object} map[string]string "Недостаточно прав"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Failure 409 {object} map[string]string "Доступ уже выдан"
+// @Router /users/{id}/access-grants [post]
+func (h *AccessGrantHandler) CreateGrant(c *gin.Context) {
+	granteeID, ok := h.granteeID(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateAccessGrantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	currentUserID := c.GetInt("user_id")
+	grant := &repositories.AccessGrant{
+		GranteeID: granteeID,
+		Scope:     req.Scope,
+		GrantedBy: sql.NullInt64{Int64: int64(currentUserID), Valid: true},
+	}
+
+	switch req.Scope {
+	case repositories.GrantScopeUser:
+		if req.UserID == granteeID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Нельзя выдать доступ к самому себе"})
+			return
+		}
+		if _, err := h.userRepo.GetByID(req.UserID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Пользователь user_id не найден"})
+			return
+		}
+		grant.UserID = sql.NullInt64{Int64: int64(req.UserID), Valid: true}
+	case repositories.GrantScopeDepartment:
+		department := strings.TrimSpace(utils.SanitizeString(req.Department))
+		if department == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите отдел"})
+			return
+		}
+		grant.Department = sql.NullString{String: department, Valid: true}
+	case repositories.GrantScopeOrganization:
+		if _, err := h.organizationRepo.GetByID(req.OrganizationID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Организация не найдена"})
+			return
+		}
+		grant.OrganizationID = sql.NullInt64{Int64: int64(req.OrganizationID), Valid: true}
+	}
+
+	if req.ValidFrom != nil {
+		grant.ValidFrom = *req.ValidFrom
+	}
+	if req.ValidUntil != nil {
+		if errMsg := validateGrantPeriod(req.ValidFrom, *req.ValidUntil); errMsg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+			return
+		}
+		grant.ValidUntil = sql.NullTime{Time: *req.ValidUntil, Valid: true}
+	}
+
+	if err := h.grantRepo.Create(grant); err != nil {
+		if repositories.IsDuplicateGrant(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Такой доступ уже выдан"})
+			return
+		}
+		log.Printf("Failed to create access grant for user %d: %v", granteeID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось выдать доступ"})
+		return
+	}
+
+	logAudit(h.auditLogRepo, c, repositories.ActionGrantAccess, &granteeID, map[string]interface{}{
+		"grant_id":        grant.ID,
+		"scope":           grant.Scope,
+		"user_id":         grant.UserID,
+		"department":      grant.Department,
+		"organization_id": grant.OrganizationID,
+		"valid_from":      grant.ValidFrom,
+		"valid_until":     grant.ValidUntil,
+	})
+	log.Printf("AUDIT: User %d granted %s access (grant %d) to user %d", currentUserID, grant.Scope, grant.ID, granteeID)
+
+	c.JSON(http.StatusCreated, gin.H{"grant": grant})
+}
+
+// DeleteGrant godoc
+// @Summary Отозвать доступ
+// @Description Удаляет доступ пользователя
+// @Tags access-grants
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param grantId path int true "ID доступа"
+// @Success 200 {object} map[string]string "Доступ отозван"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 404 {object} map[string]string "Доступ не найден"
+// @Router /users/{id}/access-grants/{grantId} [delete]
+func (h *AccessGrantHandler) DeleteGrant(c *gin.Context) {
+	granteeID, ok := h.granteeID(c)
+	if !ok {
+		return
+	}
+
+	grantID, err := strconv.Atoi(c.Param("grantId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID доступа"})
+		return
+	}
+
+	deleted, err := h.grantRepo.Delete(granteeID, grantID)
+	if err != nil {
+		log.Printf("Failed to delete access grant %d: %v", grantID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось отозвать доступ"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Доступ не найден"})
+		return
+	}
+
+	logAudit(h.auditLogRepo, c, repositories.ActionRevokeAccess, &granteeID, map[string]interface{}{
+		"grant_id": grantID,
+	})
+	log.Printf("AUDIT: User %d revoked access grant %d of user %d", c.GetInt("user_id"), grantID, granteeID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Доступ отозван"})
+}
+
+// ListExpiring godoc
+// @Summary Заканчивающиеся доступы к пользователям
+// @Description Возвращает действующие доступы к пользователям, которые закончатся в ближайшие days дней
+// @Tags access-grants
+// @Produce json
+// @Security BearerAuth
+// @Param days query int false "Горизонт в днях" default(7) maximum(90)
+// @Success 200 {object} map[string]interface{} "Список доступов"
+// @Failure 403 {object} map[string]string "Недостаточно прав"
+// @Router /access-grants/expiring [get]
+func (h *AccessGrantHandler) ListExpiring(c *gin.Context) {
+	grants, err := h.grantRepo.ListExpiring(expiringHorizon(c))
+	if err != nil {
+		log.Printf("Failed to list expiring access grants: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить список доступов"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"grants": grants})
+}
+
+// granteeID разбирает ID пользователя из пути и проверяет, что он существует
+func (h *AccessGrantHandler) granteeID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidUserID})
+		return 0, false
+	}
+
+	if _, err := h.userRepo.GetByID(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errUserNotFound})
+		return 0, false
+	}
+	return id, true
+}
+
+// validateGrantPeriod проверяет период временного доступа (пустая строка - период корректен)
+func validateGrantPeriod(validFrom *time.Time, validUntil time.Time) string {
+	if !validUntil.After(time.Now()) {
+		return "Окончание доступа должно быть в будущем"
+	}
+	if validFrom != nil && !validUntil.After(*validFrom) {
+		return "Окончание доступа должно быть позже начала"
+	}
+	if validUntil.Sub(time.Now()) > maxGrantDays*24*time.Hour {
+		return "Временный доступ выдается не более чем на год"
+	}
+	return ""
+}
+
+// expiringHorizon читает ?days= (по умолчанию 7, не больше 90) и возвращает границу отбора
+func expiringHorizon(c *gin.Context) time.Time {
+	days := defaultExpiringDays
+	if d, err := strconv.Atoi(c.Query("days")); err == nil && d > 0 && d <= maxExpiringDays {
+		days = d
+	}
+	return time.Now().AddDate(0, 0, days)
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAPIKeyLifetimeDays = 90
+	maxAPIKeyLifetimeDays     = 365
+)
+
+// APIKeyHandler управляет API ключами пользователей и сервисных учётных записей
+type APIKeyHandler struct {
+	apiKeyRepo   *repositories.APIKeyRepository
+	userRepo     *repositories.UserRepository
+	auditLogRepo *repositories.AuditLogRepository
+}
+
+// NewAPIKeyHandler создает новый handler
+func NewAPIKeyHandler(
+	apiKeyRepo *repositories.APIKeyRepository,
+	userRepo *repositories.UserRepository,
+	auditLogRepo *repositories.AuditLogRepository,
+) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyRepo:   apiKeyRepo,
+		userRepo:     userRepo,
+		auditLogRepo: auditLogRepo,
+	}
+}
+
+// ListMyKeys godoc
+// @Summary Мои API ключи
+// @Description Возвращает API ключи текущего пользователя (без самих ключей)
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Список ключей"
+// @Failure 401 {object} map[string]string "Не авторизован"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /auth/api-keys [get]
+func (h *APIKeyHandler) ListMyKeys(c *gin.Context) {
+	h.listKeys(c, c.GetInt("user_id"))
+}
+
+// CreateMyKey godoc
+// @Summary Создать API ключ
+// @Description Создает именованный API ключ текущего пользователя. Ключ возвращается только один раз
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateAPIKeyRequest true "Параметры ключа"
+// @Success 201 {object} map[string]interface{} "Ключ создан"
+// @Failure 400 {object} map[string]string "Неверные параметры"
+// @Failure 401 {object} map[string]string "Не авторизован"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /auth/api-keys [post]
+func (h *APIKeyHandler) CreateMyKey(c *gin.Context) {
+	h.createKey(c, c.GetInt("user_id"))
+}
+
+// RevokeMyKey godoc
+// @Summary Отозвать API ключ
+// @Description Отзывает API ключ текущего пользователя
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Param keyId path int true "ID ключа"
+// @Success 200 {object} map[string]string "Ключ отозван"
+// @Failure 400 {object} map[string]string "Неверный ID ключа"
+// @Failure 404 {object} map[string]string "Ключ не найден"
+// @Router /auth/api-keys/{keyId} [delete]
+func (h *APIKeyHandler) RevokeMyKey(c *gin.Context) {
+	h.revokeKey(c, c.GetInt("user_id"))
+}
+
+// ListUserKeys godoc
+// @Summary API ключи пользователя
+// @Description Возвращает API ключи пользователя или сервисной учётной записи (право api_keys.manage)
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} map[string]interface{} "Список ключей"
+// @Failure 400 {object} map[string]string "Неверный ID пользователя"
+// @Failure 403 {object} map[string]string "Доступ запрещен"
+// @Router /users/{id}/api-keys [get]
+func (h *APIKeyHandler) ListUserKeys(c *gin.Context) {
+	userID, ok := h.targetUserID(c)
+	if !ok {
+		return
+	}
+	h.listKeys(c, userID)
+}
+
+// CreateUserKey godoc
+// @Summary Создать API ключ пользователю
+// @Description Создает API ключ для пользователя или сервисной учётной записи (право api_keys.manage)
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param request body models.CreateAPIKeyRequest true "Параметры ключа"
+// @Success 201 {object} map[string]interface{} "Ключ создан"
+// @Failure 400 {object} map[string]string "Неверные параметры"
+// @Failure 403 {object} map[string]string "Доступ запрещен"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Router /users/{id}/api-keys [post]
+func (h *APIKeyHandler) CreateUserKey(c *gin.Context) {
+	userID, ok := h.targetUserID(c)
+	if !ok {
+		return
+	}
+	h.createKey(c, userID)
+}
+
+// RevokeUserKey godoc
+// @Summary Отозвать API ключ пользователя
+// @Description Отзывает API ключ пользователя или сервисной учётной записи (право api_keys.manage)
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param keyId path int true "ID ключа"
+// @Success 200 {object} map[string]string "Ключ отозван"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 404 {object} map[string]string "Ключ не найден"
+// @Router /users/{id}/api-keys/{keyId} [delete]
+func (h *APIKeyHandler) RevokeUserKey(c *gin.Context) {
+	userID, ok := h.targetUserID(c)
+	if !ok {
+		return
+	}
+	h.revokeKey(c, userID)
+}
+
+// targetUserID разбирает ID пользователя из пути и проверяет, что он существует
+func (h *APIKeyHandler) targetUserID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidUserID})
+		return 0, false
+	}
+
+	if _, err := h.userRepo.GetByID(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errUserNotFound})
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *APIKeyHandler) listKeys(c *gin.Context, userID int) {
+	keys, err := h.apiKeyRepo.ListByUser(userID)
+	if err != nil {
+		log.Printf("Failed to list API keys for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить список API ключей"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+func (h *APIKeyHandler) createKey(c *gin.Context, userID int) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Name = utils.SanitizeString(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Название ключа обязательно"})
+		return
+	}
+
+	if len(req.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите хотя бы один scope", "available_scopes": auth.AllScopes})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !auth.IsValidScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неизвестный scope: " + scope, "available_scopes": auth.AllScopes})
+			return
+		}
+	}
+
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultAPIKeyLifetimeDays
+	}
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > maxAPIKeyLifetimeDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Срок действия ключа должен быть от 1 до 365 дней"})
+		return
+	}
+
+	rawKey, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		log.Printf("Failed to generate API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать API ключ"})
+		return
+	}
+
+	currentUserID := c.GetInt("user_id")
+	key := &repositories.APIKey{
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    models.Scopes(req.Scopes),
+		ExpiresAt: time.Now().AddDate(0, 0, req.ExpiresInDays),
+		CreatedBy: sql.NullInt64{Int64: int64(currentUserID), Valid: true},
+	}
+
+	if err := h.apiKeyRepo.Create(key); err != nil {
+		log.Printf("Failed to create API key for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать API ключ"})
+		return
+	}
+
+	logAudit(h.auditLogRepo, c, repositories.ActionCreateAPIKey, &userID, map[string]interface{}{
+		"api_key_id": key.ID,
+		"name":       key.Name,
+		"prefix":     key.Prefix,
+		"scopes":     key.Scopes,
+		"expires_at": key.ExpiresAt,
+	})
+
+	log.Printf("AUDIT: User %d (%s) created API key %d (%s) for user %d",
+		currentUserID, c.GetString("username"), key.ID, key.Prefix, userID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": key,
+		"key":     rawKey,
+		"message": "Сохраните ключ: он показывается только один раз",
+	})
+}
+
+func (h *APIKeyHandler) revokeKey(c *gin.Context, userID int) {
+	keyID, err := strconv.Atoi(c.Param("keyId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID ключа"})
+		return
+	}
+
+	currentUserID := c.GetInt("user_id")
+	revoked, err := h.apiKeyRepo.Revoke(keyID, userID, currentUserID)
+	if err != nil {
+		log.Printf("Failed to revoke API key %d: %v", keyID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось отозвать API ключ"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API ключ не найден или уже отозван"})
+		return
+	}
+
+	logAudit(h.auditLogRepo, c, repositories.ActionRevokeAPIKey, &userID, map[string]interface{}{
+		"api_key_id": keyID,
+	})
+
+	log.Printf("AUDIT: User %d (%s) revoked API key %d of user %d",
+		currentUserID, c.GetString("username"), keyID, userID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "API ключ отозван"})
+}
@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/services"
+	"github.com/UAssylbek/central-reporting/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// logAudit записывает действие текущего пользователя в журнал аудита;
+// при входе администратора под пользователем запись атрибутируется обоим
+func logAudit(auditLogRepo *repositories.AuditLogRepository, c *gin.Context, action string, targetUserID *int, details map[string]interface{}) {
+	if err := auditLogRepo.LogImpersonated(
+		auth.ImpersonatorID(c),
+		c.GetInt("user_id"),
+		action,
+		targetUserID,
+		details,
+		c.ClientIP(),
+		c.Request.UserAgent(),
+	); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
+
+// logUserChanges записывает изменения пользователя: diff полей одной записью action,
+// блокировку и разблокировку - отдельными действиями
+func logUserChanges(auditLogRepo *repositories.AuditLogRepository, c *gin.Context, targetUserID int, action string, changes repositories.UserChanges) {
+	for _, record := range changes.AuditRecords(action) {
+		logAudit(auditLogRepo, c, record.Action, &targetUserID, record.Details)
+	}
+}
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+	maxAuditExportRows   = 50000
+)
+
+// AuditHandler просмотр и выгрузка журнала аудита
+type AuditHandler struct {
+	auditLogRepo *repositories.AuditLogRepository
+	userRepo     *repositories.UserRepository
+	auditChain   *services.AuditChainService
+	outbox       *services.AuditDispatcher
+}
+
+// NewAuditHandler создает новый handler
+func NewAuditHandler(
+	auditLogRepo *repositories.AuditLogRepository,
+	userRepo *repositories.UserRepository,
+	auditChain *services.AuditChainService,
+	outbox *services.AuditDispatcher,
+) *AuditHandler {
+	return &AuditHandler{
+		auditLogRepo: auditLogRepo,
+		userRepo:     userRepo,
+		auditChain:   auditChain,
+		outbox:       outbox,
+	}
+}
+
+// ListAudit godoc
+// @Summary Журнал аудита
+// @Description Записи журнала с фильтрами и курсорной пагинацией, новые первыми. Для следующей страницы передайте next_cursor в cursor
+// @Tags audit
+// @Produce json
+// @Security BearerAuth
+// @Param actor_id query int false "Кто выполнил действие"
+// @Param target_id query int false "Над кем выполнено действие"
+// @Param action query string false "Действия через запятую (login,update_user)"
+// @Param from query string false "С даты (2006-01-02 или RFC3339)"
+// @Param to query string false "По дату включительно (2006-01-02) или до момента (RFC3339)"
+// @Param ip query string false "IP адрес или подсеть CIDR"
+// @Param cursor query int false "next_cursor предыдущей страницы"
+// @Param limit query int false "Размер страницы" default(50) maximum(200)
+// @Success 200 {object} repositories.AuditLogPage "Страница журнала"
+// @Failure 400 {object} map[string]string "Неверные фильтры"
+// @Failure 403 {object} map[string]string "Недостаточно прав"
+// @Router /audit [get]
+func (h *AuditHandler) ListAudit(c *gin.Context) {
+	filter, ok := parseAuditFilter(c)
+	if !ok {
+		return
+	}
+	h.writePage(c, filter)
+}
+
+// ListUserAudit godoc
+// @Summary История пользователя
+// @Description Записи журнала, где пользователь - автор или объект действия. Фильтры и пагинация как у /audit
+// @Tags audit
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param action query string false "Действия через запятую"
+// @Param from query string false "С даты"
+// @Param to query string false "По дату"
+// @Param ip query string false "IP адрес или подсеть CIDR"
+// @Param cursor query int false "next_cursor предыдущей страницы"
+// @Param limit query int false "Размер страницы" default(50) maximum(200)
+// @Success 200 {object} repositories.AuditLogPage "Страница журнала"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Router /users/{id}/audit [get]
+func (h *AuditHandler) ListUserAudit(c *gin.Context) {
+	filter, ok := h.parseUserAuditFilter(c)
+	if !ok {
+		return
+	}
+	h.writePage(c, filter)
+}
+
+// ExportAudit godoc
+// @Summary Выгрузка журнала аудита
+// @Description Выгружает отфильтрованные записи (фильтры как у /audit, не более 50000 строк) в CSV или XLSX
+// @Tags audit
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Security BearerAuth
+// @Param format query string false "csv или xlsx" default(csv)
+// @Success 200 {file} file "Файл выгрузки"
+// @Failure 400 {object} map[string]string "Неверные фильтры или формат"
+// @Router /audit/export [get]
+func (h *AuditHandler) ExportAudit(c *gin.Context) {
+	filter, ok := parseAuditFilter(c)
+	if !ok {
+		return
+	}
+	h.export(c, filter, "audit")
+}
+
+// ExportUserAudit godoc
+// @Summary Выгрузка истории пользователя
+// @Description Выгружает историю пользователя (фильтры как у /users/{id}/audit) в CSV или XLSX
+// @Tags audit
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param format query string false "csv или xlsx" default(csv)
+// @Success 200 {file} file "Файл выгрузки"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Router /users/{id}/audit/export [get]
+func (h *AuditHandler) ExportUserAudit(c *gin.Context) {
+	filter, ok := h.parseUserAuditFilter(c)
+	if !ok {
+		return
+	}
+	h.export(c, filter, fmt.Sprintf("audit_user_%d", filter.ParticipantID))
+}
+
+// VerifyAudit godoc
+// @Summary Проверка целостности журнала аудита
+// @Description Проходит цепочку хешей журнала и подписанные контрольные точки; valid=false и break - первое нарушение (изменённая, удалённая или вставленная запись)
+// @Tags audit
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} services.AuditChainReport "Результат проверки"
+// @Failure 403 {object} map[string]string "Недостаточно прав"
+// @Router /audit/verify [get]
+func (h *AuditHandler) VerifyAudit(c *gin.Context) {
+	report, err := h.auditChain.Verify()
+	if err != nil {
+		log.Printf("Failed to verify audit log: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось проверить журнал аудита"})
+		return
+	}
+
+	if !report.Valid {
+		log.Printf("AUDIT: Audit log integrity check by user %d failed at entry %d: %s",
+			c.GetInt("user_id"), report.Break.EntryID, report.Break.Reason)
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// GetAuditOutbox godoc
+// @Summary Очередь доставки журнала аудита
+// @Description Недоставленные записи по получателям (SIEM): ждущие доставки, исчерпавшие попытки (exhausted - не отправляются, пока их не вернут в очередь командой audit_outbox -requeue) и выгруженные в архив до доставки
+// @Tags audit
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Состояние очереди"
+// @Failure 403 {object} map[string]string "Недостаточно прав"
+// @Router /audit/outbox [get]
+func (h *AuditHandler) GetAuditOutbox(c *gin.Context) {
+	status, err := h.outbox.Status()
+	if err != nil {
+		log.Printf("Failed to get audit outbox status: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить состояние очереди доставки"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sinks": status})
+}
+
+func (h *AuditHandler) writePage(c *gin.Context, filter repositories.AuditLogFilter) {
+	page, err := h.auditLogRepo.QueryPage(filter)
+	if err != nil {
+		log.Printf("Failed to query audit log: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить журнал аудита"})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func (h *AuditHandler) export(c *gin.Context, filter repositories.AuditLogFilter, name string) {
+	format := c.DefaultQuery("format", utils.ExportFormatCSV)
+	contentType, ok := utils.ExportContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Формат выгрузки: csv или xlsx"})
+		return
+	}
+
+	filter.Limit = maxAuditExportRows + 1
+	entries, err := h.auditLogRepo.Query(filter)
+	if err != nil {
+		log.Printf("Failed to query audit log for export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить журнал аудита"})
+		return
+	}
+	if len(entries) > maxAuditExportRows {
+		entries = entries[:maxAuditExportRows]
+		c.Header("X-Export-Truncated", "true")
+	}
+
+	logAudit(h.auditLogRepo, c, repositories.ActionExportAudit, nil, map[string]interface{}{
+		"format":  format,
+		"rows":    len(entries),
+		"filters": c.Request.URL.RawQuery,
+	})
+
+	filename := fmt.Sprintf("%s_%s.%s", name, time.Now().Format("20060102_150405"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	writer, err := utils.NewTableWriter(format, c.Writer, "Журнал аудита")
+	if err == nil {
+		err = writer.WriteRow(auditExportHeader)
+	}
+	for i := 0; err == nil && i < len(entries); i++ {
+		err = writer.WriteRow(auditExportRow(entries[i]))
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		// Заголовки уже отправлены - остаётся только записать ошибку в лог
+		log.Printf("Failed to write audit export: %v", err)
+	}
+}
+
+var auditExportHeader = []string{
+	"ID", "Дата", "Автор (логин)", "Автор (ФИО)", "Действие", "Пользователь (логин)", "Пользователь (ФИО)",
+	"Вход под пользователем (администратор)", "IP", "User-Agent", "Детали",
+}
+
+func auditExportRow(entry repositories.AuditLogView) []string {
+	details := ""
+	if len(entry.Details) > 0 {
+		if data, err := json.Marshal(entry.Details); err == nil {
+			details = string(data)
+		}
+	}
+
+	return []string{
+		strconv.Itoa(entry.ID),
+		entry.CreatedAt.Format("2006-01-02 15:04:05"),
+		entry.ActorUsername.String,
+		entry.ActorFullName.String,
+		entry.Action,
+		entry.TargetUsername.String,
+		entry.TargetFullName.String,
+		entry.ImpersonatorUsername.String,
+		entry.IPAddress.String,
+		entry.UserAgent.String,
+		details,
+	}
+}
+
+// parseUserAuditFilter фильтр истории пользователя из пути (пользователь должен существовать;
+// удалённый в корзину тоже подходит - его историю запрашивают как раз после удаления)
+func (h *AuditHandler) parseUserAuditFilter(c *gin.Context) (repositories.AuditLogFilter, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidUserID})
+		return repositories.AuditLogFilter{}, false
+	}
+	exists, err := h.userRepo.ExistsIncludingDeleted(id)
+	if err != nil {
+		log.Printf("Failed to check user %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось проверить пользователя"})
+		return repositories.AuditLogFilter{}, false
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": errUserNotFound})
+		return repositories.AuditLogFilter{}, false
+	}
+
+	filter, ok := parseAuditFilter(c)
+	filter.ParticipantID = id
+	return filter, ok
+}
+
+// parseAuditFilter разбирает фильтры журнала из query-параметров
+func parseAuditFilter(c *gin.Context) (repositories.AuditLogFilter, bool) {
+	filter := repositories.AuditLogFilter{Limit: defaultAuditPageSize}
+	fail := func(message string) (repositories.AuditLogFilter, bool) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return filter, false
+	}
+
+	ints := []struct {
+		param string
+		dest  *int
+	}{
+		{"actor_id", &filter.ActorID},
+		{"target_id", &filter.TargetUserID},
+		{"cursor", &filter.Before},
+	}
+	for _, p := range ints {
+		if value := c.Query(p.param); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return fail(fmt.Sprintf("Неверное значение %s", p.param))
+			}
+			*p.dest = n
+		}
+	}
+
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxAuditPageSize {
+			return fail(fmt.Sprintf("limit должен быть от 1 до %d", maxAuditPageSize))
+		}
+		filter.Limit = n
+	}
+
+	for _, value := range c.QueryArray("action") {
+		for _, action := range strings.Split(value, ",") {
+			if action = strings.TrimSpace(action); action != "" {
+				filter.Actions = append(filter.Actions, action)
+			}
+		}
+	}
+
+	var err error
+	if filter.From, err = parseAuditTime(c.Query("from"), false); err != nil {
+		return fail("Неверная дата from")
+	}
+	if filter.To, err = parseAuditTime(c.Query("to"), true); err != nil {
+		return fail("Неверная дата to")
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.To.After(filter.From) {
+		return fail("Дата to должна быть позже from")
+	}
+
+	if ip := strings.TrimSpace(c.Query("ip")); ip != "" {
+		if net.ParseIP(ip) == nil {
+			if _, _, err := net.ParseCIDR(ip); err != nil {
+				return fail("Неверный IP адрес или подсеть")
+			}
+		}
+		filter.IP = ip
+	}
+
+	return filter, true
+}
+
+// parseAuditTime разбирает RFC3339 или дату 2006-01-02 (для границы "по" дата включается целиком)
+func parseAuditTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+var auditViewCols = []string{"id", "user_id", "action", "target_user_id", "impersonator_id", "details", "ip_address", "user_agent",
+	"created_at", "actor_username", "actor_full_name", "target_username", "target_full_name", "impersonator_username"}
+
+func setupAuditTest(t *testing.T, role models.UserRole) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := builtinPermissionStore()
+	auditLogRepo := repositories.NewAuditLogRepository(sqlxDB)
+	auditChain, err := services.NewAuditChainService(auditLogRepo, "")
+	if err != nil {
+		t.Fatalf("Failed to create audit chain service: %v", err)
+	}
+	handler := NewAuditHandler(auditLogRepo, repositories.NewUserRepository(sqlxDB), auditChain, services.NewAuditDispatcher(auditLogRepo, 20))
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", 1)
+		c.Set("role", role)
+		c.Next()
+	})
+	router.Use(auth.LoadPermissions(store))
+	router.Use(auth.RequirePermission(auth.PermAuditRead))
+	router.GET("/audit", handler.ListAudit)
+	router.GET("/audit/export", handler.ExportAudit)
+	router.GET("/users/:id/audit", handler.ListUserAudit)
+	return router, mock
+}
+
+func auditViewRows(ids ...int) *sqlmock.Rows {
+	rows := sqlmock.NewRows(auditViewCols)
+	for _, id := range ids {
+		rows.AddRow(id, 1, repositories.ActionUpdateUser, 5, nil, `{"fields":["position"]}`, "10.0.0.7", "Mozilla",
+			time.Now(), "admin", "Администратор", "ivanov", "Иванов Иван", nil)
+	}
+	return rows
+}
+
+func TestListAudit_FiltersAndCursor(t *testing.T) {
+	router, mock := setupAuditTest(t, models.RoleAdmin)
+
+	// limit=2: запрашивается на одну запись больше, чтобы узнать о следующей странице
+	mock.ExpectQuery("FROM audit_log a(.+)LEFT JOIN users actor(.+)WHERE a.user_id = \\$1 AND a.action = ANY\\(\\$2\\) AND a.ip_address <<= \\$3::inet AND a.id < \\$4(.+)ORDER BY a.id DESC").
+		WithArgs(1, sqlmock.AnyArg(), "10.0.0.0/24", 100, 3).
+		WillReturnRows(auditViewRows(99, 98, 97))
+
+	req, _ := http.NewRequest("GET", "/audit?actor_id=1&action=update_user,login&ip=10.0.0.0/24&cursor=100&limit=2", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `"next_cursor":98`) || strings.Contains(body, `"id":97`) {
+		t.Errorf("Unexpected page: %s", body)
+	}
+	if !strings.Contains(body, `"target_full_name":"Иванов Иван"`) {
+		t.Errorf("Target name is not joined: %s", body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestListAudit_InvalidFilters(t *testing.T) {
+	router, _ := setupAuditTest(t, models.RoleAdmin)
+
+	for _, query := range []string{"ip=not-an-ip", "from=yesterday", "limit=1000", "from=2025-02-01&to=2025-01-01", "actor_id=abc"} {
+		req, _ := http.NewRequest("GET", "/audit?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+		}
+	}
+}
+
+// TestListUserAudit_DeletedUser проверяет, что история пользователя из корзины доступна
+func TestListUserAudit_DeletedUser(t *testing.T) {
+	router, mock := setupAuditTest(t, models.RoleAdmin)
+
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM users WHERE id = \\$1\\)").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery("FROM audit_log a(.+)WHERE \\(a.user_id = \\$1 OR a.target_user_id = \\$1\\)").
+		WithArgs(5, defaultAuditPageSize+1).
+		WillReturnRows(auditViewRows(10))
+
+	req, _ := http.NewRequest("GET", "/users/5/audit", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestListUserAudit_NotFound(t *testing.T) {
+	router, mock := setupAuditTest(t, models.RoleAdmin)
+
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM users WHERE id = \\$1\\)").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	req, _ := http.NewRequest("GET", "/users/5/audit", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestListAudit_ForbiddenWithoutPermission(t *testing.T) {
+	router, _ := setupAuditTest(t, models.RoleModerator)
+
+	req, _ := http.NewRequest("GET", "/users/5/audit", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+}
+
+func TestExportAudit_CSV(t *testing.T) {
+	router, mock := setupAuditTest(t, models.RoleAdmin)
+
+	mock.ExpectQuery("FROM audit_log a(.+)WHERE a.created_at >= \\$1 AND a.created_at < \\$2").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), maxAuditExportRows+1).
+		WillReturnRows(auditViewRows(3, 2))
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(1, repositories.ActionExportAudit, nil, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	req, _ := http.NewRequest("GET", "/audit/export?from=2025-01-01&to=2025-01-31", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Errorf("Unexpected Content-Type: %s", w.Header().Get("Content-Type"))
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected header and 2 rows, got %d lines", len(lines))
+	}
+	if !strings.Contains(lines[1], "Иванов Иван") {
+		t.Errorf("Unexpected row: %s", lines[1])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -1,30 +1,51 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
 
 	"github.com/UAssylbek/central-reporting/internal/auth"
 	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/policy"
 	"github.com/UAssylbek/central-reporting/internal/repositories"
 	"github.com/UAssylbek/central-reporting/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
 type AuthHandler struct {
-	userRepo     *repositories.UserRepository
-	jwtSecret    string
-	auditLogRepo *repositories.AuditLogRepository
+	userRepo       *repositories.UserRepository
+	tokens         *auth.KeyManager
+	auditLogRepo   *repositories.AuditLogRepository
+	authenticators []auth.Authenticator
+	orgGrantRepo   *repositories.OrganizationGrantRepository
+	customFields   *policy.CustomFieldSchema
 }
 
-func NewAuthHandler(userRepo *repositories.UserRepository, jwtSecret string, auditLogRepo *repositories.AuditLogRepository) *AuthHandler {
+func NewAuthHandler(userRepo *repositories.UserRepository, tokens *auth.KeyManager, auditLogRepo *repositories.AuditLogRepository) *AuthHandler {
 	return &AuthHandler{
-		userRepo:     userRepo,
-		jwtSecret:    jwtSecret,
-		auditLogRepo: auditLogRepo,
+		userRepo:       userRepo,
+		tokens:         tokens,
+		auditLogRepo:   auditLogRepo,
+		authenticators: []auth.Authenticator{auth.NewPasswordAuthenticator(userRepo)},
 	}
 }
 
+// UseAuthenticators задаёт цепочку способов входа (по умолчанию - только локальный пароль)
+func (h *AuthHandler) UseAuthenticators(authenticators ...auth.Authenticator) {
+	h.authenticators = authenticators
+}
+
+// UseOrganizationGrants включает в /auth/me действующие временные доступы к организациям
+func (h *AuthHandler) UseOrganizationGrants(orgGrantRepo *repositories.OrganizationGrantRepository) {
+	h.orgGrantRepo = orgGrantRepo
+}
+
+// UseCustomFields скрывает в ответах дополнительные поля, не видимые роли пользователя
+func (h *AuthHandler) UseCustomFields(schema *policy.CustomFieldSchema) {
+	h.customFields = schema
+}
+
 // Login godoc
 // @Summary Вход в систему
 // @Description Аутентификация пользователя и получение JWT токена
@@ -47,76 +68,23 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	log.Printf("Login attempt - Username: %s, Password length: %d", req.Username, len(req.Password))
 
-	user, err := h.userRepo.GetByUsername(req.Username)
+	user, method, err := auth.Authenticate(h.authenticators, req.Username, req.Password)
 	if err != nil {
-		log.Printf("Database error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
-		return
-	}
-	if user == nil {
-		log.Printf("User not found: %s", req.Username)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверные учетные данные"})
-		return
-	}
-
-	// ✅ ДОБАВИТЬ: Проверка на блокировку пользователя
-	if !user.IsActive {
-		log.Printf("User %s is blocked", user.Username)
-
-		reason := "Ваш аккаунт заблокирован"
-		if user.BlockedReason.Valid && user.BlockedReason.String != "" {
-			reason = user.BlockedReason.String
-		}
-
-		c.JSON(http.StatusForbidden, gin.H{
-			"error":   reason,
-			"blocked": true,
-		})
-		return
-	}
-
-	hasPassword := user.Password.Valid && user.Password.String != ""
-	log.Printf("User found - ID: %d, IsFirstLogin: %v, RequirePasswordChange: %v, HasPassword: %v",
-		user.ID, user.IsFirstLogin, user.RequirePasswordChange, hasPassword)
-
-	// Специальная логика для первого входа с требованием смены пароля
-	if user.IsFirstLogin && user.RequirePasswordChange {
-		log.Printf("First login with password change required")
-
-		// Если пароль в БД пустой - пропускаем любой введённый пароль
-		if hasPassword {
-			log.Printf("Checking password (password exists in DB)")
-			// Если пароль задан - проверяем его
-			isValid, err := h.userRepo.CheckPassword(user.ID, req.Password)
-			if err != nil {
-				log.Printf("Error checking password: %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки пароля"})
-				return
-			}
-			if !isValid {
-				log.Printf("Password check failed")
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверные учетные данные"})
-				return
-			}
-			log.Printf("Password check passed")
-		} else {
-			log.Printf("Password is empty in DB - allowing login without password check")
-		}
-	} else {
-		log.Printf("Regular login - checking password")
-		// Обычная проверка пароля для всех остальных случаев
-		isValid, err := h.userRepo.CheckPassword(user.ID, req.Password)
-		if err != nil {
-			log.Printf("Error checking password: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки пароля"})
-			return
-		}
-		if !isValid {
-			log.Printf("Password check failed")
+		var blockedErr *auth.BlockedError
+		switch {
+		case errors.Is(err, auth.ErrInvalidCredentials), errors.Is(err, auth.ErrUnknownUser):
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверные учетные данные"})
-			return
+		case errors.As(err, &blockedErr):
+			log.Printf("User %s is blocked", blockedErr.User.Username)
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   blockedErr.Reason(),
+				"blocked": true,
+			})
+		default:
+			log.Printf("Authentication error (%s): %v", method, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
 		}
-		log.Printf("Password check passed")
+		return
 	}
 
 	log.Printf("Updating user activity for user %d", user.ID)
@@ -124,7 +92,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		log.Printf("Failed to update activity: %v", err)
 	}
 
-	token, err := auth.GenerateToken(*user, h.jwtSecret)
+	token, err := h.tokens.GenerateToken(*user)
 	if err != nil {
 		log.Printf("Failed to generate JWT: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать токен"})
@@ -132,11 +100,15 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Audit log: успешный вход
-	if err := h.auditLogRepo.Log(user.ID, "login", nil, nil, c.ClientIP(), c.Request.UserAgent()); err != nil {
+	if err := h.auditLogRepo.Log(user.ID, "login", nil, map[string]interface{}{
+		"method": method,
+	}, c.ClientIP(), c.Request.UserAgent()); err != nil {
 		log.Printf("Failed to write audit log: %v", err)
 	}
 
 	log.Printf("Login successful for user: %s (ID: %d)", user.Username, user.ID)
+	// Права роли при входе ещё не загружены: поля скрываются только по роли
+	hideCustomFieldsFrom(h.customFields, policy.CustomFieldViewer{Role: user.Role}, user)
 	c.JSON(http.StatusOK, models.LoginResponse{
 		User:                  *user,
 		Token:                 token,
@@ -146,7 +118,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 // Me godoc
 // @Summary Получить текущего пользователя
-// @Description Возвращает информацию о текущем авторизованном пользователе
+// @Description Возвращает информацию о текущем авторизованном пользователе и его права
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -163,7 +135,31 @@ func (h *AuthHandler) Me(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"user": user})
+	hideCustomFieldsFrom(h.customFields, customFieldViewer(c), user)
+	response := gin.H{
+		"user":        user,
+		"permissions": auth.Permissions(c).List(),
+	}
+
+	// Временные доступы действуют вместе с available_organizations
+	if h.orgGrantRepo != nil {
+		orgs, err := h.orgGrantRepo.ActiveOrganizationIDs(user.ID)
+		if err != nil {
+			log.Printf("Failed to load organization grants for user %d: %v", user.ID, err)
+		} else {
+			response["temporary_organizations"] = orgs
+		}
+	}
+
+	// При входе под пользователем фронтенд показывает, кто на самом деле работает
+	if impersonatorID := auth.ImpersonatorID(c); impersonatorID != nil {
+		response["impersonator"] = gin.H{
+			"id":       *impersonatorID,
+			"username": c.GetString("impersonator_username"),
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 // Logout godoc
@@ -176,6 +172,12 @@ func (h *AuthHandler) Me(c *gin.Context) {
 // @Success 200 {object} map[string]string "Успешный выход"
 // @Router /auth/logout [post]
 func (h *AuthHandler) Logout(c *gin.Context) {
+	// Завершение имперсонации не должно менять статус настоящего пользователя
+	if auth.ImpersonatorID(c) != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Выход выполнен успешно"})
+		return
+	}
+
 	userID, exists := c.Get("user_id")
 	if exists {
 		log.Printf("Logout: Setting user %d as offline", userID.(int))
@@ -277,9 +279,7 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 	}
 
 	// Audit log: смена пароля
-	if err := h.auditLogRepo.Log(userID.(int), "change_password", nil, nil, c.ClientIP(), c.Request.UserAgent()); err != nil {
-		log.Printf("Failed to write audit log: %v", err)
-	}
+	logAudit(h.auditLogRepo, c, repositories.ActionChangePassword, nil, nil)
 
 	log.Printf("AUDIT: User %d (%s) changed their password", userID.(int), user.Username)
 
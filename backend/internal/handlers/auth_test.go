@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/auth"
 	"github.com/UAssylbek/central-reporting/internal/models"
 	"github.com/UAssylbek/central-reporting/internal/repositories"
 	"github.com/gin-gonic/gin"
@@ -29,7 +30,7 @@ func setupAuthTest(t *testing.T) (*gin.Engine, *AuthHandler, sqlmock.Sqlmock) {
 	sqlxDB := sqlx.NewDb(db, "postgres")
 	userRepo := repositories.NewUserRepository(sqlxDB)
 	auditLogRepo := repositories.NewAuditLogRepository(sqlxDB)
-	authHandler := NewAuthHandler(userRepo, testJWTSecret, auditLogRepo)
+	authHandler := NewAuthHandler(userRepo, auth.NewHMACKeyManager(testJWTSecret), auditLogRepo)
 
 	router := gin.New()
 	router.POST("/login", authHandler.Login)
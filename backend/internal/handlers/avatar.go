@@ -10,7 +10,9 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/UAssylbek/central-reporting/internal/auth"
 	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/policy"
 	"github.com/UAssylbek/central-reporting/internal/repositories"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -39,13 +41,31 @@ var allowedExtensions = map[string]bool{
 }
 
 type AvatarHandler struct {
-	userRepo *repositories.UserRepository
+	userRepo     *repositories.UserRepository
+	auditLogRepo *repositories.AuditLogRepository
+	permissions  *auth.PermissionStore
 }
 
-func NewAvatarHandler(userRepo *repositories.UserRepository) *AvatarHandler {
+func NewAvatarHandler(userRepo *repositories.UserRepository, auditLogRepo *repositories.AuditLogRepository, permissions *auth.PermissionStore) *AvatarHandler {
 	// Создаём директорию для аватарок если её нет
 	os.MkdirAll(AvatarDir, 0755)
-	return &AvatarHandler{userRepo: userRepo}
+	return &AvatarHandler{userRepo: userRepo, auditLogRepo: auditLogRepo, permissions: permissions}
+}
+
+// canManageAvatar проверяет право менять аватар по правилу поля avatar_url
+// (без users.read.all - только доступным пользователям)
+func (h *AvatarHandler) canManageAvatar(c *gin.Context, currentUserID, userID int) bool {
+	target := policy.Target{ID: userID, Accessible: true}
+	if currentUserID != userID && !auth.HasPermission(c, auth.PermUsersReadAll) {
+		canAccess, err := h.userRepo.CanModeratorAccessUser(currentUserID, userID)
+		target.Accessible = err == nil && canAccess
+	}
+	if currentUserID != userID {
+		role, err := h.userRepo.GetRole(userID)
+		target.Accessible = target.Accessible && err == nil
+		target.Permissions = h.permissions.Permissions(role)
+	}
+	return policy.CanEdit(policy.Actor{ID: currentUserID, Permissions: auth.Permissions(c)}, target, policy.FieldAvatarURL)
 }
 
 // UploadAvatar загружает аватар пользователя
@@ -58,14 +78,9 @@ func (h *AvatarHandler) UploadAvatar(c *gin.Context) {
 	}
 
 	currentUserID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
-	// Проверка прав доступа
-	if role == models.RoleAdmin {
-		// Админ может загружать аватар для любого пользователя
-		// Продолжаем выполнение
-	} else if currentUserID.(int) != userID {
-		// Не админ пытается загрузить аватар другому пользователю
+	// Проверка прав доступа: чужой аватар - как изменение профиля другого пользователя
+	if !h.canManageAvatar(c, currentUserID.(int), userID) {
 		c.JSON(http.StatusForbidden, gin.H{
 			"error": "Вы можете загружать только свой аватар",
 		})
@@ -193,10 +208,12 @@ func (h *AvatarHandler) UploadAvatar(c *gin.Context) {
 		AvatarURL: &avatarURL, // ✅ Указатель на переменную
 	}
 
-	if err := h.userRepo.Update(userID, updateReq, currentUserID.(int)); err != nil {
+	changes, err := h.userRepo.Update(userID, updateReq, currentUserID.(int))
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось обновить профиль"})
 		return
 	}
+	logUserChanges(h.auditLogRepo, c, userID, repositories.ActionUploadAvatar, changes)
 
 	c.JSON(http.StatusOK, gin.H{"avatar_url": avatarURL})
 }
@@ -211,14 +228,9 @@ func (h *AvatarHandler) DeleteAvatar(c *gin.Context) {
 	}
 
 	currentUserID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	// Проверка прав доступа
-	if role == models.RoleAdmin {
-		// Админ может удалять аватар любого пользователя
-		// Продолжаем выполнение
-	} else if currentUserID.(int) != userID {
-		// Не админ пытается удалить аватар другого пользователя
+	if !h.canManageAvatar(c, currentUserID.(int), userID) {
 		c.JSON(http.StatusForbidden, gin.H{
 			"error": "Вы можете удалять только свой аватар",
 		})
@@ -248,10 +260,12 @@ func (h *AvatarHandler) DeleteAvatar(c *gin.Context) {
 		AvatarURL: &emptyString, // Теперь это указатель!
 	}
 
-	if err := h.userRepo.Update(userID, updateReq, currentUserID.(int)); err != nil {
+	changes, err := h.userRepo.Update(userID, updateReq, currentUserID.(int))
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось обновить профиль"})
 		return
 	}
+	logUserChanges(h.auditLogRepo, c, userID, repositories.ActionDeleteAvatar, changes)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Аватар удалён"})
 }
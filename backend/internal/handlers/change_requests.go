@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/policy"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const changeRequestsLimit = 200
+
+// ChangeRequestHandler рассматривает изменения пользователей, ожидающие подтверждения второго администратора
+type ChangeRequestHandler struct {
+	changeRequestRepo *repositories.ChangeRequestRepository
+	userRepo          *repositories.UserRepository
+	auditLogRepo      *repositories.AuditLogRepository
+	permissions       *auth.PermissionStore
+}
+
+// NewChangeRequestHandler создает новый handler
+func NewChangeRequestHandler(
+	changeRequestRepo *repositories.ChangeRequestRepository,
+	userRepo *repositories.UserRepository,
+	auditLogRepo *repositories.AuditLogRepository,
+	permissions *auth.PermissionStore,
+) *ChangeRequestHandler {
+	return &ChangeRequestHandler{
+		changeRequestRepo: changeRequestRepo,
+		userRepo:          userRepo,
+		auditLogRepo:      auditLogRepo,
+		permissions:       permissions,
+	}
+}
+
+// ListChangeRequests godoc
+// @Summary Запросы на изменение пользователей
+// @Description Возвращает изменения, ожидающие подтверждения (status=pending по умолчанию; all - все)
+// @Tags change-requests
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "pending, approved, rejected или all" default(pending)
+// @Success 200 {object} map[string]interface{} "Список запросов"
+// @Failure 400 {object} map[string]string "Неверный статус"
+// @Failure 403 {object} map[string]string "Недостаточно прав"
+// @Router /change-requests [get]
+func (h *ChangeRequestHandler) ListChangeRequests(c *gin.Context) {
+	status := c.DefaultQuery("status", repositories.ChangeRequestPending)
+	switch status {
+	case repositories.ChangeRequestPending, repositories.ChangeRequestApproved, repositories.ChangeRequestRejected:
+	case "all":
+		status = ""
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный статус запроса"})
+		return
+	}
+
+	requests, err := h.changeRequestRepo.List(status, changeRequestsLimit)
+	if err != nil {
+		log.Printf("Failed to list change requests: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить список запросов"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"change_requests": requests})
+}
+
+// GetChangeRequest godoc
+// @Summary Запрос на изменение
+// @Description Возвращает запрос с отложенными изменениями и значениями до и после
+// @Tags change-requests
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID запроса"
+// @Success 200 {object} map[string]interface{} "Запрос"
+// @Failure 404 {object} map[string]string "Запрос не найден"
+// @Router /change-requests/{id} [get]
+func (h *ChangeRequestHandler) GetChangeRequest(c *gin.Context) {
+	request, ok := h.loadRequest(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"change_request": request})
+}
+
+// ApproveChangeRequest godoc
+// @Summary Подтвердить изменение
+// @Description Применяет отложенные изменения через UserRepository.Update. Подтверждает другой администратор: не автор запроса и не сам изменяемый пользователь, с правом на каждое изменение запроса
+// @Tags change-requests
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID запроса"
+// @Param request body models.ReviewChangeRequest false "Комментарий"
+// @Success 200 {object} map[string]interface{} "Изменения применены"
+// @Failure 403 {object} map[string]interface{} "Нельзя подтвердить собственный запрос или недостаточно прав для изменений"
+// @Failure 404 {object} map[string]string "Запрос не найден"
+// @Failure 409 {object} map[string]string "Запрос уже рассмотрен"
+// @Router /change-requests/{id}/approve [post]
+func (h *ChangeRequestHandler) ApproveChangeRequest(c *gin.Context) {
+	request, ok := h.loadPendingRequest(c)
+	if !ok {
+		return
+	}
+
+	currentUserID := c.GetInt("user_id")
+	if request.RequestedBy.Valid && int(request.RequestedBy.Int64) == currentUserID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нельзя подтвердить собственный запрос"})
+		return
+	}
+	if request.TargetUserID == currentUserID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нельзя подтвердить изменение своей учётной записи"})
+		return
+	}
+
+	changes, err := request.UpdateRequest()
+	if err != nil {
+		log.Printf("Failed to decode change request %d: %v", request.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось прочитать запрос"})
+		return
+	}
+	// Подтверждающий должен сам иметь право на каждое изменение запроса
+	target, ok := loadPolicyTarget(c, h.userRepo, h.permissions, currentUserID, request.TargetUserID)
+	if !ok {
+		return
+	}
+	if decision := policy.EvaluateUpdate(policy.Actor{ID: currentUserID, Permissions: auth.Permissions(c)}, target, changes); !decision.OK() {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":         "Недостаточно прав для подтверждения изменений",
+			"denied_fields": decision.Denied,
+		})
+		return
+	}
+	// Подтверждающий должен сам иметь права назначаемой роли
+	if changes.Role != "" && !auth.Permissions(c).Contains(h.permissions.Permissions(changes.Role)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нельзя назначить роль с правами, которых нет у вас"})
+		return
+	}
+
+	var req models.ReviewChangeRequest
+	_ = c.ShouldBindJSON(&req)
+
+	reviewed, ok := h.review(c, request.ID, repositories.ChangeRequestApproved, req.Comment)
+	if !ok {
+		return
+	}
+
+	userChanges, err := h.userRepo.Update(request.TargetUserID, changes, currentUserID)
+	if err != nil {
+		log.Printf("Failed to apply change request %d: %v", request.ID, err)
+		if err := h.changeRequestRepo.Reopen(request.ID); err != nil {
+			log.Printf("Failed to reopen change request %d: %v", request.ID, err)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errFailedToUpdateUser})
+		return
+	}
+
+	h.logReview(c, repositories.ActionChangeApproved, reviewed)
+	logUserChanges(h.auditLogRepo, c, reviewed.TargetUserID, repositories.ActionUpdateUser, userChanges)
+	log.Printf("AUDIT: User %d approved change request %d for user %d", currentUserID, reviewed.ID, reviewed.TargetUserID)
+
+	user, err := h.userRepo.GetByID(reviewed.TargetUserID)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"change_request": reviewed})
+		return
+	}
+	user.Password = models.NullString{}
+	c.JSON(http.StatusOK, gin.H{"change_request": reviewed, "user": user})
+}
+
+// RejectChangeRequest godoc
+// @Summary Отклонить изменение
+// @Description Отклоняет отложенные изменения; автор может так отозвать свой запрос
+// @Tags change-requests
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID запроса"
+// @Param request body models.ReviewChangeRequest false "Причина отклонения"
+// @Success 200 {object} map[string]interface{} "Запрос отклонён"
+// @Failure 404 {object} map[string]string "Запрос не найден"
+// @Failure 409 {object} map[string]string "Запрос уже рассмотрен"
+// @Router /change-requests/{id}/reject [post]
+func (h *ChangeRequestHandler) RejectChangeRequest(c *gin.Context) {
+	request, ok := h.loadPendingRequest(c)
+	if !ok {
+		return
+	}
+
+	var req models.ReviewChangeRequest
+	_ = c.ShouldBindJSON(&req)
+
+	reviewed, ok := h.review(c, request.ID, repositories.ChangeRequestRejected, req.Comment)
+	if !ok {
+		return
+	}
+
+	h.logReview(c, repositories.ActionChangeRejected, reviewed)
+	log.Printf("AUDIT: User %d rejected change request %d for user %d", c.GetInt("user_id"), reviewed.ID, reviewed.TargetUserID)
+
+	c.JSON(http.StatusOK, gin.H{"change_request": reviewed})
+}
+
+// loadRequest разбирает ID из пути и загружает запрос
+func (h *ChangeRequestHandler) loadRequest(c *gin.Context) (*repositories.ChangeRequest, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID запроса"})
+		return nil, false
+	}
+
+	request, err := h.changeRequestRepo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Запрос не найден"})
+			return nil, false
+		}
+		log.Printf("Failed to load change request %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить запрос"})
+		return nil, false
+	}
+	return request, true
+}
+
+func (h *ChangeRequestHandler) loadPendingRequest(c *gin.Context) (*repositories.ChangeRequest, bool) {
+	request, ok := h.loadRequest(c)
+	if !ok {
+		return nil, false
+	}
+	if request.Status != repositories.ChangeRequestPending {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Запрос уже рассмотрен (%s)", request.Status)})
+		return nil, false
+	}
+	return request, true
+}
+
+// review атомарно переводит запрос из pending (одновременное решение двух администраторов - 409)
+func (h *ChangeRequestHandler) review(c *gin.Context, id int, status, comment string) (*repositories.ChangeRequest, bool) {
+	reviewed, err := h.changeRequestRepo.Review(id, status, c.GetInt("user_id"), utils.SanitizeString(comment))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Запрос уже рассмотрен"})
+			return nil, false
+		}
+		log.Printf("Failed to review change request %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось сохранить решение"})
+		return nil, false
+	}
+	return reviewed, true
+}
+
+func (h *ChangeRequestHandler) logReview(c *gin.Context, action string, request *repositories.ChangeRequest) {
+	targetUserID := request.TargetUserID
+	logAudit(h.auditLogRepo, c, action, &targetUserID, map[string]interface{}{
+		"change_request_id": request.ID,
+		"requested_by":      request.RequestedBy,
+		"rules":             request.Rules,
+		"diff":              request.Diff,
+		"comment":           request.ReviewComment,
+	})
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+var changeRequestCols = []string{"id", "target_user_id", "requested_by", "rules", "changes", "diff", "status",
+	"reviewed_by", "review_comment", "reviewed_at", "created_at"}
+
+// roleReviewer собственная роль, которая может подтверждать запросы, но не менять роли
+const roleReviewer models.UserRole = "reviewer"
+
+func setupChangeRequestTest(t *testing.T, currentUserID int) (*gin.Engine, sqlmock.Sqlmock) {
+	return setupChangeRequestTestAs(t, currentUserID, models.RoleAdmin)
+}
+
+func setupChangeRequestTestAs(t *testing.T, currentUserID int, role models.UserRole) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := auth.NewPermissionStore(staticRoles{
+		models.RoleAdmin: builtinPermissionStore().Permissions(models.RoleAdmin).List(),
+		models.RoleUser:  builtinPermissionStore().Permissions(models.RoleUser).List(),
+		roleReviewer:     {auth.PermUsersRead, auth.PermUsersReadAll, auth.PermUsersApproveChanges},
+	})
+	handler := NewChangeRequestHandler(
+		repositories.NewChangeRequestRepository(sqlxDB),
+		repositories.NewUserRepository(sqlxDB),
+		repositories.NewAuditLogRepository(sqlxDB),
+		store,
+	)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", currentUserID)
+		c.Set("role", role)
+		c.Next()
+	})
+	router.Use(auth.LoadPermissions(store))
+	router.Use(auth.RequirePermission(auth.PermUsersApproveChanges))
+	router.POST("/change-requests/:id/approve", handler.ApproveChangeRequest)
+	return router, mock
+}
+
+// changeRequestRow запрос администратора 1 на повышение пользователя 5 до admin
+func changeRequestRow(status string, reviewedBy interface{}) *sqlmock.Rows {
+	return sqlmock.NewRows(changeRequestCols).AddRow(
+		7, 5, 1, "{role_admin}", `{"role":"admin"}`, `{"role":{"old":"user","new":"admin"}}`, status,
+		reviewedBy, nil, nil, time.Now(),
+	)
+}
+
+func TestApproveChangeRequest_AppliesChanges(t *testing.T) {
+	router, mock := setupChangeRequestTest(t, 2)
+
+	mock.ExpectQuery("SELECT (.+) FROM user_change_requests WHERE id = \\$1").
+		WithArgs(7).
+		WillReturnRows(changeRequestRow(repositories.ChangeRequestPending, nil))
+	mock.ExpectQuery("SELECT role FROM users WHERE id = \\$1").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("user"))
+	mock.ExpectQuery("UPDATE user_change_requests(.+)WHERE id = \\$1 AND status = 'pending'").
+		WithArgs(7, repositories.ChangeRequestApproved, 2, "").
+		WillReturnRows(changeRequestRow(repositories.ChangeRequestApproved, 2))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "role", "is_active"}).AddRow(5, "ivanov", "user", true))
+	mock.ExpectExec("UPDATE users SET role = \\$1").
+		WithArgs(models.RoleAdmin, 2, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "role", "is_active"}).AddRow(5, "ivanov", "admin", true))
+	mock.ExpectCommit()
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(2, repositories.ActionChangeApproved, 5, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	// diff роли - отдельной записью update_user
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(2, repositories.ActionUpdateUser, 5, []byte(`{"changes":{"role":{"old":"user","new":"admin"}}}`), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "role", "is_active"}).AddRow(5, "ivanov", "admin", true))
+
+	req, _ := http.NewRequest("POST", "/change-requests/7/approve", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestApproveChangeRequest_RequiresSecondAdmin(t *testing.T) {
+	router, mock := setupChangeRequestTest(t, 1)
+
+	mock.ExpectQuery("SELECT (.+) FROM user_change_requests WHERE id = \\$1").
+		WithArgs(7).
+		WillReturnRows(changeRequestRow(repositories.ChangeRequestPending, nil))
+
+	req, _ := http.NewRequest("POST", "/change-requests/7/approve", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestApproveChangeRequest_ApproverNeedsPermissions проверяет, что подтверждающий без права менять роли
+// не может подтвердить повышение роли
+func TestApproveChangeRequest_ApproverNeedsPermissions(t *testing.T) {
+	router, mock := setupChangeRequestTestAs(t, 2, roleReviewer)
+
+	mock.ExpectQuery("SELECT (.+) FROM user_change_requests WHERE id = \\$1").
+		WithArgs(7).
+		WillReturnRows(changeRequestRow(repositories.ChangeRequestPending, nil))
+	mock.ExpectQuery("SELECT role FROM users WHERE id = \\$1").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("user"))
+
+	req, _ := http.NewRequest("POST", "/change-requests/7/approve", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "denied_fields") {
+		t.Errorf("Expected denied fields in response: %s", w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestApproveChangeRequest_AlreadyReviewed(t *testing.T) {
+	router, mock := setupChangeRequestTest(t, 2)
+
+	mock.ExpectQuery("SELECT (.+) FROM user_change_requests WHERE id = \\$1").
+		WithArgs(7).
+		WillReturnRows(changeRequestRow(repositories.ChangeRequestRejected, 3))
+
+	req, _ := http.NewRequest("POST", "/change-requests/7/approve", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/policy"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const (
+	errInvalidCustomFieldID    = "Неверный ID поля"
+	errCustomFieldNotFound     = "Дополнительное поле не найдено"
+	errFailedToGetCustomFields = "Не удалось получить дополнительные поля"
+)
+
+// Ключ дополнительного поля: латиница в нижнем регистре, цифры и подчёркивание
+var customFieldKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// CustomFieldHandler управляет описаниями дополнительных полей профиля
+type CustomFieldHandler struct {
+	customFieldRepo *repositories.CustomFieldRepository
+	auditLogRepo    *repositories.AuditLogRepository
+	schema          *policy.CustomFieldSchema
+	permissions     *auth.PermissionStore
+}
+
+// NewCustomFieldHandler создает новый handler
+func NewCustomFieldHandler(
+	customFieldRepo *repositories.CustomFieldRepository,
+	auditLogRepo *repositories.AuditLogRepository,
+	schema *policy.CustomFieldSchema,
+	permissions *auth.PermissionStore,
+) *CustomFieldHandler {
+	return &CustomFieldHandler{
+		customFieldRepo: customFieldRepo,
+		auditLogRepo:    auditLogRepo,
+		schema:          schema,
+		permissions:     permissions,
+	}
+}
+
+// ListCustomFields godoc
+// @Summary Дополнительные поля профиля
+// @Description Описания дополнительных полей (custom_fields), видимых роли текущего пользователя, в порядке отображения.
+// @Description По ним интерфейс строит поля ввода; с правом custom_fields.manage - все поля
+// @Tags custom-fields
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Список полей"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /custom-fields [get]
+func (h *CustomFieldHandler) ListCustomFields(c *gin.Context) {
+	definitions, err := h.schema.Definitions()
+	if err != nil {
+		log.Printf("Failed to list custom fields: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errFailedToGetCustomFields})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"custom_fields": policy.VisibleCustomFields(definitions, customFieldViewer(c)),
+		"types":         models.CustomFieldTypes,
+	})
+}
+
+// CreateCustomField godoc
+// @Summary Создать дополнительное поле
+// @Description Описывает новый ключ custom_fields. Ключ: латиница в нижнем регистре, цифры и _, не меняется после создания.
+// @Description Тип enum требует allowed_values; visible_to - роли, которым поле видно (пусто - всем)
+// @Tags custom-fields
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CustomFieldRequest true "Описание поля"
+// @Success 201 {object} map[string]interface{} "Поле создано"
+// @Failure 400 {object} map[string]string "Неверные параметры"
+// @Failure 409 {object} map[string]string "Ключ уже занят"
+// @Router /custom-fields [post]
+func (h *CustomFieldHandler) CreateCustomField(c *gin.Context) {
+	var req models.CustomFieldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !customFieldKeyPattern.MatchString(req.Key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ключ поля: латиница в нижнем регистре, цифры и _, до 64 символов, начинается с буквы"})
+		return
+	}
+
+	definition, ok := h.definitionFromRequest(c, req)
+	if !ok {
+		return
+	}
+	definition.Key = req.Key
+	definition.CreatedBy = models.NullInt{Int: c.GetInt("user_id"), Valid: true}
+
+	if err := h.customFieldRepo.Create(definition); err != nil {
+		if repositories.IsDuplicateCustomField(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Поле с ключом '%s' уже существует", req.Key)})
+			return
+		}
+		log.Printf("Failed to create custom field: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать поле"})
+		return
+	}
+	h.schema.Invalidate()
+
+	logAudit(h.auditLogRepo, c, repositories.ActionCreateCustomField, nil, customFieldAuditDetails(definition))
+	log.Printf("AUDIT: User %d created custom field %s (%s)", c.GetInt("user_id"), definition.Key, definition.Type)
+
+	c.JSON(http.StatusCreated, gin.H{"custom_field": definition})
+}
+
+// UpdateCustomField godoc
+// @Summary Изменить дополнительное поле
+// @Description Меняет подпись, тип, обязательность, допустимые значения, видимость и порядок поля (ключ не меняется).
+// @Description Сохранённые значения пользователей не пересчитываются и проверяются при следующем изменении
+// @Tags custom-fields
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID поля"
+// @Param request body models.CustomFieldRequest true "Описание поля"
+// @Success 200 {object} map[string]interface{} "Поле изменено"
+// @Failure 400 {object} map[string]string "Неверные параметры"
+// @Failure 404 {object} map[string]string "Поле не найдено"
+// @Router /custom-fields/{id} [put]
+func (h *CustomFieldHandler) UpdateCustomField(c *gin.Context) {
+	current, ok := h.loadCustomField(c)
+	if !ok {
+		return
+	}
+
+	var req models.CustomFieldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Key != "" && req.Key != current.Key {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ключ поля нельзя изменить"})
+		return
+	}
+
+	definition, ok := h.definitionFromRequest(c, req)
+	if !ok {
+		return
+	}
+	definition.ID = current.ID
+	definition.Key = current.Key
+	definition.CreatedBy = current.CreatedBy
+	definition.CreatedAt = current.CreatedAt
+
+	updated, err := h.customFieldRepo.Update(definition)
+	if err != nil {
+		log.Printf("Failed to update custom field %d: %v", current.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось изменить поле"})
+		return
+	}
+	if !updated {
+		c.JSON(http.StatusNotFound, gin.H{"error": errCustomFieldNotFound})
+		return
+	}
+	h.schema.Invalidate()
+
+	details := customFieldAuditDetails(definition)
+	details["old"] = customFieldAuditDetails(current)
+	logAudit(h.auditLogRepo, c, repositories.ActionUpdateCustomField, nil, details)
+	log.Printf("AUDIT: User %d updated custom field %s", c.GetInt("user_id"), definition.Key)
+
+	c.JSON(http.StatusOK, gin.H{"custom_field": definition})
+}
+
+// DeleteCustomField godoc
+// @Summary Удалить дополнительное поле
+// @Description Удаляет описание поля. Сохранённые значения у пользователей остаются как поле без описания
+// @Tags custom-fields
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID поля"
+// @Success 200 {object} map[string]string "Поле удалено"
+// @Failure 404 {object} map[string]string "Поле не найдено"
+// @Router /custom-fields/{id} [delete]
+func (h *CustomFieldHandler) DeleteCustomField(c *gin.Context) {
+	definition, ok := h.loadCustomField(c)
+	if !ok {
+		return
+	}
+
+	deleted, err := h.customFieldRepo.Delete(definition.ID)
+	if err != nil {
+		log.Printf("Failed to delete custom field %d: %v", definition.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось удалить поле"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": errCustomFieldNotFound})
+		return
+	}
+	h.schema.Invalidate()
+
+	logAudit(h.auditLogRepo, c, repositories.ActionDeleteCustomField, nil, map[string]interface{}{
+		"key": definition.Key,
+	})
+	log.Printf("AUDIT: User %d deleted custom field %s", c.GetInt("user_id"), definition.Key)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Поле удалено"})
+}
+
+// loadCustomField загружает описание из параметра :id
+func (h *CustomFieldHandler) loadCustomField(c *gin.Context) (*models.CustomFieldDefinition, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidCustomFieldID})
+		return nil, false
+	}
+
+	definition, err := h.customFieldRepo.GetByID(id)
+	if err != nil {
+		log.Printf("Failed to get custom field %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errFailedToGetCustomFields})
+		return nil, false
+	}
+	if definition == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errCustomFieldNotFound})
+		return nil, false
+	}
+	return definition, true
+}
+
+// definitionFromRequest проверяет тип, допустимые значения и роли из запроса
+func (h *CustomFieldHandler) definitionFromRequest(c *gin.Context, req models.CustomFieldRequest) (*models.CustomFieldDefinition, bool) {
+	label := strings.TrimSpace(utils.SanitizeString(req.Label))
+	if label == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите подпись поля"})
+		return nil, false
+	}
+
+	knownType := false
+	for _, t := range models.CustomFieldTypes {
+		knownType = knownType || t == req.Type
+	}
+	if !knownType {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Тип поля: " + strings.Join(models.CustomFieldTypes, ", ")})
+		return nil, false
+	}
+
+	allowed := pq.StringArray{}
+	seen := map[string]bool{}
+	for _, value := range req.AllowedValues {
+		value = strings.TrimSpace(value)
+		if value != "" && !seen[value] {
+			seen[value] = true
+			allowed = append(allowed, value)
+		}
+	}
+	if req.Type == models.CustomFieldEnum && len(allowed) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Для типа enum укажите допустимые значения"})
+		return nil, false
+	}
+	if req.Type != models.CustomFieldEnum && len(allowed) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Допустимые значения задаются только для типа enum"})
+		return nil, false
+	}
+
+	visibleTo := pq.StringArray{}
+	for _, role := range req.VisibleTo {
+		if !h.permissions.RoleExists(models.UserRole(role)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Неизвестная роль: %s", role)})
+			return nil, false
+		}
+		visibleTo = append(visibleTo, role)
+	}
+
+	return &models.CustomFieldDefinition{
+		Label:         label,
+		Type:          req.Type,
+		Required:      req.Required,
+		AllowedValues: allowed,
+		VisibleTo:     visibleTo,
+		SortOrder:     req.SortOrder,
+	}, true
+}
+
+func customFieldAuditDetails(definition *models.CustomFieldDefinition) map[string]interface{} {
+	return map[string]interface{}{
+		"key":            definition.Key,
+		"label":          definition.Label,
+		"type":           definition.Type,
+		"required":       definition.Required,
+		"allowed_values": definition.AllowedValues,
+		"visible_to":     definition.VisibleTo,
+	}
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/policy"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+func setupCustomFieldTest(t *testing.T, role models.UserRole) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := builtinPermissionStore()
+	customFieldRepo := repositories.NewCustomFieldRepository(sqlxDB)
+	auditLogRepo := repositories.NewAuditLogRepository(sqlxDB)
+	schema := policy.NewCustomFieldSchema(customFieldRepo)
+
+	handler := NewCustomFieldHandler(customFieldRepo, auditLogRepo, schema, store)
+	userHandler := NewUserHandler(
+		repositories.NewUserRepository(sqlxDB),
+		repositories.NewOrganizationRepository(sqlxDB),
+		auditLogRepo,
+		store,
+	)
+	userHandler.UseCustomFields(schema)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", 1)
+		c.Set("username", "admin")
+		c.Set("role", role)
+		c.Next()
+	}, auth.LoadPermissions(store))
+	router.GET("/custom-fields", handler.ListCustomFields)
+	router.POST("/custom-fields", handler.CreateCustomField)
+	router.GET("/users", userHandler.GetUsers)
+	router.POST("/users", userHandler.CreateUser)
+	return router, mock
+}
+
+func customFieldRows() *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows([]string{"id", "key", "label", "type", "required", "allowed_values", "visible_to", "sort_order", "created_by", "created_at", "updated_at"}).
+		AddRow(1, "shift", "Смена", "enum", false, "{day,night}", "{}", 1, 1, now, now).
+		AddRow(2, "grade", "Разряд", "number", false, "{}", "{}", 2, 1, now, now).
+		AddRow(3, "salary", "Оклад", "number", false, "{}", "{admin}", 3, 1, now, now)
+}
+
+// TestListCustomFields проверяет, что роль видит только поля, открытые для неё
+func TestListCustomFields(t *testing.T) {
+	router, mock := setupCustomFieldTest(t, models.RoleModerator)
+
+	mock.ExpectQuery("FROM custom_field_definitions ORDER BY sort_order, id").WillReturnRows(customFieldRows())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/custom-fields", nil)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		CustomFields []models.CustomFieldDefinition `json:"custom_fields"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(response.CustomFields) != 2 || response.CustomFields[0].Key != "shift" || response.CustomFields[1].Key != "grade" {
+		t.Errorf("Unexpected fields: %+v", response.CustomFields)
+	}
+}
+
+func TestCreateCustomField(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		setupMock  func(mock sqlmock.Sqlmock)
+		wantStatus int
+	}{
+		{
+			name:       "Invalid key",
+			body:       `{"key":"Tab Number","label":"Табельный номер","type":"string"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Enum without allowed values",
+			body:       `{"key":"shift","label":"Смена","type":"enum","allowed_values":[" ",""]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Allowed values for non-enum type",
+			body:       `{"key":"grade","label":"Разряд","type":"number","allowed_values":["1"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Unknown role in visible_to",
+			body:       `{"key":"salary","label":"Оклад","type":"number","visible_to":["accountant"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Duplicate key",
+			body: `{"key":"shift","label":"Смена","type":"enum","allowed_values":["day"]}`,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("INSERT INTO custom_field_definitions").
+					WillReturnError(&pq.Error{Code: "23505"})
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "Created with trimmed, deduplicated values",
+			body: `{"key":"shift","label":" Смена ","type":"enum","allowed_values":["day"," night","day"],"visible_to":["admin","moderator"]}`,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("INSERT INTO custom_field_definitions").
+					WithArgs("shift", "Смена", "enum", false, pq.StringArray{"day", "night"}, pq.StringArray{"admin", "moderator"}, 0, models.NullInt{Int: 1, Valid: true}).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(4, time.Now(), time.Now()))
+				mock.ExpectExec("INSERT INTO audit_log").
+					WithArgs(1, repositories.ActionCreateCustomField, nil, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			wantStatus: http.StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := setupCustomFieldTest(t, models.RoleAdmin)
+			if tt.setupMock != nil {
+				tt.setupMock(mock)
+			}
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/custom-fields", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d. Body: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// TestCreateUser_InvalidCustomFields проверяет, что значения custom_fields сверяются с описаниями полей
+func TestCreateUser_InvalidCustomFields(t *testing.T) {
+	router, mock := setupCustomFieldTest(t, models.RoleAdmin)
+
+	mock.ExpectQuery(`FROM users WHERE LOWER\(username\) = LOWER\(\$1\)`).WithArgs("newuser").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT LOWER\(username\) FROM users WHERE LOWER\(username\) = ANY\(\$1\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"lower"}))
+	mock.ExpectQuery("FROM custom_field_definitions ORDER BY sort_order, id").WillReturnRows(customFieldRows())
+
+	body := `{"full_name":"Новый сотрудник","username":"newuser","role":"user","custom_fields":{"shift":"evening","grade":"пятый","badge":"A1"}}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/users", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Errors []policy.CustomFieldError `json:"custom_field_errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(response.Errors) != 3 || response.Errors[0].Key != "badge" || response.Errors[1].Key != "grade" || response.Errors[2].Key != "shift" {
+		t.Errorf("Unexpected custom field errors: %s", w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestGetUsers_CustomFieldFilter проверяет поиск по custom_fields через оператор @>
+func TestGetUsers_CustomFieldFilter(t *testing.T) {
+	router, mock := setupCustomFieldTest(t, models.RoleAdmin)
+
+	mock.ExpectQuery("FROM custom_field_definitions ORDER BY sort_order, id").WillReturnRows(customFieldRows())
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users WHERE deleted_at IS NULL AND custom_fields @> \$1::jsonb$`).
+		WithArgs([]byte(`{"grade":4,"shift":"night"}`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT (.+) FROM users(.+)custom_fields @> \\$1::jsonb(.+)LIMIT").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/users?custom_fields[shift]=night&custom_fields[grade]=4", nil)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+
+	// Фильтр по неизвестному полю - ошибка, а не пустой список
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/users?custom_fields[badge]=A1", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d. Body: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ImpersonationHandler вход администратора под другим пользователем для поддержки
+type ImpersonationHandler struct {
+	userRepo     *repositories.UserRepository
+	auditLogRepo *repositories.AuditLogRepository
+	tokens       *auth.KeyManager
+	permissions  *auth.PermissionStore
+}
+
+// NewImpersonationHandler создает новый handler
+func NewImpersonationHandler(
+	userRepo *repositories.UserRepository,
+	auditLogRepo *repositories.AuditLogRepository,
+	tokens *auth.KeyManager,
+	permissions *auth.PermissionStore,
+) *ImpersonationHandler {
+	return &ImpersonationHandler{
+		userRepo:     userRepo,
+		auditLogRepo: auditLogRepo,
+		tokens:       tokens,
+		permissions:  permissions,
+	}
+}
+
+// ImpersonateRequest причина входа под пользователем (попадает в журнал аудита)
+type ImpersonateRequest struct {
+	Reason string `json:"reason"`
+}
+
+// Impersonate godoc
+// @Summary Войти под пользователем
+// @Description Выдает администратору короткоживущий токен с правами пользователя (30 минут).
+// @Description Токен помечен ID администратора; все запросы с ним записываются в журнал аудита от имени обоих.
+// @Description Вход под пользователем, который сам может входить под другими (users.impersonate) или имеет права, которых нет у администратора, запрещен
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param request body ImpersonateRequest false "Причина"
+// @Success 200 {object} map[string]interface{} "Токен имперсонации"
+// @Failure 400 {object} map[string]string "Неверный запрос"
+// @Failure 403 {object} map[string]string "Доступ запрещен"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Router /users/{id}/impersonate [post]
+func (h *ImpersonationHandler) Impersonate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidUserID})
+		return
+	}
+
+	var req ImpersonateRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	req.Reason = utils.SanitizeString(req.Reason)
+
+	currentUserID := c.GetInt("user_id")
+	if id == currentUserID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Нельзя войти под самим собой"})
+		return
+	}
+
+	impersonator, err := h.userRepo.GetByID(currentUserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Пользователь не найден"})
+		return
+	}
+
+	target, err := h.userRepo.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errUserNotFound})
+		return
+	}
+
+	targetPerms := h.permissions.Permissions(target.Role)
+	if targetPerms.Has(auth.PermUsersImpersonate) {
+		log.Printf("AUDIT: Admin %d (%s) attempted to impersonate admin %d", currentUserID, impersonator.Username, id)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нельзя войти под другим администратором"})
+		return
+	}
+	// Вход под пользователем не должен давать прав, которых у администратора нет
+	if !auth.Permissions(c).Contains(targetPerms) {
+		log.Printf("AUDIT: User %d (%s) attempted to impersonate user %d with broader permissions", currentUserID, impersonator.Username, id)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нельзя войти под пользователем с правами, которых нет у вас"})
+		return
+	}
+
+	if !target.IsActive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Нельзя войти под заблокированным пользователем"})
+		return
+	}
+
+	if target.IsServiceAccount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Нельзя войти под сервисной учётной записью"})
+		return
+	}
+
+	token, expiresAt, err := h.tokens.GenerateImpersonationToken(*target, *impersonator)
+	if err != nil {
+		log.Printf("Failed to generate impersonation token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать токен"})
+		return
+	}
+
+	logAudit(h.auditLogRepo, c, repositories.ActionImpersonate, &target.ID, map[string]interface{}{
+		"username":   target.Username,
+		"reason":     req.Reason,
+		"expires_at": expiresAt,
+	})
+
+	log.Printf("AUDIT: Admin %d (%s) started impersonating user %d (%s) until %s",
+		impersonator.ID, impersonator.Username, target.ID, target.Username, expiresAt.Format("15:04:05"))
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         token,
+		"expires_at":    expiresAt,
+		"impersonation": true,
+		"user":          target,
+		"impersonator": gin.H{
+			"id":       impersonator.ID,
+			"username": impersonator.Username,
+		},
+	})
+}
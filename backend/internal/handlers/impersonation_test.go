@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+func setupImpersonationTest(t *testing.T) (*gin.Engine, *auth.KeyManager, sqlmock.Sqlmock) {
+	return setupImpersonationTestAs(t, models.RoleAdmin)
+}
+
+func setupImpersonationTestAs(t *testing.T, role models.UserRole) (*gin.Engine, *auth.KeyManager, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	tokens := auth.NewHMACKeyManager(testJWTSecret)
+	store := customRolePermissionStore()
+	handler := NewImpersonationHandler(
+		repositories.NewUserRepository(sqlxDB),
+		repositories.NewAuditLogRepository(sqlxDB),
+		tokens,
+		store,
+	)
+
+	router := gin.New()
+	router.POST("/users/:id/impersonate", func(c *gin.Context) {
+		c.Set("user_id", 1)
+		c.Set("role", role)
+		c.Next()
+	}, auth.LoadPermissions(store), handler.Impersonate)
+	return router, tokens, mock
+}
+
+func expectUserRow(mock sqlmock.Sqlmock, id int, username, role string, tokenVersion int) {
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "role", "is_active", "token_version"}).
+			AddRow(id, username, role, true, tokenVersion))
+}
+
+func TestImpersonate_Success(t *testing.T) {
+	router, tokens, mock := setupImpersonationTest(t)
+
+	expectUserRow(mock, 1, "admin", "admin", 4)
+	expectUserRow(mock, 2, "moderator1", "moderator", 1)
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(1, repositories.ActionImpersonate, 2, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	req, _ := http.NewRequest("POST", "/users/2/impersonate", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Token         string `json:"token"`
+		Impersonation bool   `json:"impersonation"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	claims, err := tokens.ValidateToken(response.Token)
+	if err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+	if !response.Impersonation || claims.UserID != 2 || claims.ImpersonatorID != 1 || claims.ImpersonatorTokenVersion != 4 {
+		t.Errorf("unexpected impersonation claims: %+v", claims)
+	}
+	if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time); lifetime > auth.ImpersonationTokenLifetime {
+		t.Errorf("token lifetime = %s, want at most %s", lifetime, auth.ImpersonationTokenLifetime)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestImpersonate_AdminForbidden(t *testing.T) {
+	router, _, mock := setupImpersonationTest(t)
+
+	expectUserRow(mock, 1, "admin", "admin", 1)
+	expectUserRow(mock, 3, "admin2", "admin", 1)
+
+	req, _ := http.NewRequest("POST", "/users/3/impersonate", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d. Body: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestImpersonate_BroaderPermissionsForbidden проверяет, что собственная роль с users.impersonate не входит
+// под пользователем, у роли которого есть права сверх её собственных
+func TestImpersonate_BroaderPermissionsForbidden(t *testing.T) {
+	router, _, mock := setupImpersonationTestAs(t, roleHelpdesk)
+
+	expectUserRow(mock, 1, "helpdesk1", string(roleHelpdesk), 1)
+	expectUserRow(mock, 4, "moderator1", "moderator", 1)
+
+	req, _ := http.NewRequest("POST", "/users/4/impersonate", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestImpersonationToken_RevokedWithAdminSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	tokens := auth.NewHMACKeyManager(testJWTSecret)
+	router := gin.New()
+	router.Use(auth.JWTMiddleware(tokens, repositories.NewUserRepository(sqlxDB), nil))
+	router.Use(auth.LoadPermissions(builtinPermissionStore()))
+	router.GET("/me", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"impersonator_id": c.GetInt("impersonator_id")})
+	})
+
+	token, _, _ := tokens.GenerateImpersonationToken(
+		models.User{ID: 2, Username: "moderator1", Role: models.RoleModerator, TokenVersion: 1},
+		models.User{ID: 1, Username: "admin", Role: models.RoleAdmin, TokenVersion: 4},
+	)
+
+	tests := []struct {
+		name                  string
+		adminRole             string
+		adminTokenVersion     int
+		wantStatus            int
+		wantImpersonatorInCtx bool
+	}{
+		{"Admin session valid", "admin", 4, http.StatusOK, true},
+		{"Admin sessions revoked", "admin", 5, http.StatusUnauthorized, false},
+		{"Impersonation permission withdrawn", "moderator", 4, http.StatusUnauthorized, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectUserRow(mock, 2, "moderator1", "moderator", 1)
+			expectUserRow(mock, 1, "admin", tt.adminRole, tt.adminTokenVersion)
+
+			req, _ := http.NewRequest("GET", "/me", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantImpersonatorInCtx && w.Header().Get("X-Impersonated-By") != "admin" {
+				t.Error("X-Impersonated-By header should mark impersonated responses")
+			}
+		})
+	}
+}
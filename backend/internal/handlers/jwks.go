@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// JWKSHandler публикует открытые ключи подписи JWT для других внутренних сервисов
+type JWKSHandler struct {
+	tokens *auth.KeyManager
+}
+
+// NewJWKSHandler создает новый handler
+func NewJWKSHandler(tokens *auth.KeyManager) *JWKSHandler {
+	return &JWKSHandler{tokens: tokens}
+}
+
+// JWKS godoc
+// @Summary Открытые ключи подписи JWT
+// @Description Возвращает действующие открытые ключи (JWK Set), включая ключи в периоде отсрочки после ротации.
+// @Description В режиме HS256 список пуст: токены подписываются общим секретом
+// @Tags auth
+// @Produce json
+// @Success 200 {object} map[string]interface{} "JWK Set"
+// @Router /.well-known/jwks.json [get]
+func (h *JWKSHandler) JWKS(c *gin.Context) {
+	// Короткий кеш: после ротации новый ключ появляется у клиентов в течение нескольких минут
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": h.tokens.JWKS()})
+}
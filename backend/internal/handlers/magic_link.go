@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/policy"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// magicLinkMessage общий ответ, не раскрывающий существование учётной записи
+const magicLinkMessage = "Если пользователь существует, на email будет отправлена ссылка для входа"
+
+// MagicLinkHandler обрабатывает вход без пароля по одноразовой ссылке из email
+type MagicLinkHandler struct {
+	userRepo          *repositories.UserRepository
+	passwordResetRepo *repositories.PasswordResetRepository
+	auditLogRepo      *repositories.AuditLogRepository
+	emailService      *services.EmailService
+	tokens            *auth.KeyManager
+	ttl               time.Duration
+	customFields      *policy.CustomFieldSchema
+}
+
+// NewMagicLinkHandler создает новый handler
+func NewMagicLinkHandler(
+	userRepo *repositories.UserRepository,
+	passwordResetRepo *repositories.PasswordResetRepository,
+	auditLogRepo *repositories.AuditLogRepository,
+	emailService *services.EmailService,
+	tokens *auth.KeyManager,
+	ttl time.Duration,
+) *MagicLinkHandler {
+	return &MagicLinkHandler{
+		userRepo:          userRepo,
+		passwordResetRepo: passwordResetRepo,
+		auditLogRepo:      auditLogRepo,
+		emailService:      emailService,
+		tokens:            tokens,
+		ttl:               ttl,
+	}
+}
+
+// UseCustomFields скрывает в ответе дополнительные поля, не видимые роли пользователя
+func (h *MagicLinkHandler) UseCustomFields(schema *policy.CustomFieldSchema) {
+	h.customFields = schema
+}
+
+// MagicLinkRequest запрос ссылки для входа
+type MagicLinkRequest struct {
+	UsernameOrEmail string `json:"username_or_email" binding:"required"`
+}
+
+// VerifyMagicLinkRequest вход по токену из ссылки
+type VerifyMagicLinkRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// RequestLink godoc
+// @Summary Запрос ссылки для входа без пароля
+// @Description Отправляет на email одноразовую ссылку для входа. Если email указан у нескольких пользователей, письмо содержит ссылку для каждой учётной записи
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body MagicLinkRequest true "Username или email"
+// @Success 200 {object} map[string]string "Ссылка отправлена, если пользователь существует"
+// @Failure 400 {object} map[string]string "Неверный запрос"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /auth/magic-link [post]
+func (h *MagicLinkHandler) RequestLink(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	email, users, err := findAccountsForRecovery(h.userRepo, req.UsernameOrEmail)
+	if err != nil {
+		log.Printf("Failed to find user for magic link: %v", err)
+	}
+	if len(users) == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": magicLinkMessage})
+		return
+	}
+
+	links := make([]services.AccountLink, 0, len(users))
+	for _, user := range users {
+		// Действует только последняя отправленная ссылка
+		if err := h.passwordResetRepo.InvalidateUserTokens(user.ID, repositories.TokenPurposeMagicLink); err != nil {
+			log.Printf("Failed to invalidate magic links: %v", err)
+		}
+
+		token, err := h.passwordResetRepo.GenerateTokenForPurpose(user.ID, repositories.TokenPurposeMagicLink, h.ttl)
+		if err != nil {
+			log.Printf("Failed to generate magic link token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать токен"})
+			return
+		}
+		links = append(links, services.AccountLink{Username: user.Username, Token: token})
+		log.Printf("Magic link generated for user %s", user.Username)
+	}
+
+	ttlMinutes := int(h.ttl / time.Minute)
+	if len(links) == 1 {
+		err = h.emailService.SendMagicLinkEmail(email, links[0].Username, links[0].Token, ttlMinutes)
+	} else {
+		log.Printf("Email %s is shared by %d users, sending account choice", email, len(links))
+		err = h.emailService.SendMagicLinkChoiceEmail(email, links, ttlMinutes)
+	}
+	if err != nil {
+		log.Printf("Failed to send magic link email: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": magicLinkMessage})
+}
+
+// Verify godoc
+// @Summary Вход по ссылке из email
+// @Description Обменивает одноразовый токен из ссылки на JWT токен
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body VerifyMagicLinkRequest true "Токен из ссылки"
+// @Success 200 {object} models.LoginResponse "Успешная авторизация"
+// @Failure 400 {object} map[string]string "Неверный запрос"
+// @Failure 401 {object} map[string]string "Токен недействителен или истек"
+// @Failure 403 {object} map[string]interface{} "Пользователь заблокирован"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /auth/magic-link/verify [post]
+func (h *MagicLinkHandler) Verify(c *gin.Context) {
+	var req VerifyMagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Токен помечается использованным атомарно: повторный вход по той же ссылке невозможен
+	userID, ok, err := h.passwordResetRepo.ConsumeToken(req.Token, repositories.TokenPurposeMagicLink)
+	if err != nil {
+		log.Printf("Failed to consume magic link token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Токен недействителен или истек"})
+		return
+	}
+
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil || user.IsServiceAccount {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Токен недействителен или истек"})
+		return
+	}
+
+	if !user.IsActive {
+		blocked := &auth.BlockedError{User: user}
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   blocked.Reason(),
+			"blocked": true,
+		})
+		return
+	}
+
+	if err := h.userRepo.UpdateUserActivity(user.ID); err != nil {
+		log.Printf("Failed to update activity: %v", err)
+	}
+
+	token, err := h.tokens.GenerateToken(*user)
+	if err != nil {
+		log.Printf("Failed to generate JWT: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать токен"})
+		return
+	}
+
+	if err := h.auditLogRepo.Log(user.ID, repositories.ActionLogin, nil, map[string]interface{}{
+		"method": "magic_link",
+	}, c.ClientIP(), c.Request.UserAgent()); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+
+	log.Printf("Magic link login successful for user: %s (ID: %d)", user.Username, user.ID)
+	hideCustomFieldsFrom(h.customFields, policy.CustomFieldViewer{Role: user.Role}, user)
+	c.JSON(http.StatusOK, models.LoginResponse{
+		User:                  *user,
+		Token:                 token,
+		RequirePasswordChange: user.RequirePasswordChange,
+	})
+}
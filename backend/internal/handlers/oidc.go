@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// OIDCHandler обрабатывает вход через внешний OpenID Connect провайдер
+type OIDCHandler struct {
+	oidcService  *services.OIDCService
+	userRepo     *repositories.UserRepository
+	auditLogRepo *repositories.AuditLogRepository
+	tokens       *auth.KeyManager
+	frontendURL  string
+}
+
+// NewOIDCHandler создает новый handler
+func NewOIDCHandler(
+	oidcService *services.OIDCService,
+	userRepo *repositories.UserRepository,
+	auditLogRepo *repositories.AuditLogRepository,
+	tokens *auth.KeyManager,
+	frontendURL string,
+) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService:  oidcService,
+		userRepo:     userRepo,
+		auditLogRepo: auditLogRepo,
+		tokens:       tokens,
+		frontendURL:  frontendURL,
+	}
+}
+
+// Login godoc
+// @Summary Вход через OIDC провайдер
+// @Description Перенаправляет на страницу входа центрального провайдера идентификации (authorization code + PKCE)
+// @Tags auth
+// @Success 302 "Перенаправление на провайдер"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /auth/oidc/login [get]
+func (h *OIDCHandler) Login(c *gin.Context) {
+	authURL, err := h.oidcService.AuthCodeURL()
+	if err != nil {
+		log.Printf("OIDC: failed to build auth URL: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось начать вход через OIDC"})
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback godoc
+// @Summary Callback OIDC провайдера
+// @Description Обменивает код авторизации на ID токен, сопоставляет пользователя и перенаправляет на фронтенд с JWT токеном
+// @Tags auth
+// @Param code query string true "Код авторизации"
+// @Param state query string true "State из запроса авторизации"
+// @Success 302 "Перенаправление на фронтенд"
+// @Router /auth/oidc/callback [get]
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	if idpError := c.Query("error"); idpError != "" {
+		log.Printf("OIDC: provider returned error: %s (%s)", idpError, c.Query("error_description"))
+		h.redirectWithError(c, "oidc_denied")
+		return
+	}
+
+	identity, err := h.oidcService.Exchange(c.Request.Context(), c.Query("state"), c.Query("code"))
+	if err != nil {
+		log.Printf("OIDC: exchange failed: %v", err)
+		h.redirectWithError(c, "oidc_failed")
+		return
+	}
+
+	user, created, err := h.oidcService.ResolveUser(identity)
+	if err != nil {
+		log.Printf("OIDC: cannot resolve user (sub=%s, username=%s, email=%s): %v",
+			identity.Subject, identity.Username, identity.Email, err)
+		switch {
+		case errors.Is(err, services.ErrOIDCUserNotFound):
+			h.redirectWithError(c, "oidc_user_not_found")
+		case errors.Is(err, services.ErrOIDCAmbiguousUser):
+			h.redirectWithError(c, "oidc_ambiguous_user")
+		case errors.Is(err, services.ErrOIDCServiceAccount):
+			h.redirectWithError(c, "oidc_service_account")
+		default:
+			h.redirectWithError(c, "oidc_failed")
+		}
+		return
+	}
+
+	if created {
+		if err := h.auditLogRepo.Log(user.ID, repositories.ActionCreateUser, &user.ID, map[string]interface{}{
+			"username": user.Username,
+			"role":     user.Role,
+			"source":   "oidc",
+		}, c.ClientIP(), c.Request.UserAgent()); err != nil {
+			log.Printf("Failed to write audit log: %v", err)
+		}
+	}
+
+	if !user.IsActive {
+		log.Printf("OIDC: user %s is blocked", user.Username)
+		h.redirectWithError(c, "blocked")
+		return
+	}
+
+	if err := h.userRepo.UpdateUserActivity(user.ID); err != nil {
+		log.Printf("Failed to update activity: %v", err)
+	}
+
+	token, err := h.tokens.GenerateToken(*user)
+	if err != nil {
+		log.Printf("Failed to generate JWT: %v", err)
+		h.redirectWithError(c, "oidc_failed")
+		return
+	}
+
+	if err := h.auditLogRepo.Log(user.ID, repositories.ActionLogin, nil, map[string]interface{}{
+		"method":  "oidc",
+		"subject": identity.Subject,
+	}, c.ClientIP(), c.Request.UserAgent()); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+
+	log.Printf("OIDC login successful for user: %s (ID: %d)", user.Username, user.ID)
+
+	// Токен передаём во фрагменте, чтобы он не попадал в логи серверов и Referer
+	c.Redirect(http.StatusFound, h.frontendURL+"/auth/oidc/callback#token="+url.QueryEscape(token))
+}
+
+func (h *OIDCHandler) redirectWithError(c *gin.Context, code string) {
+	c.Redirect(http.StatusFound, h.frontendURL+"/login?error="+url.QueryEscape(code))
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// OrganizationGrantHandler управляет временными доступами пользователей к организациям
+type OrganizationGrantHandler struct {
+	grantRepo        *repositories.OrganizationGrantRepository
+	userRepo         *repositories.UserRepository
+	organizationRepo *repositories.OrganizationRepository
+	auditLogRepo     *repositories.AuditLogRepository
+}
+
+// NewOrganizationGrantHandler создает новый handler
+func NewOrganizationGrantHandler(
+	grantRepo *repositories.OrganizationGrantRepository,
+	userRepo *repositories.UserRepository,
+	organizationRepo *repositories.OrganizationRepository,
+	auditLogRepo *repositories.AuditLogRepository,
+) *OrganizationGrantHandler {
+	return &OrganizationGrantHandler{
+		grantRepo:        grantRepo,
+		userRepo:         userRepo,
+		organizationRepo: organizationRepo,
+		auditLogRepo:     auditLogRepo,
+	}
+}
+
+// ListGrants godoc
+// @Summary Временные доступы к организациям
+// @Description Возвращает временные доступы пользователя к организациям, включая истёкшие
+// @Tags organization-grants
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} map[string]interface{} "Список доступов"
+// @Failure 403 {object} map[string]string "Недостаточно прав"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Router /users/{id}/organization-grants [get]
+func (h *OrganizationGrantHandler) ListGrants(c *gin.Context) {
+	userID, ok := h.targetUserID(c)
+	if !ok {
+		return
+	}
+
+	grants, err := h.grantRepo.ListByUser(userID)
+	if err != nil {
+		log.Printf("Failed to list organization grants for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить список доступов"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"grants": grants})
+}
+
+// CreateGrant godoc
+// @Summary Выдать временный доступ к организации
+// @Description Выдает пользователю доступ к организации на период valid_from - valid_until (не более года)
+// @Tags organization-grants
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param request body models.CreateOrganizationGrantRequest true "Организация и период"
+// @Success 201 {object} map[string]interface{} "Доступ выдан"
+// @Failure 400 {object} map[string]string "Неверные параметры"
+// @Failure 403 {object} map[string]string "Недостаточно прав"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Router /users/{id}/organization-grants [post]
+func (h *OrganizationGrantHandler) CreateGrant(c *gin.Context) {
+	userID, ok := h.targetUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateOrganizationGrantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.organizationRepo.GetByID(req.OrganizationID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Организация не найдена"})
+		return
+	}
+	if errMsg := validateGrantPeriod(req.ValidFrom, req.ValidUntil); errMsg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+
+	currentUserID := c.GetInt("user_id")
+	reason := utils.SanitizeString(req.Reason)
+	grant := &repositories.OrganizationGrant{
+		UserID:         userID,
+		OrganizationID: req.OrganizationID,
+		ValidUntil:     req.ValidUntil,
+		Reason:         sql.NullString{String: reason, Valid: reason != ""},
+		GrantedBy:      sql.NullInt64{Int64: int64(currentUserID), Valid: true},
+	}
+	if req.ValidFrom != nil {
+		grant.ValidFrom = *req.ValidFrom
+	}
+
+	if err := h.grantRepo.Create(grant); err != nil {
+		log.Printf("Failed to create organization grant for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось выдать доступ"})
+		return
+	}
+
+	logAudit(h.auditLogRepo, c, repositories.ActionGrantOrganization, &userID, map[string]interface{}{
+		"grant_id":        grant.ID,
+		"organization_id": grant.OrganizationID,
+		"valid_from":      grant.ValidFrom,
+		"valid_until":     grant.ValidUntil,
+		"reason":          reason,
+	})
+	log.Printf("AUDIT: User %d granted organization %d to user %d until %s",
+		currentUserID, grant.OrganizationID, userID, grant.ValidUntil.Format("2006-01-02 15:04"))
+
+	c.JSON(http.StatusCreated, gin.H{"grant": grant})
+}
+
+// DeleteGrant godoc
+// @Summary Досрочно отозвать доступ к организации
+// @Description Удаляет временный доступ пользователя к организации
+// @Tags organization-grants
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param grantId path int true "ID доступа"
+// @Success 200 {object} map[string]string "Доступ отозван"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 404 {object} map[string]string "Доступ не найден"
+// @Router /users/{id}/organization-grants/{grantId} [delete]
+func (h *OrganizationGrantHandler) DeleteGrant(c *gin.Context) {
+	userID, ok := h.targetUserID(c)
+	if !ok {
+		return
+	}
+
+	grantID, err := strconv.Atoi(c.Param("grantId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID доступа"})
+		return
+	}
+
+	deleted, err := h.grantRepo.Delete(userID, grantID)
+	if err != nil {
+		log.Printf("Failed to delete organization grant %d: %v", grantID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось отозвать доступ"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Доступ не найден"})
+		return
+	}
+
+	logAudit(h.auditLogRepo, c, repositories.ActionRevokeOrganization, &userID, map[string]interface{}{
+		"grant_id": grantID,
+	})
+	log.Printf("AUDIT: User %d revoked organization grant %d of user %d", c.GetInt("user_id"), grantID, userID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Доступ отозван"})
+}
+
+// ListExpiring godoc
+// @Summary Заканчивающиеся доступы к организациям
+// @Description Возвращает временные доступы к организациям, которые закончатся в ближайшие days дней
+// @Tags organization-grants
+// @Produce json
+// @Security BearerAuth
+// @Param days query int false "Горизонт в днях" default(7) maximum(90)
+// @Success 200 {object} map[string]interface{} "Список доступов"
+// @Failure 403 {object} map[string]string "Недостаточно прав"
+// @Router /organization-grants/expiring [get]
+func (h *OrganizationGrantHandler) ListExpiring(c *gin.Context) {
+	grants, err := h.grantRepo.ListExpiring(expiringHorizon(c))
+	if err != nil {
+		log.Printf("Failed to list expiring organization grants: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить список доступов"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"grants": grants})
+}
+
+// targetUserID разбирает ID пользователя из пути и проверяет, что он существует
+func (h *OrganizationGrantHandler) targetUserID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidUserID})
+		return 0, false
+	}
+
+	if _, err := h.userRepo.GetByID(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errUserNotFound})
+		return 0, false
+	}
+	return id, true
+}
@@ -3,7 +3,9 @@ package handlers
 import (
 	"log"
 	"net/http"
+	"strings"
 
+	"github.com/UAssylbek/central-reporting/internal/models"
 	"github.com/UAssylbek/central-reporting/internal/repositories"
 	"github.com/UAssylbek/central-reporting/internal/services"
 	"github.com/UAssylbek/central-reporting/internal/utils"
@@ -14,6 +16,7 @@ import (
 type PasswordResetHandler struct {
 	userRepo          *repositories.UserRepository
 	passwordResetRepo *repositories.PasswordResetRepository
+	auditLogRepo      *repositories.AuditLogRepository
 	emailService      *services.EmailService
 }
 
@@ -21,11 +24,13 @@ type PasswordResetHandler struct {
 func NewPasswordResetHandler(
 	userRepo *repositories.UserRepository,
 	passwordResetRepo *repositories.PasswordResetRepository,
+	auditLogRepo *repositories.AuditLogRepository,
 	emailService *services.EmailService,
 ) *PasswordResetHandler {
 	return &PasswordResetHandler{
 		userRepo:          userRepo,
 		passwordResetRepo: passwordResetRepo,
+		auditLogRepo:      auditLogRepo,
 		emailService:      emailService,
 	}
 }
@@ -41,16 +46,54 @@ type ResetPasswordRequest struct {
 	NewPassword string `json:"new_password" binding:"required"`
 }
 
+// forgotPasswordMessage общий ответ, не раскрывающий существование учётной записи
+const forgotPasswordMessage = "Если пользователь существует, на email будет отправлена ссылка для сброса пароля"
+
+// findAccountsForRecovery ищет учётные записи по логину или email и возвращает адрес для отправки ссылки.
+// Один email может быть указан у нескольких пользователей - тогда возвращаются все.
+// Заблокированные и сервисные учётные записи пропускаются
+func findAccountsForRecovery(userRepo *repositories.UserRepository, usernameOrEmail string) (string, []models.User, error) {
+	input := strings.TrimSpace(usernameOrEmail)
+
+	var email string
+	var candidates []models.User
+	if strings.Contains(input, "@") {
+		email = utils.SanitizeEmail(input)
+		users, err := userRepo.FindByEmail(email)
+		if err != nil {
+			return "", nil, err
+		}
+		candidates = users
+	} else {
+		user, err := userRepo.GetByUsername(input)
+		if err != nil {
+			return "", nil, err
+		}
+		if user == nil || len(user.Emails) == 0 {
+			return "", nil, nil
+		}
+		email = user.Emails[0]
+		candidates = []models.User{*user}
+	}
+
+	var users []models.User
+	for _, user := range candidates {
+		if user.IsActive && !user.IsServiceAccount {
+			users = append(users, user)
+		}
+	}
+	return email, users, nil
+}
+
 // ForgotPassword godoc
 // @Summary Запрос на сброс пароля
-// @Description Отправляет email с ссылкой для сброса пароля
+// @Description Отправляет email с ссылкой для сброса пароля. Если email указан у нескольких пользователей, письмо содержит ссылку для каждой учётной записи
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param request body ForgotPasswordRequest true "Username или email"
-// @Success 200 {object} map[string]string "Ссылка для сброса отправлена"
+// @Success 200 {object} map[string]string "Ссылка для сброса отправлена, если пользователь существует"
 // @Failure 400 {object} map[string]string "Неверный запрос"
-// @Failure 404 {object} map[string]string "Пользователь не найден"
 // @Failure 500 {object} map[string]string "Ошибка сервера"
 // @Router /auth/forgot-password [post]
 func (h *PasswordResetHandler) ForgotPassword(c *gin.Context) {
@@ -60,45 +103,42 @@ func (h *PasswordResetHandler) ForgotPassword(c *gin.Context) {
 		return
 	}
 
-	// Ищем пользователя по username
-	user, err := h.userRepo.GetByUsername(req.UsernameOrEmail)
-	if err != nil || user == nil {
+	email, users, err := findAccountsForRecovery(h.userRepo, req.UsernameOrEmail)
+	if err != nil {
+		log.Printf("Failed to find user for password reset: %v", err)
+	}
+	if len(users) == 0 {
 		// Не раскрываем информацию о существовании пользователя
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Если пользователь существует, на email будет отправлена ссылка для сброса пароля",
-		})
+		c.JSON(http.StatusOK, gin.H{"message": forgotPasswordMessage})
 		return
 	}
 
-	// Проверяем что у пользователя есть email
-	if len(user.Emails) == 0 {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Если пользователь существует, на email будет отправлена ссылка для сброса пароля",
-		})
-		return
+	// Генерируем токены (действительны 1 час)
+	links := make([]services.AccountLink, 0, len(users))
+	for _, user := range users {
+		token, err := h.passwordResetRepo.GenerateToken(user.ID, 1)
+		if err != nil {
+			log.Printf("Failed to generate reset token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать токен"})
+			return
+		}
+		links = append(links, services.AccountLink{Username: user.Username, Token: token})
+		log.Printf("Password reset token generated for user %s", user.Username)
 	}
 
-	// Генерируем токен (действителен 1 час)
-	token, err := h.passwordResetRepo.GenerateToken(user.ID, 1)
-	if err != nil {
-		log.Printf("Failed to generate reset token: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать токен"})
-		return
+	// Отправляем email с токеном (или с выбором учётной записи, если адрес общий)
+	if len(links) == 1 {
+		err = h.emailService.SendPasswordResetEmail(email, links[0].Username, links[0].Token)
+	} else {
+		log.Printf("Email %s is shared by %d users, sending account choice", email, len(links))
+		err = h.emailService.SendPasswordResetChoiceEmail(email, links)
 	}
-
-	// Отправляем email с токеном
-	if err := h.emailService.SendPasswordResetEmail(user.Emails[0], user.Username, token); err != nil {
+	if err != nil {
 		log.Printf("Failed to send password reset email: %v", err)
 		// Не раскрываем пользователю, что email не отправлен
 	}
 
-	log.Printf("Password reset token generated for user %s", user.Username)
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Ссылка для сброса пароля отправлена на email",
-		// В development режиме можно возвращать токен для тестирования
-		// "token": token, // УБРАТЬ В PRODUCTION!
-	})
+	c.JSON(http.StatusOK, gin.H{"message": forgotPasswordMessage})
 }
 
 // ResetPassword godoc
@@ -129,14 +169,14 @@ func (h *PasswordResetHandler) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	// Проверяем токен
-	valid, userID, err := h.passwordResetRepo.ValidateToken(req.Token)
+	// Токен помечается использованным атомарно до смены пароля: два одновременных запроса не сменят пароль по одному токену
+	userID, ok, err := h.passwordResetRepo.ConsumeToken(req.Token, repositories.TokenPurposePasswordReset)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный токен"})
+		log.Printf("Failed to consume password reset token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
 		return
 	}
-
-	if !valid {
+	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Токен недействителен или истек"})
 		return
 	}
@@ -148,16 +188,16 @@ func (h *PasswordResetHandler) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	// Помечаем токен как использованный
-	if err := h.passwordResetRepo.MarkAsUsed(req.Token); err != nil {
-		log.Printf("Failed to mark token as used: %v", err)
-	}
-
 	// Инвалидируем все другие токены пользователя
 	if err := h.passwordResetRepo.InvalidateAllUserTokens(userID); err != nil {
 		log.Printf("Failed to invalidate user tokens: %v", err)
 	}
 
+	if err := h.auditLogRepo.Log(userID, repositories.ActionResetPassword, &userID, map[string]interface{}{
+		"method": "token",
+	}, c.ClientIP(), c.Request.UserAgent()); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
 	log.Printf("AUDIT: User %d reset their password", userID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Пароль успешно изменен"})
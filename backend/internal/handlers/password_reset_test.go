@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+func setupPasswordResetTest(t *testing.T) (*gin.Engine, *auth.KeyManager, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	userRepo := repositories.NewUserRepository(sqlxDB)
+	passwordResetRepo := repositories.NewPasswordResetRepository(sqlxDB)
+	auditLogRepo := repositories.NewAuditLogRepository(sqlxDB)
+	// Без SMTP письма только логируются
+	emailService := &services.EmailService{}
+	tokens := auth.NewHMACKeyManager(testJWTSecret)
+
+	resetHandler := NewPasswordResetHandler(userRepo, passwordResetRepo, auditLogRepo, emailService)
+	magicLinkHandler := NewMagicLinkHandler(userRepo, passwordResetRepo, auditLogRepo, emailService, tokens, 15*time.Minute)
+
+	router := gin.New()
+	router.POST("/auth/forgot-password", resetHandler.ForgotPassword)
+	router.POST("/auth/reset-password", resetHandler.ResetPassword)
+	router.POST("/auth/magic-link", magicLinkHandler.RequestLink)
+	router.POST("/auth/magic-link/verify", magicLinkHandler.Verify)
+	return router, tokens, mock
+}
+
+func postJSON(router *gin.Engine, path string, body interface{}) *httptest.ResponseRecorder {
+	jsonBody, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestForgotPassword_ByEmail(t *testing.T) {
+	tests := []struct {
+		name       string
+		rows       [][]interface{}
+		wantTokens int
+	}{
+		{
+			name:       "Single user",
+			rows:       [][]interface{}{{1, "ivanov", []byte(`["shared@gov.kz"]`), true, false}},
+			wantTokens: 1,
+		},
+		{
+			name: "Shared email - link for every active account",
+			rows: [][]interface{}{
+				{1, "ivanov", []byte(`["shared@gov.kz"]`), true, false},
+				{2, "ivanov2", []byte(`["shared@gov.kz"]`), true, false},
+				{3, "blocked", []byte(`["shared@gov.kz"]`), false, false},
+				{4, "svc-report", []byte(`["shared@gov.kz"]`), true, true},
+			},
+			wantTokens: 2,
+		},
+		{
+			name:       "Unknown email",
+			rows:       nil,
+			wantTokens: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _, mock := setupPasswordResetTest(t)
+
+			rows := sqlmock.NewRows([]string{"id", "username", "emails", "is_active", "is_service_account"})
+			for _, row := range tt.rows {
+				rows.AddRow(row[0], row[1], row[2], row[3], row[4])
+			}
+			mock.ExpectQuery("SELECT (.+) FROM users WHERE emails @> (.+)").
+				WithArgs("shared@gov.kz").
+				WillReturnRows(rows)
+
+			for i := 0; i < tt.wantTokens; i++ {
+				mock.ExpectQuery("INSERT INTO password_reset_tokens").
+					WithArgs(i+1, sqlmock.AnyArg(), sqlmock.AnyArg(), repositories.TokenPurposePasswordReset).
+					WillReturnRows(sqlmock.NewRows([]string{"token"}).AddRow("token"))
+			}
+
+			w := postJSON(router, "/auth/forgot-password", ForgotPasswordRequest{UsernameOrEmail: " Shared@Gov.KZ "})
+
+			if w.Code != http.StatusOK {
+				t.Errorf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// TestForgotPassword_SharedEmailSendsOneEmail проверяет, что на общий адрес уходит одно письмо
+// со ссылкой для каждой учётной записи
+func TestForgotPassword_SharedEmailSendsOneEmail(t *testing.T) {
+	router, _, mock := setupPasswordResetTest(t)
+	t.Setenv("FRONTEND_URL", "https://reports.gov.kz")
+
+	// Без SMTP письмо пишется в лог
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE emails @> (.+)").
+		WithArgs("shared@gov.kz").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "emails", "is_active", "is_service_account"}).
+			AddRow(1, "ivanov", []byte(`["shared@gov.kz"]`), true, false).
+			AddRow(2, "ivanov2", []byte(`["shared@gov.kz"]`), true, false))
+	mock.ExpectQuery("INSERT INTO password_reset_tokens").
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), repositories.TokenPurposePasswordReset).
+		WillReturnRows(sqlmock.NewRows([]string{"token"}).AddRow("token-1"))
+	mock.ExpectQuery("INSERT INTO password_reset_tokens").
+		WithArgs(2, sqlmock.AnyArg(), sqlmock.AnyArg(), repositories.TokenPurposePasswordReset).
+		WillReturnRows(sqlmock.NewRows([]string{"token"}).AddRow("token-2"))
+
+	w := postJSON(router, "/auth/forgot-password", ForgotPasswordRequest{UsernameOrEmail: "shared@gov.kz"})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	output := logs.String()
+	if sent := strings.Count(output, "Email would be sent to: shared@gov.kz"); sent != 1 {
+		t.Errorf("Expected one email, got %d:\n%s", sent, output)
+	}
+	for _, link := range []string{
+		"ivanov: https://reports.gov.kz/reset-password?token=token-1",
+		"ivanov2: https://reports.gov.kz/reset-password?token=token-2",
+	} {
+		if !strings.Contains(output, link) {
+			t.Errorf("Expected link %q in email:\n%s", link, output)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestResetPassword_ConsumesTokenBeforeChange проверяет, что токен расходуется атомарно до смены пароля
+func TestResetPassword_ConsumesTokenBeforeChange(t *testing.T) {
+	router, _, mock := setupPasswordResetTest(t)
+
+	mock.ExpectQuery("UPDATE password_reset_tokens(.+)RETURNING user_id").
+		WithArgs("reset-token", repositories.TokenPurposePasswordReset).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(2))
+	mock.ExpectExec("UPDATE users SET password = \\$1").
+		WithArgs(sqlmock.AnyArg(), 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE password_reset_tokens(.+)WHERE user_id = \\$1 AND used = false").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(2, repositories.ActionResetPassword, 2, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	w := postJSON(router, "/auth/reset-password", ResetPasswordRequest{Token: "reset-token", NewPassword: "NewPass456!"})
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestResetPassword_RejectsUnusableToken проверяет, что использованный, истекший токен или токен входа по ссылке
+// не позволяет сменить пароль: условный UPDATE не находит строку
+func TestResetPassword_RejectsUnusableToken(t *testing.T) {
+	router, _, mock := setupPasswordResetTest(t)
+
+	mock.ExpectQuery("UPDATE password_reset_tokens(.+)RETURNING user_id").
+		WithArgs("magic-token", repositories.TokenPurposePasswordReset).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+
+	w := postJSON(router, "/auth/reset-password", ResetPasswordRequest{Token: "magic-token", NewPassword: "NewPass456!"})
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	// Пароль не меняется
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestMagicLinkVerify_Success(t *testing.T) {
+	router, tokens, mock := setupPasswordResetTest(t)
+
+	mock.ExpectQuery("UPDATE password_reset_tokens(.+)RETURNING user_id").
+		WithArgs("magic-token", repositories.TokenPurposeMagicLink).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(2))
+	expectUserRow(mock, 2, "ivanov", "user", 1)
+	mock.ExpectExec("UPDATE users SET is_online").
+		WithArgs(sqlmock.AnyArg(), 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(2, repositories.ActionLogin, nil, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	w := postJSON(router, "/auth/magic-link/verify", VerifyMagicLinkRequest{Token: "magic-token"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if claims, err := tokens.ValidateToken(response.Token); err != nil || claims.UserID != 2 {
+		t.Errorf("ValidateToken() = %+v, %v", claims, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestMagicLinkVerify_RejectsResetToken проверяет, что токен сброса пароля не даёт войти по ссылке:
+// токен ищется только с назначением magic_link
+func TestMagicLinkVerify_RejectsResetToken(t *testing.T) {
+	router, _, mock := setupPasswordResetTest(t)
+
+	mock.ExpectQuery("UPDATE password_reset_tokens(.+)WHERE token = \\$1 AND purpose = \\$2").
+		WithArgs("reset-token", repositories.TokenPurposeMagicLink).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+
+	w := postJSON(router, "/auth/magic-link/verify", VerifyMagicLinkRequest{Token: "reset-token"})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestMagicLinkVerify_UsedOrExpiredToken(t *testing.T) {
+	router, _, mock := setupPasswordResetTest(t)
+
+	// Использованный или истёкший токен не находится запросом
+	mock.ExpectQuery("UPDATE password_reset_tokens(.+)RETURNING user_id").
+		WithArgs("used-token", repositories.TokenPurposeMagicLink).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+
+	w := postJSON(router, "/auth/magic-link/verify", VerifyMagicLinkRequest{Token: "used-token"})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// PersonalDataHandler выгрузка и обезличивание персональных данных уволенных сотрудников
+type PersonalDataHandler struct {
+	personalData *services.PersonalDataService
+	auditLogRepo *repositories.AuditLogRepository
+}
+
+// NewPersonalDataHandler создает новый handler
+func NewPersonalDataHandler(personalData *services.PersonalDataService, auditLogRepo *repositories.AuditLogRepository) *PersonalDataHandler {
+	return &PersonalDataHandler{personalData: personalData, auditLogRepo: auditLogRepo}
+}
+
+// ExportPersonalData godoc
+// @Summary Выгрузка персональных данных пользователя
+// @Description JSON файл со всеми данными пользователя (в том числе из корзины): профиль с дополнительными полями,
+// @Description API ключи и внешние учётные записи, доступы, запросы на изменение и история в журнале аудита
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} services.PersonalDataExport "Файл выгрузки"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /users/{id}/personal-data [get]
+func (h *PersonalDataHandler) ExportPersonalData(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidUserID})
+		return
+	}
+
+	export, err := h.personalData.Export(id)
+	if err != nil {
+		if errors.Is(err, services.ErrPersonalDataUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": errUserNotFound})
+			return
+		}
+		log.Printf("Failed to export personal data of user %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось выгрузить персональные данные"})
+		return
+	}
+
+	logAudit(h.auditLogRepo, c, repositories.ActionExportPersonalData, &id, map[string]interface{}{
+		"audit_entries": len(export.AuditLog),
+	})
+	log.Printf("AUDIT: User %d (%s) exported personal data of user %d", c.GetInt("user_id"), c.GetString("username"), id)
+
+	filename := fmt.Sprintf("personal_data_%d_%s.json", id, time.Now().Format("20060102_150405"))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.JSON(http.StatusOK, export)
+}
+
+// AnonymizeUser godoc
+// @Summary Обезличить пользователя
+// @Description Необратимо стирает ФИО, email, телефоны, дату рождения, адрес, соцсети и аватар заблокированного
+// @Description или удалённого пользователя. ID, логин и журнал аудита сохраняются, ссылки на пользователя остаются целыми
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} map[string]string "Пользователь обезличен"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Failure 409 {object} map[string]string "Пользователь активен или уже обезличен"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /users/{id}/anonymize [post]
+func (h *PersonalDataHandler) AnonymizeUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidUserID})
+		return
+	}
+
+	currentUserID := c.GetInt("user_id")
+	err = h.personalData.Anonymize(id, currentUserID)
+	switch {
+	case errors.Is(err, services.ErrPersonalDataUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": errUserNotFound})
+		return
+	case errors.Is(err, services.ErrUserStillActive):
+		c.JSON(http.StatusConflict, gin.H{"error": "Пользователь активен: сначала заблокируйте или удалите его"})
+		return
+	case errors.Is(err, services.ErrUserAlreadyAnonymized):
+		c.JSON(http.StatusConflict, gin.H{"error": "Пользователь уже обезличен"})
+		return
+	case err != nil:
+		log.Printf("Failed to anonymize user %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось обезличить пользователя"})
+		return
+	}
+
+	logAudit(h.auditLogRepo, c, repositories.ActionAnonymizeUser, &id, map[string]interface{}{
+		"fields": services.AnonymizedFields,
+	})
+	log.Printf("AUDIT: User %d (%s) anonymized user %d", currentUserID, c.GetString("username"), id)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Персональные данные пользователя обезличены"})
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+var personalDataUserCols = []string{"id", "full_name", "username", "avatar_url", "is_active", "role", "created_at",
+	"updated_at", "deleted_at", "anonymized_at"}
+
+func setupPersonalDataTest(t *testing.T, avatarDir string) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	auditLogRepo := repositories.NewAuditLogRepository(sqlxDB)
+	handler := NewPersonalDataHandler(services.NewPersonalDataService(
+		repositories.NewUserRepository(sqlxDB),
+		repositories.NewAPIKeyRepository(sqlxDB),
+		repositories.NewUserIdentityRepository(sqlxDB),
+		repositories.NewAccessGrantRepository(sqlxDB),
+		repositories.NewOrganizationGrantRepository(sqlxDB),
+		repositories.NewChangeRequestRepository(sqlxDB),
+		auditLogRepo,
+		avatarDir,
+	), auditLogRepo)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", 1)
+		c.Set("username", "admin")
+		c.Next()
+	})
+	router.GET("/users/:id/personal-data", handler.ExportPersonalData)
+	router.POST("/users/:id/anonymize", handler.AnonymizeUser)
+	return router, mock
+}
+
+func personalDataUserRow(isActive bool, avatarURL, deletedAt, anonymizedAt interface{}) *sqlmock.Rows {
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	return sqlmock.NewRows(personalDataUserCols).
+		AddRow(5, "Иванов Иван", "ivanov", avatarURL, isActive, "user", now, now, deletedAt, anonymizedAt)
+}
+
+// TestExportPersonalData проверяет, что выгрузка собирает данные из всех таблиц и читает журнал до конца
+func TestExportPersonalData(t *testing.T) {
+	router, mock := setupPersonalDataTest(t, t.TempDir())
+
+	deletedAt := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT (.+) FROM users WHERE id = \$1$`).WithArgs(5).
+		WillReturnRows(personalDataUserRow(false, nil, deletedAt, nil))
+	mock.ExpectQuery("FROM api_keys").WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "prefix", "key_hash", "created_at"}).
+			AddRow(3, 5, "integration", "cr_abc", "hash", deletedAt))
+	mock.ExpectQuery("FROM user_identities").WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "provider", "external_id", "created_at"}))
+	mock.ExpectQuery("FROM user_access_grants").WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "grantee_id", "scope", "valid_from", "created_at"}))
+	mock.ExpectQuery("FROM organization_grants").WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "organization_id", "valid_from", "valid_until", "created_at"}))
+	mock.ExpectQuery("FROM user_change_requests").WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "target_user_id", "status", "created_at"}))
+	mock.ExpectQuery(`FROM audit_log a(.+)WHERE \(a.user_id = \$1 OR a.target_user_id = \$1\)`).WithArgs(5, 1001).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "action", "created_at"}).
+			AddRow(20, "update_user", deletedAt).
+			AddRow(10, "create_user", deletedAt))
+	mock.ExpectExec("INSERT INTO audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/5/personal-data", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var export struct {
+		User struct {
+			Username  string  `json:"username"`
+			DeletedAt *string `json:"deleted_at"`
+		} `json:"user"`
+		APIKeys  []map[string]interface{} `json:"api_keys"`
+		AuditLog []map[string]interface{} `json:"audit_log"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &export); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if export.User.Username != "ivanov" || export.User.DeletedAt == nil {
+		t.Errorf("Unexpected user: %s", w.Body.String())
+	}
+	if len(export.APIKeys) != 1 || export.APIKeys[0]["key_hash"] != nil {
+		t.Errorf("Expected one API key without hash: %v", export.APIKeys)
+	}
+	if len(export.AuditLog) != 2 {
+		t.Errorf("Expected 2 audit entries, got %d", len(export.AuditLog))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestExportPersonalData_NotFound(t *testing.T) {
+	router, mock := setupPersonalDataTest(t, t.TempDir())
+
+	mock.ExpectQuery(`SELECT (.+) FROM users WHERE id = \$1$`).WithArgs(5).WillReturnError(sql.ErrNoRows)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/5/personal-data", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestAnonymizeUser проверяет обезличивание заблокированного пользователя и удаление файла аватара
+func TestAnonymizeUser(t *testing.T) {
+	avatarDir := t.TempDir()
+	avatarFile := filepath.Join(avatarDir, "5_avatar.png")
+	if err := os.WriteFile(avatarFile, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	router, mock := setupPersonalDataTest(t, avatarDir)
+
+	mock.ExpectQuery(`SELECT (.+) FROM users WHERE id = \$1$`).WithArgs(5).
+		WillReturnRows(personalDataUserRow(false, "/uploads/avatars/5_avatar.png", nil, nil))
+	mock.ExpectQuery(`WITH old AS \((.+)anonymized_at IS NULL FOR UPDATE(.+)UPDATE users u SET full_name = 'Обезличенный пользователь ' \|\| u.id`).
+		WithArgs(5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"avatar_url"}).AddRow("/uploads/avatars/5_avatar.png"))
+	mock.ExpectExec("INSERT INTO audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/5/anonymize", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(avatarFile); !os.IsNotExist(err) {
+		t.Errorf("Avatar file was not removed: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestAnonymizeUser_Conflicts(t *testing.T) {
+	tests := []struct {
+		name         string
+		isActive     bool
+		anonymizedAt interface{}
+	}{
+		{"active user", true, nil},
+		{"already anonymized", false, time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := setupPersonalDataTest(t, t.TempDir())
+
+			mock.ExpectQuery(`SELECT (.+) FROM users WHERE id = \$1$`).WithArgs(5).
+				WillReturnRows(personalDataUserRow(tt.isActive, nil, nil, tt.anonymizedAt))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/5/anonymize", nil))
+
+			if w.Code != http.StatusConflict {
+				t.Fatalf("Expected 409, got %d: %s", w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	errInvalidRoleID    = "Неверный ID роли"
+	errRoleNotFound     = "Роль не найдена"
+	errBuiltinRole      = "Встроенные роли нельзя изменять или удалять"
+	errFailedToGetRoles = "Не удалось получить список ролей"
+)
+
+// RoleHandler управляет ролями и их правами
+type RoleHandler struct {
+	roleRepo     *repositories.RoleRepository
+	auditLogRepo *repositories.AuditLogRepository
+	permissions  *auth.PermissionStore
+}
+
+// NewRoleHandler создает новый handler
+func NewRoleHandler(
+	roleRepo *repositories.RoleRepository,
+	auditLogRepo *repositories.AuditLogRepository,
+	permissions *auth.PermissionStore,
+) *RoleHandler {
+	return &RoleHandler{
+		roleRepo:     roleRepo,
+		auditLogRepo: auditLogRepo,
+		permissions:  permissions,
+	}
+}
+
+// ListRoles godoc
+// @Summary Список ролей
+// @Description Возвращает встроенные и пользовательские роли с их правами
+// @Tags roles
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Список ролей"
+// @Failure 403 {object} map[string]string "Недостаточно прав"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /roles [get]
+func (h *RoleHandler) ListRoles(c *gin.Context) {
+	roles, err := h.roleRepo.List()
+	if err != nil {
+		log.Printf("Failed to list roles: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errFailedToGetRoles})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// ListPermissions godoc
+// @Summary Справочник прав
+// @Description Возвращает все права, которые можно включить в роль
+// @Tags roles
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Список прав"
+// @Failure 403 {object} map[string]string "Недостаточно прав"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /permissions [get]
+func (h *RoleHandler) ListPermissions(c *gin.Context) {
+	permissions, err := h.roleRepo.ListPermissions()
+	if err != nil {
+		log.Printf("Failed to list permissions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить список прав"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"permissions": permissions})
+}
+
+// CreateRole godoc
+// @Summary Создать роль
+// @Description Создает пользовательскую роль. Можно включить только права, которые есть у текущего пользователя
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateRoleRequest true "Роль"
+// @Success 201 {object} map[string]interface{} "Роль создана"
+// @Failure 400 {object} map[string]string "Неверные параметры"
+// @Failure 403 {object} map[string]string "Недостаточно прав"
+// @Failure 409 {object} map[string]string "Роль уже существует"
+// @Router /roles [post]
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var req models.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if valid, errMsg := utils.ValidateRoleName(req.Name); !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+
+	permissions, ok := h.validatePermissions(c, req.Permissions)
+	if !ok {
+		return
+	}
+
+	existing, err := h.roleRepo.GetByName(req.Name)
+	if err != nil {
+		log.Printf("Failed to check role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать роль"})
+		return
+	}
+	if existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Роль с таким именем уже существует"})
+		return
+	}
+
+	currentUserID := c.GetInt("user_id")
+	role := repositories.Role{
+		Name:        req.Name,
+		Description: sql.NullString{String: utils.SanitizeString(req.Description), Valid: req.Description != ""},
+		Permissions: permissions,
+		CreatedBy:   sql.NullInt64{Int64: int64(currentUserID), Valid: true},
+	}
+	if err := h.roleRepo.Create(&role); err != nil {
+		log.Printf("Failed to create role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать роль"})
+		return
+	}
+	h.permissions.Invalidate()
+
+	logAudit(h.auditLogRepo, c, repositories.ActionCreateRole, nil, map[string]interface{}{
+		"role":        role.Name,
+		"permissions": permissions,
+	})
+	log.Printf("AUDIT: User %d created role %s with permissions %v", currentUserID, role.Name, permissions)
+
+	c.JSON(http.StatusCreated, gin.H{"role": role})
+}
+
+// UpdateRole godoc
+// @Summary Изменить роль
+// @Description Меняет описание и права пользовательской роли (права заменяются целиком)
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID роли"
+// @Param request body models.UpdateRoleRequest true "Описание и права"
+// @Success 200 {object} map[string]interface{} "Роль изменена"
+// @Failure 400 {object} map[string]string "Неверные параметры"
+// @Failure 403 {object} map[string]string "Недостаточно прав или встроенная роль"
+// @Failure 404 {object} map[string]string "Роль не найдена"
+// @Router /roles/{id} [put]
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	role, ok := h.loadCustomRole(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	permissions, ok := h.validatePermissions(c, req.Permissions)
+	if !ok {
+		return
+	}
+
+	description := sql.NullString{String: utils.SanitizeString(req.Description), Valid: req.Description != ""}
+	updated, err := h.roleRepo.Update(role.ID, description, permissions)
+	if err != nil {
+		log.Printf("Failed to update role %d: %v", role.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось изменить роль"})
+		return
+	}
+	if !updated {
+		c.JSON(http.StatusNotFound, gin.H{"error": errRoleNotFound})
+		return
+	}
+	h.permissions.Invalidate()
+
+	logAudit(h.auditLogRepo, c, repositories.ActionUpdateRole, nil, map[string]interface{}{
+		"role":            role.Name,
+		"old_permissions": role.Permissions,
+		"new_permissions": permissions,
+	})
+	log.Printf("AUDIT: User %d changed role %s permissions to %v", c.GetInt("user_id"), role.Name, permissions)
+
+	updatedRole, err := h.roleRepo.GetByID(role.ID)
+	if err != nil || updatedRole == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить роль"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"role": updatedRole})
+}
+
+// DeleteRole godoc
+// @Summary Удалить роль
+// @Description Удаляет пользовательскую роль, если она не назначена ни одному пользователю
+// @Tags roles
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID роли"
+// @Success 200 {object} map[string]string "Роль удалена"
+// @Failure 403 {object} map[string]string "Недостаточно прав или встроенная роль"
+// @Failure 404 {object} map[string]string "Роль не найдена"
+// @Failure 409 {object} map[string]interface{} "Роль назначена пользователям"
+// @Router /roles/{id} [delete]
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	role, ok := h.loadCustomRole(c)
+	if !ok {
+		return
+	}
+
+	count, err := h.roleRepo.CountUsers(role.Name)
+	if err != nil {
+		log.Printf("Failed to count users with role %s: %v", role.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось удалить роль"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":       "Роль назначена пользователям, сначала смените им роль",
+			"users_count": count,
+		})
+		return
+	}
+
+	deleted, err := h.roleRepo.Delete(role.ID)
+	if err != nil {
+		log.Printf("Failed to delete role %d: %v", role.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось удалить роль"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": errRoleNotFound})
+		return
+	}
+	h.permissions.Invalidate()
+
+	logAudit(h.auditLogRepo, c, repositories.ActionDeleteRole, nil, map[string]interface{}{
+		"role": role.Name,
+	})
+	log.Printf("AUDIT: User %d deleted role %s", c.GetInt("user_id"), role.Name)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Роль удалена"})
+}
+
+// loadCustomRole загружает роль из параметра :id и проверяет, что она не встроенная
+func (h *RoleHandler) loadCustomRole(c *gin.Context) (*repositories.Role, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidRoleID})
+		return nil, false
+	}
+
+	role, err := h.roleRepo.GetByID(id)
+	if err != nil {
+		log.Printf("Failed to get role %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errFailedToGetRoles})
+		return nil, false
+	}
+	if role == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errRoleNotFound})
+		return nil, false
+	}
+	if role.IsBuiltin {
+		c.JSON(http.StatusForbidden, gin.H{"error": errBuiltinRole})
+		return nil, false
+	}
+	return role, true
+}
+
+// validatePermissions проверяет, что права есть в справочнике и у текущего пользователя
+func (h *RoleHandler) validatePermissions(c *gin.Context, codes []string) ([]string, bool) {
+	catalog, err := h.roleRepo.ListPermissions()
+	if err != nil {
+		log.Printf("Failed to list permissions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить список прав"})
+		return nil, false
+	}
+
+	known := auth.PermissionSet{}
+	for _, permission := range catalog {
+		known[permission.Code] = true
+	}
+
+	requested := auth.NewPermissionSet(codes...)
+	for code := range requested {
+		if !known[code] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неизвестное право: " + code})
+			return nil, false
+		}
+	}
+
+	// Нельзя выдать право, которого нет у себя
+	if !auth.Permissions(c).Contains(requested) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нельзя включить в роль права, которых нет у вас"})
+		return nil, false
+	}
+
+	return requested.List(), true
+}
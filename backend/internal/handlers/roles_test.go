@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// staticRoles права ролей без БД
+type staticRoles map[models.UserRole][]string
+
+func (r staticRoles) LoadRolePermissions() (map[models.UserRole][]string, error) {
+	return r, nil
+}
+
+// builtinPermissionStore права встроенных ролей, как после миграции 007
+func builtinPermissionStore() *auth.PermissionStore {
+	return auth.NewPermissionStore(staticRoles{
+		models.RoleAdmin: {
+			auth.PermUsersRead, auth.PermUsersReadAll, auth.PermUsersCreate, auth.PermUsersUpdate,
+			auth.PermUsersUpdateOrgs, auth.PermUsersUpdateRole, auth.PermUsersUpdateCredentials,
+			auth.PermUsersUpdateAccess, auth.PermUsersDelete, auth.PermUsersImpersonate,
+			auth.PermProfileUpdate, auth.PermAPIKeysManage, auth.PermRolesManage, auth.PermOrgsManage,
+			auth.PermReportsRunPayroll, auth.PermUsersApproveChanges, auth.PermAuditRead,
+			auth.PermUsersPersonalData, auth.PermCustomFieldsManage, auth.PermTagsManage,
+		},
+		models.RoleModerator: {auth.PermUsersRead, auth.PermUsersUpdateOrgs, auth.PermProfileUpdate},
+		models.RoleUser:      {auth.PermProfileUpdate},
+	})
+}
+
+// roleHelpdesk собственная роль поддержки: создаёт пользователей, меняет профили и роли, блокирует, сбрасывает пароли
+const roleHelpdesk models.UserRole = "helpdesk"
+
+var helpdeskPermissions = []string{
+	auth.PermUsersRead, auth.PermUsersReadAll, auth.PermUsersCreate, auth.PermUsersUpdate, auth.PermUsersUpdateRole,
+	auth.PermUsersUpdateCredentials, auth.PermUsersDelete, auth.PermUsersImpersonate, auth.PermProfileUpdate,
+}
+
+// customRolePermissionStore встроенные роли и собственная роль roleHelpdesk
+func customRolePermissionStore() *auth.PermissionStore {
+	return auth.NewPermissionStore(staticRoles{
+		models.RoleAdmin:     builtinPermissionStore().Permissions(models.RoleAdmin).List(),
+		models.RoleModerator: builtinPermissionStore().Permissions(models.RoleModerator).List(),
+		models.RoleUser:      builtinPermissionStore().Permissions(models.RoleUser).List(),
+		roleHelpdesk:         helpdeskPermissions,
+	})
+}
+
+func setupRoleTest(t *testing.T, role models.UserRole) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := builtinPermissionStore()
+	handler := NewRoleHandler(
+		repositories.NewRoleRepository(sqlxDB),
+		repositories.NewAuditLogRepository(sqlxDB),
+		store,
+	)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", 1)
+		c.Set("role", role)
+		c.Next()
+	})
+	router.Use(auth.LoadPermissions(store))
+	router.Use(auth.RequirePermission(auth.PermRolesManage))
+	router.POST("/roles", handler.CreateRole)
+	router.DELETE("/roles/:id", handler.DeleteRole)
+	return router, mock
+}
+
+func expectPermissionCatalog(mock sqlmock.Sqlmock, codes ...string) {
+	rows := sqlmock.NewRows([]string{"code", "description"})
+	for _, code := range codes {
+		rows.AddRow(code, code)
+	}
+	mock.ExpectQuery("SELECT code, description FROM permissions").WillReturnRows(rows)
+}
+
+func expectRoleRow(mock sqlmock.Sqlmock, id int, name string, builtin bool) {
+	mock.ExpectQuery("SELECT (.+) FROM roles r(.+)WHERE r.id = \\$1").
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "is_builtin", "permissions"}).
+			AddRow(id, name, builtin, pq.StringArray{auth.PermUsersRead}))
+}
+
+func TestCreateRole_Success(t *testing.T) {
+	router, mock := setupRoleTest(t, models.RoleAdmin)
+
+	expectPermissionCatalog(mock, auth.PermUsersRead, auth.PermReportsRunPayroll)
+	mock.ExpectQuery("SELECT (.+) FROM roles r(.+)WHERE r.name = \\$1").
+		WithArgs("payroll").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO roles").
+		WithArgs("payroll", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(4, time.Now(), time.Now()))
+	mock.ExpectExec("DELETE FROM role_permissions").WithArgs(4).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO role_permissions").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(1, repositories.ActionCreateRole, nil, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	w := postJSON(router, "/roles", models.CreateRoleRequest{
+		Name:        "payroll",
+		Permissions: []string{auth.PermReportsRunPayroll, auth.PermUsersRead},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCreateRole_Validation(t *testing.T) {
+	tests := []struct {
+		name        string
+		role        models.UserRole
+		request     models.CreateRoleRequest
+		withCatalog bool
+		wantStatus  int
+	}{
+		{
+			name:       "Without roles.manage",
+			role:       models.RoleModerator,
+			request:    models.CreateRoleRequest{Name: "auditor"},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Invalid name",
+			role:       models.RoleAdmin,
+			request:    models.CreateRoleRequest{Name: "Auditors!"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "Unknown permission",
+			role:        models.RoleAdmin,
+			request:     models.CreateRoleRequest{Name: "auditor", Permissions: []string{"users.everything"}},
+			withCatalog: true,
+			wantStatus:  http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := setupRoleTest(t, tt.role)
+			if tt.withCatalog {
+				expectPermissionCatalog(mock, auth.PermUsersRead)
+			}
+
+			w := postJSON(router, "/roles", tt.request)
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d. Body: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateRole_CannotGrantMissingPermissions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	// Делегированный администратор ролей без права удалять пользователей
+	store := auth.NewPermissionStore(staticRoles{
+		"role-admin": {auth.PermRolesManage, auth.PermUsersRead},
+	})
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	handler := NewRoleHandler(repositories.NewRoleRepository(sqlxDB), repositories.NewAuditLogRepository(sqlxDB), store)
+
+	router := gin.New()
+	router.POST("/roles", func(c *gin.Context) {
+		c.Set("user_id", 5)
+		c.Set("role", models.UserRole("role-admin"))
+		c.Next()
+	}, auth.LoadPermissions(store), handler.CreateRole)
+
+	expectPermissionCatalog(mock, auth.PermUsersRead, auth.PermUsersDelete)
+
+	w := postJSON(router, "/roles", models.CreateRoleRequest{
+		Name:        "cleaner",
+		Permissions: []string{auth.PermUsersRead, auth.PermUsersDelete},
+	})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDeleteRole(t *testing.T) {
+	tests := []struct {
+		name       string
+		builtin    bool
+		usersCount int
+		wantStatus int
+	}{
+		{"Builtin role", true, 0, http.StatusForbidden},
+		{"Role assigned to users", false, 3, http.StatusConflict},
+		{"Unused custom role", false, 0, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := setupRoleTest(t, models.RoleAdmin)
+
+			expectRoleRow(mock, 7, "auditor", tt.builtin)
+			if !tt.builtin {
+				mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE role = \\$1").
+					WithArgs("auditor").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.usersCount))
+			}
+			if tt.wantStatus == http.StatusOK {
+				mock.ExpectExec("DELETE FROM roles WHERE id = \\$1 AND is_builtin = false").
+					WithArgs(7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO audit_log").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+
+			req, _ := http.NewRequest("DELETE", "/roles/7", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d. Body: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
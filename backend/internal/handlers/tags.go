@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Максимальная длина тега (в символах)
+const maxTagLength = 100
+
+// RenameTagRequest переименование тега у всех пользователей
+type RenameTagRequest struct {
+	From string `json:"from" binding:"required"`
+	To   string `json:"to" binding:"required"`
+}
+
+// MergeTagsRequest слияние нескольких тегов в один
+type MergeTagsRequest struct {
+	Tags []string `json:"tags" binding:"required"`
+	Into string   `json:"into" binding:"required"`
+}
+
+// TagHandler каталог тегов пользователей
+type TagHandler struct {
+	tagRepo      *repositories.TagRepository
+	auditLogRepo *repositories.AuditLogRepository
+}
+
+// NewTagHandler создает новый handler
+func NewTagHandler(tagRepo *repositories.TagRepository, auditLogRepo *repositories.AuditLogRepository) *TagHandler {
+	return &TagHandler{
+		tagRepo:      tagRepo,
+		auditLogRepo: auditLogRepo,
+	}
+}
+
+// ListTags godoc
+// @Summary Каталог тегов
+// @Description Все теги пользователей с числом пользователей, самые частые первыми (без корзины).
+// @Description Без права users.read.all учитываются только доступные пользователи
+// @Tags tags
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Список тегов"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /tags [get]
+func (h *TagHandler) ListTags(c *gin.Context) {
+	accessibleTo := 0
+	if !auth.HasPermission(c, auth.PermUsersReadAll) {
+		accessibleTo = c.GetInt("user_id")
+	}
+
+	tags, err := h.tagRepo.ListTags(accessibleTo)
+	if err != nil {
+		log.Printf("Failed to list tags: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить список тегов"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// RenameTag godoc
+// @Summary Переименовать тег
+// @Description Заменяет тег from на to у всех пользователей (включая корзину) одной операцией.
+// @Description Если у пользователя уже есть тег to, повтор не добавляется
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body RenameTagRequest true "Старое и новое название"
+// @Success 200 {object} map[string]interface{} "Число изменённых пользователей"
+// @Failure 400 {object} map[string]string "Неверные параметры"
+// @Router /tags/rename [post]
+func (h *TagHandler) RenameTag(c *gin.Context) {
+	var req RenameTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	from, to := normalizeTag(req.From), normalizeTag(req.To)
+	if !checkTagName(c, to) {
+		return
+	}
+	if from == "" || from == to {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Новое название тега должно отличаться от старого"})
+		return
+	}
+
+	h.replaceTags(c, repositories.ActionRenameTag, []string{from}, to, map[string]interface{}{
+		"from": from,
+		"to":   to,
+	})
+}
+
+// MergeTags godoc
+// @Summary Объединить теги
+// @Description Заменяет все теги из tags на into у всех пользователей (включая корзину) одной операцией
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MergeTagsRequest true "Объединяемые теги и итоговый тег"
+// @Success 200 {object} map[string]interface{} "Число изменённых пользователей"
+// @Failure 400 {object} map[string]string "Неверные параметры"
+// @Router /tags/merge [post]
+func (h *TagHandler) MergeTags(c *gin.Context) {
+	var req MergeTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	into := normalizeTag(req.Into)
+	if !checkTagName(c, into) {
+		return
+	}
+	sources := []string{}
+	seen := map[string]bool{into: true}
+	for _, tag := range req.Tags {
+		if tag = normalizeTag(tag); tag != "" && !seen[tag] {
+			seen[tag] = true
+			sources = append(sources, tag)
+		}
+	}
+	if len(sources) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите теги, которые нужно объединить"})
+		return
+	}
+
+	h.replaceTags(c, repositories.ActionMergeTags, sources, into, map[string]interface{}{
+		"tags": sources,
+		"into": into,
+	})
+}
+
+// DeleteTag godoc
+// @Summary Удалить тег
+// @Description Убирает тег у всех пользователей (включая корзину) одной операцией
+// @Tags tags
+// @Produce json
+// @Security BearerAuth
+// @Param tag query string true "Тег"
+// @Success 200 {object} map[string]interface{} "Число изменённых пользователей"
+// @Failure 400 {object} map[string]string "Не указан тег"
+// @Router /tags [delete]
+func (h *TagHandler) DeleteTag(c *gin.Context) {
+	tag := normalizeTag(c.Query("tag"))
+	if tag == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите тег"})
+		return
+	}
+
+	h.replaceTags(c, repositories.ActionDeleteTag, []string{tag}, "", map[string]interface{}{
+		"tag": tag,
+	})
+}
+
+// replaceTags применяет замену тегов и пишет одну запись аудита со списком изменённых пользователей
+func (h *TagHandler) replaceTags(c *gin.Context, action string, sources []string, target string, details map[string]interface{}) {
+	currentUserID := c.GetInt("user_id")
+
+	ids, err := h.tagRepo.ReplaceTags(sources, target, currentUserID)
+	if err != nil {
+		log.Printf("Failed to %s %v: %v", action, sources, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось изменить теги"})
+		return
+	}
+
+	details["user_ids"] = ids
+	logAudit(h.auditLogRepo, c, action, nil, details)
+	log.Printf("AUDIT: User %d %s %v -> %q (%d users)", currentUserID, action, sources, target, len(ids))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       fmt.Sprintf("Теги изменены у пользователей: %d", len(ids)),
+		"updated_users": len(ids),
+	})
+}
+
+// normalizeTag очищает тег так же, как при импорте пользователей
+func normalizeTag(tag string) string {
+	return strings.TrimSpace(utils.SanitizeString(tag))
+}
+
+// checkTagName проверяет итоговое название тега
+func checkTagName(c *gin.Context, tag string) bool {
+	if tag == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите новое название тега"})
+		return false
+	}
+	if utf8.RuneCountInString(tag) > maxTagLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Тег длиннее %d символов", maxTagLength)})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+func setupTagTest(t *testing.T, role models.UserRole) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := builtinPermissionStore()
+	handler := NewTagHandler(repositories.NewTagRepository(sqlxDB), repositories.NewAuditLogRepository(sqlxDB))
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", 1)
+		c.Set("username", "admin")
+		c.Set("role", role)
+		c.Next()
+	}, auth.LoadPermissions(store))
+	router.GET("/tags", handler.ListTags)
+	router.POST("/tags/rename", handler.RenameTag)
+	router.POST("/tags/merge", handler.MergeTags)
+	router.DELETE("/tags", handler.DeleteTag)
+	return router, mock
+}
+
+func TestListTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		role  models.UserRole
+		query string
+		args  []driver.Value
+	}{
+		{
+			name:  "Admin counts all users",
+			role:  models.RoleAdmin,
+			query: `FROM users, jsonb_array_elements_text\(users.tags\) AS t\(tag\)\s+WHERE deleted_at IS NULL\s+GROUP BY`,
+		},
+		{
+			name:  "Moderator counts accessible users",
+			role:  models.RoleModerator,
+			query: `FROM users, jsonb_array_elements_text\(users.tags\)(.+)g.grantee_id = \$1`,
+			args:  []driver.Value{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := setupTagTest(t, tt.role)
+
+			mock.ExpectQuery(tt.query).
+				WithArgs(tt.args...).
+				WillReturnRows(sqlmock.NewRows([]string{"tag", "count"}).
+					AddRow("бухгалтерия", 12).
+					AddRow("удалённо", 3))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/tags", nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+			}
+			var response struct {
+				Tags []repositories.TagUsage `json:"tags"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if len(response.Tags) != 2 || response.Tags[0].Tag != "бухгалтерия" || response.Tags[0].Count != 12 {
+				t.Errorf("Unexpected tags: %+v", response.Tags)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestReplaceTags(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		sources    string
+		target     interface{}
+		action     string
+		wantStatus int
+	}{
+		{
+			name:       "Rename",
+			method:     "POST",
+			url:        "/tags/rename",
+			body:       `{"from":" бухгалтерия ","to":"Бухгалтерия"}`,
+			sources:    `{"бухгалтерия"}`,
+			target:     "Бухгалтерия",
+			action:     repositories.ActionRenameTag,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Merge skips target and duplicates",
+			method:     "POST",
+			url:        "/tags/merge",
+			body:       `{"tags":["бух","бухгалтерия","бух",""],"into":"бухгалтерия"}`,
+			sources:    `{"бух"}`,
+			target:     "бухгалтерия",
+			action:     repositories.ActionMergeTags,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Delete",
+			method:     "DELETE",
+			url:        "/tags?tag=" + url.QueryEscape("удалённо"),
+			sources:    `{"удалённо"}`,
+			target:     nil,
+			action:     repositories.ActionDeleteTag,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Rename to the same name",
+			method:     "POST",
+			url:        "/tags/rename",
+			body:       `{"from":"бухгалтерия","to":" бухгалтерия"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Merge into itself only",
+			method:     "POST",
+			url:        "/tags/merge",
+			body:       `{"tags":["бухгалтерия"],"into":"бухгалтерия"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Too long name",
+			method:     "POST",
+			url:        "/tags/rename",
+			body:       `{"from":"бух","to":"` + strings.Repeat("я", maxTagLength+1) + `"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Delete without tag",
+			method:     "DELETE",
+			url:        "/tags",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := setupTagTest(t, models.RoleAdmin)
+			if tt.wantStatus == http.StatusOK {
+				mock.ExpectQuery(`UPDATE users SET(.+)WHERE tags \?\| \$1\s+RETURNING id`).
+					WithArgs(tt.sources, tt.target, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(5))
+				mock.ExpectExec("INSERT INTO audit_log").
+					WithArgs(1, tt.action, nil, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d. Body: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK && !strings.Contains(w.Body.String(), `"updated_users":2`) {
+				t.Errorf("Unexpected response: %s", w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/policy"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/gin-gonic/gin"
+)
+
+// Пользователей в одной массовой операции (по списку ID или по фильтру)
+const maxBulkUsers = 1000
+
+// Массовые операции над пользователями
+const (
+	bulkBlock              = "block"
+	bulkUnblock            = "unblock"
+	bulkChangeRole         = "change_role"
+	bulkAssignOrganization = "assign_organizations"
+	bulkAddTags            = "add_tags"
+	bulkForcePasswordReset = "force_password_reset"
+)
+
+// Результаты операции для отдельного пользователя
+const (
+	bulkStatusUpdated         = "updated"
+	bulkStatusUnchanged       = "unchanged"
+	bulkStatusPendingApproval = "pending_approval"
+	bulkStatusDenied          = "denied"
+	bulkStatusNotFound        = "not_found"
+	bulkStatusFailed          = "failed"
+)
+
+// BulkUserFilter выбор пользователей теми же фильтрами, что и в списке
+type BulkUserFilter struct {
+	Search     string   `json:"search"`
+	Role       string   `json:"role"`
+	IsActive   *bool    `json:"is_active"`
+	Department string   `json:"department"`
+	TagsAny    []string `json:"tags_any"`
+	TagsAll    []string `json:"tags_all"`
+}
+
+// BulkUserRequest массовая операция над пользователями из ids или filter (ровно одно из двух)
+type BulkUserRequest struct {
+	IDs       []int           `json:"ids"`
+	Filter    *BulkUserFilter `json:"filter"`
+	Operation string          `json:"operation" binding:"required"`
+	// Причина блокировки (block)
+	Reason string `json:"reason"`
+	// Новая роль (change_role)
+	Role models.UserRole `json:"role"`
+	// Добавляемые организации (assign_organizations); уже назначенные сохраняются
+	OrganizationIDs []int `json:"organization_ids"`
+	// Добавляемые теги (add_tags)
+	Tags []string `json:"tags"`
+}
+
+// BulkUserResult результат операции для одного пользователя
+type BulkUserResult struct {
+	ID              int             `json:"id"`
+	Status          string          `json:"status"`
+	Error           string          `json:"error,omitempty"`
+	DeniedFields    []policy.Denial `json:"denied_fields,omitempty"`
+	ChangeRequestID int             `json:"change_request_id,omitempty"`
+}
+
+// BulkUserResponse отчёт о массовой операции
+type BulkUserResponse struct {
+	Operation string           `json:"operation"`
+	Total     int              `json:"total"`
+	Updated   int              `json:"updated"`
+	Unchanged int              `json:"unchanged"`
+	Pending   int              `json:"pending_approval"`
+	Failed    int              `json:"failed"`
+	Results   []BulkUserResult `json:"results"`
+}
+
+// bulkOperation изменение, которое операция вносит пользователю
+type bulkOperation struct {
+	// check - запрос, по которому проверяются права (какие поля меняются)
+	check models.UpdateUserRequest
+	// build - изменение конкретного пользователя; false - менять нечего
+	build func(current *models.User) (models.UpdateUserRequest, bool)
+}
+
+// newBulkOperation проверяет параметры операции; пустой текст ошибки - операция корректна
+func (h *UserHandler) newBulkOperation(c *gin.Context, req BulkUserRequest) (bulkOperation, int, string) {
+	active, blocked := true, false
+
+	switch req.Operation {
+	case bulkBlock:
+		update := models.UpdateUserRequest{IsActive: &blocked, BlockedReason: strings.TrimSpace(req.Reason)}
+		return bulkOperation{check: update, build: func(current *models.User) (models.UpdateUserRequest, bool) {
+			return update, current.IsActive
+		}}, http.StatusOK, ""
+
+	case bulkUnblock:
+		update := models.UpdateUserRequest{IsActive: &active}
+		return bulkOperation{check: update, build: func(current *models.User) (models.UpdateUserRequest, bool) {
+			return update, !current.IsActive
+		}}, http.StatusOK, ""
+
+	case bulkChangeRole:
+		if req.Role == "" {
+			return bulkOperation{}, http.StatusBadRequest, "Не указана роль"
+		}
+		if status, errMsg := h.roleAssignmentError(c, req.Role); errMsg != "" {
+			return bulkOperation{}, status, errMsg
+		}
+		update := models.UpdateUserRequest{Role: req.Role}
+		return bulkOperation{check: update, build: func(current *models.User) (models.UpdateUserRequest, bool) {
+			return update, current.Role != req.Role
+		}}, http.StatusOK, ""
+
+	case bulkAssignOrganization:
+		if len(req.OrganizationIDs) == 0 {
+			return bulkOperation{}, http.StatusBadRequest, "Не указаны организации"
+		}
+		orgs, err := h.organizationRepo.GetAll()
+		if err != nil {
+			log.Printf("Failed to get organizations: %v", err)
+			return bulkOperation{}, http.StatusInternalServerError, "Не удалось получить список организаций"
+		}
+		known := make(map[int]bool, len(orgs))
+		for _, org := range orgs {
+			known[org.ID] = true
+		}
+		for _, id := range req.OrganizationIDs {
+			if !known[id] {
+				return bulkOperation{}, http.StatusBadRequest, fmt.Sprintf("Неизвестная организация: %d", id)
+			}
+		}
+		return bulkOperation{
+			check: models.UpdateUserRequest{AvailableOrganizations: req.OrganizationIDs},
+			build: func(current *models.User) (models.UpdateUserRequest, bool) {
+				merged, added := mergeInts(current.AvailableOrganizations, req.OrganizationIDs)
+				return models.UpdateUserRequest{AvailableOrganizations: merged}, added
+			},
+		}, http.StatusOK, ""
+
+	case bulkAddTags:
+		tags := splitImportList(strings.Join(req.Tags, ";"))
+		if len(tags) == 0 {
+			return bulkOperation{}, http.StatusBadRequest, "Не указаны теги"
+		}
+		return bulkOperation{
+			check: models.UpdateUserRequest{Tags: tags},
+			build: func(current *models.User) (models.UpdateUserRequest, bool) {
+				merged, added := mergeStrings(current.Tags, tags)
+				return models.UpdateUserRequest{Tags: merged}, added
+			},
+		}, http.StatusOK, ""
+
+	case bulkForcePasswordReset:
+		update := models.UpdateUserRequest{RequirePasswordChange: &active}
+		return bulkOperation{check: update, build: func(current *models.User) (models.UpdateUserRequest, bool) {
+			// Сервисные учётные записи входят только по API ключам - пароль у них не меняется
+			return update, !current.RequirePasswordChange && !current.IsServiceAccount
+		}}, http.StatusOK, ""
+	}
+
+	return bulkOperation{}, http.StatusBadRequest, fmt.Sprintf("Неизвестная операция: %s", req.Operation)
+}
+
+// BulkUpdateUsers godoc
+// @Summary Массовая операция над пользователями
+// @Description Блокирует (block, reason), разблокирует (unblock), меняет роль (change_role, role), добавляет организации (assign_organizations, organization_ids), теги (add_tags, tags) или требует смены пароля при следующем входе (force_password_reset) у пользователей из ids или подходящих под filter (до 1000). Права проверяются для каждого пользователя как при обычном изменении; разрешённые изменения применяются одной транзакцией. Изменения, требующие подтверждения, оформляются запросами на подтверждение в той же транзакции. По каждому изменённому пользователю в журнал аудита пишется одна запись
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body BulkUserRequest true "Операция и пользователи"
+// @Success 200 {object} BulkUserResponse "Результат по каждому пользователю"
+// @Failure 400 {object} map[string]string "Неверная операция или выбор пользователей"
+// @Failure 403 {object} map[string]string "Роль нельзя назначить"
+// @Failure 500 {object} map[string]string "Ошибка сервера: изменения не применены"
+// @Router /users/bulk [post]
+func (h *UserHandler) BulkUpdateUsers(c *gin.Context) {
+	var req BulkUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (len(req.IDs) == 0) == (req.Filter == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите либо ids, либо filter"})
+		return
+	}
+
+	op, status, errMsg := h.newBulkOperation(c, req)
+	if errMsg != "" {
+		c.JSON(status, gin.H{"error": errMsg})
+		return
+	}
+
+	currentUserID := c.GetInt("user_id")
+	readAll := auth.HasPermission(c, auth.PermUsersReadAll)
+
+	ids, accessible, ok := h.bulkTargets(c, req, currentUserID, readAll)
+	if !ok {
+		return
+	}
+
+	// Права проверяются до изменений: отказ по одному пользователю не мешает остальным
+	actor := policy.Actor{ID: currentUserID, Permissions: auth.Permissions(c)}
+	results := make(map[int]*BulkUserResult, len(ids))
+	allowed := make([]int, 0, len(ids))
+	for _, id := range ids {
+		result := &BulkUserResult{ID: id}
+		results[id] = result
+
+		target := policy.Target{ID: id, Accessible: readAll || accessible[id]}
+		if decision := policy.EvaluateUpdate(actor, target, op.check); !decision.OK() {
+			result.Status = bulkStatusDenied
+			result.DeniedFields = decision.Denied
+			continue
+		}
+		allowed = append(allowed, id)
+	}
+
+	// Чувствительные изменения откладываются до подтверждения, как в UpdateUser;
+	// запросы на подтверждение сохраняются в той же транзакции, что и остальные изменения
+	pending := map[int]policy.Approval{}
+	requests := map[int]*repositories.ChangeRequest{}
+	outranked := map[int][]policy.Denial{}
+	unprepared := map[int]bool{}
+	changes := map[int]repositories.UserChanges{}
+	if len(allowed) > 0 {
+		var err error
+		changes, err = h.userRepo.UpdateBatch(allowed, currentUserID, func(current *models.User) (models.UpdateUserRequest, *repositories.ChangeRequest, bool) {
+			// Права роли сверяются по заблокированной строке: роль не сменится до конца транзакции
+			target := policy.Target{ID: current.ID, Accessible: true, Permissions: h.permissions.Permissions(current.Role)}
+			if decision := policy.EvaluateUpdate(actor, target, op.check); !decision.OK() {
+				outranked[current.ID] = decision.Denied
+				return models.UpdateUserRequest{}, nil, false
+			}
+
+			update, ok := op.build(current)
+			if !ok || len(h.approvalRules) == 0 {
+				return update, nil, ok
+			}
+			approval := policy.SplitForApproval(current, update, h.approvalRules, h.permissions)
+			if !approval.Required() {
+				return update, nil, true
+			}
+			request, err := h.newChangeRequest(c, current.ID, approval)
+			if err != nil {
+				// Запрос не сериализуется - пользователь не меняется совсем
+				log.Printf("Failed to prepare change request for user %d: %v", current.ID, err)
+				unprepared[current.ID] = true
+				return models.UpdateUserRequest{}, nil, false
+			}
+			pending[current.ID] = approval
+			requests[current.ID] = request
+			return approval.Immediate, request, policy.HasChanges(approval.Immediate)
+		})
+		if err != nil {
+			log.Printf("Bulk %s failed, nothing applied: %v", req.Operation, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось выполнить операцию: изменения не применены"})
+			return
+		}
+	}
+
+	for _, id := range allowed {
+		result := results[id]
+		userChanges, found := changes[id]
+		if denied, ok := outranked[id]; ok {
+			result.Status = bulkStatusDenied
+			result.DeniedFields = denied
+			continue
+		}
+		if !found {
+			result.Status = bulkStatusNotFound
+			continue
+		}
+		if unprepared[id] {
+			result.Status = bulkStatusFailed
+			result.Error = errFailedToCreateChangeRequest
+			continue
+		}
+
+		// Одна запись журнала на пользователя: применённые изменения и созданный запрос на подтверждение
+		var record repositories.AuditRecord
+		request, requested := requests[id]
+		switch {
+		case len(userChanges) > 0:
+			result.Status = bulkStatusUpdated
+			record = userChanges.AuditRecord(repositories.ActionUpdateUser)
+			if requested {
+				record.Details["change_request"] = changeRequestDetails(request, pending[id])
+			}
+		case requested:
+			record = repositories.AuditRecord{Action: repositories.ActionChangeRequested, Details: changeRequestDetails(request, pending[id])}
+		default:
+			result.Status = bulkStatusUnchanged
+			continue
+		}
+		if requested {
+			result.Status = bulkStatusPendingApproval
+			result.ChangeRequestID = request.ID
+		}
+		record.Details["bulk_operation"] = req.Operation
+		logAudit(h.auditLogRepo, c, record.Action, &id, record.Details)
+	}
+
+	response := BulkUserResponse{Operation: req.Operation, Total: len(ids), Results: make([]BulkUserResult, 0, len(ids))}
+	for _, id := range ids {
+		result := results[id]
+		switch result.Status {
+		case bulkStatusUpdated:
+			response.Updated++
+		case bulkStatusUnchanged:
+			response.Unchanged++
+		case bulkStatusPendingApproval:
+			response.Pending++
+		default:
+			response.Failed++
+		}
+		response.Results = append(response.Results, *result)
+	}
+
+	log.Printf("AUDIT: User %d (%s) bulk %s: %d users, %d updated, %d pending, %d failed",
+		currentUserID, c.GetString("username"), req.Operation, response.Total, response.Updated, response.Pending, response.Failed)
+	c.JSON(http.StatusOK, response)
+}
+
+// bulkTargets ID пользователей операции и те из них, что доступны без users.read.all
+func (h *UserHandler) bulkTargets(c *gin.Context, req BulkUserRequest, currentUserID int, readAll bool) ([]int, map[int]bool, bool) {
+	if req.Filter != nil {
+		params := repositories.PaginationParams{
+			Search:     req.Filter.Search,
+			Role:       req.Filter.Role,
+			IsActive:   req.Filter.IsActive,
+			Department: req.Filter.Department,
+			TagsAny:    req.Filter.TagsAny,
+			TagsAll:    req.Filter.TagsAll,
+		}
+		if !readAll {
+			params.AccessibleTo = currentUserID
+		}
+		ids, err := h.userRepo.FilteredIDs(params, maxBulkUsers+1)
+		if err != nil {
+			log.Printf("Failed to select users for bulk operation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": errFailedToGetUsers})
+			return nil, nil, false
+		}
+		if len(ids) > maxBulkUsers {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Под фильтр попадает больше %d пользователей - уточните фильтр", maxBulkUsers)})
+			return nil, nil, false
+		}
+		// Фильтр уже ограничен доступными пользователями
+		accessible := make(map[int]bool, len(ids))
+		for _, id := range ids {
+			accessible[id] = true
+		}
+		return ids, accessible, true
+	}
+
+	ids := make([]int, 0, len(req.IDs))
+	seen := make(map[int]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if id <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidUserID})
+			return nil, nil, false
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > maxBulkUsers {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Не больше %d пользователей за одну операцию", maxBulkUsers)})
+		return nil, nil, false
+	}
+
+	if readAll {
+		return ids, nil, true
+	}
+	accessible, err := h.userRepo.AccessibleIDs(currentUserID, ids)
+	if err != nil {
+		log.Printf("Failed to check access for bulk operation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки доступа"})
+		return nil, nil, false
+	}
+	return ids, accessible, true
+}
+
+// mergeInts добавляет к current отсутствующие значения; true - что-то добавлено
+func mergeInts(current []int, add []int) ([]int, bool) {
+	merged := append([]int{}, current...)
+	existing := make(map[int]bool, len(current))
+	for _, v := range current {
+		existing[v] = true
+	}
+	for _, v := range add {
+		if !existing[v] {
+			existing[v] = true
+			merged = append(merged, v)
+		}
+	}
+	return merged, len(merged) > len(current)
+}
+
+// mergeStrings добавляет к current отсутствующие значения; true - что-то добавлено
+func mergeStrings(current []string, add []string) ([]string, bool) {
+	merged := append([]string{}, current...)
+	existing := make(map[string]bool, len(current))
+	for _, v := range current {
+		existing[v] = true
+	}
+	for _, v := range add {
+		if !existing[v] {
+			existing[v] = true
+			merged = append(merged, v)
+		}
+	}
+	return merged, len(merged) > len(current)
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/policy"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var bulkSnapshotCols = []string{"id", "full_name", "username", "available_organizations", "is_active", "blocked_reason", "role", "created_at", "updated_at"}
+
+func setupUserBulkTest(t *testing.T, userID int, role models.UserRole) (*gin.Engine, sqlmock.Sqlmock) {
+	return setupUserBulkTestWithApprovals(t, userID, role, nil)
+}
+
+func setupUserBulkTestWithApprovals(t *testing.T, userID int, role models.UserRole, rules policy.ApprovalRules) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := customRolePermissionStore()
+	handler := NewUserHandler(
+		repositories.NewUserRepository(sqlxDB),
+		repositories.NewOrganizationRepository(sqlxDB),
+		repositories.NewAuditLogRepository(sqlxDB),
+		store,
+	)
+	if len(rules) > 0 {
+		handler.UseApprovals(rules)
+	}
+
+	router := gin.New()
+	router.POST("/users/bulk", func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("role", role)
+		c.Next()
+	}, auth.LoadPermissions(store), handler.BulkUpdateUsers)
+	return router, mock
+}
+
+func bulkSnapshot(id int, orgs string, active bool, reason interface{}) *sqlmock.Rows {
+	return bulkSnapshotWithRole(id, orgs, active, reason, models.RoleUser)
+}
+
+func bulkSnapshotWithRole(id int, orgs string, active bool, reason interface{}, role models.UserRole) *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows(bulkSnapshotCols).AddRow(id, "Пользователь", "user", []byte(orgs), active, reason, string(role), now, now)
+}
+
+func bulkRequest(t *testing.T, router *gin.Engine, body interface{}) (int, BulkUserResponse) {
+	data, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/bulk", bytes.NewReader(data)))
+
+	var response BulkUserResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+func bulkStatuses(response BulkUserResponse) map[int]string {
+	statuses := map[int]string{}
+	for _, result := range response.Results {
+		statuses[result.ID] = result.Status
+	}
+	return statuses
+}
+
+// TestBulkUpdateUsers_Block проверяет отчёт по каждому ID: себя заблокировать нельзя, уже заблокированный не меняется,
+// несуществующий отмечается, изменения - одной транзакцией и одной записью журнала на пользователя
+func TestBulkUpdateUsers_Block(t *testing.T) {
+	router, mock := setupUserBulkTest(t, 1, models.RoleAdmin)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id FROM users WHERE id = ANY\(\$1\) AND deleted_at IS NULL ORDER BY id FOR UPDATE`).
+		WithArgs(pq.Array([]int{5, 6, 99})).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5).AddRow(6))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").WithArgs(5).WillReturnRows(bulkSnapshot(5, "[]", true, nil))
+	mock.ExpectExec("UPDATE users SET is_active = \\$1, blocked_at = \\$2, blocked_by = \\$3, blocked_reason = \\$4, token_version = token_version \\+ 1").
+		WithArgs(false, sqlmock.AnyArg(), 1, "Уволен", 1, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").WithArgs(5).WillReturnRows(bulkSnapshot(5, "[]", false, "Уволен"))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").WithArgs(6).WillReturnRows(bulkSnapshot(6, "[]", false, "Отпуск"))
+	mock.ExpectCommit()
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(1, repositories.ActionBlockUser, 5, []byte(`{"bulk_operation":"block","reason":"Уволен"}`), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	code, response := bulkRequest(t, router, gin.H{"ids": []int{1, 5, 6, 99, 5}, "operation": "block", "reason": "Уволен"})
+
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	expected := map[int]string{1: bulkStatusDenied, 5: bulkStatusUpdated, 6: bulkStatusUnchanged, 99: bulkStatusNotFound}
+	statuses := bulkStatuses(response)
+	for id, status := range expected {
+		if statuses[id] != status {
+			t.Errorf("User %d: expected %s, got %s", id, status, statuses[id])
+		}
+	}
+	if response.Total != 4 || response.Updated != 1 || response.Unchanged != 1 || response.Failed != 2 {
+		t.Errorf("Unexpected totals: %+v", response)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestBulkUpdateUsers_ModeratorAccess проверяет, что модератор меняет только доступных пользователей
+func TestBulkUpdateUsers_ModeratorAccess(t *testing.T) {
+	router, mock := setupUserBulkTest(t, 2, models.RoleModerator)
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT (.+) FROM organizations").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "code", "parent_id", "is_active", "created_at", "updated_at"}).
+			AddRow(3, "Филиал", "BR", nil, true, now, now))
+	mock.ExpectQuery(`SELECT id FROM users WHERE id = ANY\(\$2\) AND deleted_at IS NULL AND EXISTS`).
+		WithArgs(2, pq.Array([]int{5, 7})).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectBegin()
+	mock.ExpectQuery("FOR UPDATE").WithArgs(pq.Array([]int{5})).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").WithArgs(5).WillReturnRows(bulkSnapshot(5, "[1]", true, nil))
+	mock.ExpectExec("UPDATE users SET available_organizations = \\$1").
+		WithArgs(models.Organizations{1, 3}, 2, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").WithArgs(5).WillReturnRows(bulkSnapshot(5, "[1,3]", true, nil))
+	mock.ExpectCommit()
+	mock.ExpectExec("INSERT INTO audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	code, response := bulkRequest(t, router, gin.H{"ids": []int{5, 7}, "operation": "assign_organizations", "organization_ids": []int{3}})
+
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	statuses := bulkStatuses(response)
+	if statuses[5] != bulkStatusUpdated || statuses[7] != bulkStatusDenied {
+		t.Errorf("Unexpected statuses: %v", statuses)
+	}
+	if denied := response.Results[1].DeniedFields; len(denied) != 1 || denied[0].Reason != "no_access" {
+		t.Errorf("Expected no_access denial, got %+v", denied)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestBulkUpdateUsers_CustomRoleOnAdmin проверяет, что собственная роль не блокирует администратора,
+// даже имея users.update: права администратора шире
+func TestBulkUpdateUsers_CustomRoleOnAdmin(t *testing.T) {
+	router, mock := setupUserBulkTest(t, 2, roleHelpdesk)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FOR UPDATE").WithArgs(pq.Array([]int{5, 6})).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5).AddRow(6))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").WithArgs(5).WillReturnRows(bulkSnapshotWithRole(5, "[]", true, nil, models.RoleAdmin))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").WithArgs(6).WillReturnRows(bulkSnapshot(6, "[]", true, nil))
+	mock.ExpectExec("UPDATE users SET is_active = \\$1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").WithArgs(6).WillReturnRows(bulkSnapshot(6, "[]", false, nil))
+	mock.ExpectCommit()
+	mock.ExpectExec("INSERT INTO audit_log").WithArgs(2, repositories.ActionBlockUser, 6, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	code, response := bulkRequest(t, router, gin.H{"ids": []int{5, 6}, "operation": "block"})
+
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	statuses := bulkStatuses(response)
+	if statuses[5] != bulkStatusDenied || statuses[6] != bulkStatusUpdated {
+		t.Errorf("Unexpected statuses: %v", statuses)
+	}
+	if denied := response.Results[0].DeniedFields; len(denied) == 0 || denied[0].Reason != "outranked" {
+		t.Errorf("Expected outranked denial, got %+v", denied)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestBulkUpdateUsers_UnblockRequiresApproval проверяет, что запрос на подтверждение сохраняется в транзакции
+// массовой операции, а в журнал пишется одна запись на пользователя
+func TestBulkUpdateUsers_UnblockRequiresApproval(t *testing.T) {
+	router, mock := setupUserBulkTestWithApprovals(t, 1, models.RoleAdmin, policy.ApprovalRules{policy.ApprovalUnblock: true})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id FROM users WHERE id = ANY\(\$1\) AND deleted_at IS NULL ORDER BY id FOR UPDATE`).
+		WithArgs(pq.Array([]int{5})).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").WithArgs(5).WillReturnRows(bulkSnapshot(5, "[]", false, "Отпуск"))
+	mock.ExpectQuery("INSERT INTO user_change_requests").
+		WithArgs(5, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "created_at"}).AddRow(12, repositories.ChangeRequestPending, time.Now()))
+	mock.ExpectCommit()
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(1, repositories.ActionChangeRequested, 5, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	code, response := bulkRequest(t, router, gin.H{"ids": []int{5}, "operation": "unblock"})
+
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if len(response.Results) != 1 || response.Results[0].Status != bulkStatusPendingApproval || response.Results[0].ChangeRequestID != 12 {
+		t.Errorf("Unexpected results: %+v", response.Results)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestBulkUpdateUsers_RollsBackOnError проверяет, что ошибка одного изменения отменяет все
+func TestBulkUpdateUsers_RollsBackOnError(t *testing.T) {
+	router, mock := setupUserBulkTest(t, 1, models.RoleAdmin)
+
+	mock.ExpectQuery(`SELECT id FROM users WHERE deleted_at IS NULL AND role = \$1 ORDER BY id LIMIT \$2`).
+		WithArgs("user", maxBulkUsers+1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5).AddRow(6))
+	mock.ExpectBegin()
+	mock.ExpectQuery("FOR UPDATE").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5).AddRow(6))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").WithArgs(5).WillReturnRows(bulkSnapshot(5, "[]", true, nil))
+	mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").WithArgs(5).WillReturnRows(bulkSnapshot(5, "[]", true, nil))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").WithArgs(6).WillReturnRows(bulkSnapshot(6, "[]", true, nil))
+	mock.ExpectExec("UPDATE users").WillReturnError(sqlmock.ErrCancelled)
+	mock.ExpectRollback()
+
+	code, _ := bulkRequest(t, router, gin.H{"filter": gin.H{"role": "user"}, "operation": "add_tags", "tags": []string{"пилот"}})
+
+	if code != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d", code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestBulkUpdateUsers_Validation(t *testing.T) {
+	router, _ := setupUserBulkTest(t, 1, models.RoleAdmin)
+
+	cases := map[string]gin.H{
+		"neither ids nor filter": {"operation": "block"},
+		"both ids and filter":    {"ids": []int{5}, "filter": gin.H{}, "operation": "block"},
+		"unknown operation":      {"ids": []int{5}, "operation": "delete_everything"},
+		"role without value":     {"ids": []int{5}, "operation": "change_role"},
+		"unknown role":           {"ids": []int{5}, "operation": "change_role", "role": "superuser"},
+		"empty tags":             {"ids": []int{5}, "operation": "add_tags", "tags": []string{" "}},
+		"invalid id":             {"ids": []int{0}, "operation": "unblock"},
+	}
+	for name, body := range cases {
+		if code, _ := bulkRequest(t, router, body); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, code)
+		}
+	}
+}
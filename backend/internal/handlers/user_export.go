@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// userExportColumn столбец выгрузки пользователей
+type userExportColumn struct {
+	header string
+	value  func(user *models.User) string
+}
+
+// userExportColumns допустимые столбцы выгрузки (query-параметр columns)
+var userExportColumns = map[string]userExportColumn{
+	"id":          {"ID", func(u *models.User) string { return strconv.Itoa(u.ID) }},
+	"full_name":   {"ФИО", func(u *models.User) string { return u.FullName }},
+	"username":    {"Логин", func(u *models.User) string { return u.Username }},
+	"emails":      {"Email", func(u *models.User) string { return strings.Join(u.Emails, "; ") }},
+	"phones":      {"Телефоны", func(u *models.User) string { return strings.Join(u.Phones, "; ") }},
+	"position":    {"Должность", func(u *models.User) string { return u.Position.String }},
+	"department":  {"Отдел", func(u *models.User) string { return u.Department.String }},
+	"role":        {"Роль", func(u *models.User) string { return string(u.Role) }},
+	"is_active":   {"Активен", func(u *models.User) string { return exportBool(u.IsActive) }},
+	"birth_date":  {"Дата рождения", func(u *models.User) string { return exportTime(u.BirthDate, "2006-01-02") }},
+	"address":     {"Адрес", func(u *models.User) string { return u.Address.String }},
+	"city":        {"Город", func(u *models.User) string { return u.City.String }},
+	"country":     {"Страна", func(u *models.User) string { return u.Country.String }},
+	"postal_code": {"Индекс", func(u *models.User) string { return u.PostalCode.String }},
+	"timezone":    {"Часовой пояс", func(u *models.User) string { return u.Timezone.String }},
+	"work_hours":  {"Рабочие часы", func(u *models.User) string { return u.WorkHours.String }},
+	"comment":     {"Комментарий", func(u *models.User) string { return u.Comment.String }},
+	"tags":        {"Теги", func(u *models.User) string { return strings.Join(u.Tags, "; ") }},
+	"organizations": {"Организации", func(u *models.User) string {
+		ids := make([]string, len(u.AvailableOrganizations))
+		for i, id := range u.AvailableOrganizations {
+			ids[i] = strconv.Itoa(id)
+		}
+		return strings.Join(ids, "; ")
+	}},
+	"blocked_reason":     {"Причина блокировки", func(u *models.User) string { return u.BlockedReason.String }},
+	"is_online":          {"В сети", func(u *models.User) string { return exportBool(u.IsOnline) }},
+	"last_seen":          {"Последняя активность", func(u *models.User) string { return exportTime(u.LastSeen, "2006-01-02 15:04:05") }},
+	"is_service_account": {"Сервисная учётная запись", func(u *models.User) string { return exportBool(u.IsServiceAccount) }},
+	"created_at":         {"Создан", func(u *models.User) string { return u.CreatedAt.Format("2006-01-02 15:04:05") }},
+	"updated_at":         {"Изменён", func(u *models.User) string { return u.UpdatedAt.Format("2006-01-02 15:04:05") }},
+}
+
+// Столбцы выгрузки, если columns не указан
+var defaultUserExportColumns = []string{"id", "full_name", "username", "emails", "phones", "position", "department", "role", "is_active"}
+
+func exportBool(v bool) string {
+	if v {
+		return "да"
+	}
+	return "нет"
+}
+
+func exportTime(t models.NullTime, layout string) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Format(layout)
+}
+
+// ExportUsers godoc
+// @Summary Выгрузка пользователей в CSV, XLSX или vCard
+// @Description Выгружает всех пользователей, подходящих под фильтры списка (search, role, is_active, department, sort_by, sort_desc), без пагинации. С правом users.read.all - всех, иначе только доступных. Столбцы csv и xlsx задаются через columns (через запятую): id, full_name, username, emails, phones, position, department, role, is_active, birth_date, address, city, country, postal_code, timezone, work_hours, comment, tags, organizations, blocked_reason, is_online, last_seen, is_service_account, created_at, updated_at. vCard содержит контактные поля независимо от columns. Файл формируется потоком по мере чтения из БД
+// @Tags users
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce text/vcard
+// @Security BearerAuth
+// @Param format query string false "Формат файла" Enums(csv, xlsx, vcf) default(csv)
+// @Param columns query string false "Столбцы через запятую" default(id,full_name,username,emails,phones,position,department,role,is_active)
+// @Param sort_by query string false "Поле для сортировки (relevance - по релевантности поиска, по умолчанию при search)" default(created_at)
+// @Param sort_desc query boolean false "Сортировка по убыванию" default(true)
+// @Param search query string false "Поиск по имени, username, email, телефону"
+// @Param role query string false "Фильтр по роли"
+// @Param is_active query boolean false "Фильтр по активности"
+// @Param department query string false "Фильтр по отделу"
+// @Param custom_fields[key] query string false "Фильтр по дополнительному полю key"
+// @Param tags_any query string false "Есть хотя бы один из тегов (через запятую)"
+// @Param tags_all query string false "Есть все теги (через запятую)"
+// @Success 200 {file} file "Файл выгрузки"
+// @Failure 400 {object} map[string]string "Неверный формат или столбец"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /users/export [get]
+func (h *UserHandler) ExportUsers(c *gin.Context) {
+	format := c.DefaultQuery("format", utils.ExportFormatCSV)
+	contentType, ok := utils.ExportContentTypes[format]
+	if format == utils.ExportFormatVCard {
+		contentType, ok = utils.VCardContentType, true
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Формат выгрузки: csv, xlsx или vcf"})
+		return
+	}
+
+	columns := defaultUserExportColumns
+	if raw := c.Query("columns"); raw != "" {
+		columns = nil
+		seen := map[string]bool{}
+		for _, name := range strings.Split(raw, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" || seen[name] {
+				continue
+			}
+			if _, ok := userExportColumns[name]; !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Неизвестный столбец: %s", name)})
+				return
+			}
+			seen[name] = true
+			columns = append(columns, name)
+		}
+		if len(columns) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Не выбраны столбцы выгрузки"})
+			return
+		}
+	}
+
+	params, ok := h.userListParams(c)
+	if !ok {
+		return
+	}
+
+	// Заголовки ответа отправляются с первой строкой: до этого ошибку БД ещё можно вернуть как JSON
+	var writer utils.TableWriter
+	started := false
+	rows := 0
+	start := func() error {
+		started = true
+		filename := fmt.Sprintf("users_%s.%s", time.Now().Format("20060102_150405"), format)
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		c.Status(http.StatusOK)
+
+		if format == utils.ExportFormatVCard {
+			return nil
+		}
+		var err error
+		if writer, err = utils.NewTableWriter(format, c.Writer, "Пользователи"); err != nil {
+			return err
+		}
+		header := make([]string, len(columns))
+		for i, name := range columns {
+			header[i] = userExportColumns[name].header
+		}
+		return writer.WriteRow(header)
+	}
+
+	err := h.userRepo.EachFiltered(params, func(user *models.User) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		rows++
+		if format == utils.ExportFormatVCard {
+			return utils.WriteVCard(c.Writer, userVCard(user))
+		}
+		cells := make([]string, len(columns))
+		for i, name := range columns {
+			cells[i] = userExportColumns[name].value(user)
+		}
+		return writer.WriteRow(cells)
+	})
+	if err != nil && !started {
+		log.Printf("Failed to query users for export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errFailedToGetUsers})
+		return
+	}
+	if err == nil && !started {
+		// Пустая выгрузка: только заголовок таблицы
+		err = start()
+	}
+	if err == nil && writer != nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		// Заголовки уже отправлены - остаётся только записать ошибку в лог
+		log.Printf("Failed to write users export: %v", err)
+	}
+
+	logAudit(h.auditLogRepo, c, repositories.ActionExportUsers, nil, map[string]interface{}{
+		"format":   format,
+		"rows":     rows,
+		"columns":  columns,
+		"filters":  c.Request.URL.RawQuery,
+		"complete": err == nil,
+	})
+}
+
+// userVCard карточка vCard пользователя
+func userVCard(user *models.User) utils.VCard {
+	card := utils.VCard{
+		UID:        fmt.Sprintf("urn:central-reporting:user:%d", user.ID),
+		FullName:   user.FullName,
+		Nickname:   user.Username,
+		Emails:     user.Emails,
+		Phones:     user.Phones,
+		Title:      user.Position.String,
+		Department: user.Department.String,
+		Address:    user.Address.String,
+		City:       user.City.String,
+		PostalCode: user.PostalCode.String,
+		Country:    user.Country.String,
+		Timezone:   user.Timezone.String,
+		Note:       user.Comment.String,
+		Categories: user.Tags,
+		Revision:   user.UpdatedAt,
+	}
+	if user.BirthDate.Valid {
+		card.Birthday = user.BirthDate.Time
+	}
+	return card
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+var userExportCols = []string{"id", "full_name", "username", "emails", "phones", "position", "department",
+	"role", "is_active", "created_at", "updated_at"}
+
+func setupUserExportTest(t *testing.T, role models.UserRole) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := builtinPermissionStore()
+	handler := NewUserHandler(
+		repositories.NewUserRepository(sqlxDB),
+		repositories.NewOrganizationRepository(sqlxDB),
+		repositories.NewAuditLogRepository(sqlxDB),
+		store,
+	)
+
+	router := gin.New()
+	router.GET("/users/export", func(c *gin.Context) {
+		c.Set("user_id", 2)
+		c.Set("role", role)
+		c.Next()
+	}, auth.LoadPermissions(store), handler.ExportUsers)
+	return router, mock
+}
+
+func userExportRows() *sqlmock.Rows {
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	return sqlmock.NewRows(userExportCols).
+		AddRow(5, "Иванов Иван", "ivanov", []byte(`["ivanov@example.com","ii@example.com"]`), []byte(`["+77000000000"]`),
+			"Бухгалтер", "Бухгалтерия", "user", true, now, now).
+		AddRow(6, "Петров Пётр", "petrov", []byte(`[]`), []byte(`[]`), nil, "Бухгалтерия", "user", true, now, now)
+}
+
+// TestExportUsers_ModeratorScopeAndColumns проверяет фильтры списка, ограничение доступными пользователями и выбор столбцов
+func TestExportUsers_ModeratorScopeAndColumns(t *testing.T) {
+	router, mock := setupUserExportTest(t, models.RoleModerator)
+
+	mock.ExpectQuery(`SELECT (.+) FROM users WHERE deleted_at IS NULL AND LOWER\(department\) LIKE \$1 AND EXISTS \((.+)g.grantee_id = \$2(.+) ORDER BY full_name ASC, id`).
+		WithArgs("%бухгалтерия%", 2).
+		WillReturnRows(userExportRows())
+	mock.ExpectExec("INSERT INTO audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"/users/export?format=csv&department=Бухгалтерия&sort_by=full_name&sort_desc=false&columns=full_name,emails", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), `attachment; filename="users_`) {
+		t.Errorf("Unexpected Content-Disposition: %s", w.Header().Get("Content-Disposition"))
+	}
+	expected := "\ufeffФИО,Email\nИванов Иван,ivanov@example.com; ii@example.com\nПетров Пётр,\n"
+	if w.Body.String() != expected {
+		t.Errorf("Unexpected CSV:\n%q\nwant\n%q", w.Body.String(), expected)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestExportUsers_VCard(t *testing.T) {
+	router, mock := setupUserExportTest(t, models.RoleAdmin)
+
+	mock.ExpectQuery(`SELECT (.+) FROM users WHERE deleted_at IS NULL ORDER BY created_at DESC, id`).WillReturnRows(userExportRows())
+	mock.ExpectExec("INSERT INTO audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/export?format=vcf", nil))
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/vcard; charset=utf-8" {
+		t.Fatalf("Expected vCard response, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	if strings.Count(body, "BEGIN:VCARD\r\n") != 2 || !strings.Contains(body, "EMAIL;PREF=1:ivanov@example.com\r\n") ||
+		!strings.Contains(body, "TITLE:Бухгалтер\r\n") {
+		t.Errorf("Unexpected vCard body:\n%s", body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestExportUsers_Validation(t *testing.T) {
+	router, _ := setupUserExportTest(t, models.RoleAdmin)
+
+	for _, query := range []string{"format=pdf", "columns=full_name,password", "columns=,"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/export?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestExportUsers_QueryErrorBeforeStreaming(t *testing.T) {
+	router, mock := setupUserExportTest(t, models.RoleAdmin)
+
+	mock.ExpectQuery("SELECT (.+) FROM users").WillReturnError(sqlmock.ErrCancelled)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/export?format=xlsx", nil))
+
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("Expected JSON error without attachment, got %d %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,530 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/policy"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxImportFileSize = 10 << 20 // 10MB
+	maxImportRows     = 1000
+
+	temporaryPasswordLength = 12
+)
+
+// importFields поля пользователя, которые можно загрузить из файла; без сопоставления (mapping)
+// заголовок столбца должен совпадать с именем поля
+var importFields = map[string]bool{
+	"full_name":     true,
+	"username":      true,
+	"password":      true,
+	"role":          true,
+	"emails":        true,
+	"phones":        true,
+	"position":      true,
+	"department":    true,
+	"birth_date":    true,
+	"address":       true,
+	"city":          true,
+	"country":       true,
+	"postal_code":   true,
+	"timezone":      true,
+	"work_hours":    true,
+	"comment":       true,
+	"tags":          true,
+	"organizations": true,
+}
+
+// ImportRowResult результат проверки (или создания) одной строки файла
+type ImportRowResult struct {
+	// Номер строки в файле (заголовок - строка 1)
+	Row      int      `json:"row"`
+	Username string   `json:"username,omitempty"`
+	UserID   int      `json:"user_id,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+	// Правила, по которым роль или организации ждут подтверждения (пользователь создаётся с ролью user
+	// и без организаций), и созданный запрос на подтверждение
+	PendingApproval []string `json:"pending_approval,omitempty"`
+	ChangeRequestID int      `json:"change_request_id,omitempty"`
+}
+
+// ImportResult результат импорта пользователей
+type ImportResult struct {
+	DryRun  bool   `json:"dry_run"`
+	Error   string `json:"error,omitempty"`
+	Total   int    `json:"total"`
+	Valid   int    `json:"valid"`
+	Invalid int    `json:"invalid"`
+	Created int    `json:"created"`
+	// Приветственные письма с временным паролем, поставленные в отправку
+	WelcomeEmails int               `json:"welcome_emails"`
+	Rows          []ImportRowResult `json:"rows"`
+}
+
+// importOptions параметры импорта из формы запроса
+type importOptions struct {
+	columns           map[string]int
+	defaultRole       models.UserRole
+	generatePasswords bool
+	// Код (в нижнем регистре) или ID организации -> ID
+	organizations map[string]int
+}
+
+// importRow пользователь, собранный из строки файла
+type importRow struct {
+	result ImportRowResult
+	user   *models.User
+	// Временный пароль для приветственного письма (пусто - пароль задан в файле или не задан)
+	temporaryPassword string
+}
+
+// ImportUsers godoc
+// @Summary Импорт пользователей из CSV или XLSX
+// @Description Создает пользователей из файла (первый лист xlsx, первая строка - заголовки). Столбцы сопоставляются с полями через mapping ({"ФИО": "full_name", "Логин": "username"}), без него заголовок должен совпадать с именем поля: full_name, username, password, role, emails, phones, position, department, birth_date, address, city, country, postal_code, timezone, work_hours, comment, tags, organizations (коды через ";"). В режиме dry_run (по умолчанию) только проверяет строки; иначе создает всех пользователей одной транзакцией или ни одного, если в файле есть ошибки. С generate_passwords пользователям без пароля создается временный пароль и отправляется приветственное письмо. Роль с расширенными правами и организации, требующие подтверждения, сохраняются запросами на подтверждение (pending_approval, change_request_id)
+// @Tags users
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "Файл CSV или XLSX (до 10MB, до 1000 строк)"
+// @Param mapping formData string false "Сопоставление столбцов полям (JSON)"
+// @Param dry_run formData boolean false "Только проверить строки" default(true)
+// @Param generate_passwords formData boolean false "Создать временные пароли и отправить приветственные письма" default(false)
+// @Param default_role formData string false "Роль для строк без столбца role" default(user)
+// @Success 200 {object} ImportResult "Результат проверки (dry_run)"
+// @Success 201 {object} ImportResult "Пользователи созданы"
+// @Failure 400 {object} map[string]string "Неверный файл или параметры"
+// @Failure 422 {object} ImportResult "В файле есть ошибки, пользователи не созданы"
+// @Router /users/import [post]
+func (h *UserHandler) ImportUsers(c *gin.Context) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Файл не загружен"})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxImportFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Размер файла не должен превышать 10MB"})
+		return
+	}
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+	if format != utils.ExportFormatCSV && format != utils.ExportFormatXLSX {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Поддерживаются файлы CSV и XLSX"})
+		return
+	}
+
+	result := ImportResult{DryRun: c.DefaultPostForm("dry_run", "true") != "false", Rows: []ImportRowResult{}}
+	opts := importOptions{
+		defaultRole:       models.UserRole(c.DefaultPostForm("default_role", string(models.RoleUser))),
+		generatePasswords: c.PostForm("generate_passwords") == "true",
+	}
+	if opts.generatePasswords && h.emailService == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Отправка писем не настроена: временные пароли недоступны"})
+		return
+	}
+
+	mapping := map[string]string{}
+	if raw := c.PostForm("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат mapping: ожидается JSON объект {\"столбец\": \"поле\"}"})
+			return
+		}
+	}
+	for column, field := range mapping {
+		if !importFields[field] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Столбец '%s' сопоставлен неизвестному полю: %s", column, field)})
+			return
+		}
+	}
+
+	rows, err := utils.ReadTable(format, file, header.Size)
+	if err != nil {
+		log.Printf("Failed to read import file %s: %v", header.Filename, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Не удалось прочитать файл"})
+		return
+	}
+	if len(rows) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Файл не содержит строк с пользователями"})
+		return
+	}
+
+	opts.columns, err = importColumns(rows[0], mapping)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, ok := opts.columns["organizations"]; ok {
+		orgs, err := h.organizationRepo.GetAll()
+		if err != nil {
+			log.Printf("Failed to get organizations: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить список организаций"})
+			return
+		}
+		opts.organizations = make(map[string]int, 2*len(orgs))
+		for _, org := range orgs {
+			opts.organizations[strconv.Itoa(org.ID)] = org.ID
+			if org.Code.Valid && org.Code.String != "" {
+				opts.organizations[strings.ToLower(org.Code.String)] = org.ID
+			}
+		}
+	}
+
+	// Разбор строк; пустые строки пропускаются
+	var parsed []*importRow
+	for i, cells := range rows[1:] {
+		if importRowEmpty(cells) {
+			continue
+		}
+		if len(parsed) == maxImportRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Файл содержит больше %d пользователей", maxImportRows)})
+			return
+		}
+		parsed = append(parsed, h.parseImportRow(c, i+2, cells, opts))
+	}
+	if len(parsed) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Файл не содержит строк с пользователями"})
+		return
+	}
+
+	if !h.checkImportUsernames(c, parsed) {
+		return
+	}
+
+	var valid []*importRow
+	for _, row := range parsed {
+		if len(row.result.Errors) == 0 {
+			valid = append(valid, row)
+			result.Valid++
+		} else {
+			result.Invalid++
+		}
+		result.Total++
+	}
+
+	// Роль с расширенными правами и организации подтверждаются так же, как в CreateUser
+	approvals := make([]policy.Approval, len(valid))
+	for i, row := range valid {
+		approvals[i] = h.splitNewUser(row.user)
+		if approvals[i].Required() {
+			row.result.PendingApproval = approvalRuleNames(approvals[i])
+		}
+	}
+
+	if result.DryRun {
+		result.Rows = importResults(parsed)
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	if result.Invalid > 0 {
+		result.Error = "В файле есть ошибки: пользователи не созданы"
+		result.Rows = importResults(parsed)
+		c.JSON(http.StatusUnprocessableEntity, result)
+		return
+	}
+
+	users := make([]*models.User, len(valid))
+	requests := make([]*repositories.ChangeRequest, len(valid))
+	for i, row := range valid {
+		users[i] = row.user
+		if !approvals[i].Required() {
+			continue
+		}
+		if requests[i], err = h.newChangeRequest(c, 0, approvals[i]); err != nil {
+			log.Printf("Failed to prepare change request for imported user %s: %v", row.user.Username, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": errFailedToCreateChangeRequest})
+			return
+		}
+	}
+
+	if err := h.userRepo.CreateBatch(users, requests); err != nil {
+		log.Printf("Failed to import users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать пользователей"})
+		return
+	}
+	result.Created = len(users)
+
+	currentUserID := c.GetInt("user_id")
+	var welcome []*importRow
+	for i, row := range valid {
+		row.result.UserID = row.user.ID
+		logAudit(h.auditLogRepo, c, repositories.ActionCreateUser, &row.user.ID, map[string]interface{}{
+			"username": row.user.Username,
+			"role":     row.user.Role,
+			"source":   "import",
+		})
+		if requests[i] != nil {
+			row.result.ChangeRequestID = requests[i].ID
+			h.logChangeRequest(c, row.user.ID, requests[i], approvals[i])
+		}
+		if row.temporaryPassword != "" {
+			welcome = append(welcome, row)
+		}
+	}
+	logAudit(h.auditLogRepo, c, repositories.ActionImportUsers, nil, map[string]interface{}{
+		"file":               header.Filename,
+		"created":            result.Created,
+		"generate_passwords": opts.generatePasswords,
+	})
+	log.Printf("AUDIT: User %d (%s) imported %d users from %s", currentUserID, c.GetString("username"), result.Created, header.Filename)
+
+	// Письма отправляются после ответа: SMTP на сотни адресов не должен задерживать запрос
+	result.WelcomeEmails = len(welcome)
+	if len(welcome) > 0 {
+		go h.sendWelcomeEmails(welcome)
+	}
+
+	result.Rows = importResults(parsed)
+	c.JSON(http.StatusCreated, result)
+}
+
+// importColumns сопоставляет столбцы файла полям пользователя
+func importColumns(header []string, mapping map[string]string) (map[string]int, error) {
+	columns := map[string]int{}
+	for i, cell := range header {
+		name := strings.TrimSpace(cell)
+		field, ok := mapping[name]
+		if !ok && importFields[strings.ToLower(name)] {
+			field, ok = strings.ToLower(name), true
+		}
+		if !ok {
+			continue
+		}
+		if _, duplicate := columns[field]; duplicate {
+			return nil, fmt.Errorf("Поле %s сопоставлено нескольким столбцам", field)
+		}
+		columns[field] = i
+	}
+
+	for _, required := range []string{"full_name", "username"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("В файле нет столбца для поля %s", required)
+		}
+	}
+	return columns, nil
+}
+
+// parseImportRow проверяет строку теми же правилами, что и CreateUser, и собирает пользователя
+func (h *UserHandler) parseImportRow(c *gin.Context, number int, cells []string, opts importOptions) *importRow {
+	value := func(field string) string {
+		if i, ok := opts.columns[field]; ok && i < len(cells) {
+			return strings.TrimSpace(cells[i])
+		}
+		return ""
+	}
+	row := &importRow{result: ImportRowResult{Row: number}}
+	addError := func(format string, args ...interface{}) {
+		row.result.Errors = append(row.result.Errors, fmt.Sprintf(format, args...))
+	}
+	nullString := func(field string) models.NullString {
+		s := utils.SanitizeString(value(field))
+		return models.NullString{String: s, Valid: s != ""}
+	}
+
+	user := &models.User{
+		FullName:        utils.SanitizeString(value("full_name")),
+		Username:        utils.SanitizeUsername(value("username")),
+		ShowInSelection: true,
+		Emails:          models.Emails{},
+		Phones:          models.Phones{},
+		Tags:            models.Tags{},
+		CustomFields:    models.CustomFields{},
+		Position:        nullString("position"),
+		Department:      nullString("department"),
+		Address:         nullString("address"),
+		City:            nullString("city"),
+		Country:         nullString("country"),
+		PostalCode:      nullString("postal_code"),
+		Timezone:        nullString("timezone"),
+		WorkHours:       nullString("work_hours"),
+		Comment:         nullString("comment"),
+		IsActive:        true,
+		IsFirstLogin:    true,
+		CreatedBy:       models.NullInt{Int: c.GetInt("user_id"), Valid: true},
+		Role:            opts.defaultRole,
+		AccessibleUsers: models.AccessibleUsers{},
+	}
+	row.user = user
+	row.result.Username = user.Username
+
+	if user.FullName == "" {
+		addError("ФИО обязательно")
+	}
+	if valid, errMsg := utils.ValidateUsername(user.Username); !valid {
+		addError("%s", errMsg)
+	}
+
+	if role := value("role"); role != "" {
+		user.Role = models.UserRole(strings.ToLower(role))
+	}
+	if _, errMsg := h.roleAssignmentError(c, user.Role); errMsg != "" {
+		addError("%s", errMsg)
+	}
+
+	for _, email := range splitImportList(value("emails")) {
+		cleanEmail := utils.SanitizeEmail(email)
+		if !utils.ValidateEmail(cleanEmail) {
+			addError("Некорректный email адрес: %s", email)
+			continue
+		}
+		user.Emails = append(user.Emails, cleanEmail)
+	}
+	for _, phone := range splitImportList(value("phones")) {
+		if !utils.ValidatePhone(phone) {
+			addError("Некорректный номер телефона: %s. Используйте формат +[код][номер]", phone)
+			continue
+		}
+		user.Phones = append(user.Phones, phone)
+	}
+	for _, tag := range splitImportList(value("tags")) {
+		user.Tags = append(user.Tags, utils.SanitizeString(tag))
+	}
+
+	if raw := value("birth_date"); raw != "" {
+		birthDate, ok := parseImportDate(raw)
+		if !ok {
+			addError("Некорректная дата рождения: %s. Используйте формат ГГГГ-ММ-ДД или ДД.ММ.ГГГГ", raw)
+		}
+		user.BirthDate = models.NullTime{Time: birthDate, Valid: ok}
+	}
+
+	user.AvailableOrganizations = models.Organizations{}
+	for _, code := range splitImportList(value("organizations")) {
+		id, ok := opts.organizations[strings.ToLower(code)]
+		if !ok {
+			addError("Неизвестная организация: %s", code)
+			continue
+		}
+		user.AvailableOrganizations = append(user.AvailableOrganizations, id)
+	}
+	for _, denial := range newUserFieldsDecision(c, user.AvailableOrganizations, user.AccessibleUsers).Denied {
+		addError("Недостаточно прав для изменения поля %s", denial.Field)
+	}
+
+	switch password := value("password"); {
+	case password != "":
+		if validation := utils.ValidatePassword(password); !validation.Valid {
+			row.result.Errors = append(row.result.Errors, validation.Errors...)
+		}
+		user.Password = models.NullString{String: password, Valid: true}
+	case opts.generatePasswords:
+		if len(user.Emails) == 0 {
+			addError("Для отправки временного пароля нужен email")
+			break
+		}
+		password, err := utils.GeneratePassword(temporaryPasswordLength)
+		if err != nil {
+			log.Printf("Failed to generate password: %v", err)
+			addError("Не удалось создать временный пароль")
+			break
+		}
+		user.Password = models.NullString{String: password, Valid: true}
+		user.RequirePasswordChange = true
+		row.temporaryPassword = password
+	}
+
+	return row
+}
+
+// checkImportUsernames отмечает логины, повторяющиеся в файле или уже занятые
+func (h *UserHandler) checkImportUsernames(c *gin.Context, rows []*importRow) bool {
+	var usernames []string
+	seen := map[string]int{}
+	for _, row := range rows {
+		username := strings.ToLower(row.user.Username)
+		if username == "" {
+			continue
+		}
+		if first, ok := seen[username]; ok {
+			row.result.Errors = append(row.result.Errors, fmt.Sprintf("Логин '%s' уже указан в строке %d", row.user.Username, first))
+			continue
+		}
+		seen[username] = row.result.Row
+		usernames = append(usernames, username)
+	}
+	if len(usernames) == 0 {
+		return true
+	}
+
+	existing, err := h.userRepo.ExistingUsernames(usernames)
+	if err != nil {
+		log.Printf("Failed to check usernames: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось проверить логины"})
+		return false
+	}
+	taken := make(map[string]bool, len(existing))
+	for _, username := range existing {
+		taken[username] = true
+	}
+	for _, row := range rows {
+		username := strings.ToLower(row.user.Username)
+		if taken[username] && seen[username] == row.result.Row {
+			row.result.Errors = append(row.result.Errors, fmt.Sprintf(errUserAlreadyExists, row.user.Username))
+		}
+	}
+	return true
+}
+
+// sendWelcomeEmails отправляет временные пароли импортированным пользователям
+func (h *UserHandler) sendWelcomeEmails(rows []*importRow) {
+	for _, row := range rows {
+		if err := h.emailService.SendWelcomeEmail(row.user.Emails[0], row.user.Username, row.temporaryPassword); err != nil {
+			log.Printf("Failed to send welcome email to user %d: %v", row.user.ID, err)
+		}
+	}
+}
+
+func importResults(rows []*importRow) []ImportRowResult {
+	results := make([]ImportRowResult, len(rows))
+	for i, row := range rows {
+		results[i] = row.result
+	}
+	return results
+}
+
+func importRowEmpty(cells []string) bool {
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// splitImportList делит ячейку со списком значений (через ";", "," или перевод строки)
+func splitImportList(s string) []string {
+	var items []string
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == ',' || r == '\n' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseImportDate разбирает дату ГГГГ-ММ-ДД, ДД.ММ.ГГГГ или число дней Excel (ячейка с форматом даты)
+func parseImportDate(s string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02", "02.01.2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	if days, err := strconv.Atoi(s); err == nil && days > 0 && days < 100000 {
+		return time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, days), true
+	}
+	return time.Time{}, false
+}
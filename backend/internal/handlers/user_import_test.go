@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/policy"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+func setupUserImportTest(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+	return setupUserImportTestWithApprovals(t, nil)
+}
+
+func setupUserImportTestWithApprovals(t *testing.T, rules policy.ApprovalRules) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := builtinPermissionStore()
+	handler := NewUserHandler(
+		repositories.NewUserRepository(sqlxDB),
+		repositories.NewOrganizationRepository(sqlxDB),
+		repositories.NewAuditLogRepository(sqlxDB),
+		store,
+	)
+	handler.UseApprovals(rules)
+
+	router := gin.New()
+	router.POST("/users/import", func(c *gin.Context) {
+		c.Set("user_id", 1)
+		c.Set("role", models.RoleAdmin)
+		c.Next()
+	}, auth.LoadPermissions(store), handler.ImportUsers)
+	return router, mock
+}
+
+func importRequest(t *testing.T, filename, content string, fields map[string]string) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	part.Write([]byte(content))
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/users/import", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+const importCSV = "ФИО;Логин;Email\n" +
+	"Иванов Иван;ivanov;ivanov@gov.kz\n" +
+	";;\n" +
+	"Петров Пётр;petrov;not-an-email\n" +
+	"Иванов Второй;IVANOV;\n" +
+	"Сидоров;sidorov;\n"
+
+var importMapping = `{"ФИО": "full_name", "Логин": "username", "Email": "emails"}`
+
+func TestImportUsers_DryRunReportsRowErrors(t *testing.T) {
+	router, mock := setupUserImportTest(t)
+
+	mock.ExpectQuery(`SELECT LOWER\(username\) FROM users WHERE LOWER\(username\) = ANY`).
+		WithArgs(pq.Array([]string{"ivanov", "petrov", "sidorov"})).
+		WillReturnRows(sqlmock.NewRows([]string{"lower"}).AddRow("sidorov"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, importRequest(t, "users.csv", importCSV, map[string]string{"mapping": importMapping}))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result ImportResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !result.DryRun || result.Total != 4 || result.Valid != 1 || result.Invalid != 3 {
+		t.Fatalf("Unexpected counts: %+v", result)
+	}
+
+	// Пустая строка 3 пропущена: номера строк совпадают с файлом
+	expectedErrors := map[int]int{2: 0, 4: 1, 5: 1, 6: 1}
+	for _, row := range result.Rows {
+		if len(row.Errors) != expectedErrors[row.Row] {
+			t.Errorf("Row %d: expected %d errors, got %v", row.Row, expectedErrors[row.Row], row.Errors)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestImportUsers_CommitRejectsFileWithErrors(t *testing.T) {
+	router, mock := setupUserImportTest(t)
+
+	mock.ExpectQuery(`SELECT LOWER\(username\) FROM users`).
+		WillReturnRows(sqlmock.NewRows([]string{"lower"}))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, importRequest(t, "users.csv", importCSV, map[string]string{"mapping": importMapping, "dry_run": "false"}))
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422, got %d: %s", w.Code, w.Body.String())
+	}
+	// Ни одной транзакции: пользователи не создаются, пока в файле есть ошибки
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestImportUsers_CommitCreatesUsersInOneTransaction(t *testing.T) {
+	router, mock := setupUserImportTest(t)
+	content := "full_name,username,role,phones\n" +
+		"Иванов Иван,ivanov,user,+77011234567\n" +
+		"Петров Пётр,petrov,moderator,\n"
+
+	mock.ExpectQuery(`SELECT LOWER\(username\) FROM users`).
+		WillReturnRows(sqlmock.NewRows([]string{"lower"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO users").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(10, time.Now(), time.Now()))
+	mock.ExpectQuery("INSERT INTO users").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(11, time.Now(), time.Now()))
+	mock.ExpectCommit()
+	for i := 0; i < 3; i++ {
+		mock.ExpectExec("INSERT INTO audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, importRequest(t, "users.csv", content, map[string]string{"dry_run": "false"}))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var result ImportResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if result.Created != 2 || result.Rows[1].UserID != 11 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestImportUsers_AdminRoleRequiresApproval проверяет, что импортированный администратор создаётся с ролью user,
+// а повышение роли сохраняется запросом на подтверждение в той же транзакции
+func TestImportUsers_AdminRoleRequiresApproval(t *testing.T) {
+	router, mock := setupUserImportTestWithApprovals(t, policy.ApprovalRules{policy.ApprovalRoleAdmin: true})
+	content := "full_name,username,role\n" +
+		"Петров Пётр,petrov,admin\n"
+
+	mock.ExpectQuery(`SELECT LOWER\(username\) FROM users`).
+		WillReturnRows(sqlmock.NewRows([]string{"lower"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO users").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(10, time.Now(), time.Now()))
+	mock.ExpectQuery("INSERT INTO user_change_requests").
+		WithArgs(10, sqlmock.AnyArg(), sqlmock.AnyArg(), []byte(`{"social_links":{},"role":"admin"}`), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "created_at"}).AddRow(20, repositories.ChangeRequestPending, time.Now()))
+	mock.ExpectCommit()
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(1, repositories.ActionCreateUser, 10, []byte(`{"role":"user","source":"import","username":"petrov"}`), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(1, repositories.ActionChangeRequested, 10, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec("INSERT INTO audit_log").WillReturnResult(sqlmock.NewResult(3, 1))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, importRequest(t, "users.csv", content, map[string]string{"dry_run": "false"}))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var result ImportResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if len(result.Rows) != 1 || result.Rows[0].ChangeRequestID != 20 || len(result.Rows[0].PendingApproval) != 1 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/gin-gonic/gin"
+)
+
+// Подсказки поиска: минимальная длина запроса и размер выдачи
+const (
+	minSearchQueryLength = 2
+	defaultSearchLimit   = 10
+	maxSearchLimit       = 20
+)
+
+// SearchUsers godoc
+// @Summary Подсказки поиска пользователей
+// @Description Быстрый поиск для выпадающих подсказок: до limit самых релевантных пользователей без пагинации и подсчёта общего числа.
+// @Description Находит по началу слов ФИО, логину, email, телефону (по цифрам), с опечатками, латиницей или кириллицей (Асылбек / Asylbek).
+// @Description Без права users.read.all - только доступные пользователи; запрос короче 2 символов возвращает пустой список
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param q query string true "Строка поиска"
+// @Param limit query int false "Количество подсказок" default(10) maximum(20)
+// @Success 200 {object} map[string]interface{} "Подсказки"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /users/search [get]
+func (h *UserHandler) SearchUsers(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if utf8.RuneCountInString(query) < minSearchQueryLength {
+		c.JSON(http.StatusOK, gin.H{"users": []repositories.UserSearchItem{}})
+		return
+	}
+
+	limit := defaultSearchLimit
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = min(l, maxSearchLimit)
+	}
+
+	accessibleTo := 0
+	if !auth.HasPermission(c, auth.PermUsersReadAll) {
+		accessibleTo = c.GetInt("user_id")
+	}
+
+	users, err := h.userRepo.SearchSuggestions(query, accessibleTo, limit)
+	if err != nil {
+		log.Printf("Error searching users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errFailedToGetUsers})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+func setupUserSearchTest(t *testing.T, role models.UserRole) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := builtinPermissionStore()
+	handler := NewUserHandler(
+		repositories.NewUserRepository(sqlxDB),
+		repositories.NewOrganizationRepository(sqlxDB),
+		repositories.NewAuditLogRepository(sqlxDB),
+		store,
+	)
+
+	router := gin.New()
+	router.GET("/users/search", func(c *gin.Context) {
+		c.Set("user_id", 7)
+		c.Set("role", role)
+		c.Next()
+	}, auth.LoadPermissions(store), handler.SearchUsers)
+	return router, mock
+}
+
+func TestSearchUsers(t *testing.T) {
+	tests := []struct {
+		name  string
+		role  models.UserRole
+		query string
+		sql   string
+		args  []driver.Value
+	}{
+		{
+			name:  "Admin searches all users, limit is capped",
+			role:  models.RoleAdmin,
+			query: "q=" + url.QueryEscape("Асылбек") + "&limit=500",
+			sql:   `FROM users\s+WHERE deleted_at IS NULL AND \(search_vector(.+)\)\s+ORDER BY ts_rank(.+) DESC, full_name ASC, id\s+LIMIT \$4$`,
+			args:  []driver.Value{"асылбек:*", "%асылбек%", "асылбек", 20},
+		},
+		{
+			name:  "Moderator searches accessible users",
+			role:  models.RoleModerator,
+			query: "q=" + url.QueryEscape("87011"),
+			sql:   `FROM users\s+WHERE deleted_at IS NULL AND \((.+)phone_digits LIKE \$4\) AND EXISTS(.+)g.grantee_id = \$5(.+)LIMIT \$6$`,
+			args:  []driver.Value{"87011:*", "%87011%", "87011", "%87011%", 7, 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := setupUserSearchTest(t, tt.role)
+
+			mock.ExpectQuery(tt.sql).
+				WithArgs(tt.args...).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "full_name", "username", "avatar_url", "position", "department", "is_active"}).
+					AddRow(3, "Асылбек Нурланов", "asylbek", "", "Бухгалтер", "Бухгалтерия", true))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/users/search?"+tt.query, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+			}
+			var response struct {
+				Users []repositories.UserSearchItem `json:"users"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if len(response.Users) != 1 || response.Users[0].Username != "asylbek" {
+				t.Errorf("Unexpected users: %+v", response.Users)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// TestSearchUsers_ShortQuery проверяет, что короткий запрос не обращается к БД
+func TestSearchUsers_ShortQuery(t *testing.T) {
+	router, mock := setupUserSearchTest(t, models.RoleAdmin)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/users/search?q="+url.QueryEscape(" А "), nil)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != `{"users":[]}` {
+		t.Errorf("Expected empty result, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/gin-gonic/gin"
+)
+
+// ListTrash godoc
+// @Summary Корзина пользователей
+// @Description Удалённые пользователи, которых ещё можно восстановить (до окончательного удаления по сроку хранения). Фильтры и пагинация - как в списке пользователей; по умолчанию недавно удалённые первыми
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Номер страницы" default(1)
+// @Param page_size query int false "Размер страницы" default(20) maximum(100)
+// @Param sort_by query string false "Поле для сортировки" default(deleted_at)
+// @Param sort_desc query boolean false "Сортировка по убыванию" default(true)
+// @Param search query string false "Поиск по имени, username, email, телефону"
+// @Param role query string false "Фильтр по роли"
+// @Param department query string false "Фильтр по отделу"
+// @Param tags_any query string false "Есть хотя бы один из тегов (через запятую)"
+// @Param tags_all query string false "Есть все теги (через запятую)"
+// @Success 200 {object} repositories.PaginatedListResult "Удалённые пользователи (с deleted_at и deleted_by)"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /users/trash [get]
+func (h *UserHandler) ListTrash(c *gin.Context) {
+	params, ok := h.userListParams(c)
+	if !ok {
+		return
+	}
+	params.Deleted = true
+	if c.Query("sort_by") == "" {
+		params.SortBy = "deleted_at"
+	}
+
+	result, err := h.userRepo.GetAllPaginatedLight(params)
+	if err != nil {
+		log.Printf("Error listing deleted users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errFailedToGetUsers})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// RestoreUser godoc
+// @Summary Восстановить пользователя из корзины
+// @Description Возвращает удалённого пользователя со всеми данными и доступами. Восстановить можно только доступного пользователя, чьи права есть у текущего (как при удалении). Выданные до удаления сессии не восстанавливаются - нужен новый вход
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} map[string]interface{} "Восстановленный пользователь"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 403 {object} map[string]string "Нет доступа к пользователю или у него есть права, которых нет у вас"
+// @Failure 404 {object} map[string]string "Пользователя нет в корзине"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /users/{id}/restore [post]
+func (h *UserHandler) RestoreUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidUserID})
+		return
+	}
+
+	// Восстановить можно только доступного пользователя, чьи права есть у текущего (как в DeleteUser)
+	currentUserID := c.GetInt("user_id")
+	targetPermissions, ok := h.trashTargetPermissions(c, currentUserID, id)
+	if !ok {
+		return
+	}
+	if !auth.Permissions(c).Contains(targetPermissions) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нельзя восстановить пользователя с правами, которых нет у вас"})
+		return
+	}
+
+	restored, err := h.userRepo.Restore(id, currentUserID)
+	if err != nil {
+		log.Printf("Failed to restore user %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось восстановить пользователя"})
+		return
+	}
+	if !restored {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Пользователя нет в корзине"})
+		return
+	}
+
+	logAudit(h.auditLogRepo, c, repositories.ActionRestoreUser, &id, nil)
+	log.Printf("AUDIT: User %d (%s) restored user %d", currentUserID, c.GetString("username"), id)
+
+	user, err := h.userRepo.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить восстановленного пользователя"})
+		return
+	}
+	user.Password = models.NullString{}
+	h.hideCustomFields(c, user)
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// trashTargetPermissions проверяет доступ к пользователю из корзины и возвращает права его роли
+// (как loadPolicyTarget для действующих пользователей); false - ответ уже отправлен
+func (h *UserHandler) trashTargetPermissions(c *gin.Context, currentUserID, id int) (auth.PermissionSet, bool) {
+	if !auth.HasPermission(c, auth.PermUsersReadAll) {
+		canAccess, err := h.userRepo.CanModeratorAccessDeletedUser(currentUserID, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки доступа"})
+			return nil, false
+		}
+		if !canAccess {
+			c.JSON(http.StatusForbidden, gin.H{"error": errNoAccess})
+			return nil, false
+		}
+	}
+
+	role, err := h.userRepo.GetDeletedRole(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователя нет в корзине"})
+			return nil, false
+		}
+		log.Printf("Failed to get role of deleted user %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки доступа"})
+		return nil, false
+	}
+	return h.permissions.Permissions(role), true
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+func setupUserTrashTest(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+	return setupUserTrashTestAs(t, models.RoleAdmin)
+}
+
+func setupUserTrashTestAs(t *testing.T, role models.UserRole) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := customRolePermissionStore()
+	handler := NewUserHandler(
+		repositories.NewUserRepository(sqlxDB),
+		repositories.NewOrganizationRepository(sqlxDB),
+		repositories.NewAuditLogRepository(sqlxDB),
+		store,
+	)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", 1)
+		c.Set("username", "admin")
+		c.Set("role", role)
+		c.Next()
+	}, auth.LoadPermissions(store))
+	router.GET("/users/trash", handler.ListTrash)
+	router.POST("/users/:id/restore", handler.RestoreUser)
+	return router, mock
+}
+
+// TestListTrash проверяет, что корзина выбирает только удалённых, по умолчанию недавно удалённых первыми
+func TestListTrash(t *testing.T) {
+	router, mock := setupUserTrashTest(t)
+
+	deletedAt := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users WHERE deleted_at IS NOT NULL`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`FROM users\s+WHERE deleted_at IS NOT NULL\s+ORDER BY deleted_at DESC`).
+		WithArgs(20, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "full_name", "username", "role", "is_active", "created_at", "deleted_at", "deleted_by"}).
+			AddRow(5, "Иванов Иван", "ivanov", "user", true, deletedAt, deletedAt, 1))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/trash", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Total int                         `json:"total"`
+		Users []repositories.UserListItem `json:"users"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if body.Total != 1 || len(body.Users) != 1 {
+		t.Fatalf("Unexpected response: %s", w.Body.String())
+	}
+	if body.Users[0].DeletedAt == nil || body.Users[0].DeletedBy == nil || *body.Users[0].DeletedBy != 1 {
+		t.Errorf("Expected deleted_at and deleted_by in response: %s", w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRestoreUser(t *testing.T) {
+	router, mock := setupUserTrashTest(t)
+
+	mock.ExpectQuery(`SELECT role FROM users WHERE id = \$1 AND deleted_at IS NOT NULL`).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("user"))
+	mock.ExpectExec(`UPDATE users SET deleted_at = NULL, deleted_by = NULL, updated_by = \$2\s+WHERE id = \$1 AND deleted_at IS NOT NULL`).
+		WithArgs(5, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`SELECT (.+) FROM users WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "full_name", "username", "password", "role"}).
+			AddRow(5, "Иванов Иван", "ivanov", "hash", "user"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/5/restore", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		User map[string]interface{} `json:"user"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if body.User["username"] != "ivanov" {
+		t.Errorf("Unexpected user: %s", w.Body.String())
+	}
+	if password, ok := body.User["password"]; ok && password != nil && password != "" {
+		t.Errorf("Password must not be returned: %v", password)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRestoreUser_NotInTrash(t *testing.T) {
+	router, mock := setupUserTrashTest(t)
+
+	mock.ExpectQuery(`SELECT role FROM users WHERE id = \$1 AND deleted_at IS NOT NULL`).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/5/restore", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestRestoreUser_BroaderPermissionsForbidden проверяет, что роль с правом удаления не может восстановить
+// администратора: у него есть права, которых нет у текущего пользователя
+func TestRestoreUser_BroaderPermissionsForbidden(t *testing.T) {
+	router, mock := setupUserTrashTestAs(t, roleHelpdesk)
+
+	mock.ExpectQuery(`SELECT role FROM users WHERE id = \$1 AND deleted_at IS NOT NULL`).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("admin"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/5/restore", nil))
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestRestoreUser_NoAccess проверяет, что модератор не восстанавливает недоступного ему пользователя
+func TestRestoreUser_NoAccess(t *testing.T) {
+	router, mock := setupUserTrashTestAs(t, models.RoleModerator)
+
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM users WHERE id = \$2 AND deleted_at IS NOT NULL`).
+		WithArgs(1, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/5/restore", nil))
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -1,14 +1,20 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/UAssylbek/central-reporting/internal/auth"
 	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/policy"
 	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/services"
 	"github.com/UAssylbek/central-reporting/internal/utils"
 	"github.com/gin-gonic/gin"
 )
@@ -23,6 +29,9 @@ const (
 	errFailedToDeleteUser = "Не удалось удалить пользователя"
 	errUserNotFound       = "Пользователь не найден"
 	errCannotDeleteSelf   = "Вы не можете удалить самого себя"
+	errUsernameInTrash    = "Логин '%s' занят удалённым пользователем: он освободится после окончательного удаления"
+
+	errFailedToCreateChangeRequest = "Не удалось создать запрос на подтверждение"
 )
 
 func (h *UserHandler) GetUserByID(c *gin.Context) {
@@ -33,115 +42,287 @@ type UserHandler struct {
 	userRepo         *repositories.UserRepository
 	organizationRepo *repositories.OrganizationRepository
 	auditLogRepo     *repositories.AuditLogRepository
+	permissions      *auth.PermissionStore
+
+	// Подтверждение чувствительных изменений (пустые approvalRules - изменения применяются сразу)
+	approvalRules policy.ApprovalRules
+
+	// Приветственные письма с временным паролем при импорте (nil - генерация паролей недоступна)
+	emailService *services.EmailService
+
+	// Описания дополнительных полей (nil - custom_fields не проверяются)
+	customFields *policy.CustomFieldSchema
 }
 
-func NewUserHandler(userRepo *repositories.UserRepository, organizationRepo *repositories.OrganizationRepository, auditLogRepo *repositories.AuditLogRepository) *UserHandler {
+func NewUserHandler(userRepo *repositories.UserRepository, organizationRepo *repositories.OrganizationRepository, auditLogRepo *repositories.AuditLogRepository, permissions *auth.PermissionStore) *UserHandler {
 	return &UserHandler{
 		userRepo:         userRepo,
 		organizationRepo: organizationRepo,
 		auditLogRepo:     auditLogRepo,
+		permissions:      permissions,
+	}
+}
+
+// UseEmail включает отправку приветственных писем импортированным пользователям
+func (h *UserHandler) UseEmail(emailService *services.EmailService) {
+	h.emailService = emailService
+}
+
+// UseCustomFields включает проверку custom_fields по описаниям, скрытие полей по ролям и фильтр по ним
+func (h *UserHandler) UseCustomFields(schema *policy.CustomFieldSchema) {
+	h.customFields = schema
+}
+
+// customFieldViewer роль и права текущего пользователя для видимости дополнительных полей
+func customFieldViewer(c *gin.Context) policy.CustomFieldViewer {
+	role, _ := c.Get("role")
+	userRole, _ := role.(models.UserRole)
+	return policy.CustomFieldViewer{Role: userRole, Permissions: auth.Permissions(c)}
+}
+
+// checkCustomFields проверяет custom_fields из запроса и возвращает итоговые значения
+// (current - сохранённые значения, nil при создании)
+func (h *UserHandler) checkCustomFields(c *gin.Context, submitted, current models.CustomFields) (models.CustomFields, bool) {
+	if h.customFields == nil {
+		return submitted, true
+	}
+	definitions, err := h.customFields.Definitions()
+	if err != nil {
+		log.Printf("Failed to load custom field definitions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось проверить дополнительные поля"})
+		return nil, false
+	}
+
+	values, errs := policy.ValidateCustomFields(definitions, customFieldViewer(c), submitted, current)
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":               "Неверные значения дополнительных полей",
+			"custom_field_errors": errs,
+		})
+		return nil, false
+	}
+	return values, true
+}
+
+// hideCustomFields убирает из ответа дополнительные поля, скрытые от роли текущего пользователя
+func (h *UserHandler) hideCustomFields(c *gin.Context, user *models.User) {
+	hideCustomFieldsFrom(h.customFields, customFieldViewer(c), user)
+}
+
+// hideCustomFieldsFrom убирает дополнительные поля, скрытые от viewer (schema nil - поля не скрываются).
+// Если описания не загрузились, скрываются все поля
+func hideCustomFieldsFrom(schema *policy.CustomFieldSchema, viewer policy.CustomFieldViewer, user *models.User) {
+	if schema == nil {
+		return
+	}
+	definitions, err := schema.Definitions()
+	if err != nil {
+		log.Printf("Failed to load custom field definitions: %v", err)
+		user.CustomFields = models.CustomFields{}
+		return
+	}
+	user.CustomFields = policy.FilterCustomFields(definitions, viewer, user.CustomFields)
+}
+
+// UseApprovals включает подтверждение вторым администратором для изменений из rules
+func (h *UserHandler) UseApprovals(rules policy.ApprovalRules) {
+	h.approvalRules = rules
+}
+
+// policyTarget определяет, видит ли текущий пользователь изменяемого (без users.read.all - только доступных),
+// и права роли изменяемого пользователя
+func (h *UserHandler) policyTarget(c *gin.Context, currentUserID, id int) (policy.Target, bool) {
+	return loadPolicyTarget(c, h.userRepo, h.permissions, currentUserID, id)
+}
+
+// loadPolicyTarget собирает policy.Target; при отказе сам отвечает клиенту (403, 404 или 500)
+func loadPolicyTarget(c *gin.Context, userRepo *repositories.UserRepository, permissions *auth.PermissionStore, currentUserID, id int) (policy.Target, bool) {
+	target := policy.Target{ID: id, Accessible: true}
+	if currentUserID == id {
+		return target, true
+	}
+
+	if !auth.HasPermission(c, auth.PermUsersReadAll) {
+		canAccess, err := userRepo.CanModeratorAccessUser(currentUserID, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки доступа"})
+			return target, false
+		}
+		if !canAccess {
+			c.JSON(http.StatusForbidden, gin.H{"error": errNoAccess})
+			return target, false
+		}
+	}
+
+	role, err := userRepo.GetRole(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": errUserNotFound})
+			return target, false
+		}
+		log.Printf("Failed to get role of user %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки доступа"})
+		return target, false
+	}
+	target.Permissions = permissions.Permissions(role)
+	return target, true
+}
+
+// checkRoleAssignment проверяет, что роль существует и не даёт прав больше, чем у текущего пользователя
+func (h *UserHandler) checkRoleAssignment(c *gin.Context, role models.UserRole) bool {
+	status, errMsg := h.roleAssignmentError(c, role)
+	if errMsg != "" {
+		c.JSON(status, gin.H{"error": errMsg})
+		return false
+	}
+	return true
+}
+
+// roleAssignmentError возвращает статус и текст ошибки назначения роли (пустой текст - роль можно назначить)
+func (h *UserHandler) roleAssignmentError(c *gin.Context, role models.UserRole) (int, string) {
+	if !h.permissions.RoleExists(role) {
+		return http.StatusBadRequest, fmt.Sprintf("Неизвестная роль: %s", role)
+	}
+	if !auth.Permissions(c).Contains(h.permissions.Permissions(role)) {
+		return http.StatusForbidden, "Нельзя назначить роль с правами, которых нет у вас"
 	}
+	return http.StatusOK, ""
+}
+
+// newUserFieldsDecision проверяет по правилам policy организации и доступных пользователей нового пользователя:
+// назначить их при создании можно, только если текущий пользователь может изменить эти поля
+func newUserFieldsDecision(c *gin.Context, orgs models.Organizations, accessible models.AccessibleUsers) policy.Decision {
+	actor := policy.Actor{ID: c.GetInt("user_id"), Permissions: auth.Permissions(c)}
+	return policy.EvaluateUpdate(actor, policy.Target{Accessible: true}, models.UpdateUserRequest{
+		AvailableOrganizations: orgs,
+		AccessibleUsers:        accessible,
+	})
+}
+
+// checkUsernameNotInTrash проверяет, что логин не занят удалённым пользователем из корзины
+func (h *UserHandler) checkUsernameNotInTrash(c *gin.Context, username string) bool {
+	taken, err := h.userRepo.ExistingUsernames([]string{username})
+	if err != nil {
+		log.Printf("Failed to check username %s: %v", username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось проверить логин"})
+		return false
+	}
+	if len(taken) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf(errUsernameInTrash, username)})
+		return false
+	}
+	return true
 }
 
 // GetUsers godoc
 // @Summary Получить список пользователей
-// @Description Возвращает пагинированный список пользователей с фильтрацией и поиском. Admins видят всех, Moderators - только доступных им
+// @Description Возвращает пагинированный список пользователей с фильтрацией и поиском. С правом users.read.all - всех, иначе только доступных
 // @Tags users
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param page query int false "Номер страницы" default(1)
 // @Param page_size query int false "Размер страницы" default(20) maximum(100)
-// @Param sort_by query string false "Поле для сортировки" default(created_at)
+// @Param sort_by query string false "Поле для сортировки (relevance - по релевантности поиска, по умолчанию при search)" default(created_at)
 // @Param sort_desc query boolean false "Сортировка по убыванию" default(true)
 // @Param search query string false "Поиск по имени, username, email, телефону"
 // @Param role query string false "Фильтр по роли (admin, moderator, employee)"
 // @Param is_active query boolean false "Фильтр по активности"
 // @Param department query string false "Фильтр по отделу"
+// @Param custom_fields[key] query string false "Фильтр по дополнительному полю key (точное совпадение, только видимые роли поля)"
+// @Param tags_any query string false "Есть хотя бы один из тегов (через запятую)"
+// @Param tags_all query string false "Есть все теги (через запятую)"
 // @Success 200 {object} repositories.PaginatedListResult "Список пользователей"
+// @Failure 400 {object} map[string]interface{} "Неверный фильтр по дополнительным полям"
 // @Failure 401 {object} map[string]string "Не авторизован"
 // @Failure 500 {object} map[string]string "Ошибка сервера"
 // @Router /users [get]
 func (h *UserHandler) GetUsers(c *gin.Context) {
 	log.Println("GetUsers handler called")
 
-	role, _ := c.Get("role")
-	userID, _ := c.Get("user_id")
+	params, ok := h.userListParams(c)
+	if !ok {
+		return
+	}
+	result, err := h.userRepo.GetAllPaginatedLight(params)
+	if err != nil {
+		log.Printf("Error in GetUsers handler: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errFailedToGetUsers})
+		return
+	}
+
+	log.Printf("Found %d users (page %d of %d)", len(result.Users), result.Page, result.TotalPages)
+	c.JSON(http.StatusOK, result)
+}
 
-	// Получаем параметры пагинации и фильтрации из query string
-	page := 1
-	pageSize := 20
-	sortBy := "created_at"
-	sortDesc := true
-	search := c.Query("search")
-	roleFilter := c.Query("role")
-	department := c.Query("department")
+// userListParams пагинация, фильтры и сортировка списка пользователей из query string.
+// Без права на всех пользователей - те же фильтры, но только среди доступных (ограничение в SQL).
+// Фильтр по дополнительным полям: custom_fields[ключ]=значение; при ошибке в нём ответ уже отправлен
+func (h *UserHandler) userListParams(c *gin.Context) (repositories.PaginationParams, bool) {
+	params := repositories.PaginationParams{
+		Page:       1,
+		PageSize:   20,
+		SortBy:     "created_at",
+		SortDesc:   true,
+		Search:     c.Query("search"),
+		Role:       c.Query("role"),
+		Department: c.Query("department"),
+		// Теги через запятую или повтором параметра
+		TagsAny: splitImportList(strings.Join(c.QueryArray("tags_any"), ",")),
+		TagsAll: splitImportList(strings.Join(c.QueryArray("tags_all"), ",")),
+	}
 
 	if pageStr := c.Query("page"); pageStr != "" {
 		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-			page = p
+			params.Page = p
 		}
 	}
 
 	if pageSizeStr := c.Query("page_size"); pageSizeStr != "" {
 		if ps, err := strconv.Atoi(pageSizeStr); err == nil && ps > 0 && ps <= 100 {
-			pageSize = ps
+			params.PageSize = ps
 		}
 	}
 
 	if sort := c.Query("sort_by"); sort != "" {
-		sortBy = sort
+		params.SortBy = sort
+	} else if strings.TrimSpace(params.Search) != "" {
+		// При поиске по умолчанию самые подходящие первыми
+		params.SortBy = repositories.SortByRelevance
 	}
 
 	if sortDescStr := c.Query("sort_desc"); sortDescStr != "" {
-		sortDesc = sortDescStr == "true" || sortDescStr == "1"
+		params.SortDesc = sortDescStr == "true" || sortDescStr == "1"
 	}
 
 	// Обработка фильтра is_active
-	var isActive *bool
 	if isActiveStr := c.Query("is_active"); isActiveStr != "" {
 		val := isActiveStr == "true" || isActiveStr == "1"
-		isActive = &val
+		params.IsActive = &val
 	}
 
-	// Если модератор - показываем только доступных ему пользователей
-	if role == models.RoleModerator {
-		log.Printf("Moderator %d requesting accessible users", userID.(int))
-		users, err := h.userRepo.GetAccessibleUsers(userID.(int))
+	if raw := c.QueryMap("custom_fields"); len(raw) > 0 && h.customFields != nil {
+		definitions, err := h.customFields.Definitions()
 		if err != nil {
-			log.Printf("Error in GetUsers handler: %v", err)
+			log.Printf("Failed to load custom field definitions: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": errFailedToGetUsers})
-			return
+			return params, false
 		}
-		// Возвращаем в формате совместимом с фронтендом
-		c.JSON(http.StatusOK, gin.H{
-			"users": users,
-			"total": len(users),
-		})
-		return
-	}
-
-	// Для админа - показываем всех пользователей с пагинацией и фильтрацией
-	params := repositories.PaginationParams{
-		Page:       page,
-		PageSize:   pageSize,
-		SortBy:     sortBy,
-		SortDesc:   sortDesc,
-		Search:     search,
-		Role:       roleFilter,
-		IsActive:   isActive,
-		Department: department,
+		filter, errs := policy.ParseCustomFieldFilter(definitions, customFieldViewer(c), raw)
+		if len(errs) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":               "Неверный фильтр по дополнительным полям",
+				"custom_field_errors": errs,
+			})
+			return params, false
+		}
+		params.CustomFields = filter
 	}
 
-	result, err := h.userRepo.GetAllPaginatedLight(params)
-	if err != nil {
-		log.Printf("Error in GetUsers handler: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": errFailedToGetUsers})
-		return
+	if !auth.HasPermission(c, auth.PermUsersReadAll) {
+		params.AccessibleTo = c.GetInt("user_id")
 	}
-
-	log.Printf("Found %d users (page %d of %d)", len(result.Users), result.Page, result.TotalPages)
-	c.JSON(http.StatusOK, result)
+	return params, true
 }
 
 func (h *UserHandler) GetUser(c *gin.Context) {
@@ -152,11 +333,10 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 		return
 	}
 
-	role, _ := c.Get("role")
 	userID, _ := c.Get("user_id")
 
-	// Если модератор - проверяем доступ
-	if role == models.RoleModerator {
+	// Без права на всех пользователей - проверяем доступ
+	if !auth.HasPermission(c, auth.PermUsersReadAll) {
 		canAccess, err := h.userRepo.CanModeratorAccessUser(userID.(int), id)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки доступа"})
@@ -174,6 +354,7 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 		return
 	}
 
+	h.hideCustomFields(c, user)
 	c.JSON(http.StatusOK, gin.H{"user": user})
 }
 
@@ -234,12 +415,15 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
-	role, _ := c.Get("role")
 	currentUserID, _ := c.Get("user_id")
 
-	if role != models.RoleAdmin {
+	if !h.checkRoleAssignment(c, req.Role) {
+		return
+	}
+	if decision := newUserFieldsDecision(c, req.AvailableOrganizations, req.AccessibleUsers); !decision.OK() {
 		c.JSON(http.StatusForbidden, gin.H{
-			"error": "Только администраторы могут создавать пользователей",
+			"error":         "Недостаточно прав для изменения полей",
+			"denied_fields": decision.Denied,
 		})
 		return
 	}
@@ -264,6 +448,9 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		})
 		return
 	}
+	if !h.checkUsernameNotInTrash(c, req.Username) {
+		return
+	}
 
 	// Функция для создания NullString
 	createNullString := func(s string) models.NullString {
@@ -295,6 +482,11 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 	if req.CustomFields == nil {
 		req.CustomFields = models.CustomFields{}
 	}
+	customFields, ok := h.checkCustomFields(c, req.CustomFields, nil)
+	if !ok {
+		return
+	}
+	req.CustomFields = customFields
 
 	user := models.User{
 		FullName:               req.FullName,
@@ -324,15 +516,36 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		IsActive:               true,
 		Role:                   req.Role,
 		IsFirstLogin:           true,
+		IsServiceAccount:       req.IsServiceAccount,
 		CreatedBy:              models.NullInt{Int: currentUserID.(int), Valid: true},
 	}
 
+	// Сервисная учётная запись не имеет пароля и не входит интерактивно
+	if user.IsServiceAccount {
+		user.Password = models.NullString{}
+		user.RequirePasswordChange = false
+		user.IsFirstLogin = false
+		user.ShowInSelection = false
+	}
+
 	// Если пароль не задан, но требуется его смена при первом входе
 	if !user.Password.Valid && user.RequirePasswordChange {
 		user.IsFirstLogin = true
 	}
 
-	if err := h.userRepo.Create(&user); err != nil {
+	// Роль с расширенными правами и организации нового пользователя подтверждаются так же, как при изменении
+	approval, changeRequest, ok := h.newUserApproval(c, &user)
+	if !ok {
+		return
+	}
+
+	var err error
+	if changeRequest == nil {
+		err = h.userRepo.Create(&user)
+	} else {
+		err = h.userRepo.CreateWithChangeRequest(&user, changeRequest)
+	}
+	if err != nil {
 		log.Printf("Failed to create user: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": errFailedToCreateUser,
@@ -341,12 +554,12 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 	}
 
 	// Audit log: создание пользователя
-	targetUserIDPtr := &user.ID
-	if err := h.auditLogRepo.Log(currentUserID.(int), "create_user", targetUserIDPtr, map[string]interface{}{
+	logAudit(h.auditLogRepo, c, repositories.ActionCreateUser, &user.ID, map[string]interface{}{
 		"username": user.Username,
 		"role":     user.Role,
-	}, c.ClientIP(), c.Request.UserAgent()); err != nil {
-		log.Printf("Failed to write audit log: %v", err)
+	})
+	if changeRequest != nil {
+		h.logChangeRequest(c, user.ID, changeRequest, approval)
 	}
 
 	log.Printf("AUDIT: User %d (%s) created user %d (%s) with role %s",
@@ -358,9 +571,54 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 	)
 
 	user.Password = models.NullString{}
+	h.hideCustomFields(c, &user)
+	if changeRequest != nil {
+		c.JSON(http.StatusCreated, gin.H{
+			"user":           user,
+			"change_request": changeRequest,
+			"message":        "Роль и организации вступят в силу после подтверждения другим администратором",
+		})
+		return
+	}
 	c.JSON(http.StatusCreated, gin.H{"user": user})
 }
 
+// EditableFields godoc
+// @Summary Поля, доступные для изменения
+// @Description Возвращает поля пользователя, которые текущий пользователь может изменить (для блокировки полей формы)
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} map[string]interface{} "Список полей"
+// @Failure 400 {object} map[string]string "Неверный ID пользователя"
+// @Failure 403 {object} map[string]string "Нет доступа к пользователю"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Router /users/{id}/editable-fields [get]
+func (h *UserHandler) EditableFields(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidUserID})
+		return
+	}
+
+	currentUserID := c.GetInt("user_id")
+	target, ok := h.policyTarget(c, currentUserID, id)
+	if !ok {
+		return
+	}
+
+	if _, err := h.userRepo.GetByID(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errUserNotFound})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": id,
+		"fields":  policy.EditableFields(policy.Actor{ID: currentUserID, Permissions: auth.Permissions(c)}, target),
+	})
+}
+
 // UpdateUser обновляет данные пользователя
 func (h *UserHandler) UpdateUser(c *gin.Context) {
 	idStr := c.Param("id")
@@ -376,94 +634,87 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	role, _ := c.Get("role")
 	userID, _ := c.Get("user_id")
 	currentUserID := userID.(int)
 
-	// 🔧 ИСПРАВЛЕНИЕ 1: Администратор имеет полный доступ без ограничений
-	if role == models.RoleAdmin {
-		// Админ может редактировать все поля - ничего не очищаем
-	} else if role == models.RoleModerator {
-		if currentUserID == id {
-			// Модератор редактирует себя
-			if req.Role != "" {
-				c.JSON(http.StatusForbidden, gin.H{"error": "Модераторы не могут изменять свою роль"})
-				return
-			}
-			if req.Username != "" {
-				c.JSON(http.StatusForbidden, gin.H{"error": "Модераторы не могут изменять свой логин"})
-				return
-			}
-			if req.Password != "" {
-				c.JSON(http.StatusForbidden, gin.H{"error": "Используйте отдельную форму для смены пароля"})
-				return
-			}
+	target, ok := h.policyTarget(c, currentUserID, id)
+	if !ok {
+		return
+	}
 
-			// ✅ ДОБАВИТЬ: Явно очищаем запрещённые поля
-			req.Role = ""
-			req.Username = ""
-			req.Password = ""
-			req.AvailableOrganizations = nil
-			req.AccessibleUsers = nil
-
-		} else {
-			// Модератор редактирует другого
-			canAccess, err := h.userRepo.CanModeratorAccessUser(currentUserID, id)
-			if err != nil || !canAccess {
-				c.JSON(http.StatusForbidden, gin.H{"error": errNoAccess})
-				return
-			}
+	// Каждое поле запроса проверяется по правилам policy
+	decision := policy.EvaluateUpdate(policy.Actor{ID: currentUserID, Permissions: auth.Permissions(c)}, target, req)
+	if !decision.OK() {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":         "Недостаточно прав для изменения полей",
+			"denied_fields": decision.Denied,
+		})
+		return
+	}
 
-			// ✅ УЛУЧШЕНИЕ: Создаём новый request с ТОЛЬКО разрешёнными полями
-			req = models.UpdateUserRequest{
-				AvailableOrganizations: req.AvailableOrganizations,
-			}
-		}
-	} else if role == models.RoleUser {
-		if currentUserID != id {
-			c.JSON(http.StatusForbidden, gin.H{"error": errNoAccess})
-			return
-		}
+	if req.Role != "" && !h.checkRoleAssignment(c, req.Role) {
+		return
+	}
 
-		// User редактирует себя
-		if req.Role != "" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Вы не можете изменять свою роль"})
+	// Проверка на существование пользователя с таким username (только если username меняется)
+	if req.Username != "" {
+		existingUser, _ := h.userRepo.GetByUsername(req.Username)
+		if existingUser != nil && existingUser.ID != id {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": fmt.Sprintf(errUserAlreadyExists, req.Username),
+			})
 			return
 		}
-		if req.Username != "" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Вы не можете изменять свой логин"})
+		if existingUser == nil && !h.checkUsernameNotInTrash(c, req.Username) {
 			return
 		}
-		if req.Password != "" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Используйте отдельную форму для смены пароля"})
+	}
+
+	// custom_fields заменяются целиком: значения скрытых от роли полей переносятся из сохранённых
+	if len(req.CustomFields) > 0 && h.customFields != nil {
+		current, err := h.userRepo.GetByID(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": errUserNotFound})
 			return
 		}
-		if len(req.AvailableOrganizations) > 0 {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Вы не можете изменять доступные организации"})
+		if req.CustomFields, ok = h.checkCustomFields(c, req.CustomFields, current.CustomFields); !ok {
 			return
 		}
-
-		// ✅ ДОБАВИТЬ: Явно очищаем запрещённые поля
-		req.Role = ""
-		req.Username = ""
-		req.Password = ""
-		req.AvailableOrganizations = nil
-		req.AccessibleUsers = nil
 	}
 
-	// Проверка на существование пользователя с таким username (только если username меняется)
-	if req.Username != "" {
-		existingUser, _ := h.userRepo.GetByUsername(req.Username)
-		if existingUser != nil && existingUser.ID != id {
-			c.JSON(http.StatusConflict, gin.H{
-				"error": fmt.Sprintf(errUserAlreadyExists, req.Username),
-			})
+	// Чувствительные изменения откладываются до подтверждения второго администратора
+	var changeRequest *repositories.ChangeRequest
+	var approval policy.Approval
+	if len(h.approvalRules) > 0 {
+		current, err := h.userRepo.GetByID(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": errUserNotFound})
 			return
 		}
+
+		approval = policy.SplitForApproval(current, req, h.approvalRules, h.permissions)
+		if approval.Required() {
+			if changeRequest, err = h.newChangeRequest(c, id, approval); err != nil {
+				log.Printf("Failed to prepare change request for user %d: %v", id, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": errFailedToCreateChangeRequest})
+				return
+			}
+			req = approval.Immediate
+		}
 	}
 
-	// Выполняем обновление
-	if err := h.userRepo.Update(id, req, currentUserID); err != nil {
+	// Выполняем обновление; запрос на подтверждение сохраняется в той же транзакции
+	var changes repositories.UserChanges
+	if changeRequest == nil {
+		changes, err = h.userRepo.Update(id, req, currentUserID)
+	} else {
+		var immediate *models.UpdateUserRequest
+		if policy.HasChanges(req) {
+			immediate = &req
+		}
+		changes, err = h.userRepo.UpdateWithChangeRequest(id, immediate, changeRequest, currentUserID)
+	}
+	if err != nil {
 		log.Printf("Failed to update user %d: %v", id, err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": errFailedToUpdateUser,
@@ -471,12 +722,20 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	// ✅ ДОБАВИТЬ: Лог успешного обновления
-	log.Printf("AUDIT: User %d (%s) updated user %d",
-		currentUserID,
-		c.GetString("username"),
-		id,
-	)
+	if changeRequest != nil {
+		h.logChangeRequest(c, id, changeRequest, approval)
+	}
+	// Журнал изменений (если в запросе было что-то кроме отложенных изменений)
+	if changeRequest == nil || policy.HasChanges(req) {
+		logUserChanges(h.auditLogRepo, c, id, repositories.ActionUpdateUser, changes)
+
+		// ✅ ДОБАВИТЬ: Лог успешного обновления
+		log.Printf("AUDIT: User %d (%s) updated user %d",
+			currentUserID,
+			c.GetString("username"),
+			id,
+		)
+	}
 
 	// Получаем обновлённого пользователя
 	updatedUser, err := h.userRepo.GetByID(id)
@@ -489,9 +748,90 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 
 	// Очищаем пароль перед отправкой
 	updatedUser.Password = models.NullString{}
+	h.hideCustomFields(c, updatedUser)
+	if changeRequest != nil {
+		c.JSON(http.StatusAccepted, gin.H{
+			"user":           updatedUser,
+			"change_request": changeRequest,
+			"message":        "Часть изменений вступит в силу после подтверждения другим администратором",
+		})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"user": updatedUser})
 }
 
+// logChangeRequest пишет в журнал аудита созданный запрос на подтверждение
+func (h *UserHandler) logChangeRequest(c *gin.Context, targetID int, request *repositories.ChangeRequest, approval policy.Approval) {
+	logAudit(h.auditLogRepo, c, repositories.ActionChangeRequested, &targetID, changeRequestDetails(request, approval))
+	log.Printf("AUDIT: User %d requested approval (%v) for changes of user %d, request %d",
+		request.RequestedBy.Int64, request.Rules, targetID, request.ID)
+}
+
+// newUserApproval откладывает до подтверждения чувствительные поля нового пользователя (по тем же правилам,
+// что и при изменении): пользователь создаётся с ролью user и без организаций, а запрошенные значения
+// сохраняются в запросе на подтверждение. false - ответ уже отправлен
+func (h *UserHandler) newUserApproval(c *gin.Context, user *models.User) (policy.Approval, *repositories.ChangeRequest, bool) {
+	approval := h.splitNewUser(user)
+	if !approval.Required() {
+		return approval, nil, true
+	}
+	request, err := h.newChangeRequest(c, 0, approval)
+	if err != nil {
+		log.Printf("Failed to prepare change request for new user %s: %v", user.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errFailedToCreateChangeRequest})
+		return approval, nil, false
+	}
+	return approval, request, true
+}
+
+// splitNewUser сравнивает нового пользователя с учётной записью без прав и организаций и убирает из него
+// поля, требующие подтверждения
+func (h *UserHandler) splitNewUser(user *models.User) policy.Approval {
+	if len(h.approvalRules) == 0 {
+		return policy.Approval{}
+	}
+	baseline := &models.User{Role: models.RoleUser, IsActive: true, AvailableOrganizations: models.Organizations{}}
+	approval := policy.SplitForApproval(baseline, models.UpdateUserRequest{
+		Role:                   user.Role,
+		AvailableOrganizations: user.AvailableOrganizations,
+	}, h.approvalRules, h.permissions)
+
+	if approval.Pending.Role != "" {
+		user.Role = baseline.Role
+	}
+	if approval.Pending.AvailableOrganizations != nil {
+		user.AvailableOrganizations = baseline.AvailableOrganizations
+	}
+	return approval
+}
+
+// newChangeRequest готовит запрос на подтверждение отложенных изменений (не сохраняет его)
+func (h *UserHandler) newChangeRequest(c *gin.Context, targetID int, approval policy.Approval) (*repositories.ChangeRequest, error) {
+	// При входе под другим пользователем автором считается администратор - он не сможет подтвердить сам себя
+	requesterID := c.GetInt("user_id")
+	if impersonatorID := auth.ImpersonatorID(c); impersonatorID != nil {
+		requesterID = *impersonatorID
+	}
+	return repositories.NewChangeRequest(targetID, requesterID, approvalRuleNames(approval), approval.Pending, approval.Diff)
+}
+
+// changeRequestDetails подробности записи журнала о созданном запросе на подтверждение
+func changeRequestDetails(request *repositories.ChangeRequest, approval policy.Approval) map[string]interface{} {
+	return map[string]interface{}{
+		"change_request_id": request.ID,
+		"rules":             approvalRuleNames(approval),
+		"diff":              approval.Diff,
+	}
+}
+
+func approvalRuleNames(approval policy.Approval) []string {
+	rules := make([]string, 0, len(approval.Rules))
+	for _, rule := range approval.Rules {
+		rules = append(rules, string(rule))
+	}
+	return rules
+}
+
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
@@ -500,35 +840,42 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	role, _ := c.Get("role")
 	userID, _ := c.Get("user_id")
 
-	// Модераторы не могут удалять пользователей
-	if role == models.RoleModerator {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Модераторы не могут удалять пользователей"})
-		return
-	}
-
 	// Проверяем что пользователь не пытается удалить сам себя
 	if userID.(int) == id {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Нельзя удалить самого себя"})
 		return
 	}
 
-	if err := h.userRepo.Delete(id); err != nil {
+	// Удалить можно только доступного пользователя, чьи права есть у текущего
+	target, ok := h.policyTarget(c, userID.(int), id)
+	if !ok {
+		return
+	}
+	if !auth.Permissions(c).Contains(target.Permissions) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нельзя удалить пользователя с правами, которых нет у вас"})
+		return
+	}
+
+	// Пользователь перемещается в корзину: окончательно удаляется по сроку хранения
+	deleted, err := h.userRepo.Delete(id, userID.(int))
+	if err != nil {
+		log.Printf("Failed to delete user %d: %v", id, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось удалить пользователя"})
 		return
 	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": errUserNotFound})
+		return
+	}
 
 	// Audit log: удаление пользователя
-	targetUserIDPtr := &id
-	if err := h.auditLogRepo.Log(userID.(int), "delete_user", targetUserIDPtr, nil, c.ClientIP(), c.Request.UserAgent()); err != nil {
-		log.Printf("Failed to write audit log: %v", err)
-	}
+	logAudit(h.auditLogRepo, c, repositories.ActionDeleteUser, &id, nil)
 
 	log.Printf("AUDIT: User %d (%s) deleted user %d", userID.(int), c.GetString("username"), id)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Пользователь удален успешно"})
+	c.JSON(http.StatusOK, gin.H{"message": "Пользователь перемещён в корзину"})
 }
 
 // GetOrganizations godoc
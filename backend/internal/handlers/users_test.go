@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/policy"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+func setupUserListTest(t *testing.T, role models.UserRole) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := builtinPermissionStore()
+	handler := NewUserHandler(
+		repositories.NewUserRepository(sqlxDB),
+		repositories.NewOrganizationRepository(sqlxDB),
+		repositories.NewAuditLogRepository(sqlxDB),
+		store,
+	)
+
+	router := gin.New()
+	router.GET("/users", func(c *gin.Context) {
+		c.Set("user_id", 7)
+		c.Set("role", role)
+		c.Next()
+	}, auth.LoadPermissions(store), handler.GetUsers)
+	return router, mock
+}
+
+func TestGetUsers_SameShapeForAllRoles(t *testing.T) {
+	tests := []struct {
+		name       string
+		role       models.UserRole
+		countQuery string
+		countArgs  []driver.Value
+		listArgs   []driver.Value
+	}{
+		{
+			name:       "Admin sees all users",
+			role:       models.RoleAdmin,
+			countQuery: "SELECT COUNT\\(\\*\\) FROM users WHERE deleted_at IS NULL AND LOWER\\(department\\) LIKE \\$1$",
+			countArgs:  []driver.Value{"%бухгалтерия%"},
+			listArgs:   []driver.Value{"%бухгалтерия%", 10, 10},
+		},
+		{
+			name:       "Moderator sees accessible users",
+			role:       models.RoleModerator,
+			countQuery: "SELECT COUNT\\(\\*\\) FROM users WHERE deleted_at IS NULL AND LOWER\\(department\\) LIKE \\$1 AND EXISTS(.+)g.grantee_id = \\$2",
+			countArgs:  []driver.Value{"%бухгалтерия%", 7},
+			listArgs:   []driver.Value{"%бухгалтерия%", 7, 10, 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := setupUserListTest(t, tt.role)
+
+			mock.ExpectQuery(tt.countQuery).
+				WithArgs(tt.countArgs...).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(11))
+			mock.ExpectQuery("SELECT (.+) FROM users(.+)ORDER BY full_name ASC LIMIT").
+				WithArgs(tt.listArgs...).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "full_name", "username", "role", "last_seen", "created_at"}).
+					AddRow(3, "Бухгалтер", "accountant", "user", time.Now(), time.Now()))
+
+			req, _ := http.NewRequest("GET", "/users?page=2&page_size=10&sort_by=full_name&sort_desc=false&department=Бухгалтерия", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+			}
+
+			var result repositories.PaginatedListResult
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if result.Total != 11 || result.Page != 2 || result.PageSize != 10 || result.TotalPages != 2 || len(result.Users) != 1 {
+				t.Errorf("Unexpected pagination: %+v", result)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func setupUserUpdateTest(t *testing.T, userID int, role models.UserRole) (*gin.Engine, sqlmock.Sqlmock) {
+	return setupUserUpdateTestWithApprovals(t, userID, role, nil)
+}
+
+func setupUserUpdateTestWithApprovals(t *testing.T, userID int, role models.UserRole, rules policy.ApprovalRules) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := customRolePermissionStore()
+	handler := NewUserHandler(
+		repositories.NewUserRepository(sqlxDB),
+		repositories.NewOrganizationRepository(sqlxDB),
+		repositories.NewAuditLogRepository(sqlxDB),
+		store,
+	)
+	handler.UseApprovals(rules)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("role", role)
+		c.Next()
+	}, auth.LoadPermissions(store))
+	router.POST("/users", handler.CreateUser)
+	router.PUT("/users/:id", handler.UpdateUser)
+	router.DELETE("/users/:id", handler.DeleteUser)
+	return router, mock
+}
+
+// TestUpdateUser_CustomRoleOnAdmin проверяет, что собственная роль с users.update.credentials и users.update.role
+// не меняет пароль, роль и блокировку администратора: его права шире
+func TestUpdateUser_CustomRoleOnAdmin(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "Password reset", body: `{"password":"Takeover123!"}`},
+		{name: "Demotion", body: `{"role":"user"}`},
+		{name: "Block", body: `{"is_active":false}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := setupUserUpdateTest(t, 2, roleHelpdesk)
+			mock.ExpectQuery(`SELECT role FROM users WHERE id = \$1 AND deleted_at IS NULL`).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("admin"))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", "/users/1", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"reason":"outranked"`) {
+				t.Errorf("Expected 403 outranked, got %d: %s", w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// TestUpdateUser_ApprovalInUpdateTransaction проверяет, что запрос на подтверждение сохраняется в транзакции
+// изменения: если изменение не удалось, запроса не остаётся и в журнал ничего не пишется
+func TestUpdateUser_ApprovalInUpdateTransaction(t *testing.T) {
+	tests := []struct {
+		name       string
+		updateErr  error
+		wantStatus int
+	}{
+		{name: "Update fails", updateErr: errors.New("connection reset"), wantStatus: http.StatusInternalServerError},
+		{name: "Update succeeds", wantStatus: http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := setupUserUpdateTestWithApprovals(t, 1, models.RoleAdmin, policy.ApprovalRules{policy.ApprovalUnblock: true})
+			blocked := func() *sqlmock.Rows {
+				return sqlmock.NewRows([]string{"id", "username", "role", "is_active"}).AddRow(5, "ivanov", "user", false)
+			}
+
+			mock.ExpectQuery(`SELECT role FROM users WHERE id = \$1 AND deleted_at IS NULL`).
+				WithArgs(5).
+				WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("user"))
+			mock.ExpectQuery(`SELECT (.+) FROM users WHERE id = \$1`).WithArgs(5).WillReturnRows(blocked())
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT (.+) FROM users WHERE id = \$1`).WithArgs(5).WillReturnRows(blocked())
+			mock.ExpectQuery("INSERT INTO user_change_requests").
+				WithArgs(5, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "status", "created_at"}).AddRow(12, repositories.ChangeRequestPending, time.Now()))
+			update := mock.ExpectExec(`UPDATE users SET position = \$1`).WithArgs("Инженер", 1, 5)
+			if tt.updateErr != nil {
+				update.WillReturnError(tt.updateErr)
+				mock.ExpectRollback()
+			} else {
+				update.WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`SELECT (.+) FROM users WHERE id = \$1`).WithArgs(5).WillReturnRows(blocked())
+				mock.ExpectCommit()
+				mock.ExpectExec("INSERT INTO audit_log").
+					WithArgs(1, repositories.ActionChangeRequested, 5, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery(`SELECT (.+) FROM users WHERE id = \$1`).WithArgs(5).WillReturnRows(blocked())
+			}
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", "/users/5", strings.NewReader(`{"is_active":true,"position":"Инженер"}`))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// TestCreateUser_AdminRoleRequiresApproval проверяет, что новый администратор создаётся с ролью user,
+// а повышение роли сохраняется запросом на подтверждение в той же транзакции
+func TestCreateUser_AdminRoleRequiresApproval(t *testing.T) {
+	router, mock := setupUserUpdateTestWithApprovals(t, 1, models.RoleAdmin, policy.ApprovalRules{policy.ApprovalRoleAdmin: true})
+
+	mock.ExpectQuery(`FROM users WHERE LOWER\(username\) = LOWER\(\$1\)`).WithArgs("newadmin").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT LOWER\(username\) FROM users WHERE LOWER\(username\) = ANY\(\$1\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"lower"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO users").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(10, time.Now(), time.Now()))
+	mock.ExpectQuery("INSERT INTO user_change_requests").
+		WithArgs(10, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "created_at"}).AddRow(20, repositories.ChangeRequestPending, time.Now()))
+	mock.ExpectCommit()
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(1, repositories.ActionCreateUser, 10, []byte(`{"role":"user","username":"newadmin"}`), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(1, repositories.ActionChangeRequested, 10, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/users", strings.NewReader(`{"full_name":"Новый администратор","username":"newadmin","role":"admin"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		User          models.User                `json:"user"`
+		ChangeRequest repositories.ChangeRequest `json:"change_request"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.User.Role != models.RoleUser || response.ChangeRequest.ID != 20 {
+		t.Errorf("Unexpected response: %s", w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestCreateUser_PrivilegedFieldsForbidden проверяет, что роль с users.create без users.update.orgs и
+// users.update.access не назначает организации и доступных пользователей при создании
+func TestCreateUser_PrivilegedFieldsForbidden(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		field policy.Field
+	}{
+		{name: "Organizations", body: `{"full_name":"Новый","username":"newuser","role":"user","available_organizations":[1]}`, field: policy.FieldAvailableOrganizations},
+		{name: "Accessible users", body: `{"full_name":"Новый","username":"newuser","role":"user","accessible_users":[1]}`, field: policy.FieldAccessibleUsers},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := setupUserUpdateTest(t, 2, roleHelpdesk)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/users", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("Expected status 403, got %d: %s", w.Code, w.Body.String())
+			}
+			var response struct {
+				DeniedFields []policy.Denial `json:"denied_fields"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			if len(response.DeniedFields) != 1 || response.DeniedFields[0].Field != tt.field {
+				t.Errorf("Unexpected denied fields: %s", w.Body.String())
+			}
+			// Пользователь не создан: запросов к базе нет
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// TestDeleteUser_Guards проверяет, что удалить можно только доступного пользователя с правами не шире своих
+func TestDeleteUser_Guards(t *testing.T) {
+	roleQuery := `SELECT role FROM users WHERE id = \$1 AND deleted_at IS NULL`
+	accessQuery := `SELECT EXISTS \(SELECT 1 FROM users WHERE id = \$2(.+)g.grantee_id = \$1`
+
+	tests := []struct {
+		name       string
+		role       models.UserRole
+		setupMock  func(mock sqlmock.Sqlmock)
+		wantStatus int
+	}{
+		{
+			name: "Custom role cannot delete admin",
+			role: roleHelpdesk,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(roleQuery).WithArgs(5).WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("admin"))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "Moderator cannot delete inaccessible user",
+			role: models.RoleModerator,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(accessQuery).WithArgs(2, 5).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "Unknown user",
+			role: roleHelpdesk,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(roleQuery).WithArgs(5).WillReturnRows(sqlmock.NewRows([]string{"role"}))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "Custom role deletes regular user",
+			role: roleHelpdesk,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(roleQuery).WithArgs(5).WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("user"))
+				mock.ExpectExec("UPDATE users SET deleted_at = NOW\\(\\)").WithArgs(5, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO audit_log").
+					WithArgs(2, repositories.ActionDeleteUser, 5, []byte("null"), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := setupUserUpdateTest(t, 2, tt.role)
+			tt.setupMock(mock)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("DELETE", "/users/5", nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d. Body: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Типы дополнительных полей пользователя
+const (
+	CustomFieldString = "string"
+	CustomFieldNumber = "number"
+	CustomFieldDate   = "date"
+	CustomFieldEnum   = "enum"
+	CustomFieldBool   = "bool"
+)
+
+// CustomFieldTypes допустимые типы дополнительных полей
+var CustomFieldTypes = []string{CustomFieldString, CustomFieldNumber, CustomFieldDate, CustomFieldEnum, CustomFieldBool}
+
+// CustomFieldDefinition описание дополнительного поля профиля (ключ в users.custom_fields)
+type CustomFieldDefinition struct {
+	ID       int    `json:"id" db:"id"`
+	Key      string `json:"key" db:"key"`
+	Label    string `json:"label" db:"label"`
+	Type     string `json:"type" db:"type"`
+	Required bool   `json:"required" db:"required"`
+	// Значения для типа enum
+	AllowedValues pq.StringArray `json:"allowed_values" db:"allowed_values"`
+	// Роли, которым поле видно и доступно для заполнения (пусто - всем)
+	VisibleTo pq.StringArray `json:"visible_to" db:"visible_to"`
+	SortOrder int            `json:"sort_order" db:"sort_order"`
+	CreatedBy NullInt        `json:"created_by" db:"created_by"`
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// VisibleToRole проверяет, видно ли поле пользователям роли
+func (d *CustomFieldDefinition) VisibleToRole(role UserRole) bool {
+	if len(d.VisibleTo) == 0 {
+		return true
+	}
+	for _, r := range d.VisibleTo {
+		if UserRole(r) == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Request для создания и изменения дополнительного поля (ключ задаётся при создании и не меняется)
+type CustomFieldRequest struct {
+	Key           string   `json:"key"`
+	Label         string   `json:"label" binding:"required"`
+	Type          string   `json:"type" binding:"required"`
+	Required      bool     `json:"required"`
+	AllowedValues []string `json:"allowed_values"`
+	VisibleTo     []string `json:"visible_to"`
+	SortOrder     int      `json:"sort_order"`
+}
@@ -0,0 +1,14 @@
+package models
+
+// Request для создания пользовательской роли
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// Request для изменения пользовательской роли (права заменяются целиком)
+type UpdateRoleRequest struct {
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
@@ -41,7 +41,7 @@ func (o Organizations) Value() (driver.Value, error) {
 	return json.Marshal(o)
 }
 
-// Список доступных пользователей для модератора
+// Список доступных пользователей для модератора (доступы scope = user из user_access_grants)
 type AccessibleUsers []int
 
 func (a *AccessibleUsers) Scan(value interface{}) error {
@@ -201,6 +201,32 @@ func (t Tags) Value() (driver.Value, error) {
 	return json.Marshal(t)
 }
 
+// Разрешения API ключа
+type Scopes []string
+
+func (s *Scopes) Scan(value interface{}) error {
+	if value == nil {
+		*s = Scopes{}
+		return nil
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	default:
+		return errors.New("cannot scan Scopes")
+	}
+}
+
+func (s Scopes) Value() (driver.Value, error) {
+	if len(s) == 0 {
+		return "[]", nil
+	}
+	return json.Marshal(s)
+}
+
 // Nullable строка
 type NullString struct {
 	String string
@@ -258,7 +284,7 @@ func (ni NullInt) Value() (driver.Value, error) {
 	if !ni.Valid {
 		return nil, nil
 	}
-	return ni.Int, nil
+	return int64(ni.Int), nil
 }
 
 // Nullable Time
@@ -346,6 +372,9 @@ type User struct {
 	LastSeen     NullTime `json:"last_seen" db:"last_seen"`
 	TokenVersion int      `json:"-" db:"token_version"`
 
+	// Сервисная учётная запись (интеграции): вход только по API ключам
+	IsServiceAccount bool `json:"is_service_account" db:"is_service_account"`
+
 	// История изменений
 	CreatedBy NullInt   `json:"created_by" db:"created_by"`
 	UpdatedBy NullInt   `json:"updated_by" db:"updated_by"`
@@ -353,6 +382,12 @@ type User struct {
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// FieldChange значение поля пользователя до и после изменения
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
 // Request для создания пользователя
 type CreateUserRequest struct {
 	FullName               string          `json:"full_name" binding:"required"`
@@ -380,6 +415,7 @@ type CreateUserRequest struct {
 	CustomFields           CustomFields    `json:"custom_fields"`
 	Tags                   []string        `json:"tags"`
 	Role                   UserRole        `json:"role" binding:"required"`
+	IsServiceAccount       bool            `json:"is_service_account"`
 }
 
 // Request для обновления пользователя
@@ -431,6 +467,37 @@ type ChangePasswordRequest struct {
 	ConfirmPassword string `json:"confirm_password" binding:"required"`
 }
 
+// Request для создания API ключа
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days"` // по умолчанию 90, максимум 365
+}
+
+// Request для выдачи доступа к пользователям
+// Заполняется одно поле в зависимости от scope: user_id, department или organization_id
+type CreateAccessGrantRequest struct {
+	Scope          string     `json:"scope" binding:"required,oneof=user department organization"`
+	UserID         int        `json:"user_id"`
+	Department     string     `json:"department"`
+	OrganizationID int        `json:"organization_id"`
+	ValidFrom      *time.Time `json:"valid_from"`  // nil - сразу
+	ValidUntil     *time.Time `json:"valid_until"` // nil - бессрочно
+}
+
+// Request для временного доступа к организации
+type CreateOrganizationGrantRequest struct {
+	OrganizationID int        `json:"organization_id" binding:"required"`
+	ValidFrom      *time.Time `json:"valid_from"` // nil - сразу
+	ValidUntil     time.Time  `json:"valid_until" binding:"required"`
+	Reason         string     `json:"reason"`
+}
+
+// Request для подтверждения или отклонения отложенного изменения
+type ReviewChangeRequest struct {
+	Comment string `json:"comment"`
+}
+
 func (ns NullString) MarshalJSON() ([]byte, error) {
 	if !ns.Valid || ns.String == "" {
 		return []byte("null"), nil
@@ -0,0 +1,105 @@
+package policy
+
+import (
+	"fmt"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+)
+
+// ApprovalRule вид изменения, которое вступает в силу только после подтверждения вторым администратором
+type ApprovalRule string
+
+const (
+	ApprovalRoleAdmin     ApprovalRule = "role_admin"    // повышение роли: новая роль даёт права, которых нет у текущей
+	ApprovalUnblock       ApprovalRule = "unblock"       // разблокировка пользователя
+	ApprovalOrganizations ApprovalRule = "organizations" // добавление организаций
+)
+
+// ApprovalRules включённые правила (пустой набор - все изменения применяются сразу)
+type ApprovalRules map[ApprovalRule]bool
+
+// NewApprovalRules разбирает список правил из настроек (APPROVAL_REQUIRED_FOR)
+func NewApprovalRules(names []string) (ApprovalRules, error) {
+	rules := ApprovalRules{}
+	for _, name := range names {
+		rule := ApprovalRule(name)
+		switch rule {
+		case ApprovalRoleAdmin, ApprovalUnblock, ApprovalOrganizations:
+			rules[rule] = true
+		default:
+			return nil, fmt.Errorf("unknown approval rule: %s", name)
+		}
+	}
+	return rules, nil
+}
+
+// Approval результат разбора запроса: Immediate применяется сразу, Pending ждёт подтверждения
+type Approval struct {
+	Immediate models.UpdateUserRequest
+	Pending   models.UpdateUserRequest
+	Rules     []ApprovalRule
+	Diff      map[Field]models.FieldChange
+}
+
+// Required проверяет, есть ли в запросе изменения, ждущие подтверждения
+func (a Approval) Required() bool {
+	return len(a.Rules) > 0
+}
+
+// SplitForApproval отделяет от запроса изменения, для которых включено правило подтверждения.
+// current - пользователь до изменения; понижение роли, блокировка и удаление организаций применяются сразу.
+// Повышение роли определяется по правам ролей, а не по имени: собственная роль с правами admin тоже требует подтверждения
+func SplitForApproval(current *models.User, req models.UpdateUserRequest, rules ApprovalRules, permissions *auth.PermissionStore) Approval {
+	approval := Approval{Immediate: req, Diff: map[Field]models.FieldChange{}}
+
+	if rules[ApprovalRoleAdmin] && req.Role != "" && req.Role != current.Role &&
+		!permissions.Permissions(current.Role).Contains(permissions.Permissions(req.Role)) {
+		approval.Pending.Role = req.Role
+		approval.Immediate.Role = ""
+		approval.Rules = append(approval.Rules, ApprovalRoleAdmin)
+		approval.Diff[FieldRole] = models.FieldChange{Old: current.Role, New: req.Role}
+	}
+
+	if rules[ApprovalUnblock] && req.IsActive != nil && *req.IsActive && !current.IsActive {
+		approval.Pending.IsActive = req.IsActive
+		approval.Immediate.IsActive = nil
+		// Причина блокировки относится к тому же изменению
+		approval.Pending.BlockedReason = req.BlockedReason
+		approval.Immediate.BlockedReason = ""
+		approval.Rules = append(approval.Rules, ApprovalUnblock)
+		approval.Diff[FieldIsActive] = models.FieldChange{Old: current.IsActive, New: true}
+	}
+
+	if rules[ApprovalOrganizations] && hasNewOrganizations(current.AvailableOrganizations, req.AvailableOrganizations) {
+		approval.Pending.AvailableOrganizations = req.AvailableOrganizations
+		approval.Immediate.AvailableOrganizations = nil
+		approval.Rules = append(approval.Rules, ApprovalOrganizations)
+		approval.Diff[FieldAvailableOrganizations] = models.FieldChange{Old: current.AvailableOrganizations, New: req.AvailableOrganizations}
+	}
+
+	return approval
+}
+
+// HasChanges проверяет, что запрос меняет хотя бы одно поле
+func HasChanges(req models.UpdateUserRequest) bool {
+	for _, requested := range RequestedFields(req) {
+		if requested {
+			return true
+		}
+	}
+	return false
+}
+
+func hasNewOrganizations(current, requested models.Organizations) bool {
+	existing := make(map[int]bool, len(current))
+	for _, id := range current {
+		existing[id] = true
+	}
+	for _, id := range requested {
+		if !existing[id] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+)
+
+// Собственная роль с теми же правами, что у admin
+const roleSuperuser models.UserRole = "superuser"
+
+// staticRoles права ролей без базы данных
+type staticRoles map[models.UserRole]auth.PermissionSet
+
+func (r staticRoles) LoadRolePermissions() (map[models.UserRole][]string, error) {
+	roles := make(map[models.UserRole][]string, len(r))
+	for role, permissions := range r {
+		roles[role] = permissions.List()
+	}
+	return roles, nil
+}
+
+func testPermissionStore() *auth.PermissionStore {
+	return auth.NewPermissionStore(staticRoles{
+		models.RoleAdmin:     adminPerms,
+		models.RoleModerator: moderatorPerms,
+		models.RoleUser:      userPerms,
+		roleSuperuser:        adminPerms,
+	})
+}
+
+func TestNewApprovalRules(t *testing.T) {
+	rules, err := NewApprovalRules([]string{"role_admin", "organizations"})
+	if err != nil {
+		t.Fatalf("NewApprovalRules() error = %v", err)
+	}
+	if !rules[ApprovalRoleAdmin] || !rules[ApprovalOrganizations] || rules[ApprovalUnblock] {
+		t.Errorf("NewApprovalRules() = %v", rules)
+	}
+
+	if _, err := NewApprovalRules([]string{"delete"}); err == nil {
+		t.Error("NewApprovalRules() accepted unknown rule")
+	}
+}
+
+func TestSplitForApproval(t *testing.T) {
+	all := ApprovalRules{ApprovalRoleAdmin: true, ApprovalUnblock: true, ApprovalOrganizations: true}
+	blockedModerator := &models.User{ID: 2, Role: models.RoleModerator, IsActive: false, AvailableOrganizations: models.Organizations{1, 2}}
+
+	tests := []struct {
+		name          string
+		current       *models.User
+		req           models.UpdateUserRequest
+		rules         ApprovalRules
+		wantRules     []ApprovalRule
+		wantImmediate bool
+	}{
+		{
+			name:          "Profile fields are applied immediately",
+			current:       blockedModerator,
+			req:           models.UpdateUserRequest{FullName: "Иванов", Role: models.RoleUser},
+			rules:         all,
+			wantImmediate: true,
+		},
+		{
+			name:      "Escalation to admin, unblock and new organization",
+			current:   blockedModerator,
+			req:       models.UpdateUserRequest{Role: models.RoleAdmin, IsActive: boolPtr(true), AvailableOrganizations: models.Organizations{1, 3}},
+			rules:     all,
+			wantRules: []ApprovalRule{ApprovalRoleAdmin, ApprovalUnblock, ApprovalOrganizations},
+		},
+		{
+			name:          "Removing organizations and blocking do not need approval",
+			current:       &models.User{ID: 2, Role: models.RoleUser, IsActive: true, AvailableOrganizations: models.Organizations{1, 2}},
+			req:           models.UpdateUserRequest{IsActive: boolPtr(false), AvailableOrganizations: models.Organizations{1}},
+			rules:         all,
+			wantImmediate: true,
+		},
+		{
+			name:          "Disabled rule",
+			current:       blockedModerator,
+			req:           models.UpdateUserRequest{Role: models.RoleAdmin, IsActive: boolPtr(true)},
+			rules:         ApprovalRules{ApprovalUnblock: true},
+			wantRules:     []ApprovalRule{ApprovalUnblock},
+			wantImmediate: true,
+		},
+		{
+			name:      "Escalation to custom role with admin permissions",
+			current:   &models.User{ID: 2, Role: models.RoleUser, IsActive: true},
+			req:       models.UpdateUserRequest{Role: roleSuperuser},
+			rules:     all,
+			wantRules: []ApprovalRule{ApprovalRoleAdmin},
+		},
+		{
+			name:      "Escalation from user to moderator",
+			current:   &models.User{ID: 2, Role: models.RoleUser, IsActive: true},
+			req:       models.UpdateUserRequest{Role: models.RoleModerator},
+			rules:     all,
+			wantRules: []ApprovalRule{ApprovalRoleAdmin},
+		},
+		{
+			name:          "Admin to role with the same permissions",
+			current:       &models.User{ID: 2, Role: models.RoleAdmin, IsActive: true},
+			req:           models.UpdateUserRequest{Role: roleSuperuser},
+			rules:         all,
+			wantImmediate: true,
+		},
+	}
+
+	store := testPermissionStore()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			approval := SplitForApproval(tt.current, tt.req, tt.rules, store)
+
+			if !reflect.DeepEqual(approval.Rules, tt.wantRules) {
+				t.Errorf("Rules = %v, want %v", approval.Rules, tt.wantRules)
+			}
+			if got := HasChanges(approval.Immediate); got != tt.wantImmediate {
+				t.Errorf("HasChanges(Immediate) = %v, want %v", got, tt.wantImmediate)
+			}
+			for _, rule := range approval.Rules {
+				switch rule {
+				case ApprovalRoleAdmin:
+					if approval.Pending.Role != tt.req.Role || approval.Immediate.Role != "" {
+						t.Errorf("role was not moved to pending")
+					}
+				case ApprovalUnblock:
+					if approval.Pending.IsActive == nil || approval.Immediate.IsActive != nil {
+						t.Errorf("is_active was not moved to pending")
+					}
+				case ApprovalOrganizations:
+					if len(approval.Pending.AvailableOrganizations) == 0 || approval.Immediate.AvailableOrganizations != nil {
+						t.Errorf("available_organizations were not moved to pending")
+					}
+				}
+			}
+			if len(approval.Diff) != len(approval.Rules) {
+				t.Errorf("Diff = %v, want one entry per rule", approval.Diff)
+			}
+		})
+	}
+}
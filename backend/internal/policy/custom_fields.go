@@ -0,0 +1,292 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+)
+
+// Сколько описаний дополнительных полей хранятся в памяти до перечитывания из БД
+const customFieldCacheTTL = 30 * time.Second
+
+// Максимальная длина строкового значения дополнительного поля (в символах)
+const maxCustomFieldLength = 1000
+
+// CustomFieldLoader источник описаний дополнительных полей (реализуется CustomFieldRepository)
+type CustomFieldLoader interface {
+	ListCustomFields() ([]models.CustomFieldDefinition, error)
+}
+
+// CustomFieldSchema кеш описаний дополнительных полей; перечитывается из БД по истечении
+// customFieldCacheTTL или сразу после Invalidate (изменение описаний на этом экземпляре)
+type CustomFieldSchema struct {
+	loader CustomFieldLoader
+
+	mu          sync.RWMutex
+	definitions []models.CustomFieldDefinition
+	loadedAt    time.Time
+}
+
+// NewCustomFieldSchema создает кеш описаний
+func NewCustomFieldSchema(loader CustomFieldLoader) *CustomFieldSchema {
+	return &CustomFieldSchema{loader: loader}
+}
+
+// Definitions возвращает описания в порядке отображения
+func (s *CustomFieldSchema) Definitions() ([]models.CustomFieldDefinition, error) {
+	s.mu.RLock()
+	definitions, loadedAt := s.definitions, s.loadedAt
+	s.mu.RUnlock()
+
+	if definitions != nil && time.Since(loadedAt) < customFieldCacheTTL {
+		return definitions, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.definitions != nil && time.Since(s.loadedAt) < customFieldCacheTTL {
+		return s.definitions, nil
+	}
+
+	loaded, err := s.loader.ListCustomFields()
+	if err != nil {
+		if s.definitions != nil {
+			// При ошибке БД продолжаем работать с прежними описаниями
+			log.Printf("Failed to reload custom field definitions: %v", err)
+			return s.definitions, nil
+		}
+		return nil, err
+	}
+	s.definitions = loaded
+	s.loadedAt = time.Now()
+	return loaded, nil
+}
+
+// Invalidate сбрасывает кеш после изменения описаний
+func (s *CustomFieldSchema) Invalidate() {
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.mu.Unlock()
+}
+
+// CustomFieldViewer пользователь, который читает или заполняет дополнительные поля
+type CustomFieldViewer struct {
+	Role        models.UserRole
+	Permissions auth.PermissionSet
+}
+
+// CanSee проверяет, видно ли поле: по ролям из описания, с правом custom_fields.manage - все поля
+func (v CustomFieldViewer) CanSee(definition *models.CustomFieldDefinition) bool {
+	return v.Permissions.Has(auth.PermCustomFieldsManage) || definition.VisibleToRole(v.Role)
+}
+
+// CustomFieldError ошибка значения дополнительного поля
+type CustomFieldError struct {
+	Key     string `json:"key"`
+	Message string `json:"message"`
+}
+
+// VisibleCustomFields возвращает описания, которые видны пользователю
+func VisibleCustomFields(definitions []models.CustomFieldDefinition, viewer CustomFieldViewer) []models.CustomFieldDefinition {
+	visible := []models.CustomFieldDefinition{}
+	for i := range definitions {
+		if viewer.CanSee(&definitions[i]) {
+			visible = append(visible, definitions[i])
+		}
+	}
+	return visible
+}
+
+// FilterCustomFields убирает значения полей, скрытых от пользователя
+// (значения без описания, оставшиеся с до появления схемы, видны всем)
+func FilterCustomFields(definitions []models.CustomFieldDefinition, viewer CustomFieldViewer, values models.CustomFields) models.CustomFields {
+	filtered := models.CustomFields{}
+	byKey := customFieldsByKey(definitions)
+	for key, value := range values {
+		if definition, ok := byKey[key]; ok && !viewer.CanSee(definition) {
+			continue
+		}
+		filtered[key] = value
+	}
+	return filtered
+}
+
+// ValidateCustomFields проверяет значения из запроса по описаниям и возвращает итоговые custom_fields.
+// submitted заменяет видимые пользователю поля целиком (отсутствующий ключ или null - поле очищается),
+// значения скрытых полей берутся из current без изменений. Ключ без описания допустим,
+// только если значение совпадает с уже сохранённым (данные, внесённые до появления схемы).
+// current - nil при создании пользователя
+func ValidateCustomFields(definitions []models.CustomFieldDefinition, viewer CustomFieldViewer, submitted, current models.CustomFields) (models.CustomFields, []CustomFieldError) {
+	byKey := customFieldsByKey(definitions)
+	result := models.CustomFields{}
+	errs := []CustomFieldError{}
+
+	for key, value := range current {
+		if definition, ok := byKey[key]; ok && !viewer.CanSee(definition) {
+			result[key] = value
+		}
+	}
+
+	keys := make([]string, 0, len(submitted))
+	for key := range submitted {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := submitted[key]
+		definition, ok := byKey[key]
+		if !ok {
+			if stored, exists := current[key]; exists && reflect.DeepEqual(stored, value) {
+				result[key] = value
+				continue
+			}
+			errs = append(errs, CustomFieldError{Key: key, Message: "Неизвестное дополнительное поле"})
+			continue
+		}
+		if !viewer.CanSee(definition) {
+			errs = append(errs, CustomFieldError{Key: key, Message: "Поле недоступно для вашей роли"})
+			continue
+		}
+		if value == nil || value == "" {
+			continue
+		}
+
+		normalized, err := normalizeCustomFieldValue(definition, value)
+		if err != nil {
+			errs = append(errs, CustomFieldError{Key: key, Message: err.Error()})
+			continue
+		}
+		result[key] = normalized
+	}
+
+	for i := range definitions {
+		definition := &definitions[i]
+		if _, ok := result[definition.Key]; !ok && definition.Required && viewer.CanSee(definition) {
+			errs = append(errs, CustomFieldError{Key: definition.Key, Message: fmt.Sprintf("Поле «%s» обязательно", definition.Label)})
+		}
+	}
+	return result, errs
+}
+
+// ParseCustomFieldFilter переводит фильтр из query string (ключ - строковое значение) в значения
+// нужного типа для поиска по custom_fields; фильтровать можно только по видимым полям
+func ParseCustomFieldFilter(definitions []models.CustomFieldDefinition, viewer CustomFieldViewer, raw map[string]string) (models.CustomFields, []CustomFieldError) {
+	byKey := customFieldsByKey(definitions)
+	filter := models.CustomFields{}
+	errs := []CustomFieldError{}
+
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		definition, ok := byKey[key]
+		if !ok || !viewer.CanSee(definition) {
+			errs = append(errs, CustomFieldError{Key: key, Message: "Неизвестное дополнительное поле"})
+			continue
+		}
+
+		var value interface{} = raw[key]
+		switch definition.Type {
+		case models.CustomFieldNumber:
+			number, err := strconv.ParseFloat(raw[key], 64)
+			if err != nil {
+				errs = append(errs, CustomFieldError{Key: key, Message: "Ожидается число"})
+				continue
+			}
+			value = number
+		case models.CustomFieldBool:
+			flag, err := strconv.ParseBool(raw[key])
+			if err != nil {
+				errs = append(errs, CustomFieldError{Key: key, Message: "Ожидается true или false"})
+				continue
+			}
+			value = flag
+		}
+
+		normalized, err := normalizeCustomFieldValue(definition, value)
+		if err != nil {
+			errs = append(errs, CustomFieldError{Key: key, Message: err.Error()})
+			continue
+		}
+		filter[key] = normalized
+	}
+	return filter, errs
+}
+
+// normalizeCustomFieldValue проверяет тип значения и приводит его к виду, в котором оно хранится
+func normalizeCustomFieldValue(definition *models.CustomFieldDefinition, value interface{}) (interface{}, error) {
+	switch definition.Type {
+	case models.CustomFieldString:
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("Ожидается строка")
+		}
+		s = strings.TrimSpace(s)
+		if utf8.RuneCountInString(s) > maxCustomFieldLength {
+			return nil, fmt.Errorf("Значение длиннее %d символов", maxCustomFieldLength)
+		}
+		return s, nil
+
+	case models.CustomFieldNumber:
+		switch n := value.(type) {
+		case float64:
+			return n, nil
+		case int:
+			return float64(n), nil
+		case json.Number:
+			return n.Float64()
+		}
+		return nil, errors.New("Ожидается число")
+
+	case models.CustomFieldDate:
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("Ожидается дата в формате YYYY-MM-DD")
+		}
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return nil, errors.New("Ожидается дата в формате YYYY-MM-DD")
+		}
+		return s, nil
+
+	case models.CustomFieldEnum:
+		s, ok := value.(string)
+		if ok {
+			for _, allowed := range definition.AllowedValues {
+				if s == allowed {
+					return s, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("Допустимые значения: %s", strings.Join(definition.AllowedValues, ", "))
+
+	case models.CustomFieldBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		return nil, errors.New("Ожидается true или false")
+	}
+	return nil, fmt.Errorf("Неизвестный тип поля: %s", definition.Type)
+}
+
+func customFieldsByKey(definitions []models.CustomFieldDefinition) map[string]*models.CustomFieldDefinition {
+	byKey := make(map[string]*models.CustomFieldDefinition, len(definitions))
+	for i := range definitions {
+		byKey[definitions[i].Key] = &definitions[i]
+	}
+	return byKey
+}
@@ -0,0 +1,148 @@
+package policy
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/lib/pq"
+)
+
+var testCustomFields = []models.CustomFieldDefinition{
+	{Key: "tab_number", Label: "Табельный номер", Type: models.CustomFieldString, Required: true},
+	{Key: "grade", Label: "Разряд", Type: models.CustomFieldNumber},
+	{Key: "hired_on", Label: "Дата приёма", Type: models.CustomFieldDate},
+	{Key: "shift", Label: "Смена", Type: models.CustomFieldEnum, AllowedValues: pq.StringArray{"day", "night"}},
+	{Key: "remote", Label: "Удалённо", Type: models.CustomFieldBool},
+	{Key: "salary", Label: "Оклад", Type: models.CustomFieldNumber, VisibleTo: pq.StringArray{"admin"}},
+}
+
+func TestValidateCustomFields(t *testing.T) {
+	moderator := CustomFieldViewer{Role: models.RoleModerator}
+
+	tests := []struct {
+		name      string
+		submitted models.CustomFields
+		current   models.CustomFields
+		want      models.CustomFields
+		wantKeys  []string
+	}{
+		{
+			name:      "Values are normalized by type",
+			submitted: models.CustomFields{"tab_number": " 042 ", "grade": 5, "hired_on": "2024-03-01", "shift": "night", "remote": true},
+			want:      models.CustomFields{"tab_number": "042", "grade": float64(5), "hired_on": "2024-03-01", "shift": "night", "remote": true},
+		},
+		{
+			name:      "Wrong types, enum value and missing required field",
+			submitted: models.CustomFields{"grade": "пять", "hired_on": "01.03.2024", "shift": "evening", "remote": "yes"},
+			want:      models.CustomFields{},
+			wantKeys:  []string{"grade", "hired_on", "remote", "shift", "tab_number"},
+		},
+		{
+			name:      "Hidden field is kept and cannot be changed",
+			submitted: models.CustomFields{"tab_number": "042", "salary": 1},
+			current:   models.CustomFields{"tab_number": "041", "salary": float64(500000)},
+			want:      models.CustomFields{"tab_number": "042", "salary": float64(500000)},
+			wantKeys:  []string{"salary"},
+		},
+		{
+			name:      "Omitted and empty fields are cleared",
+			submitted: models.CustomFields{"tab_number": "042", "grade": nil, "shift": ""},
+			current:   models.CustomFields{"tab_number": "042", "grade": float64(3), "shift": "day", "remote": true},
+			want:      models.CustomFields{"tab_number": "042"},
+		},
+		{
+			name:      "Legacy key without definition only if unchanged",
+			submitted: models.CustomFields{"tab_number": "042", "legacy": "a", "unknown": "b"},
+			current:   models.CustomFields{"legacy": "a"},
+			want:      models.CustomFields{"tab_number": "042", "legacy": "a"},
+			wantKeys:  []string{"unknown"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errs := ValidateCustomFields(testCustomFields, moderator, tt.submitted, tt.current)
+			keys := []string{}
+			for _, e := range errs {
+				keys = append(keys, e.Key)
+			}
+			if tt.wantKeys == nil {
+				tt.wantKeys = []string{}
+			}
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("errors = %v, want keys %v", errs, tt.wantKeys)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("values = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomFieldVisibility(t *testing.T) {
+	values := models.CustomFields{"tab_number": "042", "salary": float64(500000), "legacy": "a"}
+
+	user := CustomFieldViewer{Role: models.RoleUser}
+	if got := FilterCustomFields(testCustomFields, user, values); !reflect.DeepEqual(got, models.CustomFields{"tab_number": "042", "legacy": "a"}) {
+		t.Errorf("FilterCustomFields(user) = %v", got)
+	}
+	if got := len(VisibleCustomFields(testCustomFields, user)); got != len(testCustomFields)-1 {
+		t.Errorf("VisibleCustomFields(user) = %d fields", got)
+	}
+
+	manager := CustomFieldViewer{Role: models.RoleUser, Permissions: auth.NewPermissionSet(auth.PermCustomFieldsManage)}
+	if got := FilterCustomFields(testCustomFields, manager, values); !reflect.DeepEqual(got, values) {
+		t.Errorf("FilterCustomFields(manager) = %v", got)
+	}
+}
+
+func TestParseCustomFieldFilter(t *testing.T) {
+	viewer := CustomFieldViewer{Role: models.RoleUser}
+
+	got, errs := ParseCustomFieldFilter(testCustomFields, viewer, map[string]string{"grade": "5", "remote": "true", "shift": "day"})
+	if len(errs) > 0 {
+		t.Fatalf("ParseCustomFieldFilter() errors = %v", errs)
+	}
+	if want := (models.CustomFields{"grade": float64(5), "remote": true, "shift": "day"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseCustomFieldFilter() = %v, want %v", got, want)
+	}
+
+	// Скрытое поле недоступно для фильтра так же, как неизвестное
+	_, errs = ParseCustomFieldFilter(testCustomFields, viewer, map[string]string{"salary": "1", "grade": "x"})
+	if len(errs) != 2 || errs[0].Key != "grade" || errs[1].Key != "salary" {
+		t.Errorf("ParseCustomFieldFilter() errors = %v", errs)
+	}
+}
+
+type stubCustomFieldLoader struct {
+	calls       int
+	definitions []models.CustomFieldDefinition
+	err         error
+}
+
+func (l *stubCustomFieldLoader) ListCustomFields() ([]models.CustomFieldDefinition, error) {
+	l.calls++
+	return l.definitions, l.err
+}
+
+func TestCustomFieldSchema(t *testing.T) {
+	loader := &stubCustomFieldLoader{definitions: testCustomFields[:1]}
+	schema := NewCustomFieldSchema(loader)
+
+	schema.Definitions()
+	schema.Definitions()
+	if loader.calls != 1 {
+		t.Errorf("loader calls = %d, want 1 (cached)", loader.calls)
+	}
+
+	// После Invalidate ошибка БД не ломает работу: остаются прежние описания
+	schema.Invalidate()
+	loader.err = errors.New("db down")
+	definitions, err := schema.Definitions()
+	if err != nil || len(definitions) != 1 || loader.calls != 2 {
+		t.Errorf("Definitions() = %v, %v (calls %d)", definitions, err, loader.calls)
+	}
+}
@@ -0,0 +1,260 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+)
+
+// Field поле UpdateUserRequest (совпадает с именем в JSON)
+type Field string
+
+const (
+	FieldFullName               Field = "full_name"
+	FieldUsername               Field = "username"
+	FieldPassword               Field = "password"
+	FieldAvatarURL              Field = "avatar_url"
+	FieldResetPassword          Field = "reset_password"
+	FieldRequirePasswordChange  Field = "require_password_change"
+	FieldDisablePasswordChange  Field = "disable_password_change"
+	FieldShowInSelection        Field = "show_in_selection"
+	FieldAvailableOrganizations Field = "available_organizations"
+	FieldAccessibleUsers        Field = "accessible_users"
+	FieldEmails                 Field = "emails"
+	FieldPhones                 Field = "phones"
+	FieldPosition               Field = "position"
+	FieldDepartment             Field = "department"
+	FieldBirthDate              Field = "birth_date"
+	FieldAddress                Field = "address"
+	FieldCity                   Field = "city"
+	FieldCountry                Field = "country"
+	FieldPostalCode             Field = "postal_code"
+	FieldSocialLinks            Field = "social_links"
+	FieldTimezone               Field = "timezone"
+	FieldWorkHours              Field = "work_hours"
+	FieldComment                Field = "comment"
+	FieldCustomFields           Field = "custom_fields"
+	FieldTags                   Field = "tags"
+	FieldIsActive               Field = "is_active"
+	FieldBlockedReason          Field = "blocked_reason"
+	FieldRole                   Field = "role"
+)
+
+// Причины отказа
+const (
+	ReasonMissingPermission = "missing_permission"
+	ReasonSelfForbidden     = "self_forbidden"
+	ReasonNoAccess          = "no_access"
+	ReasonOutranked         = "outranked"
+)
+
+// fieldRule права, нужные для изменения поля
+// Self == nil - поле нельзя менять в своём профиле ни с какими правами
+type fieldRule struct {
+	Field Field
+	Self  []string
+	Other []string
+}
+
+var (
+	profileSelf  = []string{auth.PermProfileUpdate}
+	profileOther = []string{auth.PermUsersUpdate}
+	credentials  = []string{auth.PermUsersUpdateCredentials}
+)
+
+// userUpdateRules правила изменения полей пользователя
+var userUpdateRules = []fieldRule{
+	// Профиль
+	{FieldFullName, profileSelf, profileOther},
+	{FieldAvatarURL, profileSelf, profileOther},
+	{FieldEmails, profileSelf, profileOther},
+	{FieldPhones, profileSelf, profileOther},
+	{FieldPosition, profileSelf, profileOther},
+	{FieldDepartment, profileSelf, profileOther},
+	{FieldBirthDate, profileSelf, profileOther},
+	{FieldAddress, profileSelf, profileOther},
+	{FieldCity, profileSelf, profileOther},
+	{FieldCountry, profileSelf, profileOther},
+	{FieldPostalCode, profileSelf, profileOther},
+	{FieldSocialLinks, profileSelf, profileOther},
+	{FieldTimezone, profileSelf, profileOther},
+	{FieldWorkHours, profileSelf, profileOther},
+	{FieldComment, profileSelf, profileOther},
+	{FieldCustomFields, profileSelf, profileOther},
+	{FieldTags, profileSelf, profileOther},
+
+	// Учётные данные и настройки входа
+	{FieldUsername, credentials, credentials},
+	{FieldPassword, credentials, credentials},
+	{FieldResetPassword, credentials, credentials},
+	{FieldRequirePasswordChange, credentials, credentials},
+	{FieldDisablePasswordChange, credentials, credentials},
+	{FieldShowInSelection, []string{auth.PermUsersUpdate}, []string{auth.PermUsersUpdate}},
+
+	// Доступ: свои организации меняет только тот, кто может менять профиль любого пользователя
+	{FieldAvailableOrganizations, []string{auth.PermUsersUpdate, auth.PermUsersUpdateOrgs}, []string{auth.PermUsersUpdateOrgs}},
+	{FieldAccessibleUsers, []string{auth.PermUsersUpdateAccess}, []string{auth.PermUsersUpdateAccess}},
+
+	// Свою роль и блокировку не меняет никто - иначе можно остаться без администраторов
+	{FieldRole, nil, []string{auth.PermUsersUpdateRole}},
+	{FieldIsActive, nil, []string{auth.PermUsersUpdate}},
+	{FieldBlockedReason, nil, []string{auth.PermUsersUpdate}},
+}
+
+// Actor пользователь, выполняющий изменение
+type Actor struct {
+	ID          int
+	Permissions auth.PermissionSet
+}
+
+// Target изменяемый пользователь
+type Target struct {
+	ID int
+	// Accessible - actor видит пользователя (users.read.all или список доступных пользователей)
+	Accessible bool
+	// Permissions - права роли пользователя: менять можно только того, чьи права actor имеет сам
+	Permissions auth.PermissionSet
+}
+
+// Denial отказ в изменении поля
+type Denial struct {
+	Field    Field    `json:"field"`
+	Reason   string   `json:"reason"`
+	Required []string `json:"required_permissions,omitempty"`
+}
+
+// Decision результат проверки запроса на изменение
+type Decision struct {
+	Allowed []Field
+	Denied  []Denial
+}
+
+// OK возвращает true, если все запрошенные поля разрешены
+func (d Decision) OK() bool {
+	return len(d.Denied) == 0
+}
+
+// Err возвращает DeniedError или nil
+func (d Decision) Err() error {
+	if d.OK() {
+		return nil
+	}
+	return &DeniedError{Denials: d.Denied}
+}
+
+// DeniedError запрос содержит поля, которые нельзя изменить
+type DeniedError struct {
+	Denials []Denial
+}
+
+func (e *DeniedError) Error() string {
+	fields := make([]string, len(e.Denials))
+	for i, denial := range e.Denials {
+		fields[i] = string(denial.Field)
+	}
+	return fmt.Sprintf("update denied for fields: %s", strings.Join(fields, ", "))
+}
+
+// EditableFields возвращает поля, которые actor может изменить у target
+func EditableFields(actor Actor, target Target) []Field {
+	fields := []Field{}
+	for _, rule := range userUpdateRules {
+		if _, ok := check(actor, target, rule); ok {
+			fields = append(fields, rule.Field)
+		}
+	}
+	return fields
+}
+
+// CanEdit проверяет, может ли actor изменить поле target
+func CanEdit(actor Actor, target Target, field Field) bool {
+	for _, rule := range userUpdateRules {
+		if rule.Field == field {
+			_, ok := check(actor, target, rule)
+			return ok
+		}
+	}
+	return false
+}
+
+// EvaluateUpdate проверяет каждое поле запроса по правилам
+func EvaluateUpdate(actor Actor, target Target, req models.UpdateUserRequest) Decision {
+	requested := RequestedFields(req)
+	decision := Decision{Allowed: []Field{}}
+
+	for _, rule := range userUpdateRules {
+		if !requested[rule.Field] {
+			continue
+		}
+		if denial, ok := check(actor, target, rule); ok {
+			decision.Allowed = append(decision.Allowed, rule.Field)
+		} else {
+			decision.Denied = append(decision.Denied, denial)
+		}
+	}
+	return decision
+}
+
+func check(actor Actor, target Target, rule fieldRule) (Denial, bool) {
+	if actor.ID == target.ID {
+		if rule.Self == nil {
+			return Denial{Field: rule.Field, Reason: ReasonSelfForbidden}, false
+		}
+		if !actor.Permissions.Has(rule.Self...) {
+			return Denial{Field: rule.Field, Reason: ReasonMissingPermission, Required: rule.Self}, false
+		}
+		return Denial{}, true
+	}
+
+	if !target.Accessible {
+		return Denial{Field: rule.Field, Reason: ReasonNoAccess}, false
+	}
+	// Как при назначении роли: пользователя с правами, которых нет у actor, менять нельзя
+	// (иначе собственная роль с users.update.credentials сбрасывает пароль администратора)
+	if !actor.Permissions.Contains(target.Permissions) {
+		return Denial{Field: rule.Field, Reason: ReasonOutranked}, false
+	}
+	if !actor.Permissions.Has(rule.Other...) {
+		return Denial{Field: rule.Field, Reason: ReasonMissingPermission, Required: rule.Other}, false
+	}
+	return Denial{}, true
+}
+
+// RequestedFields возвращает поля, которые запрос действительно меняет
+// (та же логика "поле задано", что и в UserRepository.Update)
+func RequestedFields(req models.UpdateUserRequest) map[Field]bool {
+	social := req.SocialLinks
+	return map[Field]bool{
+		FieldFullName:               req.FullName != "",
+		FieldUsername:               req.Username != "",
+		FieldPassword:               req.Password != "",
+		FieldAvatarURL:              req.AvatarURL != nil,
+		FieldResetPassword:          req.ResetPassword,
+		FieldRequirePasswordChange:  req.RequirePasswordChange != nil,
+		FieldDisablePasswordChange:  req.DisablePasswordChange != nil,
+		FieldShowInSelection:        req.ShowInSelection != nil,
+		FieldAvailableOrganizations: len(req.AvailableOrganizations) > 0,
+		FieldAccessibleUsers:        len(req.AccessibleUsers) > 0,
+		FieldEmails:                 len(req.Emails) > 0,
+		FieldPhones:                 len(req.Phones) > 0,
+		FieldPosition:               req.Position != "",
+		FieldDepartment:             req.Department != "",
+		FieldBirthDate:              req.BirthDate != "",
+		FieldAddress:                req.Address != "",
+		FieldCity:                   req.City != "",
+		FieldCountry:                req.Country != "",
+		FieldPostalCode:             req.PostalCode != "",
+		FieldSocialLinks: social.Telegram != "" || social.WhatsApp != "" || social.LinkedIn != "" ||
+			social.Facebook != "" || social.Instagram != "" || social.Twitter != "",
+		FieldTimezone:      req.Timezone != "",
+		FieldWorkHours:     req.WorkHours != "",
+		FieldComment:       req.Comment != "",
+		FieldCustomFields:  len(req.CustomFields) > 0,
+		FieldTags:          len(req.Tags) > 0,
+		FieldIsActive:      req.IsActive != nil,
+		FieldBlockedReason: req.BlockedReason != "",
+		FieldRole:          req.Role != "",
+	}
+}
@@ -0,0 +1,208 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/models"
+)
+
+// Права встроенных ролей, как после миграции 007
+var (
+	adminPerms = auth.NewPermissionSet(
+		auth.PermUsersRead, auth.PermUsersReadAll, auth.PermUsersCreate, auth.PermUsersUpdate,
+		auth.PermUsersUpdateOrgs, auth.PermUsersUpdateRole, auth.PermUsersUpdateCredentials,
+		auth.PermUsersUpdateAccess, auth.PermUsersDelete, auth.PermUsersImpersonate, auth.PermProfileUpdate,
+	)
+	moderatorPerms = auth.NewPermissionSet(auth.PermUsersRead, auth.PermUsersUpdateOrgs, auth.PermProfileUpdate)
+	userPerms      = auth.NewPermissionSet(auth.PermProfileUpdate)
+	// Собственная роль поддержки: меняет профили и роли, блокирует, сбрасывает пароли
+	helpdeskPerms = auth.NewPermissionSet(
+		auth.PermUsersRead, auth.PermUsersReadAll, auth.PermUsersUpdate, auth.PermUsersUpdateRole,
+		auth.PermUsersUpdateCredentials, auth.PermProfileUpdate,
+	)
+)
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestEvaluateUpdate(t *testing.T) {
+	tests := []struct {
+		name        string
+		perms       auth.PermissionSet
+		targetID    int
+		accessible  bool
+		targetPerms auth.PermissionSet
+		req         models.UpdateUserRequest
+		wantDenied  map[Field]string
+	}{
+		{
+			name:     "User edits own profile",
+			perms:    userPerms,
+			targetID: 1,
+			req:      models.UpdateUserRequest{FullName: "Иванов", Phones: []string{"+77001234567"}},
+		},
+		{
+			name:       "User cannot change own credentials and activity",
+			perms:      userPerms,
+			targetID:   1,
+			req:        models.UpdateUserRequest{Username: "boss", DisablePasswordChange: boolPtr(true), IsActive: boolPtr(true)},
+			wantDenied: map[Field]string{FieldUsername: ReasonMissingPermission, FieldDisablePasswordChange: ReasonMissingPermission, FieldIsActive: ReasonSelfForbidden},
+		},
+		{
+			name:       "Admin cannot change own role",
+			perms:      adminPerms,
+			targetID:   1,
+			req:        models.UpdateUserRequest{Role: models.RoleUser, FullName: "Админ"},
+			wantDenied: map[Field]string{FieldRole: ReasonSelfForbidden},
+		},
+		{
+			name:       "Admin edits another user",
+			perms:      adminPerms,
+			targetID:   2,
+			accessible: true,
+			req:        models.UpdateUserRequest{Role: models.RoleModerator, Password: "Secret123!", IsActive: boolPtr(false), AccessibleUsers: []int{3}},
+		},
+		{
+			name:       "Moderator changes organizations of accessible user",
+			perms:      moderatorPerms,
+			targetID:   2,
+			accessible: true,
+			req:        models.UpdateUserRequest{AvailableOrganizations: []int{5}},
+		},
+		{
+			name:       "Moderator cannot change profile of another user",
+			perms:      moderatorPerms,
+			targetID:   2,
+			accessible: true,
+			req:        models.UpdateUserRequest{AvailableOrganizations: []int{5}, FullName: "Петров"},
+			wantDenied: map[Field]string{FieldFullName: ReasonMissingPermission},
+		},
+		{
+			name:       "Moderator cannot change own organizations",
+			perms:      moderatorPerms,
+			targetID:   1,
+			req:        models.UpdateUserRequest{AvailableOrganizations: []int{5}},
+			wantDenied: map[Field]string{FieldAvailableOrganizations: ReasonMissingPermission},
+		},
+		{
+			name:        "Custom role cannot take over admin",
+			perms:       helpdeskPerms,
+			targetID:    2,
+			accessible:  true,
+			targetPerms: adminPerms,
+			req:         models.UpdateUserRequest{Password: "Takeover123!", Role: models.RoleUser, IsActive: boolPtr(false)},
+			wantDenied:  map[Field]string{FieldPassword: ReasonOutranked, FieldRole: ReasonOutranked, FieldIsActive: ReasonOutranked},
+		},
+		{
+			name:        "Custom role edits user with narrower permissions",
+			perms:       helpdeskPerms,
+			targetID:    2,
+			accessible:  true,
+			targetPerms: userPerms,
+			req:         models.UpdateUserRequest{Password: "Secret123!", IsActive: boolPtr(false)},
+		},
+		{
+			name:        "Admin edits another admin",
+			perms:       adminPerms,
+			targetID:    2,
+			accessible:  true,
+			targetPerms: adminPerms,
+			req:         models.UpdateUserRequest{Password: "Secret123!"},
+		},
+		{
+			name:       "Inaccessible user",
+			perms:      moderatorPerms,
+			targetID:   3,
+			accessible: false,
+			req:        models.UpdateUserRequest{AvailableOrganizations: []int{5}},
+			wantDenied: map[Field]string{FieldAvailableOrganizations: ReasonNoAccess},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := EvaluateUpdate(
+				Actor{ID: 1, Permissions: tt.perms},
+				Target{ID: tt.targetID, Accessible: tt.accessible, Permissions: tt.targetPerms},
+				tt.req,
+			)
+
+			if len(decision.Denied) != len(tt.wantDenied) {
+				t.Fatalf("denied = %+v, want %v", decision.Denied, tt.wantDenied)
+			}
+			for _, denial := range decision.Denied {
+				if reason, ok := tt.wantDenied[denial.Field]; !ok || reason != denial.Reason {
+					t.Errorf("unexpected denial %+v", denial)
+				}
+			}
+			if decision.OK() != (decision.Err() == nil) {
+				t.Error("OK() and Err() disagree")
+			}
+		})
+	}
+}
+
+func TestEvaluateUpdate_ReportsRequiredPermissions(t *testing.T) {
+	decision := EvaluateUpdate(
+		Actor{ID: 1, Permissions: moderatorPerms},
+		Target{ID: 2, Accessible: true},
+		models.UpdateUserRequest{Role: models.RoleAdmin},
+	)
+
+	err, ok := decision.Err().(*DeniedError)
+	if !ok {
+		t.Fatalf("Err() = %v, want *DeniedError", decision.Err())
+	}
+	denial := err.Denials[0]
+	if denial.Field != FieldRole || len(denial.Required) != 1 || denial.Required[0] != auth.PermUsersUpdateRole {
+		t.Errorf("denial = %+v, want role requiring %s", denial, auth.PermUsersUpdateRole)
+	}
+}
+
+func TestEditableFields(t *testing.T) {
+	contains := func(fields []Field, field Field) bool {
+		for _, f := range fields {
+			if f == field {
+				return true
+			}
+		}
+		return false
+	}
+
+	self := EditableFields(Actor{ID: 1, Permissions: userPerms}, Target{ID: 1, Accessible: true})
+	if !contains(self, FieldFullName) || contains(self, FieldRole) || contains(self, FieldUsername) {
+		t.Errorf("user self fields = %v", self)
+	}
+
+	moderator := EditableFields(Actor{ID: 1, Permissions: moderatorPerms}, Target{ID: 2, Accessible: true})
+	if len(moderator) != 1 || moderator[0] != FieldAvailableOrganizations {
+		t.Errorf("moderator fields = %v, want [%s]", moderator, FieldAvailableOrganizations)
+	}
+
+	hidden := EditableFields(Actor{ID: 1, Permissions: adminPerms}, Target{ID: 2, Accessible: false})
+	if len(hidden) != 0 {
+		t.Errorf("fields of inaccessible user = %v, want none", hidden)
+	}
+
+	outranked := EditableFields(Actor{ID: 1, Permissions: helpdeskPerms}, Target{ID: 2, Accessible: true, Permissions: adminPerms})
+	if len(outranked) != 0 {
+		t.Errorf("fields of admin for custom role = %v, want none", outranked)
+	}
+
+	if len(EditableFields(Actor{ID: 1, Permissions: adminPerms}, Target{ID: 2, Accessible: true})) != len(userUpdateRules) {
+		t.Error("admin should be able to edit every field of another user")
+	}
+}
+
+func TestRequestedFields_CoversRules(t *testing.T) {
+	requested := RequestedFields(models.UpdateUserRequest{})
+	for _, rule := range userUpdateRules {
+		set, ok := requested[rule.Field]
+		if !ok {
+			t.Errorf("RequestedFields does not know field %s", rule.Field)
+		}
+		if set {
+			t.Errorf("empty request should not set %s", rule.Field)
+		}
+	}
+}
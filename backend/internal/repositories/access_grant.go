@@ -0,0 +1,177 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Объекты доступа
+const (
+	GrantScopeUser         = "user"
+	GrantScopeDepartment   = "department"
+	GrantScopeOrganization = "organization"
+)
+
+// AccessGrant доступ пользователя (модератора) к одному пользователю, отделу или организации
+type AccessGrant struct {
+	ID             int            `json:"id" db:"id"`
+	GranteeID      int            `json:"grantee_id" db:"grantee_id"`
+	Scope          string         `json:"scope" db:"scope"`
+	UserID         sql.NullInt64  `json:"user_id" db:"user_id"`
+	Department     sql.NullString `json:"department" db:"department"`
+	OrganizationID sql.NullInt64  `json:"organization_id" db:"organization_id"`
+	GrantedBy      sql.NullInt64  `json:"granted_by" db:"granted_by"`
+	ValidFrom      time.Time      `json:"valid_from" db:"valid_from"`
+	ValidUntil     sql.NullTime   `json:"valid_until" db:"valid_until"`
+	NotifiedAt     sql.NullTime   `json:"notified_at" db:"notified_at"`
+	ExpiredAt      sql.NullTime   `json:"expired_at" db:"expired_at"`
+	CreatedAt      time.Time      `json:"created_at" db:"created_at"`
+}
+
+const accessGrantColumns = `id, grantee_id, scope, user_id, department, organization_id, granted_by,
+	valid_from, valid_until, notified_at, expired_at, created_at`
+
+// AccessGrantRepository для работы с доступами к пользователям
+type AccessGrantRepository struct {
+	db *sqlx.DB
+}
+
+// NewAccessGrantRepository создает новый репозиторий
+func NewAccessGrantRepository(db *sqlx.DB) *AccessGrantRepository {
+	return &AccessGrantRepository{db: db}
+}
+
+// ListByGrantee возвращает все доступы пользователя, включая истёкшие
+func (r *AccessGrantRepository) ListByGrantee(granteeID int) ([]AccessGrant, error) {
+	grants := []AccessGrant{}
+	query := `SELECT ` + accessGrantColumns + ` FROM user_access_grants
+		WHERE grantee_id = $1
+		ORDER BY expired_at IS NOT NULL, scope, created_at`
+	if err := r.db.Select(&grants, query, granteeID); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// Create сохраняет доступ (ошибка unique violation - такой доступ уже есть)
+// Нулевой ValidFrom - доступ действует сразу
+func (r *AccessGrantRepository) Create(grant *AccessGrant) error {
+	if grant.ValidFrom.IsZero() {
+		grant.ValidFrom = time.Now()
+	}
+
+	query := `
+		INSERT INTO user_access_grants (grantee_id, scope, user_id, department, organization_id, granted_by, valid_from, valid_until)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+	return r.db.QueryRow(query,
+		grant.GranteeID, grant.Scope, grant.UserID, grant.Department, grant.OrganizationID, grant.GrantedBy,
+		grant.ValidFrom, grant.ValidUntil,
+	).Scan(&grant.ID, &grant.CreatedAt)
+}
+
+// Delete удаляет доступ пользователя (false если не найден)
+func (r *AccessGrantRepository) Delete(granteeID, id int) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM user_access_grants WHERE id = $1 AND grantee_id = $2`, id, granteeID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// ListExpiring возвращает действующие доступы, которые закончатся до before
+func (r *AccessGrantRepository) ListExpiring(before time.Time) ([]AccessGrant, error) {
+	grants := []AccessGrant{}
+	query := `SELECT ` + accessGrantColumns + ` FROM user_access_grants
+		WHERE expired_at IS NULL AND valid_until > NOW() AND valid_until <= $1
+		ORDER BY valid_until`
+	if err := r.db.Select(&grants, query, before); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// MarkNotified отмечает доступы, заканчивающиеся до before, о которых ещё не уведомляли,
+// и возвращает их (каждый доступ возвращается один раз)
+func (r *AccessGrantRepository) MarkNotified(before time.Time) ([]AccessGrant, error) {
+	grants := []AccessGrant{}
+	query := `UPDATE user_access_grants SET notified_at = NOW()
+		WHERE notified_at IS NULL AND expired_at IS NULL AND valid_until > NOW() AND valid_until <= $1
+		RETURNING ` + accessGrantColumns
+	if err := r.db.Select(&grants, query, before); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// ExpireDue фиксирует окончание доступов с прошедшим valid_until и возвращает их
+func (r *AccessGrantRepository) ExpireDue() ([]AccessGrant, error) {
+	grants := []AccessGrant{}
+	query := `UPDATE user_access_grants SET expired_at = NOW()
+		WHERE expired_at IS NULL AND valid_until <= NOW()
+		RETURNING ` + accessGrantColumns
+	if err := r.db.Select(&grants, query); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// IsDuplicateGrant проверяет, что ошибка Create - нарушение уникальности доступа
+func IsDuplicateGrant(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// replaceUserGrants заменяет бессрочные доступы к отдельным пользователям (поле accessible_users)
+// Временные доступы, доступы к отделам и организациям не затрагиваются
+func replaceUserGrants(tx *sqlx.Tx, granteeID int, userIDs []int, grantedBy interface{}) error {
+	if _, err := tx.Exec(`
+		DELETE FROM user_access_grants
+		WHERE grantee_id = $1 AND scope = 'user' AND valid_until IS NULL AND valid_from <= NOW()
+	`, granteeID); err != nil {
+		return err
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	// Несуществующие ID пропускаются, чтобы не нарушать внешний ключ
+	_, err := tx.Exec(`
+		INSERT INTO user_access_grants (grantee_id, scope, user_id, granted_by)
+		SELECT $1, 'user', u.id, $3
+		FROM users u
+		WHERE u.id = ANY($2::int[]) AND u.id <> $1 AND u.deleted_at IS NULL
+		ON CONFLICT DO NOTHING
+	`, granteeID, pq.Array(userIDs), grantedBy)
+	return err
+}
+
+// activeGrantCondition доступ g действует сейчас (не раньше valid_from и не позже valid_until)
+const activeGrantCondition = `g.valid_from <= NOW() AND (g.valid_until IS NULL OR g.valid_until > NOW())`
+
+// accessibleToCondition SQL условие "строка users доступна пользователю $arg" по действующим доступам
+func accessibleToCondition(arg int) string {
+	return fmt.Sprintf(`EXISTS (
+		SELECT 1 FROM user_access_grants g
+		WHERE g.grantee_id = $%d
+		  AND `+activeGrantCondition+`
+		  AND (
+		      (g.scope = 'user' AND g.user_id = users.id) OR
+		      (g.scope = 'department' AND LOWER(g.department) = LOWER(users.department)) OR
+		      (g.scope = 'organization' AND users.available_organizations @> jsonb_build_array(g.organization_id))
+		  )
+	)`, arg)
+}
+
+// accessibleUsersColumn действующие доступы к отдельным пользователям в виде поля accessible_users
+const accessibleUsersColumn = `COALESCE((
+	          SELECT jsonb_agg(g.user_id ORDER BY g.user_id) FROM user_access_grants g
+	          WHERE g.grantee_id = users.id AND g.scope = 'user' AND ` + activeGrantCondition + `
+	          ), '[]'::jsonb) AS accessible_users`
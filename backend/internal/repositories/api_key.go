@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// APIKey долгоживущий ключ доступа пользователя или сервисной учётной записи
+// Сам ключ не хранится - только его SHA-256 хеш и префикс для отображения
+type APIKey struct {
+	ID         int            `json:"id" db:"id"`
+	UserID     int            `json:"user_id" db:"user_id"`
+	Name       string         `json:"name" db:"name"`
+	Prefix     string         `json:"prefix" db:"prefix"`
+	KeyHash    string         `json:"-" db:"key_hash"`
+	Scopes     models.Scopes  `json:"scopes" db:"scopes"`
+	ExpiresAt  time.Time      `json:"expires_at" db:"expires_at"`
+	LastUsedAt sql.NullTime   `json:"last_used_at" db:"last_used_at"`
+	LastUsedIP sql.NullString `json:"last_used_ip" db:"last_used_ip"`
+	RevokedAt  sql.NullTime   `json:"revoked_at" db:"revoked_at"`
+	RevokedBy  sql.NullInt64  `json:"revoked_by" db:"revoked_by"`
+	CreatedBy  sql.NullInt64  `json:"created_by" db:"created_by"`
+	CreatedAt  time.Time      `json:"created_at" db:"created_at"`
+}
+
+// IsExpired проверяет, истёк ли срок действия ключа
+func (k *APIKey) IsExpired() bool {
+	return time.Now().After(k.ExpiresAt)
+}
+
+// IsRevoked проверяет, отозван ли ключ
+func (k *APIKey) IsRevoked() bool {
+	return k.RevokedAt.Valid
+}
+
+// HasScope проверяет, разрешена ли ключу группа маршрутов
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyRepository для работы с API ключами
+type APIKeyRepository struct {
+	db *sqlx.DB
+}
+
+// NewAPIKeyRepository создает новый репозиторий
+func NewAPIKeyRepository(db *sqlx.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+// Create сохраняет новый ключ (KeyHash и Prefix должны быть уже заполнены)
+func (r *APIKeyRepository) Create(key *APIKey) error {
+	if key.Scopes == nil {
+		key.Scopes = models.Scopes{}
+	}
+
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+	return r.db.QueryRow(query,
+		key.UserID, key.Name, key.Prefix, key.KeyHash, key.Scopes, key.ExpiresAt, key.CreatedBy,
+	).Scan(&key.ID, &key.CreatedAt)
+}
+
+// GetByHash находит ключ по хешу (nil если не найден)
+func (r *APIKeyRepository) GetByHash(keyHash string) (*APIKey, error) {
+	var key APIKey
+	query := `
+		SELECT id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, last_used_ip,
+		       revoked_at, revoked_by, created_by, created_at
+		FROM api_keys
+		WHERE key_hash = $1
+	`
+	err := r.db.Get(&key, query, keyHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ListByUser возвращает все ключи пользователя, включая отозванные и истёкшие
+func (r *APIKeyRepository) ListByUser(userID int) ([]APIKey, error) {
+	keys := []APIKey{}
+	query := `
+		SELECT id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, last_used_ip,
+		       revoked_at, revoked_by, created_by, created_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+	err := r.db.Select(&keys, query, userID)
+	return keys, err
+}
+
+// Revoke отзывает ключ пользователя; возвращает false, если ключ не найден или уже отозван
+func (r *APIKeyRepository) Revoke(id, userID, revokedBy int) (bool, error) {
+	query := `
+		UPDATE api_keys SET revoked_at = NOW(), revoked_by = $1
+		WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL
+	`
+	result, err := r.db.Exec(query, revokedBy, id, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// TouchLastUsed отмечает время и IP последнего использования ключа
+func (r *APIKeyRepository) TouchLastUsed(id int, ip string) error {
+	query := "UPDATE api_keys SET last_used_at = NOW(), last_used_ip = $1 WHERE id = $2"
+	_, err := r.db.Exec(query, ip, id)
+	return err
+}
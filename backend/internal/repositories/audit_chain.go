@@ -0,0 +1,140 @@
+package repositories
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// AuditChainRow запись журнала в текстовом виде, из которого считается её хеш
+// (значения в том же виде, что и в триггере audit_log_chain); в этом же виде записи хранятся в архивах.
+// NULL - nil: в отличие от models.NullString пустая строка не превращается в null при выгрузке в JSON
+type AuditChainRow struct {
+	ID             int     `json:"id" db:"id"`
+	PrevHash       *string `json:"prev_hash" db:"prev_hash"`
+	Hash           *string `json:"hash" db:"hash"`
+	UserID         *string `json:"user_id" db:"user_id"`
+	Action         string  `json:"action" db:"action"`
+	TargetUserID   *string `json:"target_user_id" db:"target_user_id"`
+	ImpersonatorID *string `json:"impersonator_id" db:"impersonator_id"`
+	Details        *string `json:"details" db:"details"`
+	IPAddress      *string `json:"ip_address" db:"ip_address"`
+	UserAgent      *string `json:"user_agent" db:"user_agent"`
+	// Время создания в микросекундах Unix
+	CreatedAt string `json:"created_at" db:"created_at"`
+}
+
+// Колонки AuditChainRow
+const auditChainColumns = `id, prev_hash, hash, user_id::text AS user_id, action, target_user_id::text AS target_user_id,
+		impersonator_id::text AS impersonator_id, details::text AS details, ip_address::text AS ip_address,
+		user_agent, (extract(epoch FROM created_at) * 1000000)::bigint::text AS created_at`
+
+// ComputeHash считает хеш записи так же, как триггер audit_log_chain:
+// SHA-256 от полей "длина:значение" (NULL - "-") начиная с prev_hash
+func (r AuditChainRow) ComputeHash() string {
+	id := strconv.Itoa(r.ID)
+	fields := []*string{
+		r.PrevHash,
+		&id,
+		r.UserID,
+		&r.Action,
+		r.TargetUserID,
+		r.ImpersonatorID,
+		r.Details,
+		r.IPAddress,
+		r.UserAgent,
+		&r.CreatedAt,
+	}
+
+	h := sha256.New()
+	for _, field := range fields {
+		if field == nil {
+			h.Write([]byte("-"))
+			continue
+		}
+		fmt.Fprintf(h, "%d:%s", len(*field), *field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// AuditCheckpoint подписанная контрольная точка цепочки журнала
+type AuditCheckpoint struct {
+	ID          int       `json:"id" db:"id"`
+	LastEntryID int       `json:"last_entry_id" db:"last_entry_id"`
+	LastHash    string    `json:"last_hash" db:"last_hash"`
+	KeyID       string    `json:"key_id" db:"key_id"`
+	Signature   string    `json:"signature" db:"signature"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// SignedMessage данные, которые подписывает контрольная точка
+func (c AuditCheckpoint) SignedMessage() []byte {
+	return []byte(fmt.Sprintf("audit_log checkpoint\n%d\n%s\n%d", c.LastEntryID, c.LastHash, c.CreatedAt.UnixMicro()))
+}
+
+// ChainRows возвращает записи журнала с id больше afterID в порядке цепочки
+func (r *AuditLogRepository) ChainRows(afterID int, limit int) ([]AuditChainRow, error) {
+	rows := []AuditChainRow{}
+	query := `
+		SELECT ` + auditChainColumns + `
+		FROM audit_log
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2
+	`
+	err := r.db.Select(&rows, query, afterID, limit)
+	return rows, err
+}
+
+// LastChainEntry возвращает ID и хеш последней записи цепочки (sql.ErrNoRows - записей нет)
+func (r *AuditLogRepository) LastChainEntry() (int, string, error) {
+	var entry struct {
+		ID   int    `db:"id"`
+		Hash string `db:"hash"`
+	}
+	query := `SELECT id, hash FROM audit_log WHERE hash IS NOT NULL ORDER BY id DESC LIMIT 1`
+	if err := r.db.Get(&entry, query); err != nil {
+		return 0, "", err
+	}
+	return entry.ID, entry.Hash, nil
+}
+
+// CreateCheckpoint сохраняет подписанную контрольную точку
+func (r *AuditLogRepository) CreateCheckpoint(checkpoint *AuditCheckpoint) error {
+	query := `
+		INSERT INTO audit_log_checkpoints (last_entry_id, last_hash, key_id, signature, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`
+	return r.db.QueryRow(query, checkpoint.LastEntryID, checkpoint.LastHash, checkpoint.KeyID,
+		checkpoint.Signature, checkpoint.CreatedAt).Scan(&checkpoint.ID)
+}
+
+// LastCheckpoint возвращает последнюю контрольную точку (sql.ErrNoRows - точек нет)
+func (r *AuditLogRepository) LastCheckpoint() (*AuditCheckpoint, error) {
+	var checkpoint AuditCheckpoint
+	query := `
+		SELECT id, last_entry_id, last_hash, key_id, signature, created_at
+		FROM audit_log_checkpoints
+		ORDER BY id DESC
+		LIMIT 1
+	`
+	if err := r.db.Get(&checkpoint, query); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// ListCheckpoints возвращает все контрольные точки в порядке создания
+func (r *AuditLogRepository) ListCheckpoints() ([]AuditCheckpoint, error) {
+	checkpoints := []AuditCheckpoint{}
+	query := `
+		SELECT id, last_entry_id, last_hash, key_id, signature, created_at
+		FROM audit_log_checkpoints
+		ORDER BY id
+	`
+	err := r.db.Select(&checkpoints, query)
+	return checkpoints, err
+}
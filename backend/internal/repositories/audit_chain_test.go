@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+// TestAuditChainRowComputeHash проверяет, что хеш считается так же, как в триггере audit_log_chain
+// (эталон посчитан по формуле audit_hash_field из миграции 012)
+func TestAuditChainRowComputeHash(t *testing.T) {
+	row := AuditChainRow{
+		ID:        1,
+		UserID:    stringPtr("3"),
+		Action:    ActionLogin,
+		Details:   stringPtr(`{"method": "Иванов"}`),
+		IPAddress: stringPtr("10.0.0.1"),
+		UserAgent: stringPtr("Mozilla"),
+		CreatedAt: "1760000000000000",
+	}
+
+	expected := "368d7c47844dbd5e2082598c809f0167606204ceabd5795d17d0f6d4927a9554"
+	if hash := row.ComputeHash(); hash != expected {
+		t.Errorf("Expected hash %s, got %s", expected, hash)
+	}
+
+	// NULL и пустая строка дают разные хеши
+	row.UserAgent = stringPtr("")
+	if row.ComputeHash() == expected {
+		t.Error("Empty user agent must not hash like the original")
+	}
+
+	// Архив хранит записи в JSON: пустая строка не должна превратиться в NULL
+	hash := row.ComputeHash()
+	data, err := json.Marshal(row)
+	if err != nil {
+		t.Fatalf("Failed to marshal row: %v", err)
+	}
+	var restored AuditChainRow
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("Failed to unmarshal row: %v", err)
+	}
+	if restored.ComputeHash() != hash {
+		t.Error("Row restored from JSON must keep its hash")
+	}
+}
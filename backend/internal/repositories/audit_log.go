@@ -1,28 +1,92 @@
 package repositories
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/UAssylbek/central-reporting/internal/models"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 // AuditLogEntry представляет запись в журнале аудита
 type AuditLogEntry struct {
-	ID           int                    `json:"id" db:"id"`
-	UserID       sql.NullInt64          `json:"user_id" db:"user_id"`
-	Action       string                 `json:"action" db:"action"`
-	TargetUserID sql.NullInt64          `json:"target_user_id" db:"target_user_id"`
-	Details      map[string]interface{} `json:"details" db:"details"`
-	IPAddress    sql.NullString         `json:"ip_address" db:"ip_address"`
-	UserAgent    sql.NullString         `json:"user_agent" db:"user_agent"`
-	CreatedAt    time.Time              `json:"created_at" db:"created_at"`
+	ID             int               `json:"id" db:"id"`
+	UserID         models.NullInt    `json:"user_id" db:"user_id"`
+	Action         string            `json:"action" db:"action"`
+	TargetUserID   models.NullInt    `json:"target_user_id" db:"target_user_id"`
+	ImpersonatorID models.NullInt    `json:"impersonator_id" db:"impersonator_id"`
+	Details        AuditDetails      `json:"details" db:"details"`
+	IPAddress      models.NullString `json:"ip_address" db:"ip_address"`
+	UserAgent      models.NullString `json:"user_agent" db:"user_agent"`
+	CreatedAt      time.Time         `json:"created_at" db:"created_at"`
+	// Цепочка хешей (см. AuditChainRow)
+	PrevHash models.NullString `json:"prev_hash" db:"prev_hash"`
+	Hash     models.NullString `json:"hash" db:"hash"`
+}
+
+// AuditDetails содержимое поля details (JSONB)
+type AuditDetails map[string]interface{}
+
+// Scan читает details из JSONB
+func (d *AuditDetails) Scan(value interface{}) error {
+	if value == nil {
+		*d = nil
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("cannot scan AuditDetails")
+	}
+	return json.Unmarshal(data, d)
+}
+
+// AuditLogView запись журнала с именами автора, объекта действия и администратора (при impersonation)
+type AuditLogView struct {
+	AuditLogEntry
+	ActorUsername        models.NullString `json:"actor_username" db:"actor_username"`
+	ActorFullName        models.NullString `json:"actor_full_name" db:"actor_full_name"`
+	TargetUsername       models.NullString `json:"target_username" db:"target_username"`
+	TargetFullName       models.NullString `json:"target_full_name" db:"target_full_name"`
+	ImpersonatorUsername models.NullString `json:"impersonator_username" db:"impersonator_username"`
+}
+
+// AuditLogFilter фильтры журнала аудита (нулевые значения - без фильтра)
+type AuditLogFilter struct {
+	ActorID      int
+	TargetUserID int
+	// Пользователь - автор или объект действия (история пользователя)
+	ParticipantID int
+	Actions       []string
+	From          time.Time
+	To            time.Time
+	// Адрес или подсеть в нотации CIDR
+	IP string
+	// Курсор: только записи с id меньше Before
+	Before int
+	Limit  int
+}
+
+// AuditLogPage страница журнала; NextCursor передаётся в следующий запрос (nil - записей больше нет)
+type AuditLogPage struct {
+	Entries    []AuditLogView `json:"entries"`
+	NextCursor *int           `json:"next_cursor"`
 }
 
 // AuditLogRepository для работы с audit логами
 type AuditLogRepository struct {
 	db *sqlx.DB
+	// Получатели, которым доставляется каждая запись (через очередь audit_outbox)
+	sinks []AuditSink
 }
 
 // NewAuditLogRepository создает новый репозиторий
@@ -30,6 +94,39 @@ func NewAuditLogRepository(db *sqlx.DB) *AuditLogRepository {
 	return &AuditLogRepository{db: db}
 }
 
+// UseSinks включает доставку записей журнала получателям: каждая запись ставится в очередь
+// audit_outbox той же командой, что и добавляется в журнал
+func (r *AuditLogRepository) UseSinks(sinks ...AuditSink) {
+	r.sinks = sinks
+}
+
+// Sinks возвращает подключённых получателей
+func (r *AuditLogRepository) Sinks() []AuditSink {
+	return r.sinks
+}
+
+// insert добавляет запись журнала и строки очереди для получателей
+func (r *AuditLogRepository) insert(query string, args ...interface{}) error {
+	if len(r.sinks) == 0 {
+		_, err := r.db.Exec(query, args...)
+		return err
+	}
+
+	names := make([]string, len(r.sinks))
+	for i, sink := range r.sinks {
+		names[i] = sink.Name()
+	}
+
+	// ID записи назначает триггер audit_log_chain, поэтому очередь заполняется из RETURNING
+	query = fmt.Sprintf(`
+		WITH entry AS (%s RETURNING id)
+		INSERT INTO audit_outbox (audit_log_id, sink)
+		SELECT entry.id, sink FROM entry, unnest($%d::text[]) AS sink
+	`, query, len(args)+1)
+	_, err := r.db.Exec(query, append(args, pq.Array(names))...)
+	return err
+}
+
 // Log записывает действие пользователя в журнал аудита
 func (r *AuditLogRepository) Log(
 	userID int,
@@ -38,6 +135,20 @@ func (r *AuditLogRepository) Log(
 	details map[string]interface{},
 	ipAddress string,
 	userAgent string,
+) error {
+	return r.LogImpersonated(nil, userID, action, targetUserID, details, ipAddress, userAgent)
+}
+
+// LogImpersonated записывает действие, выполненное администратором impersonatorID от имени userID
+// (nil impersonatorID - обычное действие самого пользователя)
+func (r *AuditLogRepository) LogImpersonated(
+	impersonatorID *int,
+	userID int,
+	action string,
+	targetUserID *int,
+	details map[string]interface{},
+	ipAddress string,
+	userAgent string,
 ) error {
 	detailsJSON, err := json.Marshal(details)
 	if err != nil {
@@ -45,8 +156,8 @@ func (r *AuditLogRepository) Log(
 	}
 
 	query := `
-		INSERT INTO audit_log (user_id, action, target_user_id, details, ip_address, user_agent)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO audit_log (user_id, action, target_user_id, details, ip_address, user_agent, impersonator_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 	`
 
 	var targetUserIDVal interface{}
@@ -54,15 +165,35 @@ func (r *AuditLogRepository) Log(
 		targetUserIDVal = *targetUserID
 	}
 
-	_, err = r.db.Exec(query, userID, action, targetUserIDVal, detailsJSON, ipAddress, userAgent)
-	return err
+	var impersonatorIDVal interface{}
+	if impersonatorID != nil {
+		impersonatorIDVal = *impersonatorID
+	}
+
+	return r.insert(query, userID, action, targetUserIDVal, detailsJSON, ipAddress, userAgent, impersonatorIDVal)
+}
+
+// LogSystem записывает действие фоновой задачи (без пользователя, IP и User-Agent)
+func (r *AuditLogRepository) LogSystem(action string, targetUserID *int, details map[string]interface{}) error {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	var targetUserIDVal interface{}
+	if targetUserID != nil {
+		targetUserIDVal = *targetUserID
+	}
+
+	query := `INSERT INTO audit_log (user_id, action, target_user_id, details) VALUES (NULL, $1, $2, $3)`
+	return r.insert(query, action, targetUserIDVal, detailsJSON)
 }
 
 // GetByUserID возвращает историю действий пользователя
 func (r *AuditLogRepository) GetByUserID(userID int, limit int) ([]AuditLogEntry, error) {
 	var logs []AuditLogEntry
 	query := `
-		SELECT id, user_id, action, target_user_id, details, ip_address, user_agent, created_at
+		SELECT id, user_id, action, target_user_id, impersonator_id, details, ip_address, user_agent, created_at
 		FROM audit_log
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -76,7 +207,7 @@ func (r *AuditLogRepository) GetByUserID(userID int, limit int) ([]AuditLogEntry
 func (r *AuditLogRepository) GetByAction(action string, limit int) ([]AuditLogEntry, error) {
 	var logs []AuditLogEntry
 	query := `
-		SELECT id, user_id, action, target_user_id, details, ip_address, user_agent, created_at
+		SELECT id, user_id, action, target_user_id, impersonator_id, details, ip_address, user_agent, created_at
 		FROM audit_log
 		WHERE action = $1
 		ORDER BY created_at DESC
@@ -90,7 +221,7 @@ func (r *AuditLogRepository) GetByAction(action string, limit int) ([]AuditLogEn
 func (r *AuditLogRepository) GetRecent(limit int) ([]AuditLogEntry, error) {
 	var logs []AuditLogEntry
 	query := `
-		SELECT id, user_id, action, target_user_id, details, ip_address, user_agent, created_at
+		SELECT id, user_id, action, target_user_id, impersonator_id, details, ip_address, user_agent, created_at
 		FROM audit_log
 		ORDER BY created_at DESC
 		LIMIT $1
@@ -99,17 +230,91 @@ func (r *AuditLogRepository) GetRecent(limit int) ([]AuditLogEntry, error) {
 	return logs, err
 }
 
-// DeleteOldLogs удаляет логи старше указанного количества дней
-func (r *AuditLogRepository) DeleteOldLogs(olderThanDays int) (int64, error) {
-	query := `
-		DELETE FROM audit_log
-		WHERE created_at < NOW() - INTERVAL '1 day' * $1
-	`
-	result, err := r.db.Exec(query, olderThanDays)
+// Query возвращает записи по фильтру, новые первыми
+func (r *AuditLogRepository) Query(filter AuditLogFilter) ([]AuditLogView, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	argIndex := 1
+
+	addCondition := func(format string, value interface{}) {
+		conditions = append(conditions, fmt.Sprintf(format, argIndex))
+		args = append(args, value)
+		argIndex++
+	}
+
+	if filter.ActorID > 0 {
+		addCondition("a.user_id = $%d", filter.ActorID)
+	}
+	if filter.TargetUserID > 0 {
+		addCondition("a.target_user_id = $%d", filter.TargetUserID)
+	}
+	if filter.ParticipantID > 0 {
+		conditions = append(conditions, fmt.Sprintf("(a.user_id = $%d OR a.target_user_id = $%d)", argIndex, argIndex))
+		args = append(args, filter.ParticipantID)
+		argIndex++
+	}
+	if len(filter.Actions) > 0 {
+		addCondition("a.action = ANY($%d)", pq.Array(filter.Actions))
+	}
+	if !filter.From.IsZero() {
+		addCondition("a.created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("a.created_at < $%d", filter.To)
+	}
+	if filter.IP != "" {
+		addCondition("a.ip_address <<= $%d::inet", filter.IP)
+	}
+	if filter.Before > 0 {
+		addCondition("a.id < $%d", filter.Before)
+	}
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query := fmt.Sprintf(`
+		SELECT a.id, a.user_id, a.action, a.target_user_id, a.impersonator_id, a.details, a.ip_address, a.user_agent, a.created_at,
+			a.prev_hash, a.hash,
+			actor.username AS actor_username, actor.full_name AS actor_full_name,
+			target.username AS target_username, target.full_name AS target_full_name,
+			impersonator.username AS impersonator_username
+		FROM audit_log a
+		LEFT JOIN users actor ON actor.id = a.user_id
+		LEFT JOIN users target ON target.id = a.target_user_id
+		LEFT JOIN users impersonator ON impersonator.id = a.impersonator_id
+		%s
+		ORDER BY a.id DESC
+		LIMIT $%d
+	`, whereClause, argIndex)
+	args = append(args, filter.Limit)
+
+	entries := []AuditLogView{}
+	if err := r.db.Select(&entries, query, args...); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// QueryPage возвращает страницу журнала по курсору (filter.Limit - размер страницы)
+func (r *AuditLogRepository) QueryPage(filter AuditLogFilter) (*AuditLogPage, error) {
+	pageSize := filter.Limit
+	// Лишняя запись показывает, есть ли следующая страница
+	filter.Limit = pageSize + 1
+
+	entries, err := r.Query(filter)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return result.RowsAffected()
+
+	page := &AuditLogPage{Entries: entries}
+	if len(entries) > pageSize {
+		page.Entries = entries[:pageSize]
+		next := page.Entries[pageSize-1].ID
+		page.NextCursor = &next
+	}
+	return page, nil
 }
 
 // Константы для типов действий
@@ -120,8 +325,76 @@ const (
 	ActionUpdateUser     = "update_user"
 	ActionDeleteUser     = "delete_user"
 	ActionChangePassword = "change_password"
+	ActionResetPassword  = "reset_password"
 	ActionBlockUser      = "block_user"
 	ActionUnblockUser    = "unblock_user"
 	ActionUploadAvatar   = "upload_avatar"
 	ActionDeleteAvatar   = "delete_avatar"
+	ActionCreateAPIKey   = "create_api_key"
+	ActionRevokeAPIKey   = "revoke_api_key"
+	ActionCreateRole     = "create_role"
+	ActionUpdateRole     = "update_role"
+	ActionDeleteRole     = "delete_role"
+	ActionGrantAccess    = "grant_access"
+	ActionRevokeAccess   = "revoke_access"
+)
+
+// Временные доступы к организациям и окончание доступов (access_expired пишет фоновая задача)
+const (
+	ActionGrantOrganization  = "grant_organization"
+	ActionRevokeOrganization = "revoke_organization"
+	ActionAccessExpired      = "access_expired"
+)
+
+// Изменения, ожидающие подтверждения второго администратора
+const (
+	ActionChangeRequested = "change_requested"
+	ActionChangeApproved  = "change_approved"
+	ActionChangeRejected  = "change_rejected"
+)
+
+// Выгрузка журнала аудита
+const ActionExportAudit = "export_audit"
+
+// Импорт пользователей из файла (создание каждого пользователя пишется отдельно как create_user)
+const ActionImportUsers = "import_users"
+
+// Корзина пользователей: delete_user перемещает в корзину, restore_user возвращает,
+// purge_user - окончательное удаление по сроку хранения (пишет фоновая задача)
+const (
+	ActionRestoreUser = "restore_user"
+	ActionPurgeUser   = "purge_user"
+)
+
+// Выгрузка списка пользователей (csv, xlsx, vCard)
+const ActionExportUsers = "export_users"
+
+// Персональные данные: выгрузка всех данных пользователя и необратимое обезличивание
+const (
+	ActionExportPersonalData = "export_personal_data"
+	ActionAnonymizeUser      = "anonymize_user"
+)
+
+// Описания дополнительных полей профиля
+const (
+	ActionCreateCustomField = "create_custom_field"
+	ActionUpdateCustomField = "update_custom_field"
+	ActionDeleteCustomField = "delete_custom_field"
+)
+
+// Каталог тегов: изменения сразу у всех пользователей с тегом
+const (
+	ActionRenameTag = "rename_tag"
+	ActionMergeTags = "merge_tags"
+	ActionDeleteTag = "delete_tag"
+)
+
+// Удаление устаревших данных по правилам хранения (пишет фоновая задача обслуживания)
+const ActionApplyRetention = "apply_retention"
+
+// Действия при входе администратора под другим пользователем
+// (в записях impersonated_request user_id - пользователь, impersonator_id - администратор)
+const (
+	ActionImpersonate         = "impersonate"
+	ActionImpersonatedRequest = "impersonated_request"
 )
@@ -0,0 +1,145 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// AuditSink получатель записей журнала аудита (syslog, webhook SIEM)
+type AuditSink interface {
+	// Name постоянное имя получателя: по нему строки очереди связываются с получателем после перезапуска
+	Name() string
+	// Send доставляет одну запись; ошибка - запись будет отправлена повторно
+	Send(entry AuditLogEntry) error
+}
+
+// AuditOutboxItem строка очереди доставки
+type AuditOutboxItem struct {
+	ID         int64  `db:"id"`
+	AuditLogID int    `db:"audit_log_id"`
+	Sink       string `db:"sink"`
+	Attempts   int    `db:"attempts"`
+}
+
+// ClaimOutbox забирает до limit строк получателя, готовых к доставке, в порядке записей журнала.
+// Забранные строки засчитываются как попытка и не выдаются другим экземплярам до истечения lease
+func (r *AuditLogRepository) ClaimOutbox(sink string, limit int, lease time.Duration, maxAttempts int) ([]AuditOutboxItem, error) {
+	items := []AuditOutboxItem{}
+	query := `
+		UPDATE audit_outbox
+		SET attempts = attempts + 1, next_attempt_at = NOW() + $3 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM audit_outbox
+			WHERE sink = $1 AND delivered_at IS NULL AND attempts < $4 AND next_attempt_at <= NOW()
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, audit_log_id, sink, attempts
+	`
+	err := r.db.Select(&items, query, sink, limit, int(lease.Seconds()), maxAttempts)
+	return items, err
+}
+
+// EntriesByID возвращает записи журнала по ID (выгруженных в архив записей в результате нет)
+func (r *AuditLogRepository) EntriesByID(ids []int) (map[int]AuditLogEntry, error) {
+	var entries []AuditLogEntry
+	query := `
+		SELECT id, user_id, action, target_user_id, impersonator_id, details, ip_address, user_agent, created_at, prev_hash, hash
+		FROM audit_log
+		WHERE id = ANY($1)
+	`
+	if err := r.db.Select(&entries, query, pq.Array(ids)); err != nil {
+		return nil, err
+	}
+
+	result := make(map[int]AuditLogEntry, len(entries))
+	for _, entry := range entries {
+		result[entry.ID] = entry
+	}
+	return result, nil
+}
+
+// MarkOutboxDelivered отмечает строку очереди доставленной
+func (r *AuditLogRepository) MarkOutboxDelivered(id int64) error {
+	_, err := r.db.Exec(`UPDATE audit_outbox SET delivered_at = NOW(), last_error = NULL WHERE id = $1`, id)
+	return err
+}
+
+// MarkOutboxFailed сохраняет ошибку доставки и время следующей попытки
+func (r *AuditLogRepository) MarkOutboxFailed(id int64, errMsg string, retryAt time.Time) error {
+	_, err := r.db.Exec(`UPDATE audit_outbox SET last_error = $2, next_attempt_at = $3 WHERE id = $1`, id, errMsg, retryAt)
+	return err
+}
+
+// AbandonOutbox прекращает попытки доставки строки (запись недоступна)
+func (r *AuditLogRepository) AbandonOutbox(id int64, errMsg string) error {
+	_, err := r.db.Exec(`UPDATE audit_outbox SET last_error = $2, next_attempt_at = 'infinity' WHERE id = $1`, id, errMsg)
+	return err
+}
+
+// ReleaseOutbox возвращает забранные, но не отправленные строки в очередь (попытка не засчитывается)
+func (r *AuditLogRepository) ReleaseOutbox(ids []int64, retryAt time.Time) error {
+	query := `UPDATE audit_outbox SET attempts = attempts - 1, next_attempt_at = $2 WHERE id = ANY($1)`
+	_, err := r.db.Exec(query, pq.Array(ids), retryAt)
+	return err
+}
+
+// AuditOutboxStatus состояние очереди получателя
+type AuditOutboxStatus struct {
+	Sink string `json:"sink" db:"sink"`
+	// Строки, ждущие доставки
+	Pending int `json:"pending" db:"pending"`
+	// Строки, исчерпавшие попытки: не отправляются, пока их не вернут в очередь (RequeueOutbox)
+	Exhausted         int        `json:"exhausted" db:"exhausted"`
+	OldestExhaustedAt *time.Time `json:"oldest_exhausted_at,omitempty" db:"oldest_exhausted_at"`
+	// Строки, запись которых выгружена в архив до доставки
+	Abandoned int `json:"abandoned" db:"abandoned"`
+}
+
+// OutboxStatus возвращает число недоставленных строк по получателям
+func (r *AuditLogRepository) OutboxStatus(maxAttempts int) ([]AuditOutboxStatus, error) {
+	status := []AuditOutboxStatus{}
+	query := `
+		SELECT sink,
+		       COUNT(*) FILTER (WHERE attempts < $1 AND next_attempt_at <> 'infinity') AS pending,
+		       COUNT(*) FILTER (WHERE attempts >= $1 AND next_attempt_at <> 'infinity') AS exhausted,
+		       MIN(created_at) FILTER (WHERE attempts >= $1 AND next_attempt_at <> 'infinity') AS oldest_exhausted_at,
+		       COUNT(*) FILTER (WHERE next_attempt_at = 'infinity') AS abandoned
+		FROM audit_outbox
+		WHERE delivered_at IS NULL
+		GROUP BY sink
+		ORDER BY sink
+	`
+	err := r.db.Select(&status, query, maxAttempts)
+	return status, err
+}
+
+// RequeueOutbox возвращает в очередь строки, исчерпавшие попытки (sink пустой - всех получателей);
+// возвращает число строк
+func (r *AuditLogRepository) RequeueOutbox(sink string, maxAttempts int) (int64, error) {
+	query := `
+		UPDATE audit_outbox SET attempts = 0, next_attempt_at = NOW()
+		WHERE delivered_at IS NULL AND attempts >= $2 AND next_attempt_at <> 'infinity' AND ($1 = '' OR sink = $1)
+	`
+	result, err := r.db.Exec(query, sink, maxAttempts)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteOutbox удаляет строки очереди, созданные раньше cutoff: доставленные, исчерпавшие попытки
+// и оставленные из-за выгрузки записи в архив. Ждущие доставки строки не удаляются
+func (r *AuditLogRepository) DeleteOutbox(cutoff time.Time, maxAttempts int) (int64, error) {
+	query := `
+		DELETE FROM audit_outbox
+		WHERE created_at < $1 AND (delivered_at IS NOT NULL OR attempts >= $2 OR next_attempt_at = 'infinity')
+	`
+	result, err := r.db.Exec(query, cutoff, maxAttempts)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
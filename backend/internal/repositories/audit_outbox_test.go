@@ -0,0 +1,60 @@
+package repositories
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type namedSink string
+
+func (s namedSink) Name() string                   { return string(s) }
+func (s namedSink) Send(entry AuditLogEntry) error { return nil }
+
+// TestLogQueuesEntryForSinks проверяет, что запись ставится в очередь получателей той же командой
+func TestLogQueuesEntryForSinks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewAuditLogRepository(sqlx.NewDb(db, "postgres"))
+	repo.UseSinks(namedSink("syslog:siem:514"), namedSink("webhook:https://siem.example/audit"))
+
+	mock.ExpectExec(`WITH entry AS \(\s*INSERT INTO audit_log (.+) RETURNING id\) INSERT INTO audit_outbox (.+) unnest\(\$8::text\[\]\)`).
+		WithArgs(3, ActionLogin, nil, []byte(`{"method":"password"}`), "10.0.0.1", "Mozilla", nil,
+			pq.Array([]string{"syslog:siem:514", "webhook:https://siem.example/audit"})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	if err := repo.Log(3, ActionLogin, nil, map[string]interface{}{"method": "password"}, "10.0.0.1", "Mozilla"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestLogWithoutSinks проверяет, что без получателей очередь не заполняется
+func TestLogWithoutSinks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewAuditLogRepository(sqlx.NewDb(db, "postgres"))
+
+	mock.ExpectExec(`^\s*INSERT INTO audit_log \(user_id, action, target_user_id, details\) VALUES \(NULL, \$1, \$2, \$3\)$`).
+		WithArgs(ActionApplyRetention, nil, []byte(`{"table":"audit_outbox"}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := repo.LogSystem(ActionApplyRetention, nil, map[string]interface{}{"table": "audit_outbox"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/lib/pq"
+)
+
+// Имя месячной секции журнала: audit_log_y2025m01
+const auditPartitionLayout = "audit_log_y2006m01"
+
+// AuditPartition месячная секция журнала аудита
+type AuditPartition struct {
+	Name  string
+	Month time.Time
+}
+
+// AuditArchive секция, выгруженная в файл и удалённая из базы
+type AuditArchive struct {
+	ID            int               `json:"id" db:"id"`
+	PartitionName string            `json:"partition_name" db:"partition_name"`
+	Month         time.Time         `json:"month" db:"month"`
+	Entries       int               `json:"entries" db:"entries"`
+	FirstEntryID  models.NullInt    `json:"first_entry_id" db:"first_entry_id"`
+	LastEntryID   models.NullInt    `json:"last_entry_id" db:"last_entry_id"`
+	LastHash      models.NullString `json:"last_hash" db:"last_hash"`
+	FilePath      string            `json:"file_path" db:"file_path"`
+	FileSHA256    string            `json:"file_sha256" db:"file_sha256"`
+	CreatedAt     time.Time         `json:"created_at" db:"created_at"`
+}
+
+// AuditPartitionName имя секции месяца
+func AuditPartitionName(month time.Time) string {
+	return month.Format(auditPartitionLayout)
+}
+
+// EnsurePartition создает секцию месяца, если её ещё нет
+func (r *AuditLogRepository) EnsurePartition(month time.Time) error {
+	_, err := r.db.Exec("SELECT audit_log_create_partition($1::date)", month.Format("2006-01-02"))
+	return err
+}
+
+// ListPartitions возвращает секции журнала, старые первыми
+func (r *AuditLogRepository) ListPartitions() ([]AuditPartition, error) {
+	var names []string
+	query := `
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'audit_log'::regclass
+		ORDER BY c.relname
+	`
+	if err := r.db.Select(&names, query); err != nil {
+		return nil, err
+	}
+
+	partitions := make([]AuditPartition, 0, len(names))
+	for _, name := range names {
+		month, err := time.Parse(auditPartitionLayout, name)
+		if err != nil {
+			// Секции, созданные вручную под другим именем, обслуживание не трогает
+			continue
+		}
+		partitions = append(partitions, AuditPartition{Name: name, Month: month})
+	}
+	return partitions, nil
+}
+
+// EachPartitionRow передаёт fn записи секции в порядке цепочки (в том виде, из которого считается хеш)
+func (r *AuditLogRepository) EachPartitionRow(partition AuditPartition, fn func(AuditChainRow) error) error {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM %s
+		ORDER BY id
+	`, auditChainColumns, pq.QuoteIdentifier(partition.Name))
+
+	rows, err := r.db.Queryx(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row AuditChainRow
+		if err := rows.StructScan(&row); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// DropPartition сохраняет сведения об архиве и удаляет секцию одной транзакцией
+func (r *AuditLogRepository) DropPartition(partition AuditPartition, archive *AuditArchive) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO audit_log_archives (partition_name, month, entries, first_entry_id, last_entry_id, last_hash, file_path, file_sha256)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+	if err := tx.QueryRow(query, archive.PartitionName, archive.Month, archive.Entries, archive.FirstEntryID,
+		archive.LastEntryID, archive.LastHash, archive.FilePath, archive.FileSHA256).Scan(&archive.ID, &archive.CreatedAt); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DROP TABLE " + pq.QuoteIdentifier(partition.Name)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// LastArchive возвращает последний архив с записями цепочки (sql.ErrNoRows - архивов нет)
+func (r *AuditLogRepository) LastArchive() (*AuditArchive, error) {
+	var archive AuditArchive
+	query := `
+		SELECT id, partition_name, month, entries, first_entry_id, last_entry_id, last_hash, file_path, file_sha256, created_at
+		FROM audit_log_archives
+		WHERE last_entry_id IS NOT NULL
+		ORDER BY last_entry_id DESC
+		LIMIT 1
+	`
+	if err := r.db.Get(&archive, query); err != nil {
+		return nil, err
+	}
+	return &archive, nil
+}
+
+// ListArchives возвращает все архивы по порядку месяцев
+func (r *AuditLogRepository) ListArchives() ([]AuditArchive, error) {
+	archives := []AuditArchive{}
+	query := `
+		SELECT id, partition_name, month, entries, first_entry_id, last_entry_id, last_hash, file_path, file_sha256, created_at
+		FROM audit_log_archives
+		ORDER BY month, id
+	`
+	err := r.db.Select(&archives, query)
+	return archives, err
+}
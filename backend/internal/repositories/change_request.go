@@ -0,0 +1,152 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
+)
+
+// Статусы запроса на изменение
+const (
+	ChangeRequestPending  = "pending"
+	ChangeRequestApproved = "approved"
+	ChangeRequestRejected = "rejected"
+)
+
+// ChangeRequest изменение пользователя, ожидающее подтверждения второго администратора
+type ChangeRequest struct {
+	ID            int            `json:"id" db:"id"`
+	TargetUserID  int            `json:"target_user_id" db:"target_user_id"`
+	RequestedBy   sql.NullInt64  `json:"requested_by" db:"requested_by"`
+	Rules         pq.StringArray `json:"rules" db:"rules"`
+	Changes       types.JSONText `json:"changes" db:"changes"`
+	Diff          types.JSONText `json:"diff" db:"diff"`
+	Status        string         `json:"status" db:"status"`
+	ReviewedBy    sql.NullInt64  `json:"reviewed_by" db:"reviewed_by"`
+	ReviewComment sql.NullString `json:"review_comment" db:"review_comment"`
+	ReviewedAt    sql.NullTime   `json:"reviewed_at" db:"reviewed_at"`
+	CreatedAt     time.Time      `json:"created_at" db:"created_at"`
+}
+
+// NewChangeRequest готовит запрос: changes - отложенная часть UpdateUserRequest, diff - значения до и после
+func NewChangeRequest(targetUserID, requestedBy int, rules []string, changes, diff interface{}) (*ChangeRequest, error) {
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+	diffJSON, err := json.Marshal(diff)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChangeRequest{
+		TargetUserID: targetUserID,
+		RequestedBy:  sql.NullInt64{Int64: int64(requestedBy), Valid: true},
+		Rules:        rules,
+		Changes:      changesJSON,
+		Diff:         diffJSON,
+	}, nil
+}
+
+// UpdateRequest разбирает отложенные изменения
+func (r *ChangeRequest) UpdateRequest() (models.UpdateUserRequest, error) {
+	var req models.UpdateUserRequest
+	err := json.Unmarshal(r.Changes, &req)
+	return req, err
+}
+
+const changeRequestColumns = `id, target_user_id, requested_by, rules, changes, diff, status,
+	reviewed_by, review_comment, reviewed_at, created_at`
+
+// ChangeRequestRepository для работы с запросами на изменение пользователей
+type ChangeRequestRepository struct {
+	db *sqlx.DB
+}
+
+// NewChangeRequestRepository создает новый репозиторий
+func NewChangeRequestRepository(db *sqlx.DB) *ChangeRequestRepository {
+	return &ChangeRequestRepository{db: db}
+}
+
+// insertChangeRequest сохраняет запрос со статусом pending в транзакции изменения пользователя
+func insertChangeRequest(q sqlx.Queryer, request *ChangeRequest) error {
+	query := `
+		INSERT INTO user_change_requests (target_user_id, requested_by, rules, changes, diff)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status, created_at
+	`
+	return q.QueryRowx(query,
+		request.TargetUserID, request.RequestedBy, request.Rules, request.Changes, request.Diff,
+	).Scan(&request.ID, &request.Status, &request.CreatedAt)
+}
+
+// GetByID возвращает запрос по ID
+func (r *ChangeRequestRepository) GetByID(id int) (*ChangeRequest, error) {
+	var request ChangeRequest
+	query := `SELECT ` + changeRequestColumns + ` FROM user_change_requests WHERE id = $1`
+	if err := r.db.Get(&request, query, id); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// List возвращает запросы с указанным статусом (пустой - все), новые первыми
+func (r *ChangeRequestRepository) List(status string, limit int) ([]ChangeRequest, error) {
+	requests := []ChangeRequest{}
+	query := `SELECT ` + changeRequestColumns + ` FROM user_change_requests
+		WHERE ($1 = '' OR status = $1)
+		ORDER BY created_at DESC
+		LIMIT $2`
+	if err := r.db.Select(&requests, query, status, limit); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// ListByTarget возвращает все запросы на изменение пользователя, новые первыми
+func (r *ChangeRequestRepository) ListByTarget(targetUserID int) ([]ChangeRequest, error) {
+	requests := []ChangeRequest{}
+	query := `SELECT ` + changeRequestColumns + ` FROM user_change_requests
+		WHERE target_user_id = $1
+		ORDER BY created_at DESC`
+	if err := r.db.Select(&requests, query, targetUserID); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// Review переводит запрос из pending в status и возвращает его
+// (sql.ErrNoRows - запрос не найден или уже рассмотрен другим администратором)
+func (r *ChangeRequestRepository) Review(id int, status string, reviewerID int, comment string) (*ChangeRequest, error) {
+	var request ChangeRequest
+	query := `UPDATE user_change_requests
+		SET status = $2, reviewed_by = $3, review_comment = NULLIF($4, ''), reviewed_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING ` + changeRequestColumns
+	if err := r.db.Get(&request, query, id, status, reviewerID, comment); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// Reopen возвращает подтверждённый запрос в pending, если изменение не удалось применить
+func (r *ChangeRequestRepository) Reopen(id int) error {
+	_, err := r.db.Exec(`UPDATE user_change_requests
+		SET status = 'pending', reviewed_by = NULL, review_comment = NULL, reviewed_at = NULL
+		WHERE id = $1 AND status = 'approved'`, id)
+	return err
+}
+
+// DeleteReviewed удаляет запросы, рассмотренные до cutoff (решения остаются в журнале аудита)
+func (r *ChangeRequestRepository) DeleteReviewed(cutoff time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM user_change_requests WHERE status <> 'pending' AND reviewed_at < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
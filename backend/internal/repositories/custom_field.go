@@ -0,0 +1,94 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const customFieldColumns = `id, key, label, type, required, allowed_values, visible_to, sort_order,
+	created_by, created_at, updated_at`
+
+// CustomFieldRepository для работы с описаниями дополнительных полей
+type CustomFieldRepository struct {
+	db *sqlx.DB
+}
+
+// NewCustomFieldRepository создает новый репозиторий
+func NewCustomFieldRepository(db *sqlx.DB) *CustomFieldRepository {
+	return &CustomFieldRepository{db: db}
+}
+
+// ListCustomFields возвращает все описания в порядке отображения
+func (r *CustomFieldRepository) ListCustomFields() ([]models.CustomFieldDefinition, error) {
+	definitions := []models.CustomFieldDefinition{}
+	query := `SELECT ` + customFieldColumns + ` FROM custom_field_definitions ORDER BY sort_order, id`
+	if err := r.db.Select(&definitions, query); err != nil {
+		return nil, err
+	}
+	return definitions, nil
+}
+
+// GetByID возвращает описание по ID (nil если не найдено)
+func (r *CustomFieldRepository) GetByID(id int) (*models.CustomFieldDefinition, error) {
+	var definition models.CustomFieldDefinition
+	query := `SELECT ` + customFieldColumns + ` FROM custom_field_definitions WHERE id = $1`
+	err := r.db.Get(&definition, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &definition, nil
+}
+
+// Create сохраняет описание (ошибка unique violation - ключ уже занят)
+func (r *CustomFieldRepository) Create(definition *models.CustomFieldDefinition) error {
+	query := `
+		INSERT INTO custom_field_definitions (key, label, type, required, allowed_values, visible_to, sort_order, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, updated_at
+	`
+	return r.db.QueryRow(query,
+		definition.Key, definition.Label, definition.Type, definition.Required,
+		definition.AllowedValues, definition.VisibleTo, definition.SortOrder, definition.CreatedBy,
+	).Scan(&definition.ID, &definition.CreatedAt, &definition.UpdatedAt)
+}
+
+// Update меняет описание (кроме ключа); false - описание не найдено
+func (r *CustomFieldRepository) Update(definition *models.CustomFieldDefinition) (bool, error) {
+	query := `
+		UPDATE custom_field_definitions
+		SET label = $2, type = $3, required = $4, allowed_values = $5, visible_to = $6, sort_order = $7
+		WHERE id = $1
+		RETURNING updated_at
+	`
+	err := r.db.QueryRow(query,
+		definition.ID, definition.Label, definition.Type, definition.Required,
+		definition.AllowedValues, definition.VisibleTo, definition.SortOrder,
+	).Scan(&definition.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete удаляет описание; значения поля у пользователей остаются без описания
+func (r *CustomFieldRepository) Delete(id int) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM custom_field_definitions WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// IsDuplicateCustomField проверяет, что ошибка Create - поле с таким ключом уже существует
+func IsDuplicateCustomField(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
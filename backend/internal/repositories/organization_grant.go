@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// OrganizationGrant временный доступ пользователя к организации сверх available_organizations
+type OrganizationGrant struct {
+	ID             int            `json:"id" db:"id"`
+	UserID         int            `json:"user_id" db:"user_id"`
+	OrganizationID int            `json:"organization_id" db:"organization_id"`
+	ValidFrom      time.Time      `json:"valid_from" db:"valid_from"`
+	ValidUntil     time.Time      `json:"valid_until" db:"valid_until"`
+	Reason         sql.NullString `json:"reason" db:"reason"`
+	GrantedBy      sql.NullInt64  `json:"granted_by" db:"granted_by"`
+	NotifiedAt     sql.NullTime   `json:"notified_at" db:"notified_at"`
+	ExpiredAt      sql.NullTime   `json:"expired_at" db:"expired_at"`
+	CreatedAt      time.Time      `json:"created_at" db:"created_at"`
+}
+
+// IsActive проверяет, действует ли доступ в момент now
+func (g *OrganizationGrant) IsActive(now time.Time) bool {
+	return !now.Before(g.ValidFrom) && now.Before(g.ValidUntil)
+}
+
+const organizationGrantColumns = `id, user_id, organization_id, valid_from, valid_until, reason, granted_by,
+	notified_at, expired_at, created_at`
+
+// OrganizationGrantRepository для работы с временными доступами к организациям
+type OrganizationGrantRepository struct {
+	db *sqlx.DB
+}
+
+// NewOrganizationGrantRepository создает новый репозиторий
+func NewOrganizationGrantRepository(db *sqlx.DB) *OrganizationGrantRepository {
+	return &OrganizationGrantRepository{db: db}
+}
+
+// ListByUser возвращает доступы пользователя к организациям, включая истёкшие
+func (r *OrganizationGrantRepository) ListByUser(userID int) ([]OrganizationGrant, error) {
+	grants := []OrganizationGrant{}
+	query := `SELECT ` + organizationGrantColumns + ` FROM organization_grants
+		WHERE user_id = $1
+		ORDER BY expired_at IS NOT NULL, valid_until`
+	if err := r.db.Select(&grants, query, userID); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// ActiveOrganizationIDs возвращает организации, доступ к которым действует сейчас
+func (r *OrganizationGrantRepository) ActiveOrganizationIDs(userID int) (models.Organizations, error) {
+	ids := models.Organizations{}
+	query := `SELECT DISTINCT organization_id FROM organization_grants
+		WHERE user_id = $1 AND valid_from <= NOW() AND valid_until > NOW()
+		ORDER BY organization_id`
+	if err := r.db.Select(&ids, query, userID); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Create сохраняет доступ (нулевой ValidFrom - доступ действует сразу)
+func (r *OrganizationGrantRepository) Create(grant *OrganizationGrant) error {
+	if grant.ValidFrom.IsZero() {
+		grant.ValidFrom = time.Now()
+	}
+
+	query := `
+		INSERT INTO organization_grants (user_id, organization_id, valid_from, valid_until, reason, granted_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+	return r.db.QueryRow(query,
+		grant.UserID, grant.OrganizationID, grant.ValidFrom, grant.ValidUntil, grant.Reason, grant.GrantedBy,
+	).Scan(&grant.ID, &grant.CreatedAt)
+}
+
+// Delete досрочно удаляет доступ пользователя (false если не найден)
+func (r *OrganizationGrantRepository) Delete(userID, id int) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM organization_grants WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// ListExpiring возвращает действующие доступы, которые закончатся до before
+func (r *OrganizationGrantRepository) ListExpiring(before time.Time) ([]OrganizationGrant, error) {
+	grants := []OrganizationGrant{}
+	query := `SELECT ` + organizationGrantColumns + ` FROM organization_grants
+		WHERE expired_at IS NULL AND valid_until > NOW() AND valid_until <= $1
+		ORDER BY valid_until`
+	if err := r.db.Select(&grants, query, before); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// MarkNotified отмечает доступы, заканчивающиеся до before, о которых ещё не уведомляли,
+// и возвращает их (каждый доступ возвращается один раз)
+func (r *OrganizationGrantRepository) MarkNotified(before time.Time) ([]OrganizationGrant, error) {
+	grants := []OrganizationGrant{}
+	query := `UPDATE organization_grants SET notified_at = NOW()
+		WHERE notified_at IS NULL AND expired_at IS NULL AND valid_until > NOW() AND valid_until <= $1
+		RETURNING ` + organizationGrantColumns
+	if err := r.db.Select(&grants, query, before); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// ExpireDue фиксирует окончание доступов с прошедшим valid_until и возвращает их
+func (r *OrganizationGrantRepository) ExpireDue() ([]OrganizationGrant, error) {
+	grants := []OrganizationGrant{}
+	query := `UPDATE organization_grants SET expired_at = NOW()
+		WHERE expired_at IS NULL AND valid_until <= NOW()
+		RETURNING ` + organizationGrantColumns
+	if err := r.db.Select(&grants, query); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
@@ -4,16 +4,24 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
+	"errors"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
-// PasswordResetToken представляет токен для сброса пароля
+// Назначение одноразового токена: токен одного назначения не принимается для другого
+const (
+	TokenPurposePasswordReset = "password_reset"
+	TokenPurposeMagicLink     = "magic_link"
+)
+
+// PasswordResetToken представляет одноразовый токен (сброс пароля или вход по ссылке)
 type PasswordResetToken struct {
 	ID        int          `json:"id" db:"id"`
 	UserID    int          `json:"user_id" db:"user_id"`
 	Token     string       `json:"token" db:"token"`
+	Purpose   string       `json:"purpose" db:"purpose"`
 	ExpiresAt time.Time    `json:"expires_at" db:"expires_at"`
 	Used      bool         `json:"used" db:"used"`
 	UsedAt    sql.NullTime `json:"used_at" db:"used_at"`
@@ -32,6 +40,11 @@ func NewPasswordResetRepository(db *sqlx.DB) *PasswordResetRepository {
 
 // GenerateToken создает новый токен для сброса пароля
 func (r *PasswordResetRepository) GenerateToken(userID int, expirationHours int) (string, error) {
+	return r.GenerateTokenForPurpose(userID, TokenPurposePasswordReset, time.Hour*time.Duration(expirationHours))
+}
+
+// GenerateTokenForPurpose создает одноразовый токен с указанным назначением
+func (r *PasswordResetRepository) GenerateTokenForPurpose(userID int, purpose string, ttl time.Duration) (string, error) {
 	// Генерируем случайный токен
 	tokenBytes := make([]byte, 32)
 	if _, err := rand.Read(tokenBytes); err != nil {
@@ -39,16 +52,16 @@ func (r *PasswordResetRepository) GenerateToken(userID int, expirationHours int)
 	}
 	token := hex.EncodeToString(tokenBytes)
 
-	expiresAt := time.Now().Add(time.Hour * time.Duration(expirationHours))
+	expiresAt := time.Now().Add(ttl)
 
 	query := `
-		INSERT INTO password_reset_tokens (user_id, token, expires_at)
-		VALUES ($1, $2, $3)
+		INSERT INTO password_reset_tokens (user_id, token, expires_at, purpose)
+		VALUES ($1, $2, $3, $4)
 		RETURNING token
 	`
 
 	var savedToken string
-	err := r.db.QueryRow(query, userID, token, expiresAt).Scan(&savedToken)
+	err := r.db.QueryRow(query, userID, token, expiresAt, purpose).Scan(&savedToken)
 	return savedToken, err
 }
 
@@ -56,7 +69,7 @@ func (r *PasswordResetRepository) GenerateToken(userID int, expirationHours int)
 func (r *PasswordResetRepository) GetByToken(token string) (*PasswordResetToken, error) {
 	var resetToken PasswordResetToken
 	query := `
-		SELECT id, user_id, token, expires_at, used, used_at, created_at
+		SELECT id, user_id, token, purpose, expires_at, used, used_at, created_at
 		FROM password_reset_tokens
 		WHERE token = $1
 	`
@@ -67,13 +80,18 @@ func (r *PasswordResetRepository) GetByToken(token string) (*PasswordResetToken,
 	return &resetToken, nil
 }
 
-// ValidateToken проверяет валидность токена
+// ValidateToken проверяет валидность токена сброса пароля
 func (r *PasswordResetRepository) ValidateToken(token string) (bool, int, error) {
 	resetToken, err := r.GetByToken(token)
 	if err != nil {
 		return false, 0, err
 	}
 
+	// Токен входа по ссылке не позволяет сменить пароль
+	if resetToken.Purpose != TokenPurposePasswordReset {
+		return false, 0, nil
+	}
+
 	// Проверяем что токен не использован
 	if resetToken.Used {
 		return false, 0, nil
@@ -98,13 +116,44 @@ func (r *PasswordResetRepository) MarkAsUsed(token string) error {
 	return err
 }
 
-// DeleteExpiredTokens удаляет истекшие токены
-func (r *PasswordResetRepository) DeleteExpiredTokens() (int64, error) {
+// ConsumeToken атомарно помечает действующий токен использованным и возвращает ID пользователя
+// (ok = false, если токен не найден, уже использован, истёк или имеет другое назначение)
+func (r *PasswordResetRepository) ConsumeToken(token, purpose string) (int, bool, error) {
+	query := `
+		UPDATE password_reset_tokens
+		SET used = true, used_at = NOW()
+		WHERE token = $1 AND purpose = $2 AND used = false AND expires_at > NOW()
+		RETURNING user_id
+	`
+	var userID int
+	err := r.db.QueryRow(query, token, purpose).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return userID, true, nil
+}
+
+// InvalidateUserTokens инвалидирует неиспользованные токены пользователя с указанным назначением
+func (r *PasswordResetRepository) InvalidateUserTokens(userID int, purpose string) error {
+	query := `
+		UPDATE password_reset_tokens
+		SET used = true, used_at = NOW()
+		WHERE user_id = $1 AND purpose = $2 AND used = false
+	`
+	_, err := r.db.Exec(query, userID, purpose)
+	return err
+}
+
+// DeleteExpiredTokens удаляет токены, истекшие или использованные до cutoff
+func (r *PasswordResetRepository) DeleteExpiredTokens(cutoff time.Time) (int64, error) {
 	query := `
 		DELETE FROM password_reset_tokens
-		WHERE expires_at < NOW() OR (used = true AND used_at < NOW() - INTERVAL '7 days')
+		WHERE expires_at < $1 OR (used = true AND used_at < $1)
 	`
-	result, err := r.db.Exec(query)
+	result, err := r.db.Exec(query, cutoff)
 	if err != nil {
 		return 0, err
 	}
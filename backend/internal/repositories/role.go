@@ -0,0 +1,189 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Permission право доступа из справочника
+type Permission struct {
+	Code        string `json:"code" db:"code"`
+	Description string `json:"description" db:"description"`
+}
+
+// Role именованный набор прав; встроенные роли (admin, moderator, user) не изменяются через API
+type Role struct {
+	ID          int            `json:"id" db:"id"`
+	Name        string         `json:"name" db:"name"`
+	Description sql.NullString `json:"description" db:"description"`
+	IsBuiltin   bool           `json:"is_builtin" db:"is_builtin"`
+	Permissions pq.StringArray `json:"permissions" db:"permissions"`
+	CreatedBy   sql.NullInt64  `json:"created_by" db:"created_by"`
+	CreatedAt   time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// RoleRepository для работы с ролями и правами
+type RoleRepository struct {
+	db *sqlx.DB
+}
+
+// NewRoleRepository создает новый репозиторий
+func NewRoleRepository(db *sqlx.DB) *RoleRepository {
+	return &RoleRepository{db: db}
+}
+
+const roleSelect = `
+	SELECT r.id, r.name, r.description, r.is_builtin, r.created_by, r.created_at, r.updated_at,
+	       array_remove(array_agg(rp.permission_code ORDER BY rp.permission_code), NULL) AS permissions
+	FROM roles r
+	LEFT JOIN role_permissions rp ON rp.role_id = r.id
+`
+
+// List возвращает все роли с их правами
+func (r *RoleRepository) List() ([]Role, error) {
+	var roles []Role
+	query := roleSelect + ` GROUP BY r.id ORDER BY r.is_builtin DESC, r.name`
+	if err := r.db.Select(&roles, query); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// GetByID находит роль по ID (nil если не найдена)
+func (r *RoleRepository) GetByID(id int) (*Role, error) {
+	var role Role
+	query := roleSelect + ` WHERE r.id = $1 GROUP BY r.id`
+	err := r.db.Get(&role, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// GetByName находит роль по имени (nil если не найдена)
+func (r *RoleRepository) GetByName(name string) (*Role, error) {
+	var role Role
+	query := roleSelect + ` WHERE r.name = $1 GROUP BY r.id`
+	err := r.db.Get(&role, query, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// Create создает пользовательскую роль вместе с правами
+func (r *RoleRepository) Create(role *Role) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO roles (name, description, created_by)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at
+	`
+	if err := tx.QueryRow(query, role.Name, role.Description, role.CreatedBy).
+		Scan(&role.ID, &role.CreatedAt, &role.UpdatedAt); err != nil {
+		return err
+	}
+
+	if err := replaceRolePermissions(tx, role.ID, role.Permissions); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Update меняет описание и права пользовательской роли (false если роль не найдена или встроенная)
+func (r *RoleRepository) Update(id int, description sql.NullString, permissions []string) (bool, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE roles SET description = $1, updated_at = NOW()
+		WHERE id = $2 AND is_builtin = false
+	`, description, id)
+	if err != nil {
+		return false, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return false, nil
+	}
+
+	if err := replaceRolePermissions(tx, id, permissions); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// Delete удаляет пользовательскую роль (false если роль не найдена или встроенная)
+func (r *RoleRepository) Delete(id int) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM roles WHERE id = $1 AND is_builtin = false`, id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// CountUsers возвращает количество пользователей с ролью; удалённые в корзину учитываются,
+// чтобы после восстановления у пользователя была существующая роль
+func (r *RoleRepository) CountUsers(name string) (int, error) {
+	var count int
+	err := r.db.Get(&count, `SELECT COUNT(*) FROM users WHERE role = $1`, name)
+	return count, err
+}
+
+// ListPermissions возвращает справочник прав
+func (r *RoleRepository) ListPermissions() ([]Permission, error) {
+	var permissions []Permission
+	if err := r.db.Select(&permissions, `SELECT code, description FROM permissions ORDER BY code`); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// LoadRolePermissions возвращает права всех ролей (для auth.PermissionStore)
+func (r *RoleRepository) LoadRolePermissions() (map[models.UserRole][]string, error) {
+	roles, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[models.UserRole][]string, len(roles))
+	for _, role := range roles {
+		result[models.UserRole(role.Name)] = role.Permissions
+	}
+	return result, nil
+}
+
+// replaceRolePermissions заменяет права роли в рамках транзакции
+func replaceRolePermissions(tx *sqlx.Tx, roleID int, permissions []string) error {
+	if _, err := tx.Exec(`DELETE FROM role_permissions WHERE role_id = $1`, roleID); err != nil {
+		return err
+	}
+	if len(permissions) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(`
+		INSERT INTO role_permissions (role_id, permission_code)
+		SELECT $1, unnest($2::text[])
+	`, roleID, pq.Array(permissions))
+	return err
+}
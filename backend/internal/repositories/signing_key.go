@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SigningKey ключ подписи JWT токенов
+type SigningKey struct {
+	ID         int          `db:"id"`
+	KID        string       `db:"kid"`
+	Algorithm  string       `db:"algorithm"`
+	PrivateKey string       `db:"private_key"` // зашифрован, см. auth.KeyManager
+	PublicKey  string       `db:"public_key"`
+	CreatedAt  time.Time    `db:"created_at"`
+	RetiredAt  sql.NullTime `db:"retired_at"`
+	ExpiresAt  sql.NullTime `db:"expires_at"`
+}
+
+// SigningKeyRepository для работы с ключами подписи JWT
+type SigningKeyRepository struct {
+	db *sqlx.DB
+}
+
+// NewSigningKeyRepository создает новый репозиторий
+func NewSigningKeyRepository(db *sqlx.DB) *SigningKeyRepository {
+	return &SigningKeyRepository{db: db}
+}
+
+// ListValid возвращает ключи, которыми ещё можно проверять токены (новые первыми)
+func (r *SigningKeyRepository) ListValid() ([]SigningKey, error) {
+	var keys []SigningKey
+	query := `
+		SELECT id, kid, algorithm, private_key, public_key, created_at, retired_at, expires_at
+		FROM jwt_signing_keys
+		WHERE expires_at IS NULL OR expires_at > NOW()
+		ORDER BY created_at DESC
+	`
+	err := r.db.Select(&keys, query)
+	return keys, err
+}
+
+// Rotate сохраняет новый ключ и выводит из подписи текущие, если ротация нужна
+// Выполняется под advisory lock, чтобы несколько экземпляров сервера не создали ключи одновременно;
+// возвращает false, если другой экземпляр уже выполнил ротацию (и force не задан)
+func (r *SigningKeyRepository) Rotate(key *SigningKey, rotationInterval, gracePeriod time.Duration, force bool) (bool, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('jwt_signing_keys'))"); err != nil {
+		return false, err
+	}
+
+	if !force {
+		var due bool
+		query := `
+			SELECT NOT EXISTS (
+				SELECT 1 FROM jwt_signing_keys
+				WHERE retired_at IS NULL AND created_at > NOW() - $1::interval
+			)
+		`
+		if err := tx.Get(&due, query, intervalString(rotationInterval)); err != nil {
+			return false, err
+		}
+		if !due {
+			return false, nil
+		}
+	}
+
+	retireQuery := `
+		UPDATE jwt_signing_keys SET retired_at = NOW(), expires_at = NOW() + $1::interval
+		WHERE retired_at IS NULL
+	`
+	if _, err := tx.Exec(retireQuery, intervalString(gracePeriod)); err != nil {
+		return false, err
+	}
+
+	insertQuery := `
+		INSERT INTO jwt_signing_keys (kid, algorithm, private_key, public_key)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+	if err := tx.QueryRow(insertQuery, key.KID, key.Algorithm, key.PrivateKey, key.PublicKey).Scan(&key.ID, &key.CreatedAt); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// DeleteExpired удаляет ключи, у которых закончился период отсрочки
+func (r *SigningKeyRepository) DeleteExpired() (int64, error) {
+	result, err := r.db.Exec("DELETE FROM jwt_signing_keys WHERE expires_at IS NOT NULL AND expires_at <= NOW()")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// intervalString переводит длительность в PostgreSQL interval
+func intervalString(d time.Duration) string {
+	return fmt.Sprintf("%d seconds", int64(d.Seconds()))
+}
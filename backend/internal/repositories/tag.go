@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// TagUsage тег и число пользователей с ним
+type TagUsage struct {
+	Tag   string `json:"tag" db:"tag"`
+	Count int    `json:"count" db:"count"`
+}
+
+// TagRepository для каталога тегов пользователей (users.tags)
+type TagRepository struct {
+	db *sqlx.DB
+}
+
+// NewTagRepository создает новый репозиторий
+func NewTagRepository(db *sqlx.DB) *TagRepository {
+	return &TagRepository{db: db}
+}
+
+// ListTags возвращает теги пользователей (без корзины) с числом пользователей, самые частые первыми.
+// accessibleTo > 0 - считаются только пользователи, доступные ему
+func (r *TagRepository) ListTags(accessibleTo int) ([]TagUsage, error) {
+	tags := []TagUsage{}
+	where := notDeleted
+	args := []interface{}{}
+	if accessibleTo > 0 {
+		where += " AND " + accessibleToCondition(1)
+		args = append(args, accessibleTo)
+	}
+	query := `
+		SELECT t.tag, COUNT(*) AS count
+		FROM users, jsonb_array_elements_text(users.tags) AS t(tag)
+		WHERE ` + where + `
+		GROUP BY t.tag
+		ORDER BY count DESC, t.tag`
+	if err := r.db.Select(&tags, query, args...); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// ReplaceTags заменяет теги sources на target у всех пользователей (включая корзину) одним запросом:
+// переименование и слияние. Пустой target - теги удаляются. Повторы после замены убираются,
+// порядок тегов сохраняется. Возвращает ID изменённых пользователей
+func (r *TagRepository) ReplaceTags(sources []string, target string, updatedBy int) ([]int, error) {
+	ids := []int{}
+	query := `
+		UPDATE users SET
+			tags = (
+				SELECT COALESCE(jsonb_agg(d.tag ORDER BY d.ord), '[]'::jsonb)
+				FROM (
+					SELECT DISTINCT ON (m.tag) m.tag, m.ord
+					FROM (
+						SELECT CASE WHEN e.tag = ANY($1) THEN $2::text ELSE e.tag END AS tag, e.ord
+						FROM jsonb_array_elements_text(users.tags) WITH ORDINALITY AS e(tag, ord)
+					) m
+					WHERE m.tag IS NOT NULL
+					ORDER BY m.tag, m.ord
+				) d
+			),
+			updated_by = NULLIF($3, 0)
+		WHERE tags ?| $1
+		RETURNING id`
+	targetArg := sql.NullString{String: target, Valid: target != ""}
+	if err := r.db.Select(&ids, query, pq.Array(sources), targetArg, updatedBy); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
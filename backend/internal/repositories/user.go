@@ -7,6 +7,7 @@ import (
 	"log"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/UAssylbek/central-reporting/internal/models"
 	"github.com/jmoiron/sqlx"
@@ -22,6 +23,10 @@ func NewUserRepository(db *sqlx.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
+// notDeleted условие "пользователь не удалён": удалённые (в корзине) исключаются из всех выборок,
+// кроме корзины, проверки занятости логина и окончательного удаления
+const notDeleted = "deleted_at IS NULL"
+
 // Whitelist допустимых полей для сортировки (защита от SQL Injection)
 var allowedSortFields = map[string]bool{
 	"id":         true,
@@ -35,18 +40,27 @@ var allowedSortFields = map[string]bool{
 	"last_seen":  true,
 	"created_at": true,
 	"updated_at": true,
+	"deleted_at": true,
 }
 
+// SortByRelevance сортировка списка по релевантности поиска (без поиска - по дате создания)
+const SortByRelevance = "relevance"
+
 // PaginationParams параметры пагинации
 type PaginationParams struct {
 	Page       int
 	PageSize   int
 	SortBy     string
 	SortDesc   bool
-	Search     string   // Поиск по имени, username, email, телефону
+	Search     string   // Поиск по имени (с опечатками и транслитерацией), username, email, телефону
 	Role       string   // Фильтр по роли
 	IsActive   *bool    // Фильтр по активности (nil = все)
 	Department string   // Фильтр по отделу
+	AccessibleTo int    // Только пользователи, доступные этому пользователю (0 = все)
+	Deleted    bool     // Корзина: только удалённые пользователи
+	CustomFields models.CustomFields // Значения дополнительных полей (все должны совпасть)
+	TagsAny    []string // Есть хотя бы один из тегов
+	TagsAll    []string // Есть все теги
 }
 
 // PaginatedResult результат с пагинацией
@@ -75,6 +89,8 @@ type UserListItem struct {
 	CreatedAt            time.Time        `json:"created_at" db:"created_at"`
 	ShowInSelection      bool             `json:"show_in_selection" db:"show_in_selection"`
 	RequirePasswordChange bool            `json:"require_password_change" db:"require_password_change"`
+	DeletedAt            *time.Time       `json:"deleted_at,omitempty" db:"deleted_at"`
+	DeletedBy            *int             `json:"deleted_by,omitempty" db:"deleted_by"`
 }
 
 // PaginatedListResult результат с пагинацией для облегченных списков
@@ -91,12 +107,12 @@ func (r *UserRepository) GetAll() ([]models.User, error) {
 	var users []models.User
 	// ВАЖНО: не включаем password в SELECT для списка пользователей
 	query := `SELECT id, full_name, username, avatar_url, require_password_change, disable_password_change,
-	          show_in_selection, available_organizations, accessible_users, emails, phones,
+	          show_in_selection, available_organizations, ` + accessibleUsersColumn + `, emails, phones,
 	          position, department, birth_date, address, city, country, postal_code, social_links,
 	          timezone, work_hours, comment, custom_fields, tags, is_active, blocked_reason,
 	          blocked_at, blocked_by, role, is_first_login, is_online, last_seen, created_by,
-	          updated_by, created_at, updated_at, token_version
-	          FROM users ORDER BY created_at DESC`
+	          updated_by, created_at, updated_at, token_version, is_service_account
+	          FROM users WHERE ` + notDeleted + ` ORDER BY created_at DESC`
 
 	err := r.db.Select(&users, query)
 	if err != nil {
@@ -105,51 +121,23 @@ func (r *UserRepository) GetAll() ([]models.User, error) {
 	return users, err
 }
 
-// GetAllPaginatedLight возвращает облегченный список пользователей с пагинацией (БЕЗ JSONB полей)
-// Оптимизировано для списков - выбирает только необходимые поля
-func (r *UserRepository) GetAllPaginatedLight(params PaginationParams) (*PaginatedListResult, error) {
-	// Устанавливаем значения по умолчанию
-	if params.Page < 1 {
-		params.Page = 1
-	}
-	if params.PageSize < 1 || params.PageSize > 100 {
-		params.PageSize = 20
+// userFilterClause WHERE условие списка пользователей по фильтрам (поиск, роль, активность, отдел,
+// дополнительные поля, теги, доступ)
+// и его аргументы; следующие параметры запроса нумеруются с len(args)+1
+func userFilterClause(params PaginationParams) (string, []interface{}) {
+	whereConditions := []string{notDeleted}
+	if params.Deleted {
+		whereConditions[0] = "deleted_at IS NOT NULL"
 	}
-	if params.SortBy == "" {
-		params.SortBy = "created_at"
-	}
-
-	// ✅ ЗАЩИТА ОТ SQL INJECTION: проверяем поле сортировки
-	if !allowedSortFields[params.SortBy] {
-		log.Printf("WARNING: Attempted to sort by invalid field: %s", params.SortBy)
-		params.SortBy = "created_at" // Fallback на безопасное поле
-	}
-
-	// Определяем направление сортировки
-	sortOrder := "ASC"
-	if params.SortDesc {
-		sortOrder = "DESC"
-	}
-
-	// Вычисляем offset
-	offset := (params.Page - 1) * params.PageSize
-
-	// Строим WHERE условия для фильтрации
-	whereConditions := []string{}
 	args := []interface{}{}
 	argCounter := 1
 
-	// Поиск по имени, username, email, телефону
-	if params.Search != "" {
-		searchPattern := "%" + strings.ToLower(params.Search) + "%"
-		whereConditions = append(whereConditions, fmt.Sprintf(`(
-			LOWER(full_name) LIKE $%d OR
-			LOWER(username) LIKE $%d OR
-			LOWER(emails::text) LIKE $%d OR
-			LOWER(phones::text) LIKE $%d
-		)`, argCounter, argCounter, argCounter, argCounter))
-		args = append(args, searchPattern)
-		argCounter++
+	// Поиск по имени, username, email, телефону (первый фильтр: на его параметры ссылается userOrderBy)
+	if strings.TrimSpace(params.Search) != "" {
+		condition, _, searchArgs := userSearchClause(params.Search, argCounter)
+		whereConditions = append(whereConditions, condition)
+		args = append(args, searchArgs...)
+		argCounter += len(searchArgs)
 	}
 
 	// Фильтр по роли
@@ -173,12 +161,114 @@ func (r *UserRepository) GetAllPaginatedLight(params PaginationParams) (*Paginat
 		argCounter++
 	}
 
+	// Фильтр по дополнительным полям (GIN индекс idx_users_custom_fields)
+	if len(params.CustomFields) > 0 {
+		whereConditions = append(whereConditions, fmt.Sprintf("custom_fields @> $%d::jsonb", argCounter))
+		args = append(args, params.CustomFields)
+		argCounter++
+	}
+
+	// Фильтр по тегам (GIN индекс idx_users_tags)
+	if len(params.TagsAny) > 0 {
+		whereConditions = append(whereConditions, fmt.Sprintf("tags ?| $%d", argCounter))
+		args = append(args, pq.Array(params.TagsAny))
+		argCounter++
+	}
+	if len(params.TagsAll) > 0 {
+		whereConditions = append(whereConditions, fmt.Sprintf("tags ?& $%d", argCounter))
+		args = append(args, pq.Array(params.TagsAll))
+		argCounter++
+	}
+
+	// Ограничение доступными пользователями (модератор)
+	if params.AccessibleTo > 0 {
+		whereConditions = append(whereConditions, accessibleToCondition(argCounter))
+		args = append(args, params.AccessibleTo)
+	}
+
 	// Собираем WHERE clause
-	whereClause := ""
-	if len(whereConditions) > 0 {
-		whereClause = "WHERE " + strings.Join(whereConditions, " AND ")
+	whereClause := "WHERE " + strings.Join(whereConditions, " AND ")
+	return whereClause, args
+}
+
+// userSearchClause условие поиска и выражение его релевантности, параметры нумеруются с argStart.
+// Слова ищутся по началу (search_vector), подстрока и опечатки с транслитерацией - через pg_trgm
+// (search_text), телефон - по цифрам (phone_digits). Все поля заполняет триггер (миграция 019)
+func userSearchClause(search string, argStart int) (string, string, []interface{}) {
+	term := strings.ToLower(strings.TrimSpace(search))
+	conditions := []string{}
+	ranks := []string{}
+	args := []interface{}{}
+	arg := argStart
+
+	words := strings.FieldsFunc(term, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	if len(words) > 0 {
+		conditions = append(conditions, fmt.Sprintf("search_vector @@ to_tsquery('simple', $%d)", arg))
+		ranks = append(ranks, fmt.Sprintf("ts_rank(search_vector, to_tsquery('simple', $%d))", arg))
+		args = append(args, strings.Join(words, ":* & ")+":*")
+		arg++
+	}
+
+	conditions = append(conditions,
+		fmt.Sprintf("search_text LIKE $%d", arg),
+		fmt.Sprintf("translit_kk_ru($%d) <%% search_text", arg+1))
+	ranks = append(ranks, fmt.Sprintf("word_similarity(translit_kk_ru($%d), search_text)", arg+1))
+	args = append(args, "%"+term+"%", term)
+	arg += 2
+
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, term)
+	if len(digits) >= 3 {
+		conditions = append(conditions, fmt.Sprintf("phone_digits LIKE $%d", arg))
+		args = append(args, "%"+digits+"%")
+	}
+
+	return "(" + strings.Join(conditions, " OR ") + ")", strings.Join(ranks, " + "), args
+}
+
+// userOrderBy ORDER BY списка пользователей: поле из whitelist или релевантность поиска
+func userOrderBy(params PaginationParams) string {
+	if params.SortBy == SortByRelevance && strings.TrimSpace(params.Search) != "" {
+		_, rank, _ := userSearchClause(params.Search, 1)
+		return rank + " DESC, full_name ASC"
+	}
+
+	sortBy := params.SortBy
+	// ✅ ЗАЩИТА ОТ SQL INJECTION: проверяем поле сортировки
+	if !allowedSortFields[sortBy] {
+		if sortBy != "" && sortBy != SortByRelevance {
+			log.Printf("WARNING: Attempted to sort by invalid field: %s", sortBy)
+		}
+		sortBy = "created_at" // Fallback на безопасное поле
+	}
+	if params.SortDesc {
+		return sortBy + " DESC"
+	}
+	return sortBy + " ASC"
+}
+
+// GetAllPaginatedLight возвращает облегченный список пользователей с пагинацией (БЕЗ JSONB полей)
+// Оптимизировано для списков - выбирает только необходимые поля
+func (r *UserRepository) GetAllPaginatedLight(params PaginationParams) (*PaginatedListResult, error) {
+	// Устанавливаем значения по умолчанию
+	if params.Page < 1 {
+		params.Page = 1
+	}
+	if params.PageSize < 1 || params.PageSize > 100 {
+		params.PageSize = 20
 	}
 
+	// Вычисляем offset
+	offset := (params.Page - 1) * params.PageSize
+
+	// Строим WHERE условия для фильтрации
+	whereClause, args := userFilterClause(params)
+	argCounter := len(args) + 1
+
 	// Получаем общее количество пользователей с учетом фильтров
 	var total int
 	countQuery := "SELECT COUNT(*) FROM users " + whereClause
@@ -202,11 +292,11 @@ func (r *UserRepository) GetAllPaginatedLight(params PaginationParams) (*Paginat
 		       COALESCE(position, '') as position,
 		       COALESCE(department, '') as department,
 		       role, is_active, is_online, last_seen, created_at,
-		       show_in_selection, require_password_change
+		       show_in_selection, require_password_change, deleted_at, deleted_by
 		FROM users
 		%s
-		ORDER BY %s %s
-		LIMIT $%d OFFSET $%d`, whereClause, params.SortBy, sortOrder, argCounter, argCounter+1)
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, whereClause, userOrderBy(params), argCounter, argCounter+1)
 
 	err = r.db.Select(&users, query, limitOffsetArgs...)
 	if err != nil {
@@ -226,6 +316,85 @@ func (r *UserRepository) GetAllPaginatedLight(params PaginationParams) (*Paginat
 	}, nil
 }
 
+// UserSearchItem пользователь в подсказках поиска
+type UserSearchItem struct {
+	ID         int    `json:"id" db:"id"`
+	FullName   string `json:"full_name" db:"full_name"`
+	Username   string `json:"username" db:"username"`
+	AvatarURL  string `json:"avatar_url" db:"avatar_url"`
+	Position   string `json:"position" db:"position"`
+	Department string `json:"department" db:"department"`
+	IsActive   bool   `json:"is_active" db:"is_active"`
+}
+
+// SearchSuggestions подсказки поиска: самые релевантные пользователи, без подсчёта общего числа.
+// accessibleTo > 0 - только пользователи, доступные ему
+func (r *UserRepository) SearchSuggestions(search string, accessibleTo, limit int) ([]UserSearchItem, error) {
+	params := PaginationParams{Search: search, AccessibleTo: accessibleTo, SortBy: SortByRelevance}
+	whereClause, args := userFilterClause(params)
+	query := fmt.Sprintf(`
+		SELECT id, full_name, username,
+		       COALESCE(avatar_url, '') as avatar_url,
+		       COALESCE(position, '') as position,
+		       COALESCE(department, '') as department,
+		       is_active
+		FROM users
+		%s
+		ORDER BY %s, id
+		LIMIT $%d`, whereClause, userOrderBy(params), len(args)+1)
+
+	users := []UserSearchItem{}
+	if err := r.db.Select(&users, query, append(args, limit)...); err != nil {
+		log.Printf("Database error in SearchSuggestions: %v", err)
+		return nil, err
+	}
+	return users, nil
+}
+
+// EachFiltered вызывает fn для каждого пользователя, подходящего под фильтры списка (страница не учитывается).
+// Строки читаются курсором, без загрузки всего результата в память; ошибка fn прерывает обход
+func (r *UserRepository) EachFiltered(params PaginationParams, fn func(user *models.User) error) error {
+	whereClause, args := userFilterClause(params)
+	// accessible_users не выбирается: подзапрос на каждую строку выгрузке не нужен
+	query := fmt.Sprintf(`SELECT id, full_name, username, avatar_url, require_password_change, disable_password_change,
+	          show_in_selection, available_organizations, emails, phones,
+	          position, department, birth_date, address, city, country, postal_code, social_links,
+	          timezone, work_hours, comment, custom_fields, tags, is_active, blocked_reason,
+	          blocked_at, blocked_by, role, is_first_login, is_online, last_seen, created_by,
+	          updated_by, created_at, updated_at, token_version, is_service_account
+	          FROM users %s ORDER BY %s, id`, whereClause, userOrderBy(params))
+
+	rows, err := r.db.Queryx(query, args...)
+	if err != nil {
+		log.Printf("Database error in EachFiltered: %v", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user models.User
+		if err := rows.StructScan(&user); err != nil {
+			return err
+		}
+		if err := fn(&user); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// FilteredIDs ID пользователей, подходящих под фильтры списка, по возрастанию; не больше limit
+func (r *UserRepository) FilteredIDs(params PaginationParams, limit int) ([]int, error) {
+	whereClause, args := userFilterClause(params)
+	query := fmt.Sprintf("SELECT id FROM users %s ORDER BY id LIMIT $%d", whereClause, len(args)+1)
+
+	ids := []int{}
+	if err := r.db.Select(&ids, query, append(args, limit)...); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
 // GetAllPaginated возвращает список пользователей с пагинацией
 func (r *UserRepository) GetAllPaginated(params PaginationParams) (*PaginatedResult, error) {
 	// Устанавливаем значения по умолчанию
@@ -256,7 +425,7 @@ func (r *UserRepository) GetAllPaginated(params PaginationParams) (*PaginatedRes
 
 	// Получаем общее количество пользователей
 	var total int
-	countQuery := "SELECT COUNT(*) FROM users"
+	countQuery := "SELECT COUNT(*) FROM users WHERE " + notDeleted
 	err := r.db.Get(&total, countQuery)
 	if err != nil {
 		log.Printf("Database error counting users: %v", err)
@@ -266,12 +435,12 @@ func (r *UserRepository) GetAllPaginated(params PaginationParams) (*PaginatedRes
 	// Получаем пользователей с пагинацией
 	var users []models.User
 	query := fmt.Sprintf(`SELECT id, full_name, username, avatar_url, require_password_change, disable_password_change,
-	          show_in_selection, available_organizations, accessible_users, emails, phones,
+	          show_in_selection, available_organizations, ` + accessibleUsersColumn + `, emails, phones,
 	          position, department, birth_date, address, city, country, postal_code, social_links,
 	          timezone, work_hours, comment, custom_fields, tags, is_active, blocked_reason,
 	          blocked_at, blocked_by, role, is_first_login, is_online, last_seen, created_by,
-	          updated_by, created_at, updated_at, token_version
-	          FROM users ORDER BY %s %s LIMIT $1 OFFSET $2`, params.SortBy, sortOrder)
+	          updated_by, created_at, updated_at, token_version, is_service_account
+	          FROM users WHERE `+notDeleted+` ORDER BY %s %s LIMIT $1 OFFSET $2`, params.SortBy, sortOrder)
 
 	err = r.db.Select(&users, query, params.PageSize, offset)
 	if err != nil {
@@ -291,73 +460,17 @@ func (r *UserRepository) GetAllPaginated(params PaginationParams) (*PaginatedRes
 	}, nil
 }
 
-// GetAccessibleUsers возвращает список пользователей, доступных для модератора
-func (r *UserRepository) GetAccessibleUsers(moderatorID int) ([]models.User, error) {
-	moderator, err := r.GetByID(moderatorID)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(moderator.AccessibleUsers) == 0 {
-		return []models.User{}, nil
-	}
-
-	var users []models.User
-	// ВАЖНО: не включаем password в SELECT для списка
-	query := `SELECT id, full_name, username, avatar_url, require_password_change, disable_password_change,
-	          show_in_selection, available_organizations, accessible_users, emails, phones,
-	          position, department, birth_date, address, city, country, postal_code, social_links,
-	          timezone, work_hours, comment, custom_fields, tags, is_active, blocked_reason,
-	          blocked_at, blocked_by, role, is_first_login, is_online, last_seen, created_by,
-	          updated_by, created_at, updated_at, token_version
-	          FROM users WHERE id = ANY($1::int[]) ORDER BY created_at DESC`
-
-	err = r.db.Select(&users, query, pq.Array(moderator.AccessibleUsers))
-	return users, err
-}
-
-// GetAccessibleUsersLight возвращает облегченный список пользователей, доступных для модератора
-// ОПТИМИЗАЦИЯ: выбирает только основные поля для списка
-func (r *UserRepository) GetAccessibleUsersLight(moderatorID int) ([]UserListItem, error) {
-	moderator, err := r.GetByID(moderatorID)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(moderator.AccessibleUsers) == 0 {
-		return []UserListItem{}, nil
-	}
-
-	var users []UserListItem
-	// ОПТИМИЗАЦИЯ: основные поля + emails/phones, без тяжелых JSONB (social_links, custom_fields)
-	query := `
-		SELECT id, full_name, username,
-		       COALESCE(avatar_url, '') as avatar_url,
-		       COALESCE(emails, '[]'::jsonb) as emails,
-		       COALESCE(phones, '[]'::jsonb) as phones,
-		       COALESCE(position, '') as position,
-		       COALESCE(department, '') as department,
-		       role, is_active, is_online, last_seen, created_at,
-		       show_in_selection, require_password_change
-		FROM users
-		WHERE id = ANY($1::int[])
-		ORDER BY created_at DESC`
-
-	err = r.db.Select(&users, query, pq.Array(moderator.AccessibleUsers))
-	return users, err
-}
-
 // GetByID возвращает пользователя по ID (БЕЗ пароля для безопасности)
 func (r *UserRepository) GetByID(id int) (*models.User, error) {
 	var user models.User
 	// Не включаем password, т.к. это публичный метод
 	query := `SELECT id, full_name, username, avatar_url, require_password_change, disable_password_change, 
-	          show_in_selection, available_organizations, accessible_users, emails, phones, 
+	          show_in_selection, available_organizations, ` + accessibleUsersColumn + `, emails, phones, 
 	          position, department, birth_date, address, city, country, postal_code, social_links, 
 	          timezone, work_hours, comment, custom_fields, tags, is_active, blocked_reason, 
 	          blocked_at, blocked_by, role, is_first_login, is_online, last_seen, created_by, 
-	          updated_by, created_at, updated_at, token_version 
-	          FROM users WHERE id = $1`
+	          updated_by, created_at, updated_at, token_version, is_service_account
+	          FROM users WHERE id = $1 AND ` + notDeleted
 
 	err := r.db.Get(&user, query, id)
 	return &user, err
@@ -368,12 +481,12 @@ func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
 	var user models.User
 	// ВКЛЮЧАЕМ password, т.к. используется для аутентификации
 	query := `SELECT id, full_name, username, password, avatar_url, require_password_change, disable_password_change, 
-	          show_in_selection, available_organizations, accessible_users, emails, phones, 
+	          show_in_selection, available_organizations, ` + accessibleUsersColumn + `, emails, phones, 
 	          position, department, birth_date, address, city, country, postal_code, social_links, 
 	          timezone, work_hours, comment, custom_fields, tags, is_active, blocked_reason, 
 	          blocked_at, blocked_by, role, is_first_login, is_online, last_seen, created_by, 
-	          updated_by, created_at, updated_at, token_version 
-	          FROM users WHERE LOWER(username) = LOWER($1)`
+	          updated_by, created_at, updated_at, token_version, is_service_account
+	          FROM users WHERE LOWER(username) = LOWER($1) AND ` + notDeleted
 
 	err := r.db.Get(&user, query, username)
 	if err != nil {
@@ -385,8 +498,123 @@ func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
 	return &user, nil
 }
 
+// FindByEmail возвращает всех пользователей, у которых среди emails есть указанный адрес
+// Адреса хранятся в нижнем регистре, поэтому поиск использует GIN индекс idx_users_emails.
+// Несколько совпадений возможны - решение о неоднозначности принимает вызывающий код.
+func (r *UserRepository) FindByEmail(email string) ([]models.User, error) {
+	var users []models.User
+	query := `SELECT id, full_name, username, avatar_url, require_password_change, disable_password_change,
+	          show_in_selection, available_organizations, ` + accessibleUsersColumn + `, emails, phones,
+	          position, department, birth_date, address, city, country, postal_code, social_links,
+	          timezone, work_hours, comment, custom_fields, tags, is_active, blocked_reason,
+	          blocked_at, blocked_by, role, is_first_login, is_online, last_seen, created_by,
+	          updated_by, created_at, updated_at, token_version, is_service_account
+	          FROM users WHERE emails @> jsonb_build_array(LOWER($1::text)) AND ` + notDeleted + ` ORDER BY id`
+
+	err := r.db.Select(&users, query, strings.TrimSpace(email))
+	if err != nil {
+		log.Printf("Database error in FindByEmail: %v", err)
+		return nil, err
+	}
+	return users, nil
+}
+
 // Create создает нового пользователя
 func (r *UserRepository) Create(user *models.User) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertUser(tx, user); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("User created successfully - ID: %d", user.ID)
+	return nil
+}
+
+// CreateWithChangeRequest создает пользователя и запрос на подтверждение отложенных полей одной транзакцией
+func (r *UserRepository) CreateWithChangeRequest(user *models.User, request *ChangeRequest) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertUserWithChangeRequest(tx, user, request); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("User created successfully - ID: %d, change request %d", user.ID, request.ID)
+	return nil
+}
+
+// CreateBatch создает пользователей одной транзакцией: при ошибке не создается ни один.
+// requests[i] - запрос на подтверждение отложенных полей users[i] (nil или короче users - запроса нет)
+func (r *UserRepository) CreateBatch(users []*models.User, requests []*ChangeRequest) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, user := range users {
+		var request *ChangeRequest
+		if i < len(requests) {
+			request = requests[i]
+		}
+		if err := insertUserWithChangeRequest(tx, user, request); err != nil {
+			return fmt.Errorf("create user %s: %w", user.Username, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Users created successfully - %d users", len(users))
+	return nil
+}
+
+// ExistingUsernames возвращает логины из списка, которые уже заняты (без учёта регистра);
+// логин удалённого пользователя занят до окончательного удаления
+func (r *UserRepository) ExistingUsernames(usernames []string) ([]string, error) {
+	existing := []string{}
+	query := `SELECT LOWER(username) FROM users WHERE LOWER(username) = ANY($1)`
+	lower := make([]string, len(usernames))
+	for i, username := range usernames {
+		lower[i] = strings.ToLower(username)
+	}
+	err := r.db.Select(&existing, query, pq.Array(lower))
+	return existing, err
+}
+
+// insertUserWithChangeRequest создает пользователя и, если request не nil, запрос на подтверждение для него
+func insertUserWithChangeRequest(tx *sqlx.Tx, user *models.User, request *ChangeRequest) error {
+	if err := insertUser(tx, user); err != nil {
+		return err
+	}
+	if request == nil {
+		return nil
+	}
+	request.TargetUserID = user.ID
+	if err := insertChangeRequest(tx, request); err != nil {
+		return fmt.Errorf("create change request: %w", err)
+	}
+	return nil
+}
+
+// insertUser добавляет пользователя и его доступы в рамках транзакции
+func insertUser(tx *sqlx.Tx, user *models.User) error {
 	var hashedPassword *string
 
 	// Хешируем пароль только если он задан
@@ -413,14 +641,15 @@ func (r *UserRepository) Create(user *models.User) error {
 	query := `
         INSERT INTO users (
             full_name, username, password, avatar_url, require_password_change, disable_password_change, 
-            show_in_selection, available_organizations, accessible_users, emails, phones, 
+            show_in_selection, available_organizations, emails, phones, 
             position, department, birth_date, address, city, country, postal_code, social_links, 
-            timezone, work_hours, comment, custom_fields, tags, is_active, role, is_first_login, created_by
+            timezone, work_hours, comment, custom_fields, tags, is_active, role, is_first_login, created_by,
+            is_service_account
         ) 
         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28) 
         RETURNING id, created_at, updated_at`
 
-	err := r.db.QueryRow(query,
+	err := tx.QueryRow(query,
 		user.FullName,
 		user.Username,
 		hashedPassword,
@@ -429,7 +658,6 @@ func (r *UserRepository) Create(user *models.User) error {
 		user.DisablePasswordChange,
 		user.ShowInSelection,
 		user.AvailableOrganizations,
-		user.AccessibleUsers,
 		user.Emails,
 		user.Phones,
 		nullStringToInterface(user.Position),
@@ -449,6 +677,7 @@ func (r *UserRepository) Create(user *models.User) error {
 		user.Role,
 		user.IsFirstLogin,
 		nullIntToInterface(user.CreatedBy),
+		user.IsServiceAccount,
 	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
@@ -456,7 +685,12 @@ func (r *UserRepository) Create(user *models.User) error {
 		return err
 	}
 
-	log.Printf("User created successfully - ID: %d", user.ID)
+	if len(user.AccessibleUsers) > 0 {
+		if err := replaceUserGrants(tx, user.ID, user.AccessibleUsers, nullIntToInterface(user.CreatedBy)); err != nil {
+			log.Printf("Failed to create access grants for user %d: %v", user.ID, err)
+			return err
+		}
+	}
 	return nil
 }
 
@@ -482,8 +716,61 @@ func nullTimeToInterface(nt models.NullTime) interface{} {
 	return nil
 }
 
-// Update обновляет данные пользователя
-func (r *UserRepository) Update(id int, updates models.UpdateUserRequest, updatedByUserID int) error {
+// Update обновляет данные пользователя и возвращает изменённые поля (значения до и после, без хеша пароля)
+func (r *UserRepository) Update(id int, updates models.UpdateUserRequest, updatedByUserID int) (UserChanges, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotUser(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := updateUser(tx, before, updates, updatedByUserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// UpdateWithChangeRequest сохраняет запрос на подтверждение отложенных изменений и применяет остальные (updates,
+// nil - применять нечего) одной транзакцией: при ошибке не остаётся ни изменений, ни запроса
+func (r *UserRepository) UpdateWithChangeRequest(id int, updates *models.UpdateUserRequest, request *ChangeRequest, updatedByUserID int) (UserChanges, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotUser(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertChangeRequest(tx, request); err != nil {
+		return nil, fmt.Errorf("create change request: %w", err)
+	}
+
+	var changes UserChanges
+	if updates != nil {
+		if changes, err = updateUser(tx, before, *updates, updatedByUserID); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// updateUser применяет изменения внутри транзакции; before - пользователь до изменения (snapshotUser)
+func updateUser(tx *sqlx.Tx, before *models.User, updates models.UpdateUserRequest, updatedByUserID int) (UserChanges, error) {
+	id := before.ID
 	setParts := []string{}
 	args := []interface{}{}
 	argIndex := 1
@@ -515,7 +802,7 @@ func (r *UserRepository) Update(id int, updates models.UpdateUserRequest, update
 	if updates.Password != "" {
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(updates.Password), bcrypt.DefaultCost)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		setParts = append(setParts, fmt.Sprintf("password = $%d", argIndex))
 		args = append(args, string(hashedPassword))
@@ -559,12 +846,6 @@ func (r *UserRepository) Update(id int, updates models.UpdateUserRequest, update
 		argIndex++
 	}
 
-	if len(updates.AccessibleUsers) > 0 {
-		setParts = append(setParts, fmt.Sprintf("accessible_users = $%d", argIndex))
-		args = append(args, updates.AccessibleUsers)
-		argIndex++
-	}
-
 	// Контактная информация - НЕ требует инвалидации токена
 	if len(updates.Emails) > 0 {
 		setParts = append(setParts, fmt.Sprintf("emails = $%d", argIndex))
@@ -713,7 +994,7 @@ func (r *UserRepository) Update(id int, updates models.UpdateUserRequest, update
 	argIndex++
 
 	if len(setParts) == 0 {
-		return fmt.Errorf("nothing to update")
+		return nil, fmt.Errorf("nothing to update")
 	}
 
 	// Добавляем ID пользователя в конец
@@ -725,15 +1006,183 @@ func (r *UserRepository) Update(id int, updates models.UpdateUserRequest, update
 	log.Printf("Update query: %s", query)
 	log.Printf("Update args: %v", args)
 
-	_, err := r.db.Exec(query, args...)
-	return err
+	if _, err := tx.Exec(query, args...); err != nil {
+		return nil, err
+	}
+
+	// Доступные пользователи хранятся в user_access_grants
+	if len(updates.AccessibleUsers) > 0 {
+		if err := replaceUserGrants(tx, id, updates.AccessibleUsers, updatedByUserID); err != nil {
+			return nil, err
+		}
+	}
+
+	after, err := snapshotUser(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	return DiffUsers(before, after), nil
 }
 
-// Delete удаляет пользователя
-func (r *UserRepository) Delete(id int) error {
-	query := "DELETE FROM users WHERE id = $1"
-	_, err := r.db.Exec(query, id)
-	return err
+// UpdateBatch изменяет нескольких пользователей одной транзакцией: ошибка любого изменения откатывает все.
+// build получает пользователя до изменения и возвращает запрос; ok == false - пользователь не меняется.
+// Запрос на подтверждение, если build его вернул, сохраняется в той же транзакции.
+// Результат - изменения по ID найденных пользователей (nil для неизменённых); отсутствующих ID в нём нет
+func (r *UserRepository) UpdateBatch(ids []int, updatedByUserID int, build func(current *models.User) (models.UpdateUserRequest, *ChangeRequest, bool)) (map[int]UserChanges, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Блокировка строк в порядке ID: параллельные массовые операции не взаимоблокируются
+	var found []int
+	if err := tx.Select(&found, `SELECT id FROM users WHERE id = ANY($1) AND `+notDeleted+` ORDER BY id FOR UPDATE`, pq.Array(ids)); err != nil {
+		return nil, err
+	}
+
+	results := make(map[int]UserChanges, len(found))
+	for _, id := range found {
+		current, err := snapshotUser(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		updates, request, ok := build(current)
+		if request != nil {
+			if err := insertChangeRequest(tx, request); err != nil {
+				return nil, fmt.Errorf("create change request for user %d: %w", id, err)
+			}
+		}
+		if !ok {
+			results[id] = nil
+			continue
+		}
+		if results[id], err = updateUser(tx, current, updates, updatedByUserID); err != nil {
+			return nil, fmt.Errorf("update user %d: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Delete удаляет пользователя в корзину: запись и ссылки на неё сохраняются, а сессии и API ключи
+// перестают действовать (версия токена, выборки без удалённых). false - пользователь не найден или уже удалён
+func (r *UserRepository) Delete(id int, deletedBy int) (bool, error) {
+	query := `UPDATE users SET deleted_at = NOW(), deleted_by = $2, is_online = false,
+	          token_version = token_version + 1
+	          WHERE id = $1 AND ` + notDeleted
+	result, err := r.db.Exec(query, id, deletedBy)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// Restore возвращает пользователя из корзины; false - пользователя нет в корзине
+func (r *UserRepository) Restore(id int, restoredBy int) (bool, error) {
+	query := `UPDATE users SET deleted_at = NULL, deleted_by = NULL, updated_by = $2
+	          WHERE id = $1 AND deleted_at IS NOT NULL`
+	result, err := r.db.Exec(query, id, restoredBy)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ExistsIncludingDeleted проверяет, что пользователь существует, в том числе в корзине
+func (r *UserRepository) ExistsIncludingDeleted(id int) (bool, error) {
+	var exists bool
+	err := r.db.Get(&exists, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, id)
+	return exists, err
+}
+
+// GetDeletedRole возвращает роль пользователя из корзины (sql.ErrNoRows - в корзине его нет)
+func (r *UserRepository) GetDeletedRole(id int) (models.UserRole, error) {
+	var role models.UserRole
+	err := r.db.Get(&role, `SELECT role FROM users WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+	return role, err
+}
+
+// CanModeratorAccessDeletedUser проверяет доступ модератора к пользователю из корзины
+func (r *UserRepository) CanModeratorAccessDeletedUser(moderatorID, targetUserID int) (bool, error) {
+	var canAccess bool
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE id = $2 AND deleted_at IS NOT NULL AND ` + accessibleToCondition(1) + `)`
+	err := r.db.Get(&canAccess, query, moderatorID, targetUserID)
+	return canAccess, err
+}
+
+// PurgedUser пользователь, удалённый окончательно
+type PurgedUser struct {
+	ID        int       `db:"id"`
+	Username  string    `db:"username"`
+	DeletedAt time.Time `db:"deleted_at"`
+	DeletedBy *int      `db:"deleted_by"`
+}
+
+// PurgeDeleted окончательно удаляет пользователей, удалённых в корзину раньше cutoff;
+// после этого их логины снова можно занять
+func (r *UserRepository) PurgeDeleted(cutoff time.Time) ([]PurgedUser, error) {
+	purged := []PurgedUser{}
+	query := `DELETE FROM users WHERE deleted_at < $1 RETURNING id, username, deleted_at, deleted_by`
+	err := r.db.Select(&purged, query, cutoff)
+	return purged, err
+}
+
+// PersonalDataUser пользователь для выгрузки и обезличивания персональных данных (в том числе из корзины)
+type PersonalDataUser struct {
+	models.User
+	DeletedAt    models.NullTime `json:"deleted_at" db:"deleted_at"`
+	DeletedBy    models.NullInt  `json:"deleted_by" db:"deleted_by"`
+	AnonymizedAt models.NullTime `json:"anonymized_at" db:"anonymized_at"`
+	AnonymizedBy models.NullInt  `json:"anonymized_by" db:"anonymized_by"`
+}
+
+// GetPersonalData возвращает пользователя по ID без пароля, включая удалённых в корзину
+func (r *UserRepository) GetPersonalData(id int) (*PersonalDataUser, error) {
+	var user PersonalDataUser
+	query := `SELECT id, full_name, username, avatar_url, require_password_change, disable_password_change,
+	          show_in_selection, available_organizations, ` + accessibleUsersColumn + `, emails, phones,
+	          position, department, birth_date, address, city, country, postal_code, social_links,
+	          timezone, work_hours, comment, custom_fields, tags, is_active, blocked_reason,
+	          blocked_at, blocked_by, role, is_first_login, is_online, last_seen, created_by,
+	          updated_by, created_at, updated_at, token_version, is_service_account,
+	          deleted_at, deleted_by, anonymized_at, anonymized_by
+	          FROM users WHERE id = $1`
+
+	err := r.db.Get(&user, query, id)
+	return &user, err
+}
+
+// Anonymize необратимо стирает персональные данные пользователя: ФИО заменяется на обезличенное,
+// контакты, дата рождения, адрес, соцсети и аватар очищаются. ID, логин и записи журнала аудита
+// сохраняются, чтобы ссылки на пользователя оставались целыми.
+// anonymizedBy 0 - обезличивание утилитой без пользователя.
+// Возвращает прежний avatar_url (файл удаляет вызывающий код); false - пользователь не найден или уже обезличен
+func (r *UserRepository) Anonymize(id int, anonymizedBy int) (string, bool, error) {
+	var avatarURL models.NullString
+	query := `WITH old AS (
+	              SELECT id, avatar_url FROM users WHERE id = $1 AND anonymized_at IS NULL FOR UPDATE
+	          )
+	          UPDATE users u SET full_name = 'Обезличенный пользователь ' || u.id,
+	              emails = '[]'::jsonb, phones = '[]'::jsonb, birth_date = NULL, address = NULL,
+	              social_links = '{}'::jsonb, avatar_url = NULL, is_online = false,
+	              token_version = u.token_version + 1, updated_by = NULLIF($2, 0),
+	              anonymized_at = NOW(), anonymized_by = NULLIF($2, 0)
+	          FROM old WHERE u.id = old.id
+	          RETURNING old.avatar_url`
+	err := r.db.Get(&avatarURL, query, id, anonymizedBy)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return avatarURL.String, true, nil
 }
 
 // SetOnlineStatus устанавливает онлайн статус
@@ -750,20 +1199,58 @@ func (r *UserRepository) IncrementTokenVersion(userID int) error {
 	return err
 }
 
-// CanModeratorAccessUser проверяет доступ модератора к пользователю
-func (r *UserRepository) CanModeratorAccessUser(moderatorID, targetUserID int) (bool, error) {
-	moderator, err := r.GetByID(moderatorID)
+// DeactivateUser блокирует пользователя без указания администратора (например, при синхронизации с каталогом)
+// Возвращает false, если пользователь уже был заблокирован
+func (r *UserRepository) DeactivateUser(id int, reason string) (bool, error) {
+	query := `UPDATE users SET is_active = false, blocked_at = NOW(), blocked_by = NULL, blocked_reason = $1,
+	          token_version = token_version + 1
+	          WHERE id = $2 AND is_active = true`
+	result, err := r.db.Exec(query, reason, id)
 	if err != nil {
 		return false, err
 	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
 
-	for _, id := range moderator.AccessibleUsers {
-		if id == targetUserID {
-			return true, nil
-		}
+// ApplyDirectoryAttributes устанавливает роль и организации из внешнего каталога
+// Токен инвалидируется только если роль действительно изменилась
+func (r *UserRepository) ApplyDirectoryAttributes(id int, role models.UserRole, orgs models.Organizations) error {
+	query := `UPDATE users SET role = $1, available_organizations = $2,
+	          token_version = CASE WHEN role <> $1 THEN token_version + 1 ELSE token_version END
+	          WHERE id = $3 AND (role <> $1 OR available_organizations <> $2::jsonb)`
+	_, err := r.db.Exec(query, role, orgs, id)
+	return err
+}
+
+// AccessibleIDs возвращает те из ids, которые доступны пользователю granteeID
+func (r *UserRepository) AccessibleIDs(granteeID int, ids []int) (map[int]bool, error) {
+	var accessible []int
+	query := `SELECT id FROM users WHERE id = ANY($2) AND ` + notDeleted + ` AND ` + accessibleToCondition(1)
+	if err := r.db.Select(&accessible, query, granteeID, pq.Array(ids)); err != nil {
+		return nil, err
+	}
+
+	result := make(map[int]bool, len(accessible))
+	for _, id := range accessible {
+		result[id] = true
 	}
+	return result, nil
+}
 
-	return false, nil
+// GetRole возвращает роль пользователя (sql.ErrNoRows - пользователь не найден или удалён)
+func (r *UserRepository) GetRole(id int) (models.UserRole, error) {
+	var role models.UserRole
+	err := r.db.Get(&role, `SELECT role FROM users WHERE id = $1 AND `+notDeleted, id)
+	return role, err
+}
+
+// CanModeratorAccessUser проверяет доступ модератора к пользователю по действующим доступам
+func (r *UserRepository) CanModeratorAccessUser(moderatorID, targetUserID int) (bool, error) {
+	var canAccess bool
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE id = $2 AND ` + notDeleted + ` AND ` + accessibleToCondition(1) + `)`
+	err := r.db.Get(&canAccess, query, moderatorID, targetUserID)
+	return canAccess, err
 }
 
 // MarkOfflineInactiveUsers помечает неактивных пользователей как оффлайн
@@ -778,12 +1265,12 @@ func (r *UserRepository) getByIDWithPassword(id int) (*models.User, error) {
 	var user models.User
 	// ВКЛЮЧАЕМ password для проверки
 	query := `SELECT id, full_name, username, password, avatar_url, require_password_change, disable_password_change, 
-	          show_in_selection, available_organizations, accessible_users, emails, phones, 
+	          show_in_selection, available_organizations, ` + accessibleUsersColumn + `, emails, phones, 
 	          position, department, birth_date, address, city, country, postal_code, social_links, 
 	          timezone, work_hours, comment, custom_fields, tags, is_active, blocked_reason, 
 	          blocked_at, blocked_by, role, is_first_login, is_online, last_seen, created_by, 
-	          updated_by, created_at, updated_at, token_version 
-	          FROM users WHERE id = $1`
+	          updated_by, created_at, updated_at, token_version, is_service_account
+	          FROM users WHERE id = $1 AND ` + notDeleted
 
 	err := r.db.Get(&user, query, id)
 	return &user, err
@@ -0,0 +1,160 @@
+package repositories
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// UserChanges изменённые поля пользователя (ключ - имя поля в JSON)
+type UserChanges map[string]models.FieldChange
+
+// Хеш пароля в журнал не попадает: вместо значения - признак, что пароль задан
+const maskedPassword = "***"
+
+// PersonalDataFields персональные данные профиля, которые стираются при обезличивании.
+// Журнал аудита только дополняется и пересылается во внешние системы, поэтому значения этих полей
+// в diff не пишутся: как и для пароля, только признак, что поле заполнено
+var PersonalDataFields = []string{"full_name", "emails", "phones", "birth_date", "address", "social_links", "avatar_url"}
+
+var personalDataFields = func() map[string]bool {
+	fields := make(map[string]bool, len(PersonalDataFields))
+	for _, field := range PersonalDataFields {
+		fields[field] = true
+	}
+	return fields
+}()
+
+// Поля, которые меняются как следствие других изменений или служебные - в diff не включаются
+var untrackedUserFields = map[string]bool{
+	"id":         true,
+	"is_online":  true,
+	"last_seen":  true,
+	"blocked_at": true,
+	"blocked_by": true,
+	"created_by": true,
+	"created_at": true,
+	"updated_by": true,
+	"updated_at": true,
+}
+
+const userSnapshotQuery = `SELECT id, full_name, username, password, avatar_url, require_password_change, disable_password_change,
+	show_in_selection, available_organizations, ` + accessibleUsersColumn + `, emails, phones,
+	position, department, birth_date, address, city, country, postal_code, social_links,
+	timezone, work_hours, comment, custom_fields, tags, is_active, blocked_reason,
+	blocked_at, blocked_by, role, is_first_login, is_online, last_seen, created_by,
+	updated_by, created_at, updated_at, token_version, is_service_account
+	FROM users WHERE id = $1 AND ` + notDeleted
+
+// snapshotUser читает пользователя внутри транзакции изменения
+func snapshotUser(tx *sqlx.Tx, id int) (*models.User, error) {
+	var user models.User
+	if err := tx.Get(&user, userSnapshotQuery, id); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DiffUsers сравнивает пользователя до и после изменения
+func DiffUsers(before, after *models.User) UserChanges {
+	changes := UserChanges{}
+
+	beforeValue := reflect.ValueOf(*before)
+	afterValue := reflect.ValueOf(*after)
+	userType := beforeValue.Type()
+	for i := 0; i < userType.NumField(); i++ {
+		name := strings.Split(userType.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || untrackedUserFields[name] {
+			continue
+		}
+
+		oldValue, newValue := beforeValue.Field(i).Interface(), afterValue.Field(i).Interface()
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		if personalDataFields[name] {
+			changes[name] = models.FieldChange{Old: maskPersonalData(beforeValue.Field(i)), New: maskPersonalData(afterValue.Field(i))}
+			continue
+		}
+		changes[name] = models.FieldChange{Old: oldValue, New: newValue}
+	}
+
+	if before.Password != after.Password {
+		changes["password"] = models.FieldChange{Old: maskPassword(before.Password), New: maskPassword(after.Password)}
+	}
+	return changes
+}
+
+func maskPassword(password models.NullString) interface{} {
+	if !password.Valid || password.String == "" {
+		return nil
+	}
+	return maskedPassword
+}
+
+// maskPersonalData заменяет значение персонального поля признаком, что оно заполнено (nil - пусто)
+func maskPersonalData(value reflect.Value) interface{} {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map:
+		if value.Len() == 0 {
+			return nil
+		}
+	default:
+		if value.IsZero() {
+			return nil
+		}
+	}
+	return maskedPassword
+}
+
+// AuditRecord запись журнала аудита по изменениям пользователя
+type AuditRecord struct {
+	Action  string
+	Details map[string]interface{}
+}
+
+// AuditRecords раскладывает изменения на записи журнала: блокировка и разблокировка - отдельными
+// действиями block_user / unblock_user, остальные поля - одной записью action с diff в details.changes
+func (c UserChanges) AuditRecords(action string) []AuditRecord {
+	rest := UserChanges{}
+	for field, change := range c {
+		rest[field] = change
+	}
+
+	records := []AuditRecord{}
+	if change, ok := rest["is_active"]; ok {
+		delete(rest, "is_active")
+		record := AuditRecord{Action: ActionUnblockUser, Details: map[string]interface{}{}}
+		if active, _ := change.New.(bool); !active {
+			record.Action = ActionBlockUser
+			if reason, ok := rest["blocked_reason"]; ok {
+				record.Details["reason"] = reason.New
+			}
+		}
+		delete(rest, "blocked_reason")
+		records = append(records, record)
+	}
+
+	if len(rest) > 0 {
+		records = append(records, AuditRecord{Action: action, Details: map[string]interface{}{"changes": rest}})
+	}
+	return records
+}
+
+// AuditRecord сводит изменения в одну запись журнала (массовые операции - одна запись на пользователя):
+// при блокировке или разблокировке действие block_user / unblock_user, остальные поля - в details.changes
+func (c UserChanges) AuditRecord(action string) AuditRecord {
+	records := c.AuditRecords(action)
+	if len(records) == 0 {
+		return AuditRecord{Action: action, Details: map[string]interface{}{}}
+	}
+	record := records[0]
+	for _, other := range records[1:] {
+		for key, value := range other.Details {
+			record.Details[key] = value
+		}
+	}
+	return record
+}
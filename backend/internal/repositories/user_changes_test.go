@@ -0,0 +1,98 @@
+package repositories
+
+import (
+	"testing"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+)
+
+// TestDiffUsers проверяет diff полей и маскирование пароля и персональных данных
+func TestDiffUsers(t *testing.T) {
+	before := &models.User{
+		ID:       5,
+		Username: "ivanov",
+		FullName: "Иванов И.",
+		Password: models.NullString{String: "hash1", Valid: true},
+		Role:     models.RoleUser,
+		IsActive: true,
+	}
+	after := *before
+	after.FullName = "Иванов Иван"
+	after.Password = models.NullString{String: "hash2", Valid: true}
+	after.IsOnline = true
+	after.Emails = models.Emails{"ivanov@example.com"}
+	after.Position = models.NullString{String: "Инженер", Valid: true}
+
+	changes := DiffUsers(before, &after)
+
+	if len(changes) != 4 {
+		t.Fatalf("Expected 4 changed fields, got %d: %v", len(changes), changes)
+	}
+	if change := changes["full_name"]; change.Old != maskedPassword || change.New != maskedPassword {
+		t.Errorf("Full name must be masked, got %+v", change)
+	}
+	if change := changes["emails"]; change.Old != nil || change.New != maskedPassword {
+		t.Errorf("Emails must be masked, got %+v", change)
+	}
+	if change := changes["position"]; change.Old != (models.NullString{}) || change.New != after.Position {
+		t.Errorf("Unexpected position change: %+v", change)
+	}
+	if change := changes["password"]; change.Old != maskedPassword || change.New != maskedPassword {
+		t.Errorf("Password hash must be masked, got %+v", change)
+	}
+}
+
+// TestAuditRecords_Block проверяет, что блокировка пишется отдельным действием
+func TestAuditRecords_Block(t *testing.T) {
+	changes := UserChanges{
+		"is_active":      {Old: true, New: false},
+		"blocked_reason": {Old: models.NullString{}, New: "Увольнение"},
+		"position":       {Old: "Инженер", New: ""},
+	}
+
+	records := changes.AuditRecords(ActionUpdateUser)
+
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	if records[0].Action != ActionBlockUser || records[0].Details["reason"] != "Увольнение" {
+		t.Errorf("Unexpected block record: %+v", records[0])
+	}
+	rest, _ := records[1].Details["changes"].(UserChanges)
+	if records[1].Action != ActionUpdateUser || len(rest) != 1 {
+		t.Errorf("Unexpected update record: %+v", records[1])
+	}
+	if len(changes) != 3 {
+		t.Errorf("AuditRecords must not modify changes")
+	}
+}
+
+// TestAuditRecords_Unblock проверяет разблокировку без прочих изменений
+func TestAuditRecords_Unblock(t *testing.T) {
+	changes := UserChanges{"is_active": {Old: false, New: true}}
+
+	records := changes.AuditRecords(ActionUpdateUser)
+
+	if len(records) != 1 || records[0].Action != ActionUnblockUser {
+		t.Errorf("Expected single unblock record, got %+v", records)
+	}
+}
+
+// TestAuditRecord_Block проверяет, что блокировка с прочими изменениями сводится в одну запись
+func TestAuditRecord_Block(t *testing.T) {
+	changes := UserChanges{
+		"is_active":      {Old: true, New: false},
+		"blocked_reason": {Old: models.NullString{}, New: "Увольнение"},
+		"position":       {Old: "Инженер", New: ""},
+	}
+
+	record := changes.AuditRecord(ActionUpdateUser)
+
+	if record.Action != ActionBlockUser || record.Details["reason"] != "Увольнение" {
+		t.Errorf("Unexpected record: %+v", record)
+	}
+	rest, _ := record.Details["changes"].(UserChanges)
+	if len(rest) != 1 {
+		t.Errorf("Expected other changes in the same record, got %+v", record.Details)
+	}
+}
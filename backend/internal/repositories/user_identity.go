@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Провайдеры внешних учётных записей
+const (
+	IdentityProviderOIDC = "oidc"
+	IdentityProviderLDAP = "ldap"
+)
+
+// UserIdentity связь пользователя с учётной записью во внешней системе
+type UserIdentity struct {
+	ID           int          `json:"id" db:"id"`
+	UserID       int          `json:"user_id" db:"user_id"`
+	Provider     string       `json:"provider" db:"provider"`
+	ExternalID   string       `json:"external_id" db:"external_id"`
+	CreatedAt    time.Time    `json:"created_at" db:"created_at"`
+	LastLoginAt  sql.NullTime `json:"last_login_at" db:"last_login_at"`
+	LastSyncedAt sql.NullTime `json:"last_synced_at" db:"last_synced_at"`
+}
+
+// UserIdentityRepository для работы с внешними учётными записями
+type UserIdentityRepository struct {
+	db *sqlx.DB
+}
+
+// NewUserIdentityRepository создает новый репозиторий
+func NewUserIdentityRepository(db *sqlx.DB) *UserIdentityRepository {
+	return &UserIdentityRepository{db: db}
+}
+
+// GetByExternalID возвращает связь по провайдеру и внешнему идентификатору (nil если не найдена)
+func (r *UserIdentityRepository) GetByExternalID(provider, externalID string) (*UserIdentity, error) {
+	var identity UserIdentity
+	query := `
+		SELECT id, user_id, provider, external_id, created_at, last_login_at, last_synced_at
+		FROM user_identities
+		WHERE provider = $1 AND external_id = $2
+	`
+	err := r.db.Get(&identity, query, provider, externalID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// ListByProvider возвращает все учётные записи провайдера
+func (r *UserIdentityRepository) ListByProvider(provider string) ([]UserIdentity, error) {
+	var identities []UserIdentity
+	query := `
+		SELECT id, user_id, provider, external_id, created_at, last_login_at, last_synced_at
+		FROM user_identities
+		WHERE provider = $1
+		ORDER BY id
+	`
+	err := r.db.Select(&identities, query, provider)
+	return identities, err
+}
+
+// ListByUser возвращает внешние учётные записи пользователя
+func (r *UserIdentityRepository) ListByUser(userID int) ([]UserIdentity, error) {
+	identities := []UserIdentity{}
+	query := `
+		SELECT id, user_id, provider, external_id, created_at, last_login_at, last_synced_at
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY id
+	`
+	err := r.db.Select(&identities, query, userID)
+	return identities, err
+}
+
+// Link привязывает внешнюю учётную запись к пользователю и отмечает время входа
+func (r *UserIdentityRepository) Link(userID int, provider, externalID string) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, external_id, last_login_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (provider, external_id)
+		DO UPDATE SET user_id = EXCLUDED.user_id, last_login_at = NOW()
+	`
+	_, err := r.db.Exec(query, userID, provider, externalID)
+	return err
+}
+
+// MarkSynced отмечает успешную синхронизацию учётной записи с каталогом
+func (r *UserIdentityRepository) MarkSynced(id int) error {
+	query := "UPDATE user_identities SET last_synced_at = NOW() WHERE id = $1"
+	_, err := r.db.Exec(query, id)
+	return err
+}
@@ -1,6 +1,8 @@
 package repositories
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -101,7 +103,7 @@ func TestGetByUsername(t *testing.T) {
 		nil, nil, time.Now(), time.Now(), 1,
 	)
 
-	mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(username\\) = LOWER\\(\\$1\\)").
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(username\\) = LOWER\\(\\$1\\) AND deleted_at IS NULL").
 		WithArgs("testuser").
 		WillReturnRows(rows)
 
@@ -134,7 +136,7 @@ func TestGetByUsernameNotFound(t *testing.T) {
 	sqlxDB := sqlx.NewDb(db, "postgres")
 	repo := NewUserRepository(sqlxDB)
 
-	mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(username\\) = LOWER\\(\\$1\\)").
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(username\\) = LOWER\\(\\$1\\) AND deleted_at IS NULL").
 		WithArgs("nonexistent").
 		WillReturnRows(sqlmock.NewRows([]string{}))
 
@@ -177,7 +179,7 @@ func TestGetAllPaginatedLight(t *testing.T) {
 		AddRow(1, "User 1", "user1", "", "Developer", "IT", "user", true, false, time.Now(), time.Now(), true, false).
 		AddRow(2, "User 2", "user2", "", "Manager", "HR", "moderator", true, true, time.Now(), time.Now(), true, false)
 
-	mock.ExpectQuery("SELECT (.+) FROM users ORDER BY (.+) LIMIT \\$1 OFFSET \\$2").
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE deleted_at IS NULL ORDER BY (.+) LIMIT \\$1 OFFSET \\$2").
 		WithArgs(20, 0).
 		WillReturnRows(userRows)
 
@@ -260,7 +262,7 @@ func TestSetOnlineStatus(t *testing.T) {
 	}
 }
 
-// TestDelete проверяет удаление пользователя
+// TestDelete проверяет, что удаление перемещает пользователя в корзину, а не удаляет запись
 func TestDelete(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -271,15 +273,50 @@ func TestDelete(t *testing.T) {
 	sqlxDB := sqlx.NewDb(db, "postgres")
 	repo := NewUserRepository(sqlxDB)
 
-	mock.ExpectExec("DELETE FROM users WHERE id = \\$1").
-		WithArgs(1).
+	mock.ExpectExec("UPDATE users SET deleted_at = NOW\\(\\), deleted_by = \\$2, (.+) WHERE id = \\$1 AND deleted_at IS NULL").
+		WithArgs(1, 2).
 		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE users SET deleted_at = NOW").
+		WithArgs(3, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	deleted, err := repo.Delete(1, 2)
+	if err != nil || !deleted {
+		t.Fatalf("Delete() = %v, %v; want true", deleted, err)
+	}
+	// Уже удалённый или несуществующий
+	if deleted, err := repo.Delete(3, 2); err != nil || deleted {
+		t.Errorf("Delete() of missing user = %v, %v; want false", deleted, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
 
-	err = repo.Delete(1)
+// TestPurgeDeleted проверяет окончательное удаление пользователей из корзины по сроку
+func TestPurgeDeleted(t *testing.T) {
+	db, mock, err := sqlmock.New()
 	if err != nil {
-		t.Fatalf("Delete() error = %v", err)
+		t.Fatalf("Failed to create mock: %v", err)
 	}
+	defer db.Close()
 
+	repo := NewUserRepository(sqlx.NewDb(db, "postgres"))
+	cutoff := time.Now().Add(-30 * 24 * time.Hour)
+
+	mock.ExpectQuery("DELETE FROM users WHERE deleted_at < \\$1 RETURNING id, username, deleted_at, deleted_by").
+		WithArgs(cutoff).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "deleted_at", "deleted_by"}).
+			AddRow(5, "ivanov", cutoff.Add(-time.Hour), 1))
+
+	purged, err := repo.PurgeDeleted(cutoff)
+	if err != nil {
+		t.Fatalf("PurgeDeleted() error = %v", err)
+	}
+	if len(purged) != 1 || purged[0].Username != "ivanov" || purged[0].DeletedBy == nil || *purged[0].DeletedBy != 1 {
+		t.Errorf("Unexpected purged users: %+v", purged)
+	}
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("Unfulfilled expectations: %v", err)
 	}
@@ -287,83 +324,174 @@ func TestDelete(t *testing.T) {
 
 // TestCanModeratorAccessUser проверяет доступ модератора к пользователю
 func TestCanModeratorAccessUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		targetID int
+		exists   bool
+	}{
+		{"Accessible user", 10, true},
+		{"Inaccessible user", 99, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create mock: %v", err)
+			}
+			defer db.Close()
+
+			repo := NewUserRepository(sqlx.NewDb(db, "postgres"))
+
+			// Доступ проверяется одним запросом по user_access_grants
+			mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM users WHERE id = \\$2 AND deleted_at IS NULL AND EXISTS(.+)FROM user_access_grants g(.+)g.grantee_id = \\$1").
+				WithArgs(1, tt.targetID).
+				WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(tt.exists))
+
+			canAccess, err := repo.CanModeratorAccessUser(1, tt.targetID)
+			if err != nil {
+				t.Fatalf("CanModeratorAccessUser() error = %v", err)
+			}
+			if canAccess != tt.exists {
+				t.Errorf("CanModeratorAccessUser() = %v, want %v", canAccess, tt.exists)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// TestGetAllPaginatedLight_AccessibleTo проверяет ограничение списка доступными пользователями в SQL
+func TestGetAllPaginatedLight_AccessibleTo(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("Failed to create mock: %v", err)
 	}
 	defer db.Close()
 
-	sqlxDB := sqlx.NewDb(db, "postgres")
-	repo := NewUserRepository(sqlxDB)
+	repo := NewUserRepository(sqlx.NewDb(db, "postgres"))
 
-	// Mock для получения модератора
-	rows := sqlmock.NewRows([]string{
-		"id", "full_name", "username", "avatar_url", "require_password_change",
-		"disable_password_change", "show_in_selection", "available_organizations",
-		"accessible_users", "emails", "phones", "position", "department",
-		"birth_date", "address", "city", "country", "postal_code", "social_links",
-		"timezone", "work_hours", "comment", "custom_fields", "tags", "is_active",
-		"blocked_reason", "blocked_at", "blocked_by", "role", "is_first_login",
-		"is_online", "last_seen", "created_by", "updated_by", "created_at",
-		"updated_at", "token_version",
-	}).AddRow(
-		1, "Moderator", "moderator", nil, false,
-		false, true, `[]`,
-		`[5, 10, 15]`, `[]`, `[]`, nil, nil,
-		nil, nil, nil, nil, nil, `{}`,
-		nil, nil, nil, `{}`, `[]`, true,
-		nil, nil, nil, "moderator", false,
-		false, time.Now(), nil, nil, time.Now(),
-		time.Now(), 1,
-	)
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE deleted_at IS NULL AND role = \\$1 AND EXISTS(.+)g.grantee_id = \\$2").
+		WithArgs("user", 7).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT (.+) FROM users(.+)g.grantee_id = \\$2(.+)LIMIT \\$3 OFFSET \\$4").
+		WithArgs("user", 7, 20, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "full_name", "username", "role"}).
+			AddRow(3, "User 3", "user3", "user"))
 
-	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").
-		WithArgs(1).
-		WillReturnRows(rows)
+	result, err := repo.GetAllPaginatedLight(PaginationParams{Role: "user", AccessibleTo: 7})
+	if err != nil {
+		t.Fatalf("GetAllPaginatedLight() error = %v", err)
+	}
+	if result.Total != 1 || len(result.Users) != 1 {
+		t.Errorf("Got total %d, %d users, want 1 and 1", result.Total, len(result.Users))
+	}
 
-	// Проверяем доступ к пользователю 10 (есть в списке)
-	canAccess, err := repo.CanModeratorAccessUser(1, 10)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestGetAllPaginatedLight_Tags проверяет фильтр по тегам через операторы GIN индекса
+func TestGetAllPaginatedLight_Tags(t *testing.T) {
+	db, mock, err := sqlmock.New()
 	if err != nil {
-		t.Fatalf("CanModeratorAccessUser() error = %v", err)
+		t.Fatalf("Failed to create mock: %v", err)
 	}
+	defer db.Close()
+
+	repo := NewUserRepository(sqlx.NewDb(db, "postgres"))
 
-	if !canAccess {
-		t.Error("CanModeratorAccessUser() should return true for accessible user")
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE deleted_at IS NULL AND tags \\?\\| \\$1 AND tags \\?& \\$2$").
+		WithArgs("{\"отдел кадров\",\"бухгалтерия\"}", "{\"удалённо\"}").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT (.+) FROM users(.+)tags \\?& \\$2(.+)LIMIT \\$3 OFFSET \\$4").
+		WithArgs("{\"отдел кадров\",\"бухгалтерия\"}", "{\"удалённо\"}", 20, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, err = repo.GetAllPaginatedLight(PaginationParams{
+		TagsAny: []string{"отдел кадров", "бухгалтерия"},
+		TagsAll: []string{"удалённо"},
+	})
+	if err != nil {
+		t.Fatalf("GetAllPaginatedLight() error = %v", err)
 	}
 
-	// Mock для проверки доступа к недоступному пользователю
-	rows2 := sqlmock.NewRows([]string{
-		"id", "full_name", "username", "avatar_url", "require_password_change",
-		"disable_password_change", "show_in_selection", "available_organizations",
-		"accessible_users", "emails", "phones", "position", "department",
-		"birth_date", "address", "city", "country", "postal_code", "social_links",
-		"timezone", "work_hours", "comment", "custom_fields", "tags", "is_active",
-		"blocked_reason", "blocked_at", "blocked_by", "role", "is_first_login",
-		"is_online", "last_seen", "created_by", "updated_by", "created_at",
-		"updated_at", "token_version",
-	}).AddRow(
-		1, "Moderator", "moderator", nil, false,
-		false, true, `[]`,
-		`[5, 10, 15]`, `[]`, `[]`, nil, nil,
-		nil, nil, nil, nil, nil, `{}`,
-		nil, nil, nil, `{}`, `[]`, true,
-		nil, nil, nil, "moderator", false,
-		false, time.Now(), nil, nil, time.Now(),
-		time.Now(), 1,
-	)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
 
-	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").
-		WithArgs(1).
-		WillReturnRows(rows2)
+// TestUserSearchClause проверяет разбор строки поиска на слова, подстроку и цифры телефона
+func TestUserSearchClause(t *testing.T) {
+	tests := []struct {
+		name          string
+		search        string
+		wantArgs      []interface{}
+		wantCondition string
+	}{
+		{
+			name:          "Words and phone digits",
+			search:        " Иванов +7 (701) ",
+			wantArgs:      []interface{}{"иванов:* & 7:* & 701:*", "%иванов +7 (701)%", "иванов +7 (701)", "%7701%"},
+			wantCondition: "phone_digits LIKE $6",
+		},
+		{
+			name:          "Short digits are not a phone",
+			search:        "Асылбек 12",
+			wantArgs:      []interface{}{"асылбек:* & 12:*", "%асылбек 12%", "асылбек 12"},
+			wantCondition: "translit_kk_ru($5) <% search_text",
+		},
+		{
+			name:          "No words",
+			search:        "@.",
+			wantArgs:      []interface{}{"%@.%", "@."},
+			wantCondition: "(search_text LIKE $3 OR translit_kk_ru($4) <% search_text)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition, rank, args := userSearchClause(tt.search, 3)
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %q, want %q", args, tt.wantArgs)
+			}
+			if !strings.Contains(condition, tt.wantCondition) {
+				t.Errorf("condition = %s, want it to contain %s", condition, tt.wantCondition)
+			}
+			if !strings.Contains(rank, "word_similarity(translit_kk_ru(") {
+				t.Errorf("rank = %s", rank)
+			}
+		})
+	}
+}
 
-	// Проверяем доступ к пользователю 99 (нет в списке)
-	canAccess, err = repo.CanModeratorAccessUser(1, 99)
+// TestGetAllPaginatedLight_SearchRelevance проверяет сортировку результатов поиска по релевантности
+func TestGetAllPaginatedLight_SearchRelevance(t *testing.T) {
+	db, mock, err := sqlmock.New()
 	if err != nil {
-		t.Fatalf("CanModeratorAccessUser() error = %v", err)
+		t.Fatalf("Failed to create mock: %v", err)
 	}
+	defer db.Close()
 
-	if canAccess {
-		t.Error("CanModeratorAccessUser() should return false for inaccessible user")
+	repo := NewUserRepository(sqlx.NewDb(db, "postgres"))
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE deleted_at IS NULL AND \\(search_vector @@ to_tsquery\\('simple', \\$1\\)(.+)\\) AND role = \\$4$").
+		WithArgs("asylbek:*", "%asylbek%", "asylbek", "user").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("ORDER BY ts_rank\\(search_vector, to_tsquery\\('simple', \\$1\\)\\) \\+ word_similarity\\(translit_kk_ru\\(\\$3\\), search_text\\) DESC, full_name ASC\\s+LIMIT \\$5 OFFSET \\$6").
+		WithArgs("asylbek:*", "%asylbek%", "asylbek", "user", 20, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "full_name", "username", "role"}).
+			AddRow(3, "Асылбек Нурланов", "asylbek", "user"))
+
+	result, err := repo.GetAllPaginatedLight(PaginationParams{Search: "Asylbek", Role: "user", SortBy: SortByRelevance})
+	if err != nil {
+		t.Fatalf("GetAllPaginatedLight() error = %v", err)
+	}
+	if result.Total != 1 || len(result.Users) != 1 {
+		t.Errorf("Got total %d, %d users, want 1 and 1", result.Total, len(result.Users))
 	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -419,7 +547,7 @@ func TestPaginationParamsDefaults(t *testing.T) {
 		"show_in_selection", "require_password_change",
 	})
 
-	mock.ExpectQuery("SELECT (.+) FROM users ORDER BY created_at ASC LIMIT \\$1 OFFSET \\$2").
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE deleted_at IS NULL ORDER BY created_at ASC LIMIT \\$1 OFFSET \\$2").
 		WithArgs(20, 0).
 		WillReturnRows(userRows)
 
@@ -467,7 +595,7 @@ func TestPaginationMaxPageSize(t *testing.T) {
 		"show_in_selection", "require_password_change",
 	})
 
-	mock.ExpectQuery("SELECT (.+) FROM users ORDER BY created_at DESC LIMIT \\$1 OFFSET \\$2").
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE deleted_at IS NULL ORDER BY created_at DESC LIMIT \\$1 OFFSET \\$2").
 		WithArgs(20, 0).
 		WillReturnRows(userRows)
 
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+)
+
+// Сколько месяцев вперёд создаются секции журнала
+const auditPartitionsAhead = 3
+
+// AuditArchiver создает месячные секции журнала аудита, выгружает устаревшие в архив и удаляет их
+type AuditArchiver struct {
+	auditLogRepo *repositories.AuditLogRepository
+	// Подписывает контрольную точку на границе каждой выгружаемой секции
+	chain *AuditChainService
+	dir   string
+	// Сколько месяцев секция хранится в базе, не считая текущего (0 - без ограничения)
+	retentionMonths int
+}
+
+// NewAuditArchiver создает архиватор (dir - каталог файлов архива)
+func NewAuditArchiver(auditLogRepo *repositories.AuditLogRepository, chain *AuditChainService, dir string, retentionMonths int) *AuditArchiver {
+	return &AuditArchiver{
+		auditLogRepo:    auditLogRepo,
+		chain:           chain,
+		dir:             dir,
+		retentionMonths: retentionMonths,
+	}
+}
+
+// EnsurePartitions создает секции текущего месяца и нескольких следующих
+func (a *AuditArchiver) EnsurePartitions(now time.Time) error {
+	month := monthStart(now)
+	for i := 0; i <= auditPartitionsAhead; i++ {
+		if err := a.auditLogRepo.EnsurePartition(month.AddDate(0, i, 0)); err != nil {
+			return fmt.Errorf("create audit partition %s: %w", repositories.AuditPartitionName(month.AddDate(0, i, 0)), err)
+		}
+	}
+	return nil
+}
+
+// Apply выгружает в архив и удаляет секции старше срока хранения; возвращает число удалённых записей
+func (a *AuditArchiver) Apply(now time.Time) (int64, error) {
+	if err := a.EnsurePartitions(now); err != nil {
+		return 0, err
+	}
+	if a.retentionMonths <= 0 {
+		return 0, nil
+	}
+
+	partitions, err := a.auditLogRepo.ListPartitions()
+	if err != nil {
+		return 0, fmt.Errorf("list audit partitions: %w", err)
+	}
+
+	// Цепочка секций продолжает последний архив; подложный архив не даст удалить секцию,
+	// потому что первая запись на него не сошлётся
+	var cursor auditChainCursor
+	last, err := a.auditLogRepo.LastArchive()
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("get last audit archive: %w", err)
+	}
+	if last != nil {
+		cursor = auditChainCursor{chained: last.LastHash.Valid, prevHash: last.LastHash.String}
+	}
+
+	list, err := a.auditLogRepo.ListCheckpoints()
+	if err != nil {
+		return 0, fmt.Errorf("list audit checkpoints: %w", err)
+	}
+	checkpoints := make(map[int]repositories.AuditCheckpoint, len(list))
+	for _, checkpoint := range list {
+		checkpoints[checkpoint.LastEntryID] = checkpoint
+	}
+
+	cutoff := monthStart(now).AddDate(0, -a.retentionMonths, 0)
+	var deleted int64
+	// Секции удаляются по порядку: оставшаяся цепочка продолжает последний архив
+	for _, partition := range partitions {
+		if !partition.Month.Before(cutoff) {
+			break
+		}
+		archive, err := a.archive(partition, &cursor, checkpoints)
+		if err != nil {
+			return deleted, fmt.Errorf("archive %s: %w", partition.Name, err)
+		}
+		if err := a.signBoundary(archive, checkpoints); err != nil {
+			return deleted, fmt.Errorf("archive %s: %w", partition.Name, err)
+		}
+		if err := a.auditLogRepo.DropPartition(partition, archive); err != nil {
+			return deleted, fmt.Errorf("drop %s: %w", partition.Name, err)
+		}
+		deleted += int64(archive.Entries)
+		log.Printf("AUDIT: Archived audit partition %s (%d entries) to %s", partition.Name, archive.Entries, archive.FilePath)
+	}
+	return deleted, nil
+}
+
+// signBoundary подписывает контрольную точку на последней записи секции, если её ещё нет:
+// проверка журнала не доверяет сведениям об архиве без такой точки
+func (a *AuditArchiver) signBoundary(archive *repositories.AuditArchive, checkpoints map[int]repositories.AuditCheckpoint) error {
+	if !archive.LastHash.Valid {
+		return nil
+	}
+	if checkpoint, ok := checkpoints[archive.LastEntryID.Int]; ok && checkpoint.LastHash == archive.LastHash.String {
+		return nil
+	}
+	checkpoint, err := a.chain.CheckpointAt(archive.LastEntryID.Int, archive.LastHash.String)
+	if err != nil {
+		return err
+	}
+	if checkpoint != nil {
+		checkpoints[checkpoint.LastEntryID] = *checkpoint
+	}
+	return nil
+}
+
+// archive проверяет цепочку секции и выгружает её в NDJSON.gz: файл пишется во временный
+// и переименовывается после fsync, чтобы секция не удалялась при неполном архиве или нарушенной цепочке
+func (a *AuditArchiver) archive(partition repositories.AuditPartition, cursor *auditChainCursor, checkpoints map[int]repositories.AuditCheckpoint) (*repositories.AuditArchive, error) {
+	if err := os.MkdirAll(a.dir, 0750); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(a.dir, partition.Name+".ndjson.gz")
+	tmp, err := os.CreateTemp(a.dir, partition.Name+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	archive := &repositories.AuditArchive{
+		PartitionName: partition.Name,
+		Month:         partition.Month,
+		FilePath:      path,
+	}
+
+	digest := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(tmp, digest))
+	encoder := json.NewEncoder(gz)
+	err = a.auditLogRepo.EachPartitionRow(partition, func(row repositories.AuditChainRow) error {
+		if reason := cursor.next(row); reason != "" {
+			return fmt.Errorf("audit chain broken at entry %d: %s", row.ID, reason)
+		}
+		if checkpoint, ok := checkpoints[row.ID]; ok && (row.Hash == nil || checkpoint.LastHash != *row.Hash) {
+			return fmt.Errorf("audit entry %d does not match signed checkpoint %d", row.ID, checkpoint.ID)
+		}
+		if !archive.FirstEntryID.Valid {
+			archive.FirstEntryID = models.NullInt{Int: row.ID, Valid: true}
+		}
+		archive.LastEntryID = models.NullInt{Int: row.ID, Valid: true}
+		archive.LastHash = models.NullString{}
+		if row.Hash != nil {
+			archive.LastHash = models.NullString{String: *row.Hash, Valid: true}
+		}
+		archive.Entries++
+		return encoder.Encode(row)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+
+	archive.FileSHA256 = hex.EncodeToString(digest.Sum(nil))
+	return archive, nil
+}
+
+// checkArchiveFile сверяет файл архива с file_sha256 и проходит его записи, продолжая цепочку cursor;
+// совпавшие контрольные точки удаляются из pending. Возвращает первое нарушение или nil
+func checkArchiveFile(archive repositories.AuditArchive, cursor *auditChainCursor, pending map[int]repositories.AuditCheckpoint) (*AuditChainBreak, error) {
+	broken := func(entryID int, reason string) *AuditChainBreak {
+		return &AuditChainBreak{ArchiveID: archive.ID, EntryID: entryID, Reason: reason}
+	}
+
+	file, err := os.Open(archive.FilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return broken(0, "Файл архива отсутствует"), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	digest := sha256.New()
+	if _, err := io.Copy(digest, file); err != nil {
+		return nil, err
+	}
+	if hex.EncodeToString(digest.Sum(nil)) != archive.FileSHA256 {
+		return broken(0, "Файл архива не совпадает с file_sha256"), nil
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return broken(0, "Файл архива повреждён"), nil
+	}
+	decoder := json.NewDecoder(gz)
+
+	entries, firstID, lastID := 0, 0, 0
+	for {
+		var row repositories.AuditChainRow
+		err := decoder.Decode(&row)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return broken(lastID, "Файл архива повреждён"), nil
+		}
+
+		if entries > 0 && row.ID <= lastID {
+			return broken(row.ID, "Записи архива идут не по порядку"), nil
+		}
+		if reason := cursor.next(row); reason != "" {
+			return broken(row.ID, reason), nil
+		}
+		if checkpoint, ok := pending[row.ID]; ok {
+			if row.Hash == nil || checkpoint.LastHash != *row.Hash {
+				return &AuditChainBreak{ArchiveID: archive.ID, EntryID: row.ID, CheckpointID: checkpoint.ID, Reason: "Хеш записи не совпадает с подписанной контрольной точкой"}, nil
+			}
+			delete(pending, row.ID)
+		}
+
+		if entries == 0 {
+			firstID = row.ID
+		}
+		lastID = row.ID
+		entries++
+	}
+
+	if entries != archive.Entries || firstID != archive.FirstEntryID.Int || lastID != archive.LastEntryID.Int ||
+		cursor.chained != archive.LastHash.Valid || (archive.LastHash.Valid && cursor.prevHash != archive.LastHash.String) {
+		return broken(lastID, "Сведения об архиве не совпадают с его файлом"), nil
+	}
+	return nil, nil
+}
+
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
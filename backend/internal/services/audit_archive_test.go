@@ -0,0 +1,145 @@
+package services
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestAuditArchiver_ArchivesAndDropsExpiredPartitions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	dir := t.TempDir()
+	auditLogRepo := repositories.NewAuditLogRepository(sqlx.NewDb(db, "postgres"))
+	chain, err := NewAuditChainService(auditLogRepo, testAuditSigningKey)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	archiver := NewAuditArchiver(auditLogRepo, chain, dir, 12)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	rows := buildChain(repositories.ActionLogin, repositories.ActionLogout)
+
+	// Секции текущего месяца и трёх следующих
+	for _, month := range []string{"2026-10-01", "2026-11-01", "2026-12-01", "2027-01-01"} {
+		mock.ExpectExec("SELECT audit_log_create_partition").
+			WithArgs(month).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectQuery("SELECT c.relname FROM pg_inherits").
+		WillReturnRows(sqlmock.NewRows([]string{"relname"}).
+			AddRow("audit_log_y2025m09").
+			AddRow("audit_log_y2025m10").
+			AddRow("audit_log_y2026m10"))
+	mock.ExpectQuery("SELECT (.+) FROM audit_log_archives").
+		WillReturnRows(sqlmock.NewRows(auditArchiveCols))
+	mock.ExpectQuery("SELECT (.+) FROM audit_log_checkpoints").
+		WillReturnRows(sqlmock.NewRows(auditCheckpointCols))
+	mock.ExpectQuery(`SELECT (.+) FROM "audit_log_y2025m09"`).
+		WillReturnRows(chainRows(rows))
+	// Граница секции подтверждается подписанной контрольной точкой до удаления
+	mock.ExpectQuery("INSERT INTO audit_log_checkpoints").
+		WithArgs(2, *rows[1].Hash, chain.keyID, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO audit_log_archives").
+		WithArgs("audit_log_y2025m09", sqlmock.AnyArg(), 2, 1, 2, *rows[1].Hash,
+			filepath.Join(dir, "audit_log_y2025m09.ndjson.gz"), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, now))
+	mock.ExpectExec(`DROP TABLE "audit_log_y2025m09"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	deleted, err := archiver.Apply(now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 archived entries, got %d", deleted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+
+	// Архив содержит записи в том виде, из которого считается хеш
+	file, err := os.Open(filepath.Join(dir, "audit_log_y2025m09.ndjson.gz"))
+	if err != nil {
+		t.Fatalf("Archive file not written: %v", err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Archive is not gzip: %v", err)
+	}
+
+	scanner := bufio.NewScanner(gz)
+	count := 0
+	for scanner.Scan() {
+		var row repositories.AuditChainRow
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatalf("Invalid archive line: %v", err)
+		}
+		if row.Hash == nil || row.ComputeHash() != *row.Hash {
+			t.Errorf("Archived entry %d does not match its hash", row.ID)
+		}
+		count++
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 archived lines, got %d", count)
+	}
+}
+
+// TestAuditArchiver_KeepsPartitionWithBrokenChain проверяет, что секция с нарушенной цепочкой не удаляется
+func TestAuditArchiver_KeepsPartitionWithBrokenChain(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	dir := t.TempDir()
+	auditLogRepo := repositories.NewAuditLogRepository(sqlx.NewDb(db, "postgres"))
+	chain, err := NewAuditChainService(auditLogRepo, "")
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	archiver := NewAuditArchiver(auditLogRepo, chain, dir, 12)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	rows := buildChain(repositories.ActionLogin, repositories.ActionUpdateUser, repositories.ActionLogout)
+
+	for _, month := range []string{"2026-10-01", "2026-11-01", "2026-12-01", "2027-01-01"} {
+		mock.ExpectExec("SELECT audit_log_create_partition").
+			WithArgs(month).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectQuery("SELECT c.relname FROM pg_inherits").
+		WillReturnRows(sqlmock.NewRows([]string{"relname"}).AddRow("audit_log_y2025m09"))
+	mock.ExpectQuery("SELECT (.+) FROM audit_log_archives").
+		WillReturnRows(sqlmock.NewRows(auditArchiveCols))
+	mock.ExpectQuery("SELECT (.+) FROM audit_log_checkpoints").
+		WillReturnRows(sqlmock.NewRows(auditCheckpointCols))
+	// Запись 2 удалена из секции
+	mock.ExpectQuery(`SELECT (.+) FROM "audit_log_y2025m09"`).
+		WillReturnRows(chainRows([]repositories.AuditChainRow{rows[0], rows[2]}))
+
+	if _, err := archiver.Apply(now); err == nil {
+		t.Fatal("Expected error for broken chain")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "audit_log_y2025m09.ndjson.gz")); !os.IsNotExist(err) {
+		t.Error("Archive file should not be written for broken chain")
+	}
+}
@@ -0,0 +1,341 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+)
+
+// Сколько записей журнала читается за один запрос при проверке цепочки
+const auditChainBatchSize = 1000
+
+// AuditChainBreak первое найденное нарушение цепочки
+type AuditChainBreak struct {
+	EntryID      int    `json:"entry_id,omitempty"`
+	CheckpointID int    `json:"checkpoint_id,omitempty"`
+	ArchiveID    int    `json:"archive_id,omitempty"`
+	Reason       string `json:"reason"`
+}
+
+// AuditChainReport результат проверки журнала аудита
+type AuditChainReport struct {
+	Valid bool `json:"valid"`
+	// Записи до включения цепочки (без хеша) не проверяются
+	UnchainedEntries int `json:"unchained_entries"`
+	EntriesChecked   int `json:"entries_checked"`
+	LastEntryID      int `json:"last_entry_id"`
+	// Записи до этой включительно выгружены в архив и удалены; цепочка продолжает последнюю из них
+	ArchivedThroughEntryID int `json:"archived_through_entry_id,omitempty"`
+	// Архивы, файлы которых сверены с file_sha256 и пройдены как часть цепочки (VerifyWithArchives)
+	ArchiveFilesChecked int  `json:"archive_files_checked,omitempty"`
+	CheckpointsChecked  int  `json:"checkpoints_checked"`
+	SignaturesVerified  bool `json:"signatures_verified"`
+	// Отпечаток ключа, которым проверялись подписи
+	KeyID string           `json:"key_id,omitempty"`
+	Break *AuditChainBreak `json:"break,omitempty"`
+}
+
+// AuditChainService проверяет цепочку хешей журнала аудита и подписывает контрольные точки
+type AuditChainService struct {
+	auditLogRepo *repositories.AuditLogRepository
+	// nil - ключ не задан: контрольные точки не создаются, подписи не проверяются
+	signingKey ed25519.PrivateKey
+	keyID      string
+}
+
+// NewAuditChainService создает сервис; signingKey - seed Ed25519 (32 байта) в base64 или пустая строка
+func NewAuditChainService(auditLogRepo *repositories.AuditLogRepository, signingKey string) (*AuditChainService, error) {
+	s := &AuditChainService{auditLogRepo: auditLogRepo}
+	if signingKey == "" {
+		return s, nil
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(signingKey)
+	if err != nil {
+		return nil, fmt.Errorf("AUDIT_SIGNING_KEY is not valid base64: %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("AUDIT_SIGNING_KEY must be a %d-byte Ed25519 seed (got %d bytes)", ed25519.SeedSize, len(seed))
+	}
+
+	s.signingKey = ed25519.NewKeyFromSeed(seed)
+	s.keyID = auditKeyID(s.signingKey.Public().(ed25519.PublicKey))
+	return s, nil
+}
+
+// SigningEnabled проверяет, задан ли ключ подписи контрольных точек
+func (s *AuditChainService) SigningEnabled() bool {
+	return s.signingKey != nil
+}
+
+// PublicKey возвращает публичный ключ проверки контрольных точек в base64 (пусто, если ключ не задан)
+func (s *AuditChainService) PublicKey() string {
+	if s.signingKey == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(s.signingKey.Public().(ed25519.PublicKey))
+}
+
+// Checkpoint подписывает последнюю запись цепочки, если после предыдущей точки появились новые записи
+// (вызывается фоновой задачей); nil - новая точка не нужна
+func (s *AuditChainService) Checkpoint() (*repositories.AuditCheckpoint, error) {
+	if s.signingKey == nil {
+		return nil, nil
+	}
+
+	lastEntryID, lastHash, err := s.auditLogRepo.LastChainEntry()
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get last audit entry: %w", err)
+	}
+
+	previous, err := s.auditLogRepo.LastCheckpoint()
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("get last audit checkpoint: %w", err)
+	}
+	if previous != nil && previous.LastEntryID >= lastEntryID {
+		return nil, nil
+	}
+
+	return s.CheckpointAt(lastEntryID, lastHash)
+}
+
+// CheckpointAt подписывает контрольную точку на указанной записи (граница выгружаемой секции);
+// nil - ключ не задан
+func (s *AuditChainService) CheckpointAt(entryID int, hash string) (*repositories.AuditCheckpoint, error) {
+	if s.signingKey == nil {
+		return nil, nil
+	}
+
+	checkpoint := &repositories.AuditCheckpoint{
+		LastEntryID: entryID,
+		LastHash:    hash,
+		KeyID:       s.keyID,
+		// Точность PostgreSQL - микросекунды: подписанное время должно совпасть с сохранённым
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	checkpoint.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.signingKey, checkpoint.SignedMessage()))
+
+	if err := s.auditLogRepo.CreateCheckpoint(checkpoint); err != nil {
+		return nil, fmt.Errorf("create audit checkpoint: %w", err)
+	}
+	log.Printf("AUDIT: Signed audit log checkpoint %d at entry %d", checkpoint.ID, checkpoint.LastEntryID)
+	return checkpoint, nil
+}
+
+// Verify проходит цепочку от первой записи и сообщает о первом нарушении:
+// изменённой записи, удалённой или вставленной записи, неверной или непроверяемой контрольной точке,
+// подложных сведениях об архиве. Записи выгруженных секций не читаются (см. VerifyWithArchives)
+func (s *AuditChainService) Verify() (*AuditChainReport, error) {
+	return s.verify(false)
+}
+
+// VerifyWithArchives как Verify, но дополнительно сверяет файлы архивов с file_sha256
+// и проходит их записи как часть цепочки
+func (s *AuditChainService) VerifyWithArchives() (*AuditChainReport, error) {
+	return s.verify(true)
+}
+
+func (s *AuditChainService) verify(withArchives bool) (*AuditChainReport, error) {
+	report := &AuditChainReport{SignaturesVerified: s.signingKey != nil, KeyID: s.keyID}
+
+	checkpoints, err := s.auditLogRepo.ListCheckpoints()
+	if err != nil {
+		return nil, fmt.Errorf("list audit checkpoints: %w", err)
+	}
+	archives, err := s.auditLogRepo.ListArchives()
+	if err != nil {
+		return nil, fmt.Errorf("list audit archives: %w", err)
+	}
+
+	pending := make(map[int]repositories.AuditCheckpoint, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		if reason := s.checkSignature(checkpoint); reason != "" {
+			report.Break = &AuditChainBreak{CheckpointID: checkpoint.ID, EntryID: checkpoint.LastEntryID, Reason: reason}
+			return report, nil
+		}
+		pending[checkpoint.LastEntryID] = checkpoint
+	}
+	report.CheckpointsChecked = len(checkpoints)
+
+	var cursor auditChainCursor
+	var previous *repositories.AuditArchive
+	for i := range archives {
+		archive := &archives[i]
+		// Пустые секции не содержат записей цепочки
+		if !archive.LastEntryID.Valid {
+			continue
+		}
+		if reason := s.checkArchive(*archive, previous, pending); reason != "" {
+			report.Break = &AuditChainBreak{ArchiveID: archive.ID, EntryID: archive.LastEntryID.Int, Reason: reason}
+			return report, nil
+		}
+
+		if withArchives {
+			chainBreak, err := checkArchiveFile(*archive, &cursor, pending)
+			if err != nil {
+				return nil, fmt.Errorf("read audit archive %s: %w", archive.PartitionName, err)
+			}
+			if chainBreak != nil {
+				report.Break = chainBreak
+				return report, nil
+			}
+			report.ArchiveFilesChecked++
+		} else {
+			cursor = auditChainCursor{chained: archive.LastHash.Valid, prevHash: archive.LastHash.String}
+		}
+		report.ArchivedThroughEntryID = archive.LastEntryID.Int
+		previous = archive
+	}
+
+	// Без чтения файлов записи выгруженных секций не проверить: граница архива проверена выше
+	for entryID := range pending {
+		if entryID <= report.ArchivedThroughEntryID {
+			delete(pending, entryID)
+		}
+	}
+
+	afterID := 0
+	for {
+		rows, err := s.auditLogRepo.ChainRows(afterID, auditChainBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("read audit log: %w", err)
+		}
+
+		for _, row := range rows {
+			afterID = row.ID
+			// Секции удаляются целиком после выгрузки: оставшиеся записи не могут входить в архив
+			if row.ID <= report.ArchivedThroughEntryID {
+				report.Break = &AuditChainBreak{EntryID: row.ID, Reason: "Запись журнала входит в диапазон выгруженного архива: сведения об архиве подложны"}
+				return report, nil
+			}
+			if reason := cursor.next(row); reason != "" {
+				report.Break = &AuditChainBreak{EntryID: row.ID, Reason: reason}
+				return report, nil
+			}
+			if row.Hash == nil {
+				report.UnchainedEntries++
+				continue
+			}
+
+			if checkpoint, ok := pending[row.ID]; ok {
+				if checkpoint.LastHash != *row.Hash {
+					report.Break = &AuditChainBreak{EntryID: row.ID, CheckpointID: checkpoint.ID, Reason: "Хеш записи не совпадает с подписанной контрольной точкой"}
+					return report, nil
+				}
+				delete(pending, row.ID)
+			}
+
+			report.EntriesChecked++
+			report.LastEntryID = row.ID
+		}
+
+		if len(rows) < auditChainBatchSize {
+			break
+		}
+	}
+
+	// Точки, запись которых не встретилась в цепочке: запись удалена (в том числе конец журнала)
+	for _, checkpoint := range checkpoints {
+		if _, ok := pending[checkpoint.LastEntryID]; ok {
+			report.Break = &AuditChainBreak{EntryID: checkpoint.LastEntryID, CheckpointID: checkpoint.ID, Reason: "Запись контрольной точки отсутствует в журнале"}
+			return report, nil
+		}
+	}
+
+	report.Valid = true
+	return report, nil
+}
+
+// checkArchive проверяет сведения об архиве относительно предыдущего архива и контрольных точек;
+// пустая строка - архив в порядке. Таблица архивов доступна для вставки, поэтому граница каждого архива
+// с цепочкой должна быть подтверждена подписанной контрольной точкой
+func (s *AuditChainService) checkArchive(archive repositories.AuditArchive, previous *repositories.AuditArchive, checkpoints map[int]repositories.AuditCheckpoint) string {
+	if !archive.FirstEntryID.Valid || archive.FirstEntryID.Int > archive.LastEntryID.Int {
+		return "Неверный диапазон записей архива"
+	}
+	if previous != nil {
+		if archive.FirstEntryID.Int <= previous.LastEntryID.Int {
+			return "Архив не продолжает предыдущий: диапазоны записей пересекаются или идут не по порядку"
+		}
+		if previous.LastHash.Valid && !archive.LastHash.Valid {
+			return "Архив без цепочки следует за архивом с цепочкой"
+		}
+	}
+	if s.signingKey != nil && archive.LastHash.Valid {
+		checkpoint, ok := checkpoints[archive.LastEntryID.Int]
+		if !ok || checkpoint.LastHash != archive.LastHash.String {
+			return "Граница архива не подтверждена подписанной контрольной точкой"
+		}
+	}
+	return ""
+}
+
+// auditChainCursor положение в цепочке: хеш последней пройденной записи
+type auditChainCursor struct {
+	chained  bool
+	prevHash string
+}
+
+// next проверяет очередную запись и переходит к ней; пустая строка - запись в порядке
+func (c *auditChainCursor) next(row repositories.AuditChainRow) string {
+	if reason := checkChainRow(row, c.chained, c.prevHash); reason != "" {
+		return reason
+	}
+	if row.Hash != nil {
+		c.chained = true
+		c.prevHash = *row.Hash
+	}
+	return ""
+}
+
+// checkChainRow проверяет запись относительно предыдущей; пустая строка - запись в порядке
+func checkChainRow(row repositories.AuditChainRow, chained bool, prevHash string) string {
+	if row.Hash == nil {
+		if chained {
+			return "Запись добавлена в обход цепочки (нет хеша)"
+		}
+		return ""
+	}
+	if chained && (row.PrevHash == nil || *row.PrevHash != prevHash) {
+		return "Ссылка на предыдущую запись не совпадает: запись удалена или вставлена"
+	}
+	if !chained && row.PrevHash != nil {
+		return "Начало цепочки ссылается на отсутствующую запись"
+	}
+	if row.ComputeHash() != *row.Hash {
+		return "Хеш не совпадает с содержимым: запись изменена"
+	}
+	return ""
+}
+
+// checkSignature проверяет подпись контрольной точки; пустая строка - подпись верна или ключ не задан
+func (s *AuditChainService) checkSignature(checkpoint repositories.AuditCheckpoint) string {
+	if s.signingKey == nil {
+		return ""
+	}
+	if checkpoint.KeyID != s.keyID {
+		return "Контрольная точка подписана неизвестным ключом"
+	}
+	signature, err := base64.StdEncoding.DecodeString(checkpoint.Signature)
+	if err != nil || !ed25519.Verify(s.signingKey.Public().(ed25519.PublicKey), checkpoint.SignedMessage(), signature) {
+		return "Неверная подпись контрольной точки"
+	}
+	return ""
+}
+
+// auditKeyID отпечаток публичного ключа: первые 16 байт SHA-256 в hex
+func auditKeyID(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:16])
+}
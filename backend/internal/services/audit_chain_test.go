@@ -0,0 +1,353 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	auditChainCols = []string{"id", "prev_hash", "hash", "user_id", "action", "target_user_id", "impersonator_id",
+		"details", "ip_address", "user_agent", "created_at"}
+	auditCheckpointCols = []string{"id", "last_entry_id", "last_hash", "key_id", "signature", "created_at"}
+	auditArchiveCols    = []string{"id", "partition_name", "month", "entries", "first_entry_id", "last_entry_id", "last_hash",
+		"file_path", "file_sha256", "created_at"}
+)
+
+// Тестовый seed ключа подписи
+var testAuditSigningKey = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", ed25519.SeedSize)))
+
+func newTestAuditChainService(t *testing.T, signingKey string) (*AuditChainService, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	service, err := NewAuditChainService(repositories.NewAuditLogRepository(sqlx.NewDb(db, "postgres")), signingKey)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	return service, mock
+}
+
+// buildChain строит цепочку записей с хешами, как их записал бы триггер
+func buildChain(actions ...string) []repositories.AuditChainRow {
+	rows := []repositories.AuditChainRow{}
+	var prev *string
+	for i, action := range actions {
+		userID, details, userAgent := "1", "{}", ""
+		row := repositories.AuditChainRow{
+			ID:        i + 1,
+			PrevHash:  prev,
+			UserID:    &userID,
+			Action:    action,
+			Details:   &details,
+			UserAgent: &userAgent,
+			CreatedAt: "1760000000000000",
+		}
+		hash := row.ComputeHash()
+		row.Hash = &hash
+		prev = row.Hash
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func chainRows(rows []repositories.AuditChainRow) *sqlmock.Rows {
+	result := sqlmock.NewRows(auditChainCols)
+	for _, row := range rows {
+		result.AddRow(row.ID, nullable(row.PrevHash), nullable(row.Hash), nullable(row.UserID), row.Action,
+			nullable(row.TargetUserID), nullable(row.ImpersonatorID), nullable(row.Details), nullable(row.IPAddress),
+			nullable(row.UserAgent), row.CreatedAt)
+	}
+	return result
+}
+
+func nullable(s *string) interface{} {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
+
+func TestAuditChainService_VerifyValidChain(t *testing.T) {
+	service, mock := newTestAuditChainService(t, "")
+	rows := buildChain(repositories.ActionLogin, repositories.ActionUpdateUser, repositories.ActionLogout)
+
+	mock.ExpectQuery("SELECT (.+) FROM audit_log_checkpoints").
+		WillReturnRows(sqlmock.NewRows(auditCheckpointCols))
+	mock.ExpectQuery("SELECT (.+) FROM audit_log_archives").
+		WillReturnRows(sqlmock.NewRows(auditArchiveCols))
+	mock.ExpectQuery("SELECT (.+) FROM audit_log").
+		WithArgs(0, auditChainBatchSize).
+		WillReturnRows(chainRows(rows))
+
+	report, err := service.Verify()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !report.Valid || report.EntriesChecked != 3 || report.LastEntryID != 3 {
+		t.Errorf("Expected valid chain of 3 entries, got %+v", report)
+	}
+}
+
+func TestAuditChainService_VerifyDetectsEditedEntry(t *testing.T) {
+	service, mock := newTestAuditChainService(t, "")
+	rows := buildChain(repositories.ActionLogin, repositories.ActionUpdateUser, repositories.ActionLogout)
+	details := `{"role": "admin"}`
+	rows[1].Details = &details
+
+	mock.ExpectQuery("SELECT (.+) FROM audit_log_checkpoints").
+		WillReturnRows(sqlmock.NewRows(auditCheckpointCols))
+	mock.ExpectQuery("SELECT (.+) FROM audit_log_archives").
+		WillReturnRows(sqlmock.NewRows(auditArchiveCols))
+	mock.ExpectQuery("SELECT (.+) FROM audit_log").
+		WithArgs(0, auditChainBatchSize).
+		WillReturnRows(chainRows(rows))
+
+	report, err := service.Verify()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.Valid || report.Break == nil || report.Break.EntryID != 2 {
+		t.Errorf("Expected break at entry 2, got %+v", report)
+	}
+}
+
+func TestAuditChainService_VerifyDetectsDeletedEntry(t *testing.T) {
+	service, mock := newTestAuditChainService(t, "")
+	rows := buildChain(repositories.ActionLogin, repositories.ActionUpdateUser, repositories.ActionLogout)
+
+	mock.ExpectQuery("SELECT (.+) FROM audit_log_checkpoints").
+		WillReturnRows(sqlmock.NewRows(auditCheckpointCols))
+	mock.ExpectQuery("SELECT (.+) FROM audit_log_archives").
+		WillReturnRows(sqlmock.NewRows(auditArchiveCols))
+	mock.ExpectQuery("SELECT (.+) FROM audit_log").
+		WithArgs(0, auditChainBatchSize).
+		WillReturnRows(chainRows([]repositories.AuditChainRow{rows[0], rows[2]}))
+
+	report, err := service.Verify()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.Valid || report.Break == nil || report.Break.EntryID != 3 {
+		t.Errorf("Expected break at entry 3, got %+v", report)
+	}
+}
+
+func TestAuditChainService_CheckpointDetectsTruncatedTail(t *testing.T) {
+	service, mock := newTestAuditChainService(t, testAuditSigningKey)
+	rows := buildChain(repositories.ActionLogin, repositories.ActionUpdateUser, repositories.ActionLogout)
+
+	// Контрольная точка подписана на записи 3, которой больше нет
+	checkpoint := repositories.AuditCheckpoint{
+		ID:          1,
+		LastEntryID: 3,
+		LastHash:    *rows[2].Hash,
+		KeyID:       service.keyID,
+		CreatedAt:   time.Now().UTC().Truncate(time.Microsecond),
+	}
+	checkpoint.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(service.signingKey, checkpoint.SignedMessage()))
+
+	mock.ExpectQuery("SELECT (.+) FROM audit_log_checkpoints").
+		WillReturnRows(sqlmock.NewRows(auditCheckpointCols).AddRow(
+			checkpoint.ID, checkpoint.LastEntryID, checkpoint.LastHash, checkpoint.KeyID, checkpoint.Signature, checkpoint.CreatedAt))
+	mock.ExpectQuery("SELECT (.+) FROM audit_log_archives").
+		WillReturnRows(sqlmock.NewRows(auditArchiveCols))
+	mock.ExpectQuery("SELECT (.+) FROM audit_log").
+		WithArgs(0, auditChainBatchSize).
+		WillReturnRows(chainRows(rows[:2]))
+
+	report, err := service.Verify()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.Valid || report.Break == nil || report.Break.CheckpointID != 1 {
+		t.Errorf("Expected break at checkpoint 1, got %+v", report)
+	}
+	if !report.SignaturesVerified {
+		t.Error("Expected signatures to be verified")
+	}
+}
+
+func TestAuditChainService_CheckpointSignsLastEntry(t *testing.T) {
+	service, mock := newTestAuditChainService(t, testAuditSigningKey)
+
+	mock.ExpectQuery("SELECT id, hash FROM audit_log WHERE hash IS NOT NULL").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "hash"}).AddRow(42, "abc"))
+	mock.ExpectQuery("SELECT (.+) FROM audit_log_checkpoints").
+		WillReturnRows(sqlmock.NewRows(auditCheckpointCols).AddRow(1, 40, "def", service.keyID, "sig", time.Now()))
+	mock.ExpectQuery("INSERT INTO audit_log_checkpoints").
+		WithArgs(42, "abc", service.keyID, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+
+	checkpoint, err := service.Checkpoint()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if checkpoint == nil || checkpoint.ID != 2 || service.checkSignature(*checkpoint) != "" {
+		t.Errorf("Expected signed checkpoint 2, got %+v", checkpoint)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// signedCheckpoint подписывает контрольную точку ключом сервиса
+func signedCheckpoint(service *AuditChainService, id int, row repositories.AuditChainRow) repositories.AuditCheckpoint {
+	checkpoint := repositories.AuditCheckpoint{
+		ID:          id,
+		LastEntryID: row.ID,
+		LastHash:    *row.Hash,
+		KeyID:       service.keyID,
+		CreatedAt:   time.Now().UTC().Truncate(time.Microsecond),
+	}
+	checkpoint.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(service.signingKey, checkpoint.SignedMessage()))
+	return checkpoint
+}
+
+func checkpointRows(checkpoints ...repositories.AuditCheckpoint) *sqlmock.Rows {
+	result := sqlmock.NewRows(auditCheckpointCols)
+	for _, c := range checkpoints {
+		result.AddRow(c.ID, c.LastEntryID, c.LastHash, c.KeyID, c.Signature, c.CreatedAt)
+	}
+	return result
+}
+
+// TestAuditChainService_VerifyDetectsForgedArchive проверяет, что вставленная запись об архиве
+// не позволяет пропустить оставшуюся цепочку
+func TestAuditChainService_VerifyDetectsForgedArchive(t *testing.T) {
+	rows := buildChain(repositories.ActionLogin, repositories.ActionUpdateUser, repositories.ActionLogout)
+	month := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		signingKey string
+		archives   func(service *AuditChainService) (*sqlmock.Rows, *sqlmock.Rows)
+		wantReason string
+	}{
+		{
+			name: "Live entries inside archived range",
+			archives: func(*AuditChainService) (*sqlmock.Rows, *sqlmock.Rows) {
+				return checkpointRows(), sqlmock.NewRows(auditArchiveCols).
+					AddRow(1, "audit_log_y2025m09", month, 1, 1, 2, *rows[1].Hash, "/tmp/a.gz", "00", time.Now())
+			},
+			wantReason: "диапазон выгруженного архива",
+		},
+		{
+			name:       "Archive boundary without signed checkpoint",
+			signingKey: testAuditSigningKey,
+			archives: func(*AuditChainService) (*sqlmock.Rows, *sqlmock.Rows) {
+				return checkpointRows(), sqlmock.NewRows(auditArchiveCols).
+					AddRow(1, "audit_log_y2025m09", month, 2, 1, 2, *rows[1].Hash, "/tmp/a.gz", "00", time.Now())
+			},
+			wantReason: "не подтверждена",
+		},
+		{
+			name:       "Archives out of order",
+			signingKey: testAuditSigningKey,
+			archives: func(service *AuditChainService) (*sqlmock.Rows, *sqlmock.Rows) {
+				return checkpointRows(signedCheckpoint(service, 1, rows[1]), signedCheckpoint(service, 2, rows[0])),
+					sqlmock.NewRows(auditArchiveCols).
+						AddRow(1, "audit_log_y2025m08", month.AddDate(0, -1, 0), 2, 1, 2, *rows[1].Hash, "/tmp/a.gz", "00", time.Now()).
+						AddRow(2, "audit_log_y2025m09", month, 1, 1, 1, *rows[0].Hash, "/tmp/b.gz", "00", time.Now())
+			},
+			wantReason: "не продолжает предыдущий",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, mock := newTestAuditChainService(t, tt.signingKey)
+			checkpoints, archives := tt.archives(service)
+
+			mock.ExpectQuery("SELECT (.+) FROM audit_log_checkpoints").WillReturnRows(checkpoints)
+			mock.ExpectQuery("SELECT (.+) FROM audit_log_archives").WillReturnRows(archives)
+			mock.ExpectQuery("SELECT (.+) FROM audit_log").
+				WithArgs(0, auditChainBatchSize).
+				WillReturnRows(chainRows(rows))
+
+			report, err := service.Verify()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if report.Valid || report.Break == nil || !strings.Contains(report.Break.Reason, tt.wantReason) {
+				t.Errorf("Expected break %q, got %+v", tt.wantReason, report.Break)
+			}
+		})
+	}
+}
+
+// TestAuditChainService_VerifyWithArchives проверяет сверку файла архива и продолжение цепочки после него
+func TestAuditChainService_VerifyWithArchives(t *testing.T) {
+	rows := buildChain(repositories.ActionLogin, repositories.ActionUpdateUser, repositories.ActionLogout)
+	path := filepath.Join(t.TempDir(), "audit_log_y2025m09.ndjson.gz")
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(gz)
+	for _, row := range rows[:2] {
+		if err := encoder.Encode(row); err != nil {
+			t.Fatalf("Failed to encode row: %v", err)
+		}
+	}
+	gz.Close()
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+
+	tests := []struct {
+		name      string
+		sha256    string
+		wantValid bool
+	}{
+		{name: "File matches", sha256: hex.EncodeToString(sum[:]), wantValid: true},
+		{name: "File replaced", sha256: strings.Repeat("0", 64)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, mock := newTestAuditChainService(t, testAuditSigningKey)
+
+			mock.ExpectQuery("SELECT (.+) FROM audit_log_checkpoints").
+				WillReturnRows(checkpointRows(signedCheckpoint(service, 1, rows[1])))
+			mock.ExpectQuery("SELECT (.+) FROM audit_log_archives").
+				WillReturnRows(sqlmock.NewRows(auditArchiveCols).
+					AddRow(1, "audit_log_y2025m09", time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC), 2, 1, 2, *rows[1].Hash, path, tt.sha256, time.Now()))
+			if tt.wantValid {
+				mock.ExpectQuery("SELECT (.+) FROM audit_log").
+					WithArgs(0, auditChainBatchSize).
+					WillReturnRows(chainRows(rows[2:]))
+			}
+
+			report, err := service.VerifyWithArchives()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if report.Valid != tt.wantValid {
+				t.Errorf("Valid = %v, want %v (break %+v)", report.Valid, tt.wantValid, report.Break)
+			}
+			if tt.wantValid && (report.ArchiveFilesChecked != 1 || report.EntriesChecked != 1 || report.ArchivedThroughEntryID != 2) {
+				t.Errorf("Unexpected report %+v", report)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+)
+
+const (
+	// Сколько строк очереди забирается за раз
+	auditOutboxBatchSize = 100
+	// На это время забранные строки скрыты от других экземпляров (если экземпляр упал во время доставки)
+	auditOutboxLease = 5 * time.Minute
+
+	// Повторы: 10 с, 20 с, 40 с ... не реже раза в час
+	auditOutboxMinBackoff = 10 * time.Second
+	auditOutboxMaxBackoff = time.Hour
+)
+
+// AuditDispatcher доставляет записи журнала из очереди audit_outbox получателям
+// (вызывается фоновой задачей отдельно для каждого получателя)
+type AuditDispatcher struct {
+	auditLogRepo *repositories.AuditLogRepository
+	maxAttempts  int
+}
+
+// NewAuditDispatcher создает диспетчер; после maxAttempts неудачных попыток строка больше не отправляется
+func NewAuditDispatcher(auditLogRepo *repositories.AuditLogRepository, maxAttempts int) *AuditDispatcher {
+	return &AuditDispatcher{
+		auditLogRepo: auditLogRepo,
+		maxAttempts:  maxAttempts,
+	}
+}
+
+// Deliver отправляет получателю накопившиеся записи и возвращает число доставленных.
+// При ошибке доставка останавливается до следующей попытки, чтобы записи не обгоняли друг друга
+func (d *AuditDispatcher) Deliver(sink repositories.AuditSink) (int, error) {
+	delivered := 0
+	for {
+		items, err := d.auditLogRepo.ClaimOutbox(sink.Name(), auditOutboxBatchSize, auditOutboxLease, d.maxAttempts)
+		if err != nil {
+			return delivered, fmt.Errorf("claim audit outbox: %w", err)
+		}
+		if len(items) == 0 {
+			return delivered, nil
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+
+		ids := make([]int, len(items))
+		for i, item := range items {
+			ids[i] = item.AuditLogID
+		}
+		entries, err := d.auditLogRepo.EntriesByID(ids)
+		if err != nil {
+			return delivered, fmt.Errorf("read audit entries: %w", err)
+		}
+
+		for i, item := range items {
+			entry, ok := entries[item.AuditLogID]
+			if !ok {
+				// Запись уже выгружена в архив: повторять бесполезно
+				log.Printf("Audit entry %d for %s not found, dropping it from the outbox", item.AuditLogID, sink.Name())
+				if err := d.auditLogRepo.AbandonOutbox(item.ID, "Запись журнала не найдена"); err != nil {
+					return delivered, err
+				}
+				continue
+			}
+
+			if err := sink.Send(entry); err != nil {
+				retryAt := time.Now().Add(auditOutboxBackoff(item.Attempts))
+				if err := d.auditLogRepo.MarkOutboxFailed(item.ID, err.Error(), retryAt); err != nil {
+					return delivered, err
+				}
+				if item.Attempts >= d.maxAttempts {
+					log.Printf("⚠️  Audit entry %d was not delivered to %s after %d attempts, delivery stopped until requeued (audit_outbox -requeue): %v",
+						item.AuditLogID, sink.Name(), item.Attempts, err)
+				}
+				if rest := items[i+1:]; len(rest) > 0 {
+					restIDs := make([]int64, len(rest))
+					for j, r := range rest {
+						restIDs[j] = r.ID
+					}
+					if err := d.auditLogRepo.ReleaseOutbox(restIDs, retryAt); err != nil {
+						return delivered, err
+					}
+				}
+				return delivered, fmt.Errorf("deliver audit entry %d to %s: %w", item.AuditLogID, sink.Name(), err)
+			}
+
+			if err := d.auditLogRepo.MarkOutboxDelivered(item.ID); err != nil {
+				return delivered, err
+			}
+			delivered++
+		}
+
+		if len(items) < auditOutboxBatchSize {
+			return delivered, nil
+		}
+	}
+}
+
+// Status возвращает состояние очереди по получателям
+func (d *AuditDispatcher) Status() ([]repositories.AuditOutboxStatus, error) {
+	return d.auditLogRepo.OutboxStatus(d.maxAttempts)
+}
+
+// Requeue возвращает в очередь строки, исчерпавшие попытки (sink пустой - всех получателей)
+func (d *AuditDispatcher) Requeue(sink string) (int64, error) {
+	requeued, err := d.auditLogRepo.RequeueOutbox(sink, d.maxAttempts)
+	if err != nil {
+		return 0, err
+	}
+	if requeued > 0 {
+		log.Printf("AUDIT: Requeued %d undelivered audit outbox rows (sink %q)", requeued, sink)
+	}
+	return requeued, nil
+}
+
+// DeleteOutbox удаляет строки очереди старше cutoff, которые больше не будут отправлены
+// (политика хранения audit_outbox)
+func (d *AuditDispatcher) DeleteOutbox(cutoff time.Time) (int64, error) {
+	return d.auditLogRepo.DeleteOutbox(cutoff, d.maxAttempts)
+}
+
+// WarnExhausted пишет в лог получателей, у которых есть строки, исчерпавшие попытки
+func (d *AuditDispatcher) WarnExhausted() error {
+	status, err := d.Status()
+	if err != nil {
+		return err
+	}
+	for _, sink := range status {
+		if sink.Exhausted > 0 {
+			log.Printf("⚠️  %d audit entries were not delivered to %s (oldest from %s); requeue them with audit_outbox -requeue",
+				sink.Exhausted, sink.Sink, sink.OldestExhaustedAt.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// auditOutboxBackoff задержка перед следующей попыткой после attempts неудачных
+func auditOutboxBackoff(attempts int) time.Duration {
+	backoff := auditOutboxMinBackoff
+	for i := 1; i < attempts && backoff < auditOutboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > auditOutboxMaxBackoff {
+		return auditOutboxMaxBackoff
+	}
+	return backoff
+}
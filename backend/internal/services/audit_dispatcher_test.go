@@ -0,0 +1,176 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	auditOutboxCols = []string{"id", "audit_log_id", "sink", "attempts"}
+	auditEntryCols  = []string{"id", "user_id", "action", "target_user_id", "impersonator_id", "details", "ip_address",
+		"user_agent", "created_at", "prev_hash", "hash"}
+)
+
+// fakeAuditSink записывает отправленные записи; fail - ID записей, доставка которых падает
+type fakeAuditSink struct {
+	sent []int
+	fail map[int]bool
+}
+
+func (s *fakeAuditSink) Name() string { return "webhook:https://siem.example/audit" }
+
+func (s *fakeAuditSink) Send(entry repositories.AuditLogEntry) error {
+	if s.fail[entry.ID] {
+		return errors.New("connection refused")
+	}
+	s.sent = append(s.sent, entry.ID)
+	return nil
+}
+
+func newTestAuditDispatcher(t *testing.T) (*AuditDispatcher, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewAuditDispatcher(repositories.NewAuditLogRepository(sqlx.NewDb(db, "postgres")), 20), mock
+}
+
+func auditEntryRows(ids ...int) *sqlmock.Rows {
+	rows := sqlmock.NewRows(auditEntryCols)
+	for _, id := range ids {
+		rows.AddRow(id, 1, repositories.ActionLogin, nil, nil, []byte(`{}`), "10.0.0.1", "Mozilla", time.Now(), nil, nil)
+	}
+	return rows
+}
+
+func TestAuditDispatcher_DeliversInOrder(t *testing.T) {
+	dispatcher, mock := newTestAuditDispatcher(t)
+	sink := &fakeAuditSink{}
+
+	mock.ExpectQuery("UPDATE audit_outbox SET attempts = attempts \\+ 1").
+		WithArgs(sink.Name(), auditOutboxBatchSize, 300, 20).
+		WillReturnRows(sqlmock.NewRows(auditOutboxCols).
+			AddRow(11, 101, sink.Name(), 1).
+			AddRow(10, 100, sink.Name(), 1))
+	mock.ExpectQuery("SELECT (.+) FROM audit_log WHERE id = ANY").
+		WithArgs(pq.Array([]int{100, 101})).
+		WillReturnRows(auditEntryRows(100, 101))
+	mock.ExpectExec("UPDATE audit_outbox SET delivered_at = NOW()").WithArgs(10).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE audit_outbox SET delivered_at = NOW()").WithArgs(11).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	delivered, err := dispatcher.Deliver(sink)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if delivered != 2 || len(sink.sent) != 2 || sink.sent[0] != 100 {
+		t.Errorf("Expected entries 100, 101 delivered in order, got %v", sink.sent)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestAuditDispatcher_StopsAndReschedulesOnFailure(t *testing.T) {
+	dispatcher, mock := newTestAuditDispatcher(t)
+	sink := &fakeAuditSink{fail: map[int]bool{100: true}}
+
+	mock.ExpectQuery("UPDATE audit_outbox SET attempts = attempts \\+ 1").
+		WillReturnRows(sqlmock.NewRows(auditOutboxCols).
+			AddRow(10, 100, sink.Name(), 3).
+			AddRow(11, 101, sink.Name(), 1))
+	mock.ExpectQuery("SELECT (.+) FROM audit_log WHERE id = ANY").
+		WillReturnRows(auditEntryRows(100, 101))
+	mock.ExpectExec("UPDATE audit_outbox SET last_error = \\$2, next_attempt_at = \\$3").
+		WithArgs(10, "connection refused", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Запись 101 не отправлялась: попытка возвращается
+	mock.ExpectExec("UPDATE audit_outbox SET attempts = attempts - 1").
+		WithArgs(pq.Array([]int64{11}), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	delivered, err := dispatcher.Deliver(sink)
+	if err == nil {
+		t.Fatal("Expected delivery error")
+	}
+	if delivered != 0 || len(sink.sent) != 0 {
+		t.Errorf("Expected nothing delivered, got %v", sink.sent)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestAuditOutboxBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  10 * time.Second,
+		2:  20 * time.Second,
+		4:  80 * time.Second,
+		20: time.Hour,
+	}
+	for attempts, expected := range cases {
+		if got := auditOutboxBackoff(attempts); got != expected {
+			t.Errorf("attempts=%d: expected %v, got %v", attempts, expected, got)
+		}
+	}
+}
+
+// TestAuditDispatcher_DeleteOutboxKeepsUndelivered проверяет, что срок хранения не удаляет строки, ждущие доставки
+func TestAuditDispatcher_DeleteOutboxKeepsUndelivered(t *testing.T) {
+	dispatcher, mock := newTestAuditDispatcher(t)
+	cutoff := time.Now().Add(-7 * 24 * time.Hour)
+
+	mock.ExpectExec("DELETE FROM audit_outbox\\s+WHERE created_at < \\$1 AND \\(delivered_at IS NOT NULL OR attempts >= \\$2 OR next_attempt_at = 'infinity'\\)").
+		WithArgs(cutoff, 20).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	deleted, err := dispatcher.DeleteOutbox(cutoff)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("Expected 3 deleted rows, got %d", deleted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestAuditDispatcher_RequeueExhausted проверяет возврат в очередь строк, исчерпавших попытки
+func TestAuditDispatcher_RequeueExhausted(t *testing.T) {
+	dispatcher, mock := newTestAuditDispatcher(t)
+	sink := &fakeAuditSink{}
+
+	mock.ExpectQuery("SELECT sink,(.+)FROM audit_outbox\\s+WHERE delivered_at IS NULL").
+		WithArgs(20).
+		WillReturnRows(sqlmock.NewRows([]string{"sink", "pending", "exhausted", "oldest_exhausted_at", "abandoned"}).
+			AddRow(sink.Name(), 0, 2, time.Now().Add(-time.Hour), 0))
+	mock.ExpectExec("UPDATE audit_outbox SET attempts = 0, next_attempt_at = NOW\\(\\)").
+		WithArgs(sink.Name(), 20).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	status, err := dispatcher.Status()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(status) != 1 || status[0].Exhausted != 2 || status[0].OldestExhaustedAt == nil {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	requeued, err := dispatcher.Requeue(sink.Name())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if requeued != 2 {
+		t.Errorf("Expected 2 requeued rows, got %d", requeued)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+)
+
+const (
+	// Facility 13 (log audit) и severity 5 (notice) по RFC 5424
+	syslogFacilityLogAudit = 13
+	syslogSeverityNotice   = 5
+
+	// SD-ID структурированных данных записи (32473 - номер из RFC 5612 для примеров и документации)
+	syslogStructuredDataID = "audit@32473"
+
+	auditSinkTimeout = 10 * time.Second
+)
+
+// SyslogSink отправляет записи журнала в syslog (RFC 5424) по UDP или TCP
+type SyslogSink struct {
+	network  string
+	addr     string
+	appName  string
+	hostname string
+	procID   string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslogSink создает получателя; network - udp или tcp, addr - host:port
+func NewSyslogSink(network, addr, appName string) *SyslogSink {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &SyslogSink{
+		network:  network,
+		addr:     addr,
+		appName:  appName,
+		hostname: hostname,
+		procID:   strconv.Itoa(os.Getpid()),
+	}
+}
+
+// Name имя получателя в очереди доставки
+func (s *SyslogSink) Name() string {
+	return "syslog:" + s.addr
+}
+
+// Send отправляет запись; соединение переиспользуется и пересоздаётся после ошибки
+func (s *SyslogSink) Send(entry repositories.AuditLogEntry) error {
+	message, err := s.format(entry)
+	if err != nil {
+		return err
+	}
+	// TCP: кадрирование с указанием длины (RFC 6587), UDP: одна запись - одна датаграмма
+	if s.network == "tcp" {
+		message = append([]byte(strconv.Itoa(len(message))+" "), message...)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.addr, auditSinkTimeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(auditSinkTimeout))
+	if _, err := s.conn.Write(message); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// format собирает сообщение RFC 5424: заголовок, структурированные данные и запись в JSON
+func (s *SyslogSink) format(entry repositories.AuditLogEntry) ([]byte, error) {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	var sd strings.Builder
+	sd.WriteString("[" + syslogStructuredDataID)
+	writeParam := func(name, value string) {
+		sd.WriteString(" " + name + `="` + escapeSDParam(value) + `"`)
+	}
+	writeParam("id", strconv.Itoa(entry.ID))
+	writeParam("action", entry.Action)
+	if entry.UserID.Valid {
+		writeParam("user_id", strconv.Itoa(entry.UserID.Int))
+	}
+	if entry.TargetUserID.Valid {
+		writeParam("target_user_id", strconv.Itoa(entry.TargetUserID.Int))
+	}
+	if entry.ImpersonatorID.Valid {
+		writeParam("impersonator_id", strconv.Itoa(entry.ImpersonatorID.Int))
+	}
+	if entry.IPAddress.Valid && entry.IPAddress.String != "" {
+		writeParam("ip", entry.IPAddress.String)
+	}
+	if entry.Hash.Valid {
+		writeParam("hash", entry.Hash.String)
+	}
+	sd.WriteString("]")
+
+	header := fmt.Sprintf("<%d>1 %s %s %s %s %s ",
+		syslogFacilityLogAudit*8+syslogSeverityNotice,
+		entry.CreatedAt.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		syslogHeaderField(s.hostname, 255),
+		syslogHeaderField(s.appName, 48),
+		syslogHeaderField(s.procID, 128),
+		syslogHeaderField(entry.Action, 32),
+	)
+
+	// Сообщение в UTF-8 начинается с BOM
+	message := append([]byte(header+sd.String()+" \xEF\xBB\xBF"), body...)
+	return message, nil
+}
+
+// syslogHeaderField приводит значение к полю заголовка: печатные ASCII без пробелов, не длиннее maxLen
+func syslogHeaderField(value string, maxLen int) string {
+	var b strings.Builder
+	for _, r := range value {
+		if b.Len() >= maxLen {
+			break
+		}
+		if r > 32 && r < 127 {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "-"
+	}
+	return b.String()
+}
+
+// escapeSDParam экранирует значение параметра структурированных данных
+func escapeSDParam(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+// WebhookSink отправляет записи журнала POST-запросом с подписью HMAC-SHA256
+type WebhookSink struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// NewWebhookSink создает получателя
+func NewWebhookSink(url, secret string) *WebhookSink {
+	return &WebhookSink{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: auditSinkTimeout},
+	}
+}
+
+// Name имя получателя в очереди доставки
+func (s *WebhookSink) Name() string {
+	return "webhook:" + s.url
+}
+
+// Send отправляет запись в JSON; любой ответ кроме 2xx - ошибка.
+// Подпись: X-Audit-Signature = "sha256=" + hex(HMAC-SHA256(secret, X-Audit-Timestamp + "." + тело))
+func (s *WebhookSink) Send(entry repositories.AuditLogEntry) error {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Audit-Event-ID", strconv.Itoa(entry.ID))
+	req.Header.Set("X-Audit-Timestamp", timestamp)
+	req.Header.Set("X-Audit-Signature", "sha256="+SignAuditWebhook(s.secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New("webhook responded with " + resp.Status)
+	}
+	return nil
+}
+
+// SignAuditWebhook подпись тела webhook (hex); получатель сверяет её с X-Audit-Signature
+func SignAuditWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
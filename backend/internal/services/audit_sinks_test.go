@@ -0,0 +1,139 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+)
+
+func testAuditEntry() repositories.AuditLogEntry {
+	return repositories.AuditLogEntry{
+		ID:        42,
+		UserID:    models.NullInt{Int: 3, Valid: true},
+		Action:    repositories.ActionLogin,
+		Details:   repositories.AuditDetails{"method": "password"},
+		IPAddress: models.NullString{String: "10.0.0.1", Valid: true},
+		CreatedAt: time.Date(2026, 10, 18, 9, 30, 0, 123456000, time.UTC),
+		Hash:      models.NullString{String: "abc", Valid: true},
+	}
+}
+
+func TestSyslogSink_FormatsRFC5424(t *testing.T) {
+	sink := NewSyslogSink("udp", "127.0.0.1:514", "central reporting")
+	sink.hostname = "app01"
+	sink.procID = "100"
+
+	entry := testAuditEntry()
+	entry.Details = repositories.AuditDetails{"reason": `quote " and ]`}
+	message, err := sink.format(entry)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `<109>1 2026-10-18T09:30:00.123456Z app01 central_reporting 100 login ` +
+		`[audit@32473 id="42" action="login" user_id="3" ip="10.0.0.1" hash="abc"] ` + "\xEF\xBB\xBF"
+	if !strings.HasPrefix(string(message), expected) {
+		t.Fatalf("Unexpected syslog header:\n%q\nwant prefix\n%q", message, expected)
+	}
+
+	var decoded repositories.AuditLogEntry
+	if err := json.Unmarshal(message[len(expected):], &decoded); err != nil {
+		t.Fatalf("Message body is not the JSON entry: %v", err)
+	}
+	if decoded.ID != 42 || decoded.Details["reason"] != `quote " and ]` {
+		t.Errorf("Unexpected decoded entry: %+v", decoded)
+	}
+
+	if got := escapeSDParam(`a"b\c]`); got != `a\"b\\c\]` {
+		t.Errorf("Unexpected escaped SD param: %s", got)
+	}
+}
+
+func TestSyslogSink_SendsOctetCountedOverTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		length, err := reader.ReadString(' ')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(length))
+		frame := make([]byte, n)
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			return
+		}
+		received <- string(frame)
+	}()
+
+	sink := NewSyslogSink("tcp", listener.Addr().String(), "central-reporting")
+	if err := sink.Send(testAuditEntry()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	select {
+	case frame := <-received:
+		if !strings.HasPrefix(frame, "<109>1 ") || !strings.HasSuffix(frame, "}") {
+			t.Errorf("Unexpected frame: %q", frame)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Syslog message was not received")
+	}
+}
+
+func TestWebhookSink_SignsRequest(t *testing.T) {
+	secret := strings.Repeat("s", 32)
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header.Clone()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, secret)
+	if err := sink.Send(testAuditEntry()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if header.Get("X-Audit-Event-ID") != "42" {
+		t.Errorf("Expected event id 42, got %q", header.Get("X-Audit-Event-ID"))
+	}
+	expected := "sha256=" + SignAuditWebhook([]byte(secret), header.Get("X-Audit-Timestamp"), body)
+	if header.Get("X-Audit-Signature") != expected {
+		t.Errorf("Signature %q does not match %q", header.Get("X-Audit-Signature"), expected)
+	}
+}
+
+func TestWebhookSink_FailsOnErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	if err := NewWebhookSink(server.URL, "secret").Send(testAuditEntry()); err == nil {
+		t.Error("Expected error for 503 response")
+	}
+}
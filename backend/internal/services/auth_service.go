@@ -12,15 +12,15 @@ import (
 
 // AuthService содержит бизнес-логику для аутентификации
 type AuthService struct {
-	userRepo  *repositories.UserRepository
-	jwtSecret string
+	userRepo *repositories.UserRepository
+	tokens   *auth.KeyManager
 }
 
 // NewAuthService создает новый экземпляр AuthService
-func NewAuthService(userRepo *repositories.UserRepository, jwtSecret string) *AuthService {
+func NewAuthService(userRepo *repositories.UserRepository, tokens *auth.KeyManager) *AuthService {
 	return &AuthService{
-		userRepo:  userRepo,
-		jwtSecret: jwtSecret,
+		userRepo: userRepo,
+		tokens:   tokens,
 	}
 }
 
@@ -58,7 +58,7 @@ func (s *AuthService) Login(username, password string) (*models.User, string, er
 	}
 
 	// Генерируем JWT токен
-	token, err := auth.GenerateToken(*user, s.jwtSecret)
+	token, err := s.tokens.GenerateToken(*user)
 	if err != nil {
 		log.Printf("Failed to generate JWT for user %d: %v", user.ID, err)
 		return nil, "", fmt.Errorf("failed to generate token")
@@ -7,6 +7,7 @@ import (
 	"net/smtp"
 	"os"
 	"strings"
+	"time"
 )
 
 // EmailService предоставляет функциональность отправки email
@@ -59,6 +60,115 @@ func (s *EmailService) SendPasswordResetEmail(toEmail, username, resetToken stri
 	return s.sendEmail(toEmail, subject, body)
 }
 
+// AccountLink ссылка для одной из учётных записей, использующих общий email
+type AccountLink struct {
+	Username string
+	Token    string
+}
+
+// SendPasswordResetChoiceEmail отправляет на общий адрес ссылки сброса пароля для каждой учётной записи
+func (s *EmailService) SendPasswordResetChoiceEmail(toEmail string, accounts []AccountLink) error {
+	frontendURL := getEnv("FRONTEND_URL", "http://localhost:3000")
+
+	var links strings.Builder
+	for _, account := range accounts {
+		links.WriteString(fmt.Sprintf("  %s: %s/reset-password?token=%s\n", account.Username, frontendURL, account.Token))
+	}
+
+	subject := "Восстановление пароля - Central Reporting"
+	body := fmt.Sprintf(`
+Здравствуйте!
+
+Был запрошен сброс пароля по адресу %s. Этот адрес указан у нескольких учётных записей в системе Central Reporting.
+
+Выберите учётную запись, пароль которой нужно сбросить:
+%s
+Ссылки действительны в течение 1 часа.
+
+Если вы не запрашивали сброс пароля, просто проигнорируйте это письмо.
+
+---
+С уважением,
+Команда Central Reporting
+`, toEmail, links.String())
+
+	return s.sendEmail(toEmail, subject, body)
+}
+
+// SendMagicLinkEmail отправляет ссылку для входа без пароля
+func (s *EmailService) SendMagicLinkEmail(toEmail, username, token string, ttlMinutes int) error {
+	frontendURL := getEnv("FRONTEND_URL", "http://localhost:3000")
+	loginLink := fmt.Sprintf("%s/auth/magic-link?token=%s", frontendURL, token)
+
+	subject := "Вход в Central Reporting"
+	body := fmt.Sprintf(`
+Здравствуйте, %s!
+
+Чтобы войти в систему Central Reporting без пароля, перейдите по ссылке:
+%s
+
+Ссылка одноразовая и действительна в течение %d минут.
+
+Если вы не запрашивали вход, просто проигнорируйте это письмо.
+
+---
+С уважением,
+Команда Central Reporting
+`, username, loginLink, ttlMinutes)
+
+	return s.sendEmail(toEmail, subject, body)
+}
+
+// SendMagicLinkChoiceEmail отправляет на общий адрес ссылки входа для каждой учётной записи
+func (s *EmailService) SendMagicLinkChoiceEmail(toEmail string, accounts []AccountLink, ttlMinutes int) error {
+	frontendURL := getEnv("FRONTEND_URL", "http://localhost:3000")
+
+	var links strings.Builder
+	for _, account := range accounts {
+		links.WriteString(fmt.Sprintf("  %s: %s/auth/magic-link?token=%s\n", account.Username, frontendURL, account.Token))
+	}
+
+	subject := "Вход в Central Reporting"
+	body := fmt.Sprintf(`
+Здравствуйте!
+
+Был запрошен вход без пароля по адресу %s. Этот адрес указан у нескольких учётных записей в системе Central Reporting.
+
+Выберите учётную запись для входа:
+%s
+Ссылки одноразовые и действительны в течение %d минут.
+
+Если вы не запрашивали вход, просто проигнорируйте это письмо.
+
+---
+С уважением,
+Команда Central Reporting
+`, toEmail, links.String(), ttlMinutes)
+
+	return s.sendEmail(toEmail, subject, body)
+}
+
+// SendAccessExpiryEmail предупреждает о скором окончании временного доступа
+func (s *EmailService) SendAccessExpiryEmail(toEmail, username, access string, validUntil time.Time) error {
+	subject := "Временный доступ скоро закончится"
+	body := fmt.Sprintf(`
+Здравствуйте, %s!
+
+Временный доступ в системе Central Reporting скоро закончится:
+%s
+
+Доступ действует до %s.
+
+Если доступ нужен дольше, обратитесь к администратору.
+
+---
+С уважением,
+Команда Central Reporting
+`, username, access, validUntil.Format("02.01.2006 15:04"))
+
+	return s.sendEmail(toEmail, subject, body)
+}
+
 // sendEmail отправляет email с использованием SMTP
 func (s *EmailService) sendEmail(to, subject, body string) error {
 	// Проверяем, настроен ли SMTP
@@ -96,7 +206,7 @@ func (s *EmailService) sendEmail(to, subject, body string) error {
 		return fmt.Errorf("failed to send email: %w", err)
 	}
 
-	log.Printf("Password reset email sent to: %s", to)
+	log.Printf("Email sent to: %s", to)
 	return nil
 }
 
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/utils"
+)
+
+// externalAccount данные пользователя из внешней системы (OIDC провайдер, LDAP каталог)
+type externalAccount struct {
+	Username      string
+	FullName      string
+	Email         string
+	Role          models.UserRole
+	Organizations models.Organizations
+}
+
+// provisionExternalUser создает локального пользователя для внешней учётной записи (JIT)
+func provisionExternalUser(userRepo *repositories.UserRepository, account externalAccount) (*models.User, error) {
+	username := utils.SanitizeUsername(account.Username)
+	if username == "" && account.Email != "" {
+		username = utils.SanitizeUsername(strings.SplitN(account.Email, "@", 2)[0])
+	}
+	if valid, errMsg := utils.ValidateUsername(username); !valid {
+		return nil, fmt.Errorf("cannot provision user: %s", errMsg)
+	}
+
+	fullName := utils.SanitizeString(account.FullName)
+	if fullName == "" {
+		fullName = username
+	}
+
+	emails := models.Emails{}
+	if email := utils.SanitizeEmail(account.Email); email != "" && utils.ValidateEmail(email) {
+		emails = append(emails, email)
+	}
+
+	orgs := account.Organizations
+	if orgs == nil {
+		orgs = models.Organizations{}
+	}
+
+	// Случайный пароль, чтобы локальный вход по пустому паролю был невозможен
+	randomPassword, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	user := models.User{
+		FullName:               fullName,
+		Username:               username,
+		Password:               models.NullString{String: randomPassword, Valid: true},
+		ShowInSelection:        true,
+		AvailableOrganizations: orgs,
+		AccessibleUsers:        models.AccessibleUsers{},
+		Emails:                 emails,
+		Phones:                 models.Phones{},
+		CustomFields:           models.CustomFields{},
+		Tags:                   models.Tags{},
+		IsActive:               true,
+		Role:                   account.Role,
+		IsFirstLogin:           false,
+	}
+
+	if err := userRepo.Create(&user); err != nil {
+		return nil, fmt.Errorf("provisioning failed: %w", err)
+	}
+
+	log.Printf("Provisioned external user %d (%s) with role %s", user.ID, user.Username, user.Role)
+	return userRepo.GetByID(user.ID)
+}
+
+// linkableByUsername проверяет, можно ли привязать внешнюю учётную запись к локальной только по совпадению логина
+// или email. Ни то, ни другое во внешней системе не доказывает владение локальной учётной записью, поэтому так
+// привязываются лишь обычные пользователи без локального пароля; администраторов и сервисные учётные записи - никогда
+func linkableByUsername(user *models.User) bool {
+	if user.IsServiceAccount || user.Role != models.RoleUser {
+		return false
+	}
+	return !user.Password.Valid || user.Password.String == ""
+}
+
+// organizationIDsByCodes переводит коды организаций в ID, пропуская неизвестные
+func organizationIDsByCodes(orgRepo *repositories.OrganizationRepository, codes []string) models.Organizations {
+	orgs := models.Organizations{}
+	if orgRepo == nil {
+		return orgs
+	}
+	for _, code := range codes {
+		org, err := orgRepo.GetByCode(code)
+		if err != nil {
+			log.Printf("Unknown organization code %q in external account", code)
+			continue
+		}
+		orgs = append(orgs, org.ID)
+	}
+	return orgs
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+)
+
+// GrantExpiryService уведомляет о скором окончании временных доступов и фиксирует их окончание
+type GrantExpiryService struct {
+	accessGrantRepo  *repositories.AccessGrantRepository
+	orgGrantRepo     *repositories.OrganizationGrantRepository
+	userRepo         *repositories.UserRepository
+	organizationRepo *repositories.OrganizationRepository
+	auditLogRepo     *repositories.AuditLogRepository
+	emailService     *EmailService
+	notifyBefore     time.Duration
+}
+
+// NewGrantExpiryService создает сервис (notifyBefore - за сколько до окончания предупреждать, 0 - не предупреждать)
+func NewGrantExpiryService(
+	accessGrantRepo *repositories.AccessGrantRepository,
+	orgGrantRepo *repositories.OrganizationGrantRepository,
+	userRepo *repositories.UserRepository,
+	organizationRepo *repositories.OrganizationRepository,
+	auditLogRepo *repositories.AuditLogRepository,
+	emailService *EmailService,
+	notifyBefore time.Duration,
+) *GrantExpiryService {
+	return &GrantExpiryService{
+		accessGrantRepo:  accessGrantRepo,
+		orgGrantRepo:     orgGrantRepo,
+		userRepo:         userRepo,
+		organizationRepo: organizationRepo,
+		auditLogRepo:     auditLogRepo,
+		emailService:     emailService,
+		notifyBefore:     notifyBefore,
+	}
+}
+
+// Run отправляет уведомления и фиксирует окончание доступов (вызывается фоновой задачей)
+func (s *GrantExpiryService) Run() error {
+	if s.notifyBefore > 0 {
+		if err := s.notify(time.Now().Add(s.notifyBefore)); err != nil {
+			return err
+		}
+	}
+	return s.expire()
+}
+
+func (s *GrantExpiryService) notify(before time.Time) error {
+	accessGrants, err := s.accessGrantRepo.MarkNotified(before)
+	if err != nil {
+		return fmt.Errorf("mark access grants notified: %w", err)
+	}
+	for _, grant := range accessGrants {
+		s.sendExpiryNotice(grant.GranteeID, grant.GrantedBy.Int64, s.describeAccessGrant(grant), grant.ValidUntil.Time)
+	}
+
+	orgGrants, err := s.orgGrantRepo.MarkNotified(before)
+	if err != nil {
+		return fmt.Errorf("mark organization grants notified: %w", err)
+	}
+	for _, grant := range orgGrants {
+		access := fmt.Sprintf("%s: %s", s.username(grant.UserID), s.describeOrganization(grant.OrganizationID))
+		s.sendExpiryNotice(grant.UserID, grant.GrantedBy.Int64, access, grant.ValidUntil)
+	}
+	return nil
+}
+
+func (s *GrantExpiryService) expire() error {
+	accessGrants, err := s.accessGrantRepo.ExpireDue()
+	if err != nil {
+		return fmt.Errorf("expire access grants: %w", err)
+	}
+	for _, grant := range accessGrants {
+		granteeID := grant.GranteeID
+		s.logExpired(&granteeID, map[string]interface{}{
+			"grant_type":      "user_access",
+			"grant_id":        grant.ID,
+			"scope":           grant.Scope,
+			"user_id":         grant.UserID,
+			"department":      grant.Department,
+			"organization_id": grant.OrganizationID,
+			"valid_until":     grant.ValidUntil,
+		})
+	}
+
+	orgGrants, err := s.orgGrantRepo.ExpireDue()
+	if err != nil {
+		return fmt.Errorf("expire organization grants: %w", err)
+	}
+	for _, grant := range orgGrants {
+		userID := grant.UserID
+		s.logExpired(&userID, map[string]interface{}{
+			"grant_type":      "organization",
+			"grant_id":        grant.ID,
+			"organization_id": grant.OrganizationID,
+			"valid_until":     grant.ValidUntil,
+		})
+	}
+
+	if len(accessGrants)+len(orgGrants) > 0 {
+		log.Printf("Grant expiry: %d access grants and %d organization grants expired", len(accessGrants), len(orgGrants))
+	}
+	return nil
+}
+
+func (s *GrantExpiryService) logExpired(targetUserID *int, details map[string]interface{}) {
+	if err := s.auditLogRepo.LogSystem(repositories.ActionAccessExpired, targetUserID, details); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
+
+// sendExpiryNotice уведомляет получателя доступа и того, кто его выдал
+func (s *GrantExpiryService) sendExpiryNotice(userID int, grantedBy int64, access string, validUntil time.Time) {
+	recipients := []int{userID}
+	if grantedBy != 0 && int(grantedBy) != userID {
+		recipients = append(recipients, int(grantedBy))
+	}
+
+	for _, id := range recipients {
+		user, err := s.userRepo.GetByID(id)
+		if err != nil {
+			log.Printf("Grant expiry: failed to load user %d: %v", id, err)
+			continue
+		}
+		if len(user.Emails) == 0 {
+			continue
+		}
+		if err := s.emailService.SendAccessExpiryEmail(user.Emails[0], user.Username, access, validUntil); err != nil {
+			log.Printf("Grant expiry: failed to notify user %d: %v", id, err)
+		}
+	}
+}
+
+// describeAccessGrant описание доступа к пользователям для письма
+func (s *GrantExpiryService) describeAccessGrant(grant repositories.AccessGrant) string {
+	grantee := s.username(grant.GranteeID)
+
+	switch grant.Scope {
+	case repositories.GrantScopeUser:
+		target := fmt.Sprintf("#%d", grant.UserID.Int64)
+		if user, err := s.userRepo.GetByID(int(grant.UserID.Int64)); err == nil {
+			target = user.FullName
+		}
+		return fmt.Sprintf("%s: доступ к пользователю %s", grantee, target)
+	case repositories.GrantScopeDepartment:
+		return fmt.Sprintf("%s: доступ к пользователям отдела «%s»", grantee, grant.Department.String)
+	default:
+		return fmt.Sprintf("%s: доступ к пользователям, у которых есть %s", grantee, s.describeOrganization(int(grant.OrganizationID.Int64)))
+	}
+}
+
+func (s *GrantExpiryService) username(id int) string {
+	user, err := s.userRepo.GetByID(id)
+	if err != nil {
+		return fmt.Sprintf("пользователь #%d", id)
+	}
+	return user.Username
+}
+
+func (s *GrantExpiryService) describeOrganization(id int) string {
+	org, err := s.organizationRepo.GetByID(id)
+	if err != nil {
+		return fmt.Sprintf("организация #%d", id)
+	}
+	return fmt.Sprintf("организация «%s»", org.Name)
+}
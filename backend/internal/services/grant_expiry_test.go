@@ -0,0 +1,96 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	accessGrantCols = []string{"id", "grantee_id", "scope", "user_id", "department", "organization_id", "granted_by",
+		"valid_from", "valid_until", "notified_at", "expired_at", "created_at"}
+	organizationGrantCols = []string{"id", "user_id", "organization_id", "valid_from", "valid_until", "reason", "granted_by",
+		"notified_at", "expired_at", "created_at"}
+)
+
+func newTestGrantExpiryService(t *testing.T, notifyBefore time.Duration) (*GrantExpiryService, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	return NewGrantExpiryService(
+		repositories.NewAccessGrantRepository(sqlxDB),
+		repositories.NewOrganizationGrantRepository(sqlxDB),
+		repositories.NewUserRepository(sqlxDB),
+		repositories.NewOrganizationRepository(sqlxDB),
+		repositories.NewAuditLogRepository(sqlxDB),
+		&EmailService{},
+		notifyBefore,
+	), mock
+}
+
+func TestGrantExpiryService_NotifiesBeforeExpiry(t *testing.T) {
+	service, mock := newTestGrantExpiryService(t, 72*time.Hour)
+	now := time.Now()
+
+	mock.ExpectQuery("UPDATE user_access_grants SET notified_at = NOW\\(\\)").
+		WillReturnRows(sqlmock.NewRows(accessGrantCols))
+	mock.ExpectQuery("UPDATE organization_grants SET notified_at = NOW\\(\\)").
+		WillReturnRows(sqlmock.NewRows(organizationGrantCols).
+			AddRow(1, 5, 3, now.AddDate(0, 0, -20), now.Add(48*time.Hour), "Аудит", nil, now, nil, now))
+
+	// Описание доступа: логин и организация
+	userRow := sqlmock.NewRows([]string{"id", "username", "emails"}).AddRow(5, "auditor", `["auditor@gov.kz"]`)
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").WithArgs(5).WillReturnRows(userRow)
+	mock.ExpectQuery("SELECT (.+) FROM organizations").WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "is_active"}).AddRow(3, "Акимат", true))
+	// Письмо получателю доступа (granted_by не задан - выдавшему не пишем)
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "emails"}).AddRow(5, "auditor", `["auditor@gov.kz"]`))
+
+	mock.ExpectQuery("UPDATE user_access_grants SET expired_at = NOW\\(\\)").
+		WillReturnRows(sqlmock.NewRows(accessGrantCols))
+	mock.ExpectQuery("UPDATE organization_grants SET expired_at = NOW\\(\\)").
+		WillReturnRows(sqlmock.NewRows(organizationGrantCols))
+
+	if err := service.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGrantExpiryService_AuditsExpiredGrants(t *testing.T) {
+	service, mock := newTestGrantExpiryService(t, 0)
+	now := time.Now()
+
+	mock.ExpectQuery("UPDATE user_access_grants SET expired_at = NOW\\(\\)(.+)WHERE expired_at IS NULL AND valid_until <= NOW\\(\\)").
+		WillReturnRows(sqlmock.NewRows(accessGrantCols).
+			AddRow(4, 7, repositories.GrantScopeDepartment, nil, "Бухгалтерия", nil, 1, now.AddDate(0, -1, 0), now, now, now, now))
+	mock.ExpectExec("INSERT INTO audit_log \\(user_id, action, target_user_id, details\\) VALUES \\(NULL").
+		WithArgs(repositories.ActionAccessExpired, 7, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("UPDATE organization_grants SET expired_at = NOW\\(\\)").
+		WillReturnRows(sqlmock.NewRows(organizationGrantCols).
+			AddRow(2, 9, 3, now.AddDate(0, 0, -14), now, nil, 1, now, now, now))
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(repositories.ActionAccessExpired, 9, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	// notifyBefore = 0: уведомления не отправляются
+	if err := service.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,341 @@
+package services
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/config"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Причина блокировки пользователей, удалённых из каталога
+const ldapRemovedReason = "Учётная запись удалена из каталога LDAP"
+
+// DirectoryEntry пользователь, найденный в LDAP каталоге
+type DirectoryEntry struct {
+	DN       string
+	Username string
+	Email    string
+	FullName string
+	Groups   []string
+}
+
+// Directory операции с каталогом, которые нужны для входа и синхронизации
+// Реальная реализация - ldapDirectory, в тестах используется заглушка в памяти
+type Directory interface {
+	// FindUser ищет пользователя по логину (nil, nil если не найден)
+	FindUser(username string) (*DirectoryEntry, error)
+	// FindByDN ищет пользователя по DN (nil, nil если не найден)
+	FindByDN(dn string) (*DirectoryEntry, error)
+	// Bind проверяет пароль пользователя, возвращает auth.ErrInvalidCredentials при неверном пароле
+	Bind(dn, password string) error
+}
+
+// LDAPAuthenticator вход через LDAP / Active Directory с сопоставлением групп ролям и организациям
+type LDAPAuthenticator struct {
+	cfg          config.LDAPConfig
+	directory    Directory
+	userRepo     *repositories.UserRepository
+	orgRepo      *repositories.OrganizationRepository
+	identityRepo *repositories.UserIdentityRepository
+	auditLogRepo *repositories.AuditLogRepository
+}
+
+// NewLDAPAuthenticator создает способ входа через LDAP
+func NewLDAPAuthenticator(
+	cfg config.LDAPConfig,
+	directory Directory,
+	userRepo *repositories.UserRepository,
+	orgRepo *repositories.OrganizationRepository,
+	identityRepo *repositories.UserIdentityRepository,
+	auditLogRepo *repositories.AuditLogRepository,
+) *LDAPAuthenticator {
+	return &LDAPAuthenticator{
+		cfg:          cfg,
+		directory:    directory,
+		userRepo:     userRepo,
+		orgRepo:      orgRepo,
+		identityRepo: identityRepo,
+		auditLogRepo: auditLogRepo,
+	}
+}
+
+func (a *LDAPAuthenticator) Name() string {
+	return repositories.IdentityProviderLDAP
+}
+
+// Authenticate проверяет пароль в каталоге; пользователей вне каталога передаёт следующему способу входа.
+// Недоступный каталог не блокирует вход: локальные учётные записи (в том числе аварийный администратор)
+// проверяются следующим способом входа
+func (a *LDAPAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	entry, err := a.directory.FindUser(username)
+	if err != nil {
+		log.Printf("LDAP: search for %s failed, falling back to next authenticator: %v", username, err)
+		return nil, auth.ErrUnknownUser
+	}
+	if entry == nil {
+		return nil, auth.ErrUnknownUser
+	}
+
+	// Локальный пользователь определяется до проверки пароля в каталоге: если запись каталога не привязана
+	// и не может быть создана, пользователь с тем же логином входит по локальному паролю
+	user, provision, err := a.findUser(entry)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil && !provision {
+		log.Printf("LDAP: directory user %s has no linkable local account, falling back to next authenticator", username)
+		return nil, auth.ErrUnknownUser
+	}
+
+	// Пустой пароль в LDAP означает анонимный bind, который "успешен" - отклоняем явно
+	if password == "" {
+		return nil, auth.ErrInvalidCredentials
+	}
+	if err := a.directory.Bind(entry.DN, password); err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		if user, err = a.provisionUser(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	// Сервисные учётные записи работают только по API ключам, как и при входе по паролю
+	if user.IsServiceAccount {
+		log.Printf("Interactive login rejected for service account: %s", username)
+		return nil, auth.ErrInvalidCredentials
+	}
+
+	if err := a.identityRepo.Link(user.ID, repositories.IdentityProviderLDAP, entry.DN); err != nil {
+		log.Printf("LDAP: failed to link identity for user %d: %v", user.ID, err)
+	}
+
+	if !user.IsActive {
+		return nil, &auth.BlockedError{User: user}
+	}
+
+	if err := a.applyGroups(user, entry); err != nil {
+		log.Printf("LDAP: failed to apply group mapping for user %d: %v", user.ID, err)
+	}
+
+	return a.userRepo.GetByID(user.ID)
+}
+
+// Sync сверяет привязанных пользователей с каталогом: удалённых блокирует, остальным обновляет роль и организации
+func (a *LDAPAuthenticator) Sync() error {
+	identities, err := a.identityRepo.ListByProvider(repositories.IdentityProviderLDAP)
+	if err != nil {
+		return err
+	}
+
+	deactivated := 0
+	for _, identity := range identities {
+		entry, err := a.directory.FindByDN(identity.ExternalID)
+		if err != nil {
+			// Ошибка каталога не повод блокировать пользователя
+			log.Printf("LDAP sync: lookup of %s failed: %v", identity.ExternalID, err)
+			continue
+		}
+
+		if entry == nil {
+			changed, err := a.userRepo.DeactivateUser(identity.UserID, ldapRemovedReason)
+			if err != nil {
+				log.Printf("LDAP sync: failed to deactivate user %d: %v", identity.UserID, err)
+				continue
+			}
+			if changed {
+				deactivated++
+				userID := identity.UserID
+				if err := a.auditLogRepo.LogSystem(repositories.ActionBlockUser, &userID, map[string]interface{}{
+					"reason": ldapRemovedReason,
+					"source": "ldap_sync",
+					"dn":     identity.ExternalID,
+				}); err != nil {
+					log.Printf("Failed to write audit log: %v", err)
+				}
+				log.Printf("AUDIT: LDAP sync deactivated user %d (%s removed from directory)", identity.UserID, identity.ExternalID)
+			}
+			continue
+		}
+
+		user, err := a.userRepo.GetByID(identity.UserID)
+		if err != nil {
+			log.Printf("LDAP sync: failed to load user %d: %v", identity.UserID, err)
+			continue
+		}
+		if err := a.applyGroups(user, entry); err != nil {
+			log.Printf("LDAP sync: failed to apply groups for user %d: %v", identity.UserID, err)
+			continue
+		}
+		if err := a.identityRepo.MarkSynced(identity.ID); err != nil {
+			log.Printf("LDAP sync: failed to mark identity %d synced: %v", identity.ID, err)
+		}
+	}
+
+	log.Printf("LDAP sync completed: %d identities checked, %d users deactivated", len(identities), deactivated)
+	return nil
+}
+
+// findUser находит локального пользователя по привязанному DN; provision = true - пользователя нет и его можно создать.
+// По логину привязывает только если это явно разрешено (LDAP_LINK_BY_USERNAME) и учётную запись можно так привязать;
+// иначе пользователь с тем же логином входит по локальному паролю
+func (a *LDAPAuthenticator) findUser(entry *DirectoryEntry) (*models.User, bool, error) {
+	linked, err := a.identityRepo.GetByExternalID(repositories.IdentityProviderLDAP, entry.DN)
+	if err != nil {
+		return nil, false, err
+	}
+	if linked != nil {
+		user, err := a.userRepo.GetByID(linked.UserID)
+		return user, false, err
+	}
+
+	user, err := a.userRepo.GetByUsername(entry.Username)
+	if err != nil {
+		return nil, false, err
+	}
+	if user != nil {
+		if a.cfg.LinkByUsername && linkableByUsername(user) {
+			return user, false, nil
+		}
+		log.Printf("LDAP: refusing to link %s to user %d by username", entry.DN, user.ID)
+		return nil, false, nil
+	}
+	return nil, a.cfg.AutoProvision, nil
+}
+
+// provisionUser создаёт локального пользователя для записи каталога (после проверки пароля)
+func (a *LDAPAuthenticator) provisionUser(entry *DirectoryEntry) (*models.User, error) {
+	role, ok := auth.MapGroupsToRole(entry.Groups, a.cfg.RoleMapping)
+	if !ok {
+		role = models.UserRole(a.cfg.DefaultRole)
+	}
+	return provisionExternalUser(a.userRepo, externalAccount{
+		Username:      entry.Username,
+		FullName:      entry.FullName,
+		Email:         entry.Email,
+		Role:          role,
+		Organizations: organizationIDsByCodes(a.orgRepo, auth.MapGroupsToValues(entry.Groups, a.cfg.OrganizationMapping)),
+	})
+}
+
+// applyGroups применяет сопоставление групп ролям и организациям, если оно настроено.
+// Если ни одна группа не сопоставлена роли, роль не меняется (как в OIDCService.syncClaims):
+// роль по умолчанию назначается только при создании пользователя
+func (a *LDAPAuthenticator) applyGroups(user *models.User, entry *DirectoryEntry) error {
+	role, ok := auth.MapGroupsToRole(entry.Groups, a.cfg.RoleMapping)
+	if !ok {
+		role = user.Role
+	}
+
+	orgs := user.AvailableOrganizations
+	if len(a.cfg.OrganizationMapping) > 0 {
+		orgs = organizationIDsByCodes(a.orgRepo, auth.MapGroupsToValues(entry.Groups, a.cfg.OrganizationMapping))
+	}
+
+	return a.userRepo.ApplyDirectoryAttributes(user.ID, role, orgs)
+}
+
+// ldapDirectory реализация Directory поверх go-ldap
+type ldapDirectory struct {
+	cfg config.LDAPConfig
+}
+
+// NewLDAPDirectory создает клиент каталога (соединение открывается на каждую операцию)
+func NewLDAPDirectory(cfg config.LDAPConfig) Directory {
+	return &ldapDirectory{cfg: cfg}
+}
+
+func (d *ldapDirectory) FindUser(username string) (*DirectoryEntry, error) {
+	filter := fmt.Sprintf(d.cfg.UserFilter, ldap.EscapeFilter(username))
+	return d.search(d.cfg.BaseDN, ldap.ScopeWholeSubtree, filter)
+}
+
+func (d *ldapDirectory) FindByDN(dn string) (*DirectoryEntry, error) {
+	entry, err := d.search(dn, ldap.ScopeBaseObject, "(objectClass=*)")
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		return nil, nil
+	}
+	return entry, err
+}
+
+func (d *ldapDirectory) Bind(dn, password string) error {
+	conn, err := d.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(dn, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return auth.ErrInvalidCredentials
+		}
+		return err
+	}
+	return nil
+}
+
+// search выполняет поиск под сервисной учётной записью и возвращает единственный результат
+func (d *ldapDirectory) search(baseDN string, scope int, filter string) (*DirectoryEntry, error) {
+	conn, err := d.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if d.cfg.BindDN != "" {
+		if err := conn.Bind(d.cfg.BindDN, d.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("service bind failed: %w", err)
+		}
+	}
+
+	request := ldap.NewSearchRequest(
+		baseDN, scope, ldap.NeverDerefAliases, 2, 0, false, filter,
+		[]string{d.cfg.UsernameAttribute, d.cfg.EmailAttribute, d.cfg.NameAttribute, d.cfg.GroupAttribute},
+		nil,
+	)
+	result, err := conn.Search(request)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(result.Entries) {
+	case 0:
+		return nil, nil
+	case 1:
+		entry := result.Entries[0]
+		return &DirectoryEntry{
+			DN:       entry.DN,
+			Username: entry.GetAttributeValue(d.cfg.UsernameAttribute),
+			Email:    strings.ToLower(entry.GetAttributeValue(d.cfg.EmailAttribute)),
+			FullName: entry.GetAttributeValue(d.cfg.NameAttribute),
+			Groups:   entry.GetAttributeValues(d.cfg.GroupAttribute),
+		}, nil
+	default:
+		return nil, errors.New("ldap: filter matched more than one entry")
+	}
+}
+
+func (d *ldapDirectory) dial() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: d.cfg.InsecureSkipVerify}
+
+	conn, err := ldap.DialURL(d.cfg.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("ldap dial failed: %w", err)
+	}
+
+	if d.cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap StartTLS failed: %w", err)
+		}
+	}
+	return conn, nil
+}
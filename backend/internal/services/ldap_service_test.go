@@ -0,0 +1,311 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/config"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// stubDirectory каталог в памяти вместо LDAP сервера
+type stubDirectory struct {
+	entries   map[string]*DirectoryEntry // по логину
+	passwords map[string]string          // по DN
+	failDN    string                     // DN, поиск которого возвращает ошибку
+	down      bool                       // каталог недоступен
+}
+
+func (d *stubDirectory) FindUser(username string) (*DirectoryEntry, error) {
+	if d.down {
+		return nil, errors.New("ldap dial failed: connection refused")
+	}
+	return d.entries[username], nil
+}
+
+func (d *stubDirectory) FindByDN(dn string) (*DirectoryEntry, error) {
+	if dn == d.failDN {
+		return nil, errors.New("directory unavailable")
+	}
+	for _, entry := range d.entries {
+		if entry.DN == dn {
+			return entry, nil
+		}
+	}
+	return nil, nil
+}
+
+func (d *stubDirectory) Bind(dn, password string) error {
+	if d.passwords[dn] != password {
+		return auth.ErrInvalidCredentials
+	}
+	return nil
+}
+
+func newTestLDAPAuthenticator(t *testing.T) (*LDAPAuthenticator, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	directory := &stubDirectory{
+		entries: map[string]*DirectoryEntry{
+			"akhmetov": {
+				DN:       "CN=Akhmetov,OU=Staff,DC=gov,DC=kz",
+				Username: "akhmetov",
+				Email:    "akhmetov@gov.kz",
+				FullName: "Ахметов Ерлан",
+				Groups:   []string{"CN=CR-Moderators,OU=Groups,DC=gov,DC=kz"},
+			},
+		},
+		passwords: map[string]string{"CN=Akhmetov,OU=Staff,DC=gov,DC=kz": "Secret123!"},
+	}
+
+	cfg := config.LDAPConfig{
+		RoleMapping: map[string]string{"cn=cr-moderators,ou=groups,dc=gov,dc=kz": "moderator"},
+		DefaultRole: "user",
+	}
+
+	return NewLDAPAuthenticator(cfg, directory,
+		repositories.NewUserRepository(sqlxDB),
+		repositories.NewOrganizationRepository(sqlxDB),
+		repositories.NewUserIdentityRepository(sqlxDB),
+		repositories.NewAuditLogRepository(sqlxDB),
+	), mock
+}
+
+func TestLDAPAuthenticate_UnknownUserFallsThrough(t *testing.T) {
+	authenticator, mock := newTestLDAPAuthenticator(t)
+
+	_, err := authenticator.Authenticate("local-admin", "Admin123!")
+	if !errors.Is(err, auth.ErrUnknownUser) {
+		t.Errorf("Authenticate() error = %v, want ErrUnknownUser", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestLDAPAuthenticate_DirectoryDown проверяет, что при недоступном каталоге вход передаётся проверке локального пароля
+func TestLDAPAuthenticate_DirectoryDown(t *testing.T) {
+	authenticator, mock := newTestLDAPAuthenticator(t)
+	authenticator.directory.(*stubDirectory).down = true
+
+	_, err := authenticator.Authenticate("admin", "Admin123!")
+	if !errors.Is(err, auth.ErrUnknownUser) {
+		t.Errorf("Authenticate() error = %v, want ErrUnknownUser", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestLDAPAuthenticate_WrongPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+	}{
+		{"Wrong password", "wrong"},
+		{"Empty password (anonymous bind)", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator, mock := newTestLDAPAuthenticator(t)
+
+			mock.ExpectQuery("FROM user_identities\\s+WHERE provider = \\$1 AND external_id = \\$2").
+				WithArgs("ldap", "CN=Akhmetov,OU=Staff,DC=gov,DC=kz").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "provider", "external_id"}).
+					AddRow(1, 10, "ldap", "CN=Akhmetov,OU=Staff,DC=gov,DC=kz"))
+			mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").
+				WithArgs(10).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "username", "role", "is_active"}).
+					AddRow(10, "akhmetov", "user", true))
+
+			_, err := authenticator.Authenticate("akhmetov", tt.password)
+			if !errors.Is(err, auth.ErrInvalidCredentials) {
+				t.Errorf("Authenticate() error = %v, want ErrInvalidCredentials", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// TestLDAPAuthenticate_LocalPasswordWithSameUsername проверяет, что неверный пароль каталога не мешает
+// непривязанному локальному администратору с тем же логином войти по локальному паролю
+func TestLDAPAuthenticate_LocalPasswordWithSameUsername(t *testing.T) {
+	authenticator, mock := newTestLDAPAuthenticator(t)
+	authenticators := []auth.Authenticator{authenticator, auth.NewPasswordAuthenticator(authenticator.userRepo)}
+	hash, _ := bcrypt.GenerateFromPassword([]byte("Local123!"), bcrypt.MinCost)
+
+	mock.ExpectQuery("FROM user_identities\\s+WHERE provider = \\$1 AND external_id = \\$2").
+		WithArgs("ldap", "CN=Akhmetov,OU=Staff,DC=gov,DC=kz").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("FROM users WHERE LOWER\\(username\\) = LOWER\\(\\$1\\)").
+			WithArgs("akhmetov").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "role", "is_active"}).
+				AddRow(1, "akhmetov", "admin", true))
+	}
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "role", "is_active"}).
+			AddRow(1, "akhmetov", string(hash), "admin", true))
+
+	user, method, err := auth.Authenticate(authenticators, "akhmetov", "Local123!")
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if user.ID != 1 || method != "password" {
+		t.Errorf("Authenticate() = user %d via %s, want user 1 via password", user.ID, method)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestLDAPAuthenticate_DoesNotLinkLocalAccountByUsername проверяет, что запись каталога с логином локального
+// администратора не привязывается к нему: вход передаётся проверке локального пароля
+func TestLDAPAuthenticate_DoesNotLinkLocalAccountByUsername(t *testing.T) {
+	tests := []struct {
+		name           string
+		linkByUsername bool
+		role           string
+	}{
+		{name: "Linking by username disabled", role: "user"},
+		{name: "Admin is never linked", linkByUsername: true, role: "admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator, mock := newTestLDAPAuthenticator(t)
+			authenticator.cfg.LinkByUsername = tt.linkByUsername
+			authenticator.cfg.AutoProvision = true
+
+			mock.ExpectQuery("FROM user_identities\\s+WHERE provider = \\$1 AND external_id = \\$2").
+				WithArgs("ldap", "CN=Akhmetov,OU=Staff,DC=gov,DC=kz").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectQuery("FROM users WHERE LOWER\\(username\\) = LOWER\\(\\$1\\)").
+				WithArgs("akhmetov").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "role", "is_active"}).
+					AddRow(1, "akhmetov", nil, tt.role, true))
+
+			_, err := authenticator.Authenticate("akhmetov", "Secret123!")
+			if !errors.Is(err, auth.ErrUnknownUser) {
+				t.Errorf("Authenticate() error = %v, want ErrUnknownUser", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestLDAPSync_DeactivatesRemovedUsers(t *testing.T) {
+	authenticator, mock := newTestLDAPAuthenticator(t)
+	authenticator.directory.(*stubDirectory).failDN = "CN=Unreachable,OU=Staff,DC=gov,DC=kz"
+
+	mock.ExpectQuery("SELECT (.+) FROM user_identities WHERE provider = \\$1").
+		WithArgs("ldap").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "provider", "external_id"}).
+			AddRow(1, 10, "ldap", "CN=Removed,OU=Staff,DC=gov,DC=kz").
+			AddRow(2, 11, "ldap", "CN=Unreachable,OU=Staff,DC=gov,DC=kz"))
+
+	// Пользователь, удалённый из каталога, блокируется
+	mock.ExpectExec("UPDATE users SET is_active = false(.+)WHERE id = \\$2 AND is_active = true").
+		WithArgs(ldapRemovedReason, 10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO audit_log \\(user_id, action, target_user_id, details\\) VALUES \\(NULL").
+		WithArgs(repositories.ActionBlockUser, 10, []byte(`{"dn":"CN=Removed,OU=Staff,DC=gov,DC=kz","reason":"`+ldapRemovedReason+`","source":"ldap_sync"}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// Ошибка каталога для второго пользователя не приводит к блокировке
+
+	if err := authenticator.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestLDAPAuthenticate_ServiceAccount проверяет, что запись каталога, привязанная к сервисной учётной записи,
+// не получает интерактивный вход
+func TestLDAPAuthenticate_ServiceAccount(t *testing.T) {
+	authenticator, mock := newTestLDAPAuthenticator(t)
+
+	mock.ExpectQuery("FROM user_identities\\s+WHERE provider = \\$1 AND external_id = \\$2").
+		WithArgs("ldap", "CN=Akhmetov,OU=Staff,DC=gov,DC=kz").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "provider", "external_id"}).
+			AddRow(1, 10, "ldap", "CN=Akhmetov,OU=Staff,DC=gov,DC=kz"))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "role", "is_active", "is_service_account"}).
+			AddRow(10, "akhmetov", "user", true, true))
+
+	_, err := authenticator.Authenticate("akhmetov", "Secret123!")
+	if !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Errorf("Authenticate() error = %v, want ErrInvalidCredentials", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestLDAPSync_KeepsRoleWithoutMappedGroups проверяет, что пользователь без сопоставленных групп
+// не понижается до роли по умолчанию
+func TestLDAPSync_KeepsRoleWithoutMappedGroups(t *testing.T) {
+	authenticator, mock := newTestLDAPAuthenticator(t)
+	authenticator.directory.(*stubDirectory).entries["akhmetov"].Groups = []string{"CN=Staff,OU=Groups,DC=gov,DC=kz"}
+
+	mock.ExpectQuery("SELECT (.+) FROM user_identities WHERE provider = \\$1").
+		WithArgs("ldap").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "provider", "external_id"}).
+			AddRow(1, 10, "ldap", "CN=Akhmetov,OU=Staff,DC=gov,DC=kz"))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "role", "available_organizations"}).
+			AddRow(10, "akhmetov", "admin", []byte("[1]")))
+	mock.ExpectExec("UPDATE users SET role = \\$1, available_organizations = \\$2").
+		WithArgs(models.RoleAdmin, models.Organizations{1}, 10).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE user_identities SET last_synced_at = NOW\\(\\) WHERE id = \\$1").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := authenticator.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestMapGroupsToRole(t *testing.T) {
+	mapping := map[string]string{
+		"CN=CR-Admins,DC=gov,DC=kz":     "admin",
+		"CN=CR-Moderators,DC=gov,DC=kz": "moderator",
+	}
+
+	role, ok := auth.MapGroupsToRole([]string{"cn=cr-moderators,dc=gov,dc=kz", "CN=CR-Admins,DC=gov,DC=kz"}, mapping)
+	if !ok || role != "admin" {
+		t.Errorf("MapGroupsToRole() = %s, %v, want admin, true", role, ok)
+	}
+
+	if _, ok := auth.MapGroupsToRole([]string{"CN=Other,DC=gov,DC=kz"}, mapping); ok {
+		t.Error("MapGroupsToRole() should not match unknown groups")
+	}
+}
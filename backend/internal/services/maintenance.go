@@ -0,0 +1,85 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+)
+
+// RetentionPolicy правило хранения данных одной таблицы
+type RetentionPolicy struct {
+	Table string
+	// Apply удаляет устаревшие данные и возвращает число удалённых записей
+	Apply func(now time.Time) (int64, error)
+}
+
+// MaintenanceService применяет правила хранения по таблицам (вызывается фоновой задачей)
+type MaintenanceService struct {
+	auditLogRepo *repositories.AuditLogRepository
+	policies     []RetentionPolicy
+}
+
+// NewMaintenanceService создает сервис с набором правил
+func NewMaintenanceService(auditLogRepo *repositories.AuditLogRepository, policies ...RetentionPolicy) *MaintenanceService {
+	return &MaintenanceService{
+		auditLogRepo: auditLogRepo,
+		policies:     policies,
+	}
+}
+
+// Run применяет все правила; ошибка одного правила не останавливает остальные
+func (s *MaintenanceService) Run(now time.Time) {
+	for _, policy := range s.policies {
+		deleted, err := policy.Apply(now)
+		if err != nil {
+			log.Printf("Error applying retention policy for %s: %v", policy.Table, err)
+		}
+		if deleted == 0 {
+			continue
+		}
+
+		log.Printf("Retention policy for %s deleted %d rows", policy.Table, deleted)
+		if err := s.auditLogRepo.LogSystem(repositories.ActionApplyRetention, nil, map[string]interface{}{
+			"table":   policy.Table,
+			"deleted": deleted,
+		}); err != nil {
+			log.Printf("Failed to write audit log: %v", err)
+		}
+	}
+}
+
+// PurgeDeletedUsers правило хранения корзины пользователей: удалённые раньше срока retention удаляются
+// окончательно (логины освобождаются), по каждому - запись purge_user с логином для контекста журнала
+func PurgeDeletedUsers(userRepo *repositories.UserRepository, auditLogRepo *repositories.AuditLogRepository, retention time.Duration) RetentionPolicy {
+	return RetainFor("users", retention, func(cutoff time.Time) (int64, error) {
+		purged, err := userRepo.PurgeDeleted(cutoff)
+		for _, user := range purged {
+			id := user.ID
+			details := map[string]interface{}{
+				"username":   user.Username,
+				"deleted_at": user.DeletedAt,
+			}
+			if user.DeletedBy != nil {
+				details["deleted_by"] = *user.DeletedBy
+			}
+			if err := auditLogRepo.LogSystem(repositories.ActionPurgeUser, &id, details); err != nil {
+				log.Printf("Failed to write audit log: %v", err)
+			}
+		}
+		return int64(len(purged)), err
+	})
+}
+
+// RetainFor правило "удалять записи старше retention"; нулевой срок отключает правило
+func RetainFor(table string, retention time.Duration, purge func(cutoff time.Time) (int64, error)) RetentionPolicy {
+	return RetentionPolicy{
+		Table: table,
+		Apply: func(now time.Time) (int64, error) {
+			if retention <= 0 {
+				return 0, nil
+			}
+			return purge(now.Add(-retention))
+		},
+	}
+}
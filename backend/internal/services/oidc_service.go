@@ -0,0 +1,345 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/auth"
+	"github.com/UAssylbek/central-reporting/internal/config"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/UAssylbek/central-reporting/internal/utils"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// Время, в течение которого пользователь должен вернуться от провайдера
+const oidcPendingTTL = 10 * time.Minute
+
+var (
+	ErrOIDCInvalidState   = errors.New("oidc: invalid or expired state")
+	ErrOIDCUserNotFound   = errors.New("oidc: user not found and auto provisioning is disabled")
+	ErrOIDCAmbiguousUser  = errors.New("oidc: several users share this email")
+	ErrOIDCMissingClaims  = errors.New("oidc: id token has neither username nor verified email")
+	ErrOIDCServiceAccount = errors.New("oidc: interactive login is not allowed for service accounts")
+)
+
+// OIDCIdentity данные пользователя, полученные из ID токена провайдера
+type OIDCIdentity struct {
+	Subject       string
+	Username      string
+	Email         string
+	EmailVerified bool
+	FullName      string
+	Roles         []string
+	Organizations []string
+}
+
+// oidcPendingAuth параметры начатого входа, ожидающего callback
+type oidcPendingAuth struct {
+	verifier  string
+	nonce     string
+	expiresAt time.Time
+}
+
+// OIDCService реализует вход через OpenID Connect (authorization code + PKCE)
+type OIDCService struct {
+	cfg          config.OIDCConfig
+	oauth2Config oauth2.Config
+	verifier     *oidc.IDTokenVerifier
+	userRepo     *repositories.UserRepository
+	orgRepo      *repositories.OrganizationRepository
+	identityRepo *repositories.UserIdentityRepository
+
+	mu      sync.Mutex
+	pending map[string]oidcPendingAuth
+}
+
+// NewOIDCService выполняет discovery провайдера и создает сервис
+func NewOIDCService(
+	ctx context.Context,
+	cfg config.OIDCConfig,
+	userRepo *repositories.UserRepository,
+	orgRepo *repositories.OrganizationRepository,
+	identityRepo *repositories.UserIdentityRepository,
+) (*OIDCService, error) {
+	provider, err := oidc.NewProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %w", err)
+	}
+
+	return &OIDCService{
+		cfg: cfg,
+		oauth2Config: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       cfg.Scopes,
+		},
+		verifier:     provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		userRepo:     userRepo,
+		orgRepo:      orgRepo,
+		identityRepo: identityRepo,
+		pending:      make(map[string]oidcPendingAuth),
+	}, nil
+}
+
+// AuthCodeURL начинает вход: генерирует state, nonce и PKCE verifier и возвращает адрес провайдера
+func (s *OIDCService) AuthCodeURL() (string, error) {
+	state, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	s.mu.Lock()
+	s.cleanupPendingLocked()
+	s.pending[state] = oidcPendingAuth{
+		verifier:  verifier,
+		nonce:     nonce,
+		expiresAt: time.Now().Add(oidcPendingTTL),
+	}
+	s.mu.Unlock()
+
+	return s.oauth2Config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange обменивает код авторизации на токены и проверяет ID токен
+func (s *OIDCService) Exchange(ctx context.Context, state, code string) (*OIDCIdentity, error) {
+	s.mu.Lock()
+	pending, ok := s.pending[state]
+	delete(s.pending, state)
+	s.mu.Unlock()
+
+	if !ok || time.Now().After(pending.expiresAt) {
+		return nil, ErrOIDCInvalidState
+	}
+
+	token, err := s.oauth2Config.Exchange(ctx, code, oauth2.VerifierOption(pending.verifier))
+	if err != nil {
+		return nil, fmt.Errorf("oidc code exchange failed: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("oidc: token response has no id_token")
+	}
+
+	idToken, err := s.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("oidc id token verification failed: %w", err)
+	}
+	if idToken.Nonce != pending.nonce {
+		return nil, errors.New("oidc: nonce mismatch")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("oidc: cannot parse claims: %w", err)
+	}
+
+	return s.identityFromClaims(idToken.Subject, claims), nil
+}
+
+// ResolveUser сопоставляет identity с существующим пользователем или создает нового (JIT)
+func (s *OIDCService) ResolveUser(identity *OIDCIdentity) (*models.User, bool, error) {
+	user, err := s.findUser(identity)
+	if err != nil {
+		return nil, false, err
+	}
+	// Сервисные учётные записи работают только по API ключам, как и при входе по паролю
+	if user != nil && user.IsServiceAccount {
+		return nil, false, ErrOIDCServiceAccount
+	}
+
+	created := false
+	if user == nil {
+		if !s.cfg.AutoProvision {
+			return nil, false, ErrOIDCUserNotFound
+		}
+		user, err = provisionExternalUser(s.userRepo, externalAccount{
+			Username:      identity.Username,
+			FullName:      identity.FullName,
+			Email:         s.verifiedEmail(identity),
+			Role:          s.mapRole(identity.Roles),
+			Organizations: organizationIDsByCodes(s.orgRepo, identity.Organizations),
+		})
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: %v", ErrOIDCMissingClaims, err)
+		}
+		created = true
+	} else if s.cfg.SyncClaims {
+		if err := s.syncClaims(user, identity); err != nil {
+			log.Printf("OIDC: failed to sync claims for user %d: %v", user.ID, err)
+		}
+	}
+
+	if err := s.identityRepo.Link(user.ID, repositories.IdentityProviderOIDC, identity.Subject); err != nil {
+		log.Printf("OIDC: failed to link identity for user %d: %v", user.ID, err)
+	}
+
+	if created {
+		return user, true, nil
+	}
+
+	// Перечитываем пользователя, чтобы получить актуальные role и token_version
+	user, err = s.userRepo.GetByID(user.ID)
+	return user, false, err
+}
+
+// findUser ищет пользователя по привязанному sub. По username (OIDC_LINK_BY_USERNAME) и подтверждённому
+// email (OIDC_LINK_BY_EMAIL) - только если это явно разрешено и учётную запись можно так привязать
+func (s *OIDCService) findUser(identity *OIDCIdentity) (*models.User, error) {
+	if identity.Subject != "" {
+		linked, err := s.identityRepo.GetByExternalID(repositories.IdentityProviderOIDC, identity.Subject)
+		if err != nil {
+			return nil, err
+		}
+		if linked != nil {
+			return s.userRepo.GetByID(linked.UserID)
+		}
+	}
+
+	if s.cfg.LinkByUsername && identity.Username != "" {
+		user, err := s.userRepo.GetByUsername(identity.Username)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil {
+			if linkableByUsername(user) {
+				return user, nil
+			}
+			log.Printf("OIDC: refusing to link sub=%s to user %d by username %s", identity.Subject, user.ID, identity.Username)
+		}
+	}
+
+	email := s.verifiedEmail(identity)
+	if !s.cfg.LinkByEmail || email == "" {
+		return nil, nil
+	}
+
+	users, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	switch len(users) {
+	case 0:
+		return nil, nil
+	case 1:
+		// Email у провайдера тоже не доказывает владение локальной учётной записью
+		if linkableByUsername(&users[0]) {
+			return &users[0], nil
+		}
+		log.Printf("OIDC: refusing to link sub=%s to user %d by email %s", identity.Subject, users[0].ID, email)
+		return nil, nil
+	default:
+		return nil, ErrOIDCAmbiguousUser
+	}
+}
+
+// verifiedEmail возвращает email только если провайдер его подтвердил
+func (s *OIDCService) verifiedEmail(identity *OIDCIdentity) string {
+	if !identity.EmailVerified {
+		return ""
+	}
+	return identity.Email
+}
+
+// syncClaims обновляет роль и организации пользователя по claims провайдера
+func (s *OIDCService) syncClaims(user *models.User, identity *OIDCIdentity) error {
+	role, ok := auth.MapGroupsToRole(identity.Roles, s.cfg.RoleMapping)
+	if !ok {
+		role = user.Role
+	}
+	orgs := organizationIDsByCodes(s.orgRepo, identity.Organizations)
+	if len(orgs) == 0 {
+		orgs = user.AvailableOrganizations
+	}
+	return s.userRepo.ApplyDirectoryAttributes(user.ID, role, orgs)
+}
+
+// identityFromClaims извлекает нужные поля из claims согласно настройкам
+func (s *OIDCService) identityFromClaims(subject string, claims map[string]interface{}) *OIDCIdentity {
+	identity := &OIDCIdentity{
+		Subject:       subject,
+		Username:      claimString(claims, s.cfg.UsernameClaim),
+		Email:         utils.SanitizeEmail(claimString(claims, "email")),
+		FullName:      claimString(claims, "name"),
+		Roles:         claimStrings(claims, s.cfg.RoleClaim),
+		Organizations: claimStrings(claims, s.cfg.OrganizationsClaim),
+	}
+	if verified, ok := claims["email_verified"].(bool); ok {
+		identity.EmailVerified = verified
+	}
+	return identity
+}
+
+// mapRole возвращает роль по группам из claim или роль по умолчанию
+func (s *OIDCService) mapRole(values []string) models.UserRole {
+	if role, ok := auth.MapGroupsToRole(values, s.cfg.RoleMapping); ok {
+		return role
+	}
+	return models.UserRole(s.cfg.DefaultRole)
+}
+
+// cleanupPendingLocked удаляет просроченные незавершённые входы (mu должен быть захвачен)
+func (s *OIDCService) cleanupPendingLocked() {
+	now := time.Now()
+	for state, p := range s.pending {
+		if now.After(p.expiresAt) {
+			delete(s.pending, state)
+		}
+	}
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	if name == "" {
+		return ""
+	}
+	value, _ := claims[name].(string)
+	return strings.TrimSpace(value)
+}
+
+// claimStrings поддерживает как массив строк, так и одиночную строку
+func claimStrings(claims map[string]interface{}, name string) []string {
+	if name == "" {
+		return nil
+	}
+	switch v := claims[name].(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok && str != "" {
+				result = append(result, str)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,385 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/UAssylbek/central-reporting/internal/config"
+	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+const testOIDCClientID = "central-reporting"
+
+// mockIdP минимальный OIDC провайдер для тестов: discovery, JWKS и token endpoint с проверкой PKCE
+type mockIdP struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	idp := &mockIdP{key: key}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss":   idp.server.URL,
+			"aud":   testOIDCClientID,
+			"sub":   "subject-123",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"iat":   time.Now().Unix(),
+			"nonce": idp.nonce,
+		}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test-key"
+		idToken, _ := token.SignedString(key)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func newTestOIDCService(t *testing.T, idp *mockIdP, userRepo *repositories.UserRepository) *OIDCService {
+	cfg := config.OIDCConfig{
+		Enabled:            true,
+		IssuerURL:          idp.server.URL,
+		ClientID:           testOIDCClientID,
+		ClientSecret:       "secret",
+		RedirectURL:        "http://localhost:8080/api/auth/oidc/callback",
+		Scopes:             []string{"openid", "profile", "email"},
+		UsernameClaim:      "preferred_username",
+		RoleClaim:          "groups",
+		OrganizationsClaim: "organizations",
+		RoleMapping:        map[string]string{"cr-admins": "admin", "cr-moderators": "moderator"},
+		DefaultRole:        "user",
+	}
+
+	svc, err := NewOIDCService(context.Background(), cfg, userRepo, nil, nil)
+	if err != nil {
+		t.Fatalf("NewOIDCService() error = %v", err)
+	}
+	return svc
+}
+
+// startLogin начинает вход и сохраняет PKCE challenge и nonce в mock провайдере
+func startLogin(t *testing.T, svc *OIDCService, idp *mockIdP) string {
+	authURL, err := svc.AuthCodeURL()
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+
+	parsed, _ := url.Parse(authURL)
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("code_challenge_method = %q, want S256", query.Get("code_challenge_method"))
+	}
+
+	idp.challenge = query.Get("code_challenge")
+	idp.nonce = query.Get("nonce")
+	return query.Get("state")
+}
+
+func TestOIDCExchange_MockIdP(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.claims = jwt.MapClaims{
+		"preferred_username": "ivanov",
+		"email":              "Ivanov@Gov.KZ",
+		"email_verified":     true,
+		"name":               "Иванов Иван",
+		"groups":             []string{"staff", "cr-moderators"},
+		"organizations":      "MOF",
+	}
+	svc := newTestOIDCService(t, idp, nil)
+
+	state := startLogin(t, svc, idp)
+	identity, err := svc.Exchange(context.Background(), state, "auth-code")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	if identity.Subject != "subject-123" {
+		t.Errorf("Subject = %s, want subject-123", identity.Subject)
+	}
+	if identity.Username != "ivanov" {
+		t.Errorf("Username = %s, want ivanov", identity.Username)
+	}
+	if identity.Email != "ivanov@gov.kz" || !identity.EmailVerified {
+		t.Errorf("Email = %s (verified=%v), want ivanov@gov.kz (verified)", identity.Email, identity.EmailVerified)
+	}
+	if len(identity.Roles) != 2 || len(identity.Organizations) != 1 {
+		t.Errorf("Roles = %v, Organizations = %v", identity.Roles, identity.Organizations)
+	}
+	if role := svc.mapRole(identity.Roles); role != models.RoleModerator {
+		t.Errorf("mapRole() = %s, want moderator", role)
+	}
+
+	// state одноразовый
+	if _, err := svc.Exchange(context.Background(), state, "auth-code"); !errors.Is(err, ErrOIDCInvalidState) {
+		t.Errorf("second Exchange() error = %v, want ErrOIDCInvalidState", err)
+	}
+}
+
+func TestOIDCExchange_InvalidState(t *testing.T) {
+	idp := newMockIdP(t)
+	svc := newTestOIDCService(t, idp, nil)
+	startLogin(t, svc, idp)
+
+	_, err := svc.Exchange(context.Background(), "unknown-state", "auth-code")
+	if !errors.Is(err, ErrOIDCInvalidState) {
+		t.Errorf("Exchange() error = %v, want ErrOIDCInvalidState", err)
+	}
+}
+
+func TestOIDCMapRole(t *testing.T) {
+	svc := &OIDCService{cfg: config.OIDCConfig{
+		RoleMapping: map[string]string{"cr-admins": "admin", "cr-moderators": "moderator"},
+		DefaultRole: "user",
+	}}
+
+	tests := []struct {
+		name   string
+		groups []string
+		want   models.UserRole
+	}{
+		{"No groups", nil, models.RoleUser},
+		{"Unknown groups", []string{"staff"}, models.RoleUser},
+		{"Moderator", []string{"cr-moderators"}, models.RoleModerator},
+		{"Most privileged wins", []string{"cr-moderators", "cr-admins"}, models.RoleAdmin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := svc.mapRole(tt.groups); got != tt.want {
+				t.Errorf("mapRole(%v) = %s, want %s", tt.groups, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCResolveUser_AmbiguousEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	userRepo := repositories.NewUserRepository(sqlx.NewDb(db, "postgres"))
+	svc := &OIDCService{userRepo: userRepo, cfg: config.OIDCConfig{AutoProvision: true, LinkByEmail: true}}
+
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE emails @> (.+)").
+		WithArgs("shared@gov.kz").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).
+			AddRow(1, "petrov1").
+			AddRow(2, "petrov2"))
+
+	_, _, err = svc.ResolveUser(&OIDCIdentity{
+		Username:      "petrov",
+		Email:         "shared@gov.kz",
+		EmailVerified: true,
+	})
+	if !errors.Is(err, ErrOIDCAmbiguousUser) {
+		t.Errorf("ResolveUser() error = %v, want ErrOIDCAmbiguousUser", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestOIDCFindUser_UsernameLinking проверяет, что по preferred_username привязывается только явно разрешённая
+// и безопасная для этого учётная запись: не администратор, не сервисная и без локального пароля
+func TestOIDCFindUser_UsernameLinking(t *testing.T) {
+	tests := []struct {
+		name           string
+		linkByUsername bool
+		role           string
+		password       interface{}
+		service        bool
+		wantLinked     bool
+	}{
+		{name: "Disabled by default", role: "user"},
+		{name: "Admin is never linked", linkByUsername: true, role: "admin"},
+		{name: "Account with local password", linkByUsername: true, role: "user", password: "$2a$10$hash"},
+		{name: "Service account", linkByUsername: true, role: "user", service: true},
+		{name: "Regular user without password", linkByUsername: true, role: "user", wantLinked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create mock: %v", err)
+			}
+			defer db.Close()
+
+			userRepo := repositories.NewUserRepository(sqlx.NewDb(db, "postgres"))
+			svc := &OIDCService{userRepo: userRepo, cfg: config.OIDCConfig{LinkByUsername: tt.linkByUsername}}
+
+			if tt.linkByUsername {
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(username\\) = LOWER\\(\\$1\\)").
+					WithArgs("admin").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "role", "is_service_account"}).
+						AddRow(1, "admin", tt.password, tt.role, tt.service))
+			}
+
+			// Неподтверждённый email не используется для поиска
+			user, err := svc.findUser(&OIDCIdentity{Username: "admin", Email: "admin@gov.kz"})
+			if err != nil {
+				t.Fatalf("findUser() error = %v", err)
+			}
+			if (user != nil) != tt.wantLinked {
+				t.Errorf("findUser() = %+v, want linked = %v", user, tt.wantLinked)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// TestOIDCFindUser_EmailLinking проверяет, что по подтверждённому email привязывается только явно разрешённая
+// и безопасная для этого учётная запись
+func TestOIDCFindUser_EmailLinking(t *testing.T) {
+	tests := []struct {
+		name        string
+		linkByEmail bool
+		role        string
+		password    interface{}
+		service     bool
+		wantLinked  bool
+	}{
+		{name: "Disabled by default", role: "user"},
+		{name: "Admin with matching email is not linked", linkByEmail: true, role: "admin"},
+		{name: "Account with local password", linkByEmail: true, role: "user", password: "$2a$10$hash"},
+		{name: "Service account", linkByEmail: true, role: "user", service: true},
+		{name: "Regular user without password", linkByEmail: true, role: "user", wantLinked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create mock: %v", err)
+			}
+			defer db.Close()
+
+			userRepo := repositories.NewUserRepository(sqlx.NewDb(db, "postgres"))
+			svc := &OIDCService{userRepo: userRepo, cfg: config.OIDCConfig{LinkByEmail: tt.linkByEmail}}
+
+			if tt.linkByEmail {
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE emails @> (.+)").
+					WithArgs("admin@gov.kz").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "role", "is_service_account"}).
+						AddRow(1, "admin", tt.password, tt.role, tt.service))
+			}
+
+			user, err := svc.findUser(&OIDCIdentity{Email: "admin@gov.kz", EmailVerified: true})
+			if err != nil {
+				t.Fatalf("findUser() error = %v", err)
+			}
+			if (user != nil) != tt.wantLinked {
+				t.Errorf("findUser() = %+v, want linked = %v", user, tt.wantLinked)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// TestOIDCResolveUser_ServiceAccount проверяет, что вход через провайдер под сервисной учётной записью отклоняется
+func TestOIDCResolveUser_ServiceAccount(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	svc := &OIDCService{
+		userRepo:     repositories.NewUserRepository(sqlxDB),
+		identityRepo: repositories.NewUserIdentityRepository(sqlxDB),
+	}
+
+	mock.ExpectQuery("SELECT (.+) FROM user_identities WHERE provider = \\$1 AND external_id = \\$2").
+		WithArgs(repositories.IdentityProviderOIDC, "subject-etl").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "provider", "external_id"}).
+			AddRow(1, 9, repositories.IdentityProviderOIDC, "subject-etl"))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").
+		WithArgs(9).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "is_active", "is_service_account"}).
+			AddRow(9, "etl-robot", true, true))
+
+	_, _, err = svc.ResolveUser(&OIDCIdentity{Subject: "subject-etl"})
+	if !errors.Is(err, ErrOIDCServiceAccount) {
+		t.Errorf("ResolveUser() error = %v, want ErrOIDCServiceAccount", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
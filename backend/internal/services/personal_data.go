@@ -0,0 +1,171 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/UAssylbek/central-reporting/internal/repositories"
+)
+
+var (
+	ErrPersonalDataUserNotFound = errors.New("personal data: user not found")
+	ErrUserStillActive          = errors.New("personal data: user is active; block or delete the user before anonymization")
+	ErrUserAlreadyAnonymized    = errors.New("personal data: user is already anonymized")
+)
+
+// Сколько записей журнала аудита читается за один запрос при выгрузке
+const personalDataAuditBatch = 1000
+
+// AnonymizedFields поля, которые стираются при обезличивании
+var AnonymizedFields = repositories.PersonalDataFields
+
+// RetainedData данные, которые остаются после обезличивания
+var RetainedData = []string{
+	"Профиль: логин, роль, организации, должность, подразделение и служебные поля",
+	"Журнал аудита: ID пользователя как автора и объекта действий, логин в записях о создании, IP адреса и User-Agent входов, " +
+		"названия изменённых полей профиля. Значения персональных полей (" + strings.Join(AnonymizedFields, ", ") + ") в журнал не пишутся",
+	"Копии журнала аудита во внешних системах (SIEM) и выгруженные архивы журнала - с тем же содержимым",
+}
+
+// PersonalDataExport все данные пользователя, хранящиеся в системе.
+// Сессии выдаются как JWT и не хранятся: о них говорят is_online, last_seen и версия токена
+// в профиле, а долгоживущий доступ - API ключи и внешние учётные записи
+type PersonalDataExport struct {
+	GeneratedAt        time.Time                        `json:"generated_at"`
+	User               *repositories.PersonalDataUser   `json:"user"`
+	TokenVersion       int                              `json:"token_version"`
+	APIKeys            []repositories.APIKey            `json:"api_keys"`
+	Identities         []repositories.UserIdentity      `json:"identities"`
+	AccessGrants       []repositories.AccessGrant       `json:"access_grants"`
+	OrganizationGrants []repositories.OrganizationGrant `json:"organization_grants"`
+	ChangeRequests     []repositories.ChangeRequest     `json:"change_requests"`
+	// Записи журнала, где пользователь - автор или объект действия, новые первыми
+	AuditLog []repositories.AuditLogView `json:"audit_log"`
+	// Что из этих данных сохранится после обезличивания
+	RetainedAfterAnonymization []string `json:"retained_after_anonymization"`
+}
+
+// PersonalDataService выгрузка и обезличивание персональных данных уволенных сотрудников
+type PersonalDataService struct {
+	userRepo          *repositories.UserRepository
+	apiKeyRepo        *repositories.APIKeyRepository
+	userIdentityRepo  *repositories.UserIdentityRepository
+	accessGrantRepo   *repositories.AccessGrantRepository
+	orgGrantRepo      *repositories.OrganizationGrantRepository
+	changeRequestRepo *repositories.ChangeRequestRepository
+	auditLogRepo      *repositories.AuditLogRepository
+	avatarDir         string
+}
+
+// NewPersonalDataService создает сервис (avatarDir - каталог файлов аватаров)
+func NewPersonalDataService(
+	userRepo *repositories.UserRepository,
+	apiKeyRepo *repositories.APIKeyRepository,
+	userIdentityRepo *repositories.UserIdentityRepository,
+	accessGrantRepo *repositories.AccessGrantRepository,
+	orgGrantRepo *repositories.OrganizationGrantRepository,
+	changeRequestRepo *repositories.ChangeRequestRepository,
+	auditLogRepo *repositories.AuditLogRepository,
+	avatarDir string,
+) *PersonalDataService {
+	return &PersonalDataService{
+		userRepo:          userRepo,
+		apiKeyRepo:        apiKeyRepo,
+		userIdentityRepo:  userIdentityRepo,
+		accessGrantRepo:   accessGrantRepo,
+		orgGrantRepo:      orgGrantRepo,
+		changeRequestRepo: changeRequestRepo,
+		auditLogRepo:      auditLogRepo,
+		avatarDir:         avatarDir,
+	}
+}
+
+// Export собирает все данные пользователя, включая удалённого в корзину
+func (s *PersonalDataService) Export(userID int) (*PersonalDataExport, error) {
+	user, err := s.userRepo.GetPersonalData(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPersonalDataUserNotFound
+		}
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+
+	export := &PersonalDataExport{
+		GeneratedAt:                time.Now(),
+		User:                       user,
+		TokenVersion:               user.TokenVersion,
+		RetainedAfterAnonymization: RetainedData,
+	}
+	if export.APIKeys, err = s.apiKeyRepo.ListByUser(userID); err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+	if export.Identities, err = s.userIdentityRepo.ListByUser(userID); err != nil {
+		return nil, fmt.Errorf("list identities: %w", err)
+	}
+	if export.AccessGrants, err = s.accessGrantRepo.ListByGrantee(userID); err != nil {
+		return nil, fmt.Errorf("list access grants: %w", err)
+	}
+	if export.OrganizationGrants, err = s.orgGrantRepo.ListByUser(userID); err != nil {
+		return nil, fmt.Errorf("list organization grants: %w", err)
+	}
+	if export.ChangeRequests, err = s.changeRequestRepo.ListByTarget(userID); err != nil {
+		return nil, fmt.Errorf("list change requests: %w", err)
+	}
+
+	filter := repositories.AuditLogFilter{ParticipantID: userID, Limit: personalDataAuditBatch}
+	export.AuditLog = []repositories.AuditLogView{}
+	for {
+		page, err := s.auditLogRepo.QueryPage(filter)
+		if err != nil {
+			return nil, fmt.Errorf("query audit log: %w", err)
+		}
+		export.AuditLog = append(export.AuditLog, page.Entries...)
+		if page.NextCursor == nil {
+			break
+		}
+		filter.Before = *page.NextCursor
+	}
+	return export, nil
+}
+
+// Anonymize необратимо стирает персональные данные заблокированного или удалённого пользователя
+// и файл его аватара. Журнал аудита не меняется: записи и ссылки на пользователя сохраняются,
+// значения персональных полей в нём маскированы (см. RetainedData)
+func (s *PersonalDataService) Anonymize(userID, anonymizedBy int) error {
+	user, err := s.userRepo.GetPersonalData(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPersonalDataUserNotFound
+		}
+		return fmt.Errorf("get user: %w", err)
+	}
+	if user.AnonymizedAt.Valid {
+		return ErrUserAlreadyAnonymized
+	}
+	if user.IsActive && !user.DeletedAt.Valid {
+		return ErrUserStillActive
+	}
+
+	avatarURL, anonymized, err := s.userRepo.Anonymize(userID, anonymizedBy)
+	if err != nil {
+		return fmt.Errorf("anonymize user: %w", err)
+	}
+	if !anonymized {
+		// Обезличен параллельным запросом
+		return ErrUserAlreadyAnonymized
+	}
+
+	if avatarURL != "" {
+		filePath := filepath.Join(s.avatarDir, filepath.Base(strings.TrimPrefix(avatarURL, "/uploads/avatars/")))
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: failed to remove avatar file %s of anonymized user %d: %v", filePath, userID, err)
+		}
+	}
+	return nil
+}
@@ -4,41 +4,34 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/UAssylbek/central-reporting/internal/auth"
 	"github.com/UAssylbek/central-reporting/internal/models"
+	"github.com/UAssylbek/central-reporting/internal/policy"
 	"github.com/UAssylbek/central-reporting/internal/repositories"
 	"github.com/UAssylbek/central-reporting/internal/utils"
 )
 
 // UserService содержит бизнес-логику для работы с пользователями
 type UserService struct {
-	userRepo *repositories.UserRepository
+	userRepo    *repositories.UserRepository
+	permissions *auth.PermissionStore
 }
 
 // NewUserService создает новый экземпляр UserService
-func NewUserService(userRepo *repositories.UserRepository) *UserService {
+func NewUserService(userRepo *repositories.UserRepository, permissions *auth.PermissionStore) *UserService {
 	return &UserService{
-		userRepo: userRepo,
+		userRepo:    userRepo,
+		permissions: permissions,
 	}
 }
 
-// GetAllUsers возвращает список всех пользователей с пагинацией
-// Для админов - все пользователи, для модераторов - только доступные
-func (s *UserService) GetAllUsers(role models.UserRole, moderatorID int, params repositories.PaginationParams) (interface{}, error) {
-	if role == models.RoleModerator {
-		// Moderator видит только доступных ему пользователей
-		users, err := s.userRepo.GetAccessibleUsersLight(moderatorID)
-		if err != nil {
-			log.Printf("Error getting accessible users: %v", err)
-			return nil, fmt.Errorf("failed to get users")
-		}
-
-		return map[string]interface{}{
-			"users": users,
-			"total": len(users),
-		}, nil
+// GetAllUsers возвращает список пользователей с пагинацией
+// С правом users.read.all - все пользователи, иначе только доступные
+func (s *UserService) GetAllUsers(perms auth.PermissionSet, requestorID int, params repositories.PaginationParams) (*repositories.PaginatedListResult, error) {
+	if !perms.Has(auth.PermUsersReadAll) {
+		params.AccessibleTo = requestorID
 	}
 
-	// Admin видит всех пользователей с пагинацией
 	result, err := s.userRepo.GetAllPaginatedLight(params)
 	if err != nil {
 		log.Printf("Error getting paginated users: %v", err)
@@ -49,9 +42,9 @@ func (s *UserService) GetAllUsers(role models.UserRole, moderatorID int, params
 }
 
 // GetUserByID возвращает пользователя по ID с проверкой доступа
-func (s *UserService) GetUserByID(userID int, requestorRole models.UserRole, requestorID int) (*models.User, error) {
-	// Проверка доступа для модераторов
-	if requestorRole == models.RoleModerator {
+func (s *UserService) GetUserByID(userID int, perms auth.PermissionSet, requestorID int) (*models.User, error) {
+	// Без права на всех пользователей - проверка доступа
+	if !perms.Has(auth.PermUsersReadAll) {
 		canAccess, err := s.userRepo.CanModeratorAccessUser(requestorID, userID)
 		if err != nil {
 			return nil, fmt.Errorf("access check failed: %w", err)
@@ -131,46 +124,43 @@ func (s *UserService) CreateUser(req models.CreateUserRequest, creatorID int) (*
 }
 
 // UpdateUser обновляет пользователя с проверкой прав доступа
-func (s *UserService) UpdateUser(userID int, req models.UpdateUserRequest, updaterRole models.UserRole, updaterID int) (*models.User, error) {
-	// Проверка доступа для модераторов
-	if updaterRole == models.RoleModerator && updaterID != userID {
+// Возвращает и изменённые поля - вызывающий записывает их в журнал аудита с контекстом запроса
+func (s *UserService) UpdateUser(userID int, req models.UpdateUserRequest, perms auth.PermissionSet, updaterID int) (*models.User, repositories.UserChanges, error) {
+	target := policy.Target{ID: userID, Accessible: true}
+	if updaterID != userID && !perms.Has(auth.PermUsersReadAll) {
 		canAccess, err := s.userRepo.CanModeratorAccessUser(updaterID, userID)
-		if err != nil || !canAccess {
-			return nil, fmt.Errorf("access denied")
-		}
-
-		// Модератор может редактировать только организации
-		req = models.UpdateUserRequest{
-			AvailableOrganizations: req.AvailableOrganizations,
+		if err != nil {
+			return nil, nil, fmt.Errorf("access check failed: %w", err)
 		}
+		target.Accessible = canAccess
 	}
-
-	// Ограничения для обычных пользователей
-	if updaterRole == models.RoleUser {
-		if updaterID != userID {
-			return nil, fmt.Errorf("access denied")
+	if updaterID != userID {
+		role, err := s.userRepo.GetRole(userID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get role of user %d: %w", userID, err)
 		}
+		target.Permissions = s.permissions.Permissions(role)
+	}
 
-		// User не может менять роль, username, пароль, организации
-		req.Role = ""
-		req.Username = ""
-		req.Password = ""
-		req.AvailableOrganizations = nil
-		req.AccessibleUsers = nil
+	// Те же правила полей, что и в UserHandler.UpdateUser
+	decision := policy.EvaluateUpdate(policy.Actor{ID: updaterID, Permissions: perms}, target, req)
+	if err := decision.Err(); err != nil {
+		return nil, nil, err
 	}
 
 	// Проверка на существование username если меняется
 	if req.Username != "" {
 		existingUser, _ := s.userRepo.GetByUsername(req.Username)
 		if existingUser != nil && existingUser.ID != userID {
-			return nil, fmt.Errorf("username already exists")
+			return nil, nil, fmt.Errorf("username already exists")
 		}
 	}
 
 	// Выполняем обновление
-	if err := s.userRepo.Update(userID, req, updaterID); err != nil {
+	changes, err := s.userRepo.Update(userID, req, updaterID)
+	if err != nil {
 		log.Printf("Failed to update user %d: %v", userID, err)
-		return nil, fmt.Errorf("failed to update user")
+		return nil, nil, fmt.Errorf("failed to update user")
 	}
 
 	log.Printf("AUDIT: User %d updated user %d", updaterID, userID)
@@ -178,23 +168,27 @@ func (s *UserService) UpdateUser(userID int, req models.UpdateUserRequest, updat
 	// Получаем обновленного пользователя
 	updatedUser, err := s.userRepo.GetByID(userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get updated user")
+		return nil, nil, fmt.Errorf("failed to get updated user")
 	}
 
 	updatedUser.Password = models.NullString{}
-	return updatedUser, nil
+	return updatedUser, changes, nil
 }
 
-// DeleteUser удаляет пользователя (только для админов)
+// DeleteUser удаляет пользователя в корзину (право users.delete проверяется на маршруте)
 func (s *UserService) DeleteUser(userID int, deleterID int) error {
 	// Нельзя удалить самого себя
 	if userID == deleterID {
 		return fmt.Errorf("cannot delete yourself")
 	}
 
-	if err := s.userRepo.Delete(userID); err != nil {
+	deleted, err := s.userRepo.Delete(userID, deleterID)
+	if err != nil {
 		return fmt.Errorf("failed to delete user")
 	}
+	if !deleted {
+		return fmt.Errorf("user not found")
+	}
 
 	log.Printf("AUDIT: User %d deleted user %d", deleterID, userID)
 	return nil
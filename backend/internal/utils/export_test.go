@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestTableWriter_XLSX(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewTableWriter(ExportFormatXLSX, &buf, "Журнал аудита")
+	if err != nil {
+		t.Fatalf("NewTableWriter() error = %v", err)
+	}
+	writer.WriteRow([]string{"ID", "Детали"})
+	writer.WriteRow([]string{"1", `{"a":"<b> & c"}`})
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Result is not a zip archive: %v", err)
+	}
+
+	files := map[string]string{}
+	for _, f := range archive.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("Missing part %s", name)
+		}
+	}
+	if sheet := files["xl/worksheets/sheet1.xml"]; !strings.Contains(sheet, "&lt;b&gt; &amp; c") {
+		t.Errorf("Cell text is not escaped: %s", sheet)
+	}
+}
+
+func TestTableWriter_CSV(t *testing.T) {
+	var buf bytes.Buffer
+	writer, _ := NewTableWriter(ExportFormatCSV, &buf, "")
+	writer.WriteRow([]string{"Иванов", "=HYPERLINK(\"x\")"})
+	writer.Close()
+
+	got := buf.String()
+	if !strings.HasPrefix(got, "\ufeff") {
+		t.Error("CSV must start with UTF-8 BOM")
+	}
+	if !strings.Contains(got, `"'=HYPERLINK(""x"")"`) {
+		t.Errorf("Formula is not neutralized: %s", got)
+	}
+
+	if _, err := NewTableWriter("pdf", &buf, ""); err == nil {
+		t.Error("NewTableWriter() accepted unknown format")
+	}
+}
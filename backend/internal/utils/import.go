@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+const (
+	// Части книги xlsx больше этого размера (после распаковки) не читаются
+	maxXLSXPartSize = 64 << 20
+	// Строк на листе Excel
+	maxXLSXRows = 1048576
+)
+
+// ReadTable читает таблицу из файла csv или xlsx (первый лист); строки возвращаются в порядке файла,
+// пустые строки xlsx сохраняются, чтобы номера строк совпадали с табличным редактором
+func ReadTable(format string, r io.ReaderAt, size int64) ([][]string, error) {
+	switch format {
+	case ExportFormatCSV:
+		return readCSVTable(io.NewSectionReader(r, 0, size))
+	case ExportFormatXLSX:
+		return readXLSXTable(r, size)
+	default:
+		return nil, fmt.Errorf("unsupported import format: %s", format)
+	}
+}
+
+func readCSVTable(r io.Reader) ([][]string, error) {
+	br := bufio.NewReader(r)
+	// BOM, который добавляет Excel (и NewTableWriter)
+	if bom, err := br.Peek(3); err == nil && string(bom) == "\ufeff" {
+		br.Discard(3)
+	}
+
+	// Excel с русской локалью сохраняет CSV с разделителем ";"
+	reader := csv.NewReader(br)
+	head, _ := br.Peek(4096)
+	line, _, _ := bytes.Cut(head, []byte("\n"))
+	if bytes.Count(line, []byte(";")) > bytes.Count(line, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			// Обратное к csvTableWriter: апостроф перед значением, похожим на формулу
+			if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune("=+-@", rune(cell[1])) {
+				row[i] = cell[1:]
+			}
+		}
+	}
+	return rows, nil
+}
+
+type xlsxRichText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxRichText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+type xlsxCell struct {
+	Ref    string       `xml:"r,attr"`
+	Type   string       `xml:"t,attr"`
+	Value  string       `xml:"v"`
+	Inline xlsxRichText `xml:"is"`
+}
+
+type xlsxRow struct {
+	Index int        `xml:"r,attr"`
+	Cells []xlsxCell `xml:"c"`
+}
+
+func readXLSXTable(r io.ReaderAt, size int64) ([][]string, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("not an xlsx file: %w", err)
+	}
+
+	var sharedStrings struct {
+		Items []xlsxRichText `xml:"si"`
+	}
+	if err := readXLSXPart(z, "xl/sharedStrings.xml", &sharedStrings); err != nil && !errors.Is(err, errXLSXPartNotFound) {
+		return nil, err
+	}
+
+	sheetPath, err := firstXLSXSheet(z)
+	if err != nil {
+		return nil, err
+	}
+	var sheet struct {
+		Rows []xlsxRow `xml:"sheetData>row"`
+	}
+	if err := readXLSXPart(z, sheetPath, &sheet); err != nil {
+		return nil, err
+	}
+
+	rows := [][]string{}
+	for _, row := range sheet.Rows {
+		if row.Index > maxXLSXRows {
+			return nil, fmt.Errorf("invalid row number: %d", row.Index)
+		}
+		// Строки без содержимого Excel не записывает: номер берётся из атрибута r
+		for row.Index > len(rows)+1 {
+			rows = append(rows, []string{})
+		}
+
+		cells := []string{}
+		for i, cell := range row.Cells {
+			column := i
+			if cell.Ref != "" {
+				if column, err = xlsxColumn(cell.Ref); err != nil {
+					return nil, err
+				}
+			}
+			for len(cells) <= column {
+				cells = append(cells, "")
+			}
+
+			switch cell.Type {
+			case "s":
+				var index int
+				if _, err := fmt.Sscan(cell.Value, &index); err != nil || index < 0 || index >= len(sharedStrings.Items) {
+					return nil, fmt.Errorf("invalid shared string in cell %s", cell.Ref)
+				}
+				cells[column] = sharedStrings.Items[index].String()
+			case "inlineStr":
+				cells[column] = cell.Inline.String()
+			default:
+				cells[column] = cell.Value
+			}
+		}
+		rows = append(rows, cells)
+	}
+	return rows, nil
+}
+
+var errXLSXPartNotFound = errors.New("xlsx part not found")
+
+func readXLSXPart(z *zip.Reader, name string, v interface{}) error {
+	for _, f := range z.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return xml.NewDecoder(io.LimitReader(rc, maxXLSXPartSize)).Decode(v)
+	}
+	return fmt.Errorf("%w: %s", errXLSXPartNotFound, name)
+}
+
+// firstXLSXSheet путь к первому листу книги
+func firstXLSXSheet(z *zip.Reader) (string, error) {
+	var workbook struct {
+		Sheets []struct {
+			RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Items []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := readXLSXPart(z, "xl/workbook.xml", &workbook); err != nil {
+		return "", err
+	}
+	if err := readXLSXPart(z, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", errors.New("xlsx workbook has no sheets")
+	}
+
+	for _, rel := range rels.Items {
+		if rel.ID != workbook.Sheets[0].RelID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return "", errors.New("xlsx first sheet not found")
+}
+
+// xlsxColumn номер столбца (с нуля) из ссылки на ячейку: "B3" -> 1
+func xlsxColumn(ref string) (int, error) {
+	column := 0
+	letters := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A'+1)
+		letters++
+	}
+	if letters == 0 || letters > 3 {
+		return 0, fmt.Errorf("invalid cell reference: %s", ref)
+	}
+	return column - 1, nil
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadTable_RoundTrip(t *testing.T) {
+	rows := [][]string{
+		{"full_name", "username", "phones"},
+		{"Иванов Иван", "ivanov", "+77011234567"},
+		{"Петров <Пётр> & Co", "petrov", ""},
+	}
+
+	for _, format := range []string{ExportFormatCSV, ExportFormatXLSX} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := NewTableWriter(format, &buf, "Пользователи")
+			if err != nil {
+				t.Fatalf("NewTableWriter() error = %v", err)
+			}
+			for _, row := range rows {
+				writer.WriteRow(row)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			got, err := ReadTable(format, bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatalf("ReadTable() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, rows) {
+				t.Errorf("ReadTable() = %q, want %q", got, rows)
+			}
+		})
+	}
+}
+
+func TestReadTable_CSVSemicolon(t *testing.T) {
+	data := "\ufeffФИО;Логин\nИванов Иван;ivanov\n"
+	got, err := ReadTable(ExportFormatCSV, strings.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ReadTable() error = %v", err)
+	}
+	want := [][]string{{"ФИО", "Логин"}, {"Иванов Иван", "ivanov"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadTable() = %q, want %q", got, want)
+	}
+}
+
+// TestReadTable_XLSXSharedStrings книга в том виде, в каком её сохраняет Excel:
+// общие строки, ссылки на ячейки с пропусками и пропущенные пустые строки
+func TestReadTable_XLSXSharedStrings(t *testing.T) {
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Лист1" sheetId="1" r:id="rId3"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId3" Type="worksheet" Target="worksheets/data.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<si><t>ФИО</t></si><si><t>Логин</t></si><si><r><t>Иванов </t></r><r><t>Иван</t></r></si></sst>`,
+		"xl/worksheets/data.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>` +
+			`<row r="3"><c r="A3" t="s"><v>2</v></c><c r="B3"><v>36526</v></c><c r="C3" t="inlineStr"><is><t>ivanov</t></is></c></row>` +
+			`</sheetData></worksheet>`,
+	}
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	for name, content := range parts {
+		f, _ := z.Create(name)
+		f.Write([]byte(content))
+	}
+	z.Close()
+
+	got, err := ReadTable(ExportFormatXLSX, bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("ReadTable() error = %v", err)
+	}
+	want := [][]string{{"ФИО", "", "Логин"}, {}, {"Иванов Иван", "36526", "ivanov"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadTable() = %q, want %q", got, want)
+	}
+}
@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"crypto/rand"
 	"fmt"
+	"math/big"
 	"regexp"
 	"unicode"
 )
@@ -100,6 +102,58 @@ func ValidatePassword(password string) PasswordValidationResult {
 	return result
 }
 
+// Наборы символов временного пароля (без похожих друг на друга l, I, O, 0, 1)
+var passwordCharsets = []string{
+	"ABCDEFGHJKLMNPQRSTUVWXYZ",
+	"abcdefghijkmnopqrstuvwxyz",
+	"23456789",
+	"!@#$%^&*-_=+?",
+}
+
+// GeneratePassword создает случайный временный пароль длины length (не меньше 8),
+// который проходит ValidatePassword: по символу из каждого набора, остальные - из всех наборов
+func GeneratePassword(length int) (string, error) {
+	if length < 8 {
+		length = 8
+	}
+
+	all := ""
+	password := make([]byte, 0, length)
+	for _, charset := range passwordCharsets {
+		all += charset
+		char, err := randomChar(charset)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, char)
+	}
+	for len(password) < length {
+		char, err := randomChar(all)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, char)
+	}
+
+	// Перемешиваем, чтобы обязательные символы не стояли в начале
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+	return string(password), nil
+}
+
+func randomChar(charset string) (byte, error) {
+	index, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+	if err != nil {
+		return 0, err
+	}
+	return charset[index.Int64()], nil
+}
+
 // ValidateEmail проверяет корректность email адреса
 func ValidateEmail(email string) bool {
 	if email == "" {
@@ -146,6 +200,17 @@ func ValidateUsername(username string) (bool, string) {
 	return true, ""
 }
 
+// roleNameRegex имя роли: строчные латинские буквы, цифры, дефисы и подчеркивания, начинается с буквы
+var roleNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_-]{2,49}$`)
+
+// ValidateRoleName проверяет корректность имени роли
+func ValidateRoleName(name string) (bool, string) {
+	if !roleNameRegex.MatchString(name) {
+		return false, "Имя роли должно содержать от 3 до 50 символов: строчные латинские буквы, цифры, дефисы и подчеркивания, начинаться с буквы"
+	}
+	return true, ""
+}
+
 // FormatValidationErrors форматирует список ошибок валидации в строку
 func FormatValidationErrors(errors []string) string {
 	if len(errors) == 0 {
@@ -107,6 +107,26 @@ func TestValidatePassword(t *testing.T) {
 	}
 }
 
+func TestGeneratePassword(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		password, err := GeneratePassword(12)
+		if err != nil {
+			t.Fatalf("GeneratePassword() error = %v", err)
+		}
+		if len(password) != 12 {
+			t.Errorf("GeneratePassword() length = %d, want 12", len(password))
+		}
+		if result := ValidatePassword(password); !result.Valid {
+			t.Errorf("GeneratePassword() = %q does not pass ValidatePassword: %v", password, result.Errors)
+		}
+		seen[password] = true
+	}
+	if len(seen) < 50 {
+		t.Error("GeneratePassword() returned repeated passwords")
+	}
+}
+
 func TestValidateEmail(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -377,6 +397,38 @@ func TestValidateUsername(t *testing.T) {
 	}
 }
 
+func TestValidateRoleName(t *testing.T) {
+	tests := []struct {
+		name     string
+		roleName string
+		valid    bool
+	}{
+		{"Valid simple name", "auditor", true},
+		{"Valid with dash and digits", "payroll-2", true},
+		{"Valid with underscore", "hr_manager", true},
+		{"Too short", "hr", false},
+		{"Too long", "a" + strings.Repeat("b", 50), false},
+		{"Uppercase letters", "Auditor", false},
+		{"Starts with digit", "1auditor", false},
+		{"Contains dot", "hr.manager", false},
+		{"Empty", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid, errMsg := ValidateRoleName(tt.roleName)
+
+			if valid != tt.valid {
+				t.Errorf("ValidateRoleName(%q) valid = %v, want %v", tt.roleName, valid, tt.valid)
+			}
+
+			if !tt.valid && errMsg == "" {
+				t.Errorf("ValidateRoleName(%q) should return error message when invalid", tt.roleName)
+			}
+		})
+	}
+}
+
 func TestSanitizeString(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Выгрузка контактов в формате vCard 4.0 (RFC 6350)
+const (
+	ExportFormatVCard = "vcf"
+	VCardContentType  = "text/vcard; charset=utf-8"
+)
+
+const (
+	// Длина строки без CRLF; длиннее - перенос
+	vcardMaxLineOctets     = 75
+	vcardTimestampLayout   = "20060102T150405Z"
+	vcardBirthdayLayout    = "20060102"
+	vcardEscapedCharacters = "\\,;"
+)
+
+// VCard контакт; пустые поля не выводятся
+type VCard struct {
+	UID        string
+	FullName   string
+	Nickname   string
+	Emails     []string
+	Phones     []string
+	Title      string
+	Department string
+	Birthday   time.Time
+	Address    string
+	City       string
+	PostalCode string
+	Country    string
+	Timezone   string
+	Note       string
+	Categories []string
+	Revision   time.Time
+}
+
+// WriteVCard записывает одну карточку (BEGIN:VCARD ... END:VCARD)
+func WriteVCard(w io.Writer, card VCard) error {
+	var b strings.Builder
+	line := func(name, value string) {
+		writeVCardLine(&b, name+":"+value)
+	}
+
+	line("BEGIN", "VCARD")
+	line("VERSION", "4.0")
+	if card.UID != "" {
+		line("UID", escapeVCard(card.UID))
+	}
+	// FN обязателен
+	line("FN", escapeVCard(card.FullName))
+	if card.Nickname != "" {
+		line("NICKNAME", escapeVCard(card.Nickname))
+	}
+	for i, email := range card.Emails {
+		line(vcardPreferred("EMAIL", i), escapeVCard(email))
+	}
+	for i, phone := range card.Phones {
+		line(vcardPreferred("TEL", i), escapeVCard(phone))
+	}
+	if card.Title != "" {
+		line("TITLE", escapeVCard(card.Title))
+	}
+	if card.Department != "" {
+		line("ORG", escapeVCard(card.Department))
+	}
+	if !card.Birthday.IsZero() {
+		line("BDAY", card.Birthday.Format(vcardBirthdayLayout))
+	}
+	if card.Address != "" || card.City != "" || card.PostalCode != "" || card.Country != "" {
+		// ADR: почтовый ящик;доп. адрес;улица;город;регион;индекс;страна
+		line("ADR", strings.Join([]string{"", "", escapeVCard(card.Address), escapeVCard(card.City), "",
+			escapeVCard(card.PostalCode), escapeVCard(card.Country)}, ";"))
+	}
+	if card.Timezone != "" {
+		line("TZ", escapeVCard(card.Timezone))
+	}
+	if card.Note != "" {
+		line("NOTE", escapeVCard(card.Note))
+	}
+	if len(card.Categories) > 0 {
+		categories := make([]string, len(card.Categories))
+		for i, category := range card.Categories {
+			categories[i] = escapeVCard(category)
+		}
+		line("CATEGORIES", strings.Join(categories, ","))
+	}
+	if !card.Revision.IsZero() {
+		line("REV", card.Revision.UTC().Format(vcardTimestampLayout))
+	}
+	line("END", "VCARD")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// vcardPreferred первое значение помечается как основное
+func vcardPreferred(name string, index int) string {
+	if index == 0 {
+		return name + ";PREF=1"
+	}
+	return name
+}
+
+// escapeVCard экранирует значение свойства: \ , ; и переводы строк
+func escapeVCard(value string) string {
+	var b strings.Builder
+	for _, r := range strings.ReplaceAll(value, "\r\n", "\n") {
+		switch {
+		case r == '\n' || r == '\r':
+			b.WriteString(`\n`)
+		case strings.ContainsRune(vcardEscapedCharacters, r):
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// writeVCardLine записывает строку с переносом по 75 октетов (продолжение начинается с пробела),
+// не разрывая многобайтовые символы UTF-8
+func writeVCardLine(b *strings.Builder, content string) {
+	limit := vcardMaxLineOctets
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		b.WriteString(content[:cut])
+		b.WriteString("\r\n ")
+		content = content[cut:]
+		// Пробел в начале строки продолжения входит в лимит
+		limit = vcardMaxLineOctets - 1
+	}
+	b.WriteString(content)
+	b.WriteString("\r\n")
+}
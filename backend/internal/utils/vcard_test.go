@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteVCard(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteVCard(&buf, VCard{
+		UID:        "urn:test:1",
+		FullName:   "Иванов, Иван; мл.",
+		Emails:     []string{"ivanov@example.com", "ii@example.com"},
+		Phones:     []string{"+7 700 000 00 00"},
+		Birthday:   time.Date(1990, 5, 17, 0, 0, 0, 0, time.UTC),
+		City:       "Алматы",
+		Note:       "первая строка\nвторая",
+		Categories: []string{"ИТ", "a,b"},
+	})
+	if err != nil {
+		t.Fatalf("WriteVCard() error = %v", err)
+	}
+
+	got := buf.String()
+	for _, line := range []string{
+		"BEGIN:VCARD\r\nVERSION:4.0\r\n",
+		"FN:Иванов\\, Иван\\; мл.\r\n",
+		"EMAIL;PREF=1:ivanov@example.com\r\nEMAIL:ii@example.com\r\n",
+		"TEL;PREF=1:+7 700 000 00 00\r\n",
+		"BDAY:19900517\r\n",
+		"ADR:;;;Алматы;;;\r\n",
+		"NOTE:первая строка\\nвторая\r\n",
+		"CATEGORIES:ИТ,a\\,b\r\n",
+	} {
+		if !strings.Contains(got, line) {
+			t.Errorf("Missing %q in:\n%s", line, got)
+		}
+	}
+	if !strings.HasSuffix(got, "END:VCARD\r\n") {
+		t.Errorf("Card is not terminated: %q", got)
+	}
+}
+
+func TestWriteVCard_FoldsLongLines(t *testing.T) {
+	var buf bytes.Buffer
+	WriteVCard(&buf, VCard{FullName: strings.Repeat("Ж", 100)})
+
+	var unfolded strings.Builder
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Line longer than 75 octets: %d", len(line))
+		}
+		if strings.HasPrefix(line, " ") {
+			unfolded.WriteString(line[1:])
+			continue
+		}
+		unfolded.WriteString("\n" + line)
+	}
+	if !strings.Contains(unfolded.String(), "\nFN:"+strings.Repeat("Ж", 100)+"\n") {
+		t.Errorf("Folded value does not unfold to the original: %q", unfolded.String())
+	}
+}
@@ -0,0 +1,5 @@
+-- ==============================================
+-- Откат миграции 002: Удаление внешних учётных записей
+-- ==============================================
+
+DROP TABLE IF EXISTS user_identities CASCADE;
@@ -0,0 +1,25 @@
+-- ==============================================
+-- Миграция 002: Внешние учётные записи пользователей
+-- Связь пользователя с OIDC провайдером или LDAP/Active Directory
+-- ==============================================
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    external_id TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_login_at TIMESTAMP WITH TIME ZONE,
+    last_synced_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (provider, external_id)
+);
+
+-- Индексы для user_identities
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+CREATE INDEX idx_user_identities_provider ON user_identities(provider);
+
+-- Комментарии для user_identities
+COMMENT ON TABLE user_identities IS 'Внешние учётные записи пользователей (OIDC, LDAP)';
+COMMENT ON COLUMN user_identities.provider IS 'Источник учётной записи: oidc, ldap';
+COMMENT ON COLUMN user_identities.external_id IS 'Идентификатор во внешней системе: sub для OIDC, DN для LDAP';
+COMMENT ON COLUMN user_identities.last_synced_at IS 'Время последней успешной синхронизации с каталогом';
@@ -0,0 +1,6 @@
+-- ==============================================
+-- Откат миграции 003: Удаление API ключей
+-- ==============================================
+
+DROP TABLE IF EXISTS api_keys CASCADE;
+ALTER TABLE users DROP COLUMN IF EXISTS is_service_account;
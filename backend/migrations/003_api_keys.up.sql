@@ -0,0 +1,35 @@
+-- ==============================================
+-- Миграция 003: API ключи и сервисные учётные записи
+-- Долгоживущие ключи для интеграций (учётные системы, BI)
+-- ==============================================
+
+-- Сервисная учётная запись не входит интерактивно, только по API ключам
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_service_account BOOLEAN DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(32) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes JSONB DEFAULT '[]'::jsonb,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    last_used_ip VARCHAR(45),
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    revoked_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Индексы для api_keys
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
+CREATE INDEX idx_api_keys_expires_at ON api_keys(expires_at) WHERE revoked_at IS NULL;
+
+-- Комментарии для api_keys
+COMMENT ON TABLE api_keys IS 'API ключи пользователей и сервисных учётных записей';
+COMMENT ON COLUMN api_keys.prefix IS 'Начало ключа для отображения в списке (сам ключ не хранится)';
+COMMENT ON COLUMN api_keys.key_hash IS 'SHA-256 хеш ключа в hex';
+COMMENT ON COLUMN api_keys.scopes IS 'Разрешённые группы маршрутов: ["users:read", "users:write", ...]';
+COMMENT ON COLUMN api_keys.last_used_ip IS 'IP адрес последнего запроса с этим ключом';
+COMMENT ON COLUMN users.is_service_account IS 'Сервисная учётная запись: вход только по API ключам';
@@ -0,0 +1,5 @@
+-- ==============================================
+-- Откат миграции 004: Удаление ключей подписи JWT
+-- ==============================================
+
+DROP TABLE IF EXISTS jwt_signing_keys CASCADE;
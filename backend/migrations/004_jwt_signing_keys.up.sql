@@ -0,0 +1,28 @@
+-- ==============================================
+-- Миграция 004: Ключи подписи JWT
+-- Асимметричные ключи (RS256 / EdDSA) с ротацией; публичная часть отдаётся в /.well-known/jwks.json
+-- ==============================================
+
+CREATE TABLE IF NOT EXISTS jwt_signing_keys (
+    id SERIAL PRIMARY KEY,
+    kid VARCHAR(64) NOT NULL UNIQUE,
+    algorithm VARCHAR(16) NOT NULL,
+    private_key TEXT NOT NULL,
+    public_key TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    retired_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Индексы для jwt_signing_keys
+CREATE INDEX idx_jwt_signing_keys_active ON jwt_signing_keys(created_at DESC) WHERE retired_at IS NULL;
+CREATE INDEX idx_jwt_signing_keys_expires_at ON jwt_signing_keys(expires_at);
+
+-- Комментарии для jwt_signing_keys
+COMMENT ON TABLE jwt_signing_keys IS 'Ключи подписи JWT токенов';
+COMMENT ON COLUMN jwt_signing_keys.kid IS 'Идентификатор ключа (заголовок kid токена)';
+COMMENT ON COLUMN jwt_signing_keys.algorithm IS 'Алгоритм подписи: RS256, EdDSA';
+COMMENT ON COLUMN jwt_signing_keys.private_key IS 'Приватный ключ PKCS#8, зашифрованный AES-GCM ключом из JWT_SECRET';
+COMMENT ON COLUMN jwt_signing_keys.public_key IS 'Публичный ключ в PEM';
+COMMENT ON COLUMN jwt_signing_keys.retired_at IS 'Время замены новым ключом: ключ больше не подписывает, но ещё проверяет токены';
+COMMENT ON COLUMN jwt_signing_keys.expires_at IS 'Окончание периода отсрочки: после него ключ удаляется из JWKS';
@@ -0,0 +1,6 @@
+-- ==============================================
+-- Откат миграции 005: Удаление имперсонации из журнала аудита
+-- ==============================================
+
+DROP INDEX IF EXISTS idx_audit_log_impersonator_id;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS impersonator_id;
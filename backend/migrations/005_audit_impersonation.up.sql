@@ -0,0 +1,12 @@
+-- ==============================================
+-- Миграция 005: Имперсонация в журнале аудита
+-- Действия, выполненные администратором под другим пользователем, атрибутируются обоим
+-- ==============================================
+
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS impersonator_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+-- Индексы для audit_log
+CREATE INDEX IF NOT EXISTS idx_audit_log_impersonator_id ON audit_log(impersonator_id) WHERE impersonator_id IS NOT NULL;
+
+-- Комментарии для audit_log
+COMMENT ON COLUMN audit_log.impersonator_id IS 'Администратор, выполнивший действие от имени user_id (вход под пользователем)';
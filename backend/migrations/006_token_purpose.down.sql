@@ -0,0 +1,6 @@
+-- ==============================================
+-- Откат миграции 006: Удаление назначения токенов
+-- ==============================================
+
+DROP INDEX IF EXISTS idx_password_reset_tokens_user_purpose;
+ALTER TABLE password_reset_tokens DROP COLUMN IF EXISTS purpose;
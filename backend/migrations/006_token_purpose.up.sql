@@ -0,0 +1,12 @@
+-- ==============================================
+-- Миграция 006: Назначение одноразовых токенов
+-- password_reset_tokens используется и для сброса пароля, и для входа по ссылке (magic link)
+-- ==============================================
+
+ALTER TABLE password_reset_tokens ADD COLUMN IF NOT EXISTS purpose VARCHAR(20) NOT NULL DEFAULT 'password_reset';
+
+-- Индексы для password_reset_tokens
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_purpose ON password_reset_tokens(user_id, purpose);
+
+-- Комментарии для password_reset_tokens
+COMMENT ON COLUMN password_reset_tokens.purpose IS 'Назначение токена: password_reset, magic_link';
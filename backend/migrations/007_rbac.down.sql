@@ -0,0 +1,8 @@
+-- ==============================================
+-- Откат миграции 007: Удаление ролей и прав
+-- ==============================================
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS fk_users_role;
+DROP TABLE IF EXISTS role_permissions CASCADE;
+DROP TABLE IF EXISTS roles CASCADE;
+DROP TABLE IF EXISTS permissions CASCADE;
@@ -0,0 +1,83 @@
+-- ==============================================
+-- Миграция 007: Права доступа и роли
+-- Роль - набор прав; встроенные роли admin, moderator, user перенесены как наборы прав
+-- ==============================================
+
+CREATE TABLE IF NOT EXISTS permissions (
+    code VARCHAR(100) PRIMARY KEY,
+    description TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS roles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) NOT NULL UNIQUE,
+    description TEXT,
+    is_builtin BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_code VARCHAR(100) NOT NULL REFERENCES permissions(code) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_code)
+);
+
+-- Справочник прав
+INSERT INTO permissions (code, description) VALUES
+    ('users.read', 'Просмотр пользователей (без users.read.all - только назначенных)'),
+    ('users.read.all', 'Просмотр всех пользователей'),
+    ('users.create', 'Создание пользователей'),
+    ('users.update', 'Изменение профиля других пользователей'),
+    ('users.update.orgs', 'Изменение доступных организаций пользователей'),
+    ('users.update.role', 'Назначение ролей'),
+    ('users.update.credentials', 'Изменение логина и пароля пользователей'),
+    ('users.update.access', 'Изменение списка доступных пользователей'),
+    ('users.delete', 'Удаление пользователей'),
+    ('users.impersonate', 'Вход под другим пользователем'),
+    ('profile.update', 'Изменение своего профиля'),
+    ('api_keys.manage', 'Управление API ключами других пользователей'),
+    ('roles.manage', 'Управление ролями'),
+    ('orgs.manage', 'Управление организациями'),
+    ('reports.run.payroll', 'Запуск отчётов по заработной плате')
+ON CONFLICT (code) DO NOTHING;
+
+-- Встроенные роли
+INSERT INTO roles (name, description, is_builtin) VALUES
+    ('admin', 'Администратор', TRUE),
+    ('moderator', 'Модератор', TRUE),
+    ('user', 'Пользователь', TRUE)
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_code)
+SELECT r.id, p.code FROM roles r CROSS JOIN permissions p WHERE r.name = 'admin'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_code)
+SELECT r.id, p.code FROM roles r
+JOIN permissions p ON p.code IN ('users.read', 'users.update.orgs', 'profile.update')
+WHERE r.name = 'moderator'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_code)
+SELECT r.id, p.code FROM roles r
+JOIN permissions p ON p.code IN ('profile.update')
+WHERE r.name = 'user'
+ON CONFLICT DO NOTHING;
+
+-- Роли, которые уже встречаются у пользователей, сохраняются как пользовательские роли без прав
+INSERT INTO roles (name, description)
+SELECT DISTINCT role, 'Перенесено из users.role' FROM users
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE users ADD CONSTRAINT fk_users_role FOREIGN KEY (role) REFERENCES roles(name);
+
+-- Индексы для role_permissions
+CREATE INDEX idx_role_permissions_permission ON role_permissions(permission_code);
+
+-- Комментарии
+COMMENT ON TABLE permissions IS 'Справочник прав доступа';
+COMMENT ON TABLE roles IS 'Роли - именованные наборы прав';
+COMMENT ON COLUMN roles.is_builtin IS 'Встроенная роль: не изменяется и не удаляется через API';
+COMMENT ON TABLE role_permissions IS 'Права, входящие в роль';
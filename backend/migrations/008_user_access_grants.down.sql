@@ -0,0 +1,18 @@
+-- ==============================================
+-- Откат миграции 008: Возврат users.accessible_users
+-- Доступы к отделам и организациям теряются
+-- ==============================================
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS accessible_users JSONB DEFAULT '[]'::jsonb;
+
+UPDATE users u SET accessible_users = g.ids
+FROM (
+    SELECT grantee_id, jsonb_agg(user_id ORDER BY user_id) AS ids
+    FROM user_access_grants
+    WHERE scope = 'user'
+    GROUP BY grantee_id
+) g
+WHERE g.grantee_id = u.id;
+
+CREATE INDEX IF NOT EXISTS idx_users_accessible_users ON users USING GIN(accessible_users);
+DROP TABLE IF EXISTS user_access_grants CASCADE;
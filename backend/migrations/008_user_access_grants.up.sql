@@ -0,0 +1,46 @@
+-- ==============================================
+-- Миграция 008: Доступы модераторов к пользователям
+-- Заменяет JSONB массив users.accessible_users таблицей с внешними ключами
+-- ==============================================
+
+CREATE TABLE IF NOT EXISTS user_access_grants (
+    id SERIAL PRIMARY KEY,
+    grantee_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    scope VARCHAR(20) NOT NULL CHECK (scope IN ('user', 'department', 'organization')),
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    department VARCHAR(255),
+    organization_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE,
+    granted_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CONSTRAINT chk_user_access_grants_subject CHECK (
+        (scope = 'user' AND user_id IS NOT NULL AND department IS NULL AND organization_id IS NULL) OR
+        (scope = 'department' AND department IS NOT NULL AND user_id IS NULL AND organization_id IS NULL) OR
+        (scope = 'organization' AND organization_id IS NOT NULL AND user_id IS NULL AND department IS NULL)
+    )
+);
+
+-- Один доступ на каждый объект
+CREATE UNIQUE INDEX idx_user_access_grants_user ON user_access_grants(grantee_id, user_id) WHERE scope = 'user';
+CREATE UNIQUE INDEX idx_user_access_grants_department ON user_access_grants(grantee_id, LOWER(department)) WHERE scope = 'department';
+CREATE UNIQUE INDEX idx_user_access_grants_organization ON user_access_grants(grantee_id, organization_id) WHERE scope = 'organization';
+CREATE INDEX idx_user_access_grants_user_id ON user_access_grants(user_id);
+
+-- Перенос существующих доступов (ID удалённых пользователей отбрасываются)
+INSERT INTO user_access_grants (grantee_id, scope, user_id)
+SELECT DISTINCT u.id, 'user', target.id
+FROM users u
+CROSS JOIN LATERAL jsonb_array_elements_text(COALESCE(u.accessible_users, '[]'::jsonb)) AS a(value)
+JOIN users target ON target.id = a.value::int;
+
+DROP INDEX IF EXISTS idx_users_accessible_users;
+ALTER TABLE users DROP COLUMN IF EXISTS accessible_users;
+
+-- Комментарии для user_access_grants
+COMMENT ON TABLE user_access_grants IS 'Доступ пользователя (модератора) к другим пользователям';
+COMMENT ON COLUMN user_access_grants.grantee_id IS 'Кто получает доступ';
+COMMENT ON COLUMN user_access_grants.scope IS 'Объект доступа: user - один пользователь, department - отдел, organization - организация';
+COMMENT ON COLUMN user_access_grants.department IS 'Отдел (сравнивается с users.department без учёта регистра)';
+COMMENT ON COLUMN user_access_grants.organization_id IS 'Организация: доступны пользователи, у которых она есть в available_organizations';
+COMMENT ON COLUMN user_access_grants.granted_by IS 'Кто выдал доступ';
+COMMENT ON COLUMN user_access_grants.expires_at IS 'Срок действия (NULL - бессрочно)';
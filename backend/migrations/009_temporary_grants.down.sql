@@ -0,0 +1,21 @@
+-- ==============================================
+-- Откат миграции 009: Удаление временных доступов
+-- Истёкшие доступы к пользователям удаляются
+-- ==============================================
+
+DROP TABLE IF EXISTS organization_grants CASCADE;
+
+DELETE FROM user_access_grants WHERE expired_at IS NOT NULL;
+DROP INDEX IF EXISTS idx_user_access_grants_valid_until;
+DROP INDEX IF EXISTS idx_user_access_grants_user;
+DROP INDEX IF EXISTS idx_user_access_grants_department;
+DROP INDEX IF EXISTS idx_user_access_grants_organization;
+CREATE UNIQUE INDEX idx_user_access_grants_user ON user_access_grants(grantee_id, user_id) WHERE scope = 'user';
+CREATE UNIQUE INDEX idx_user_access_grants_department ON user_access_grants(grantee_id, LOWER(department)) WHERE scope = 'department';
+CREATE UNIQUE INDEX idx_user_access_grants_organization ON user_access_grants(grantee_id, organization_id) WHERE scope = 'organization';
+
+ALTER TABLE user_access_grants DROP CONSTRAINT IF EXISTS chk_user_access_grants_period;
+ALTER TABLE user_access_grants DROP COLUMN IF EXISTS expired_at;
+ALTER TABLE user_access_grants DROP COLUMN IF EXISTS notified_at;
+ALTER TABLE user_access_grants DROP COLUMN IF EXISTS valid_from;
+ALTER TABLE user_access_grants RENAME COLUMN valid_until TO expires_at;
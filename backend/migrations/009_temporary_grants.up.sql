@@ -0,0 +1,53 @@
+-- ==============================================
+-- Миграция 009: Временные доступы
+-- Срок действия доступов к пользователям и временный доступ к организациям
+-- ==============================================
+
+-- Доступы к пользователям: период действия вместо одного срока
+ALTER TABLE user_access_grants RENAME COLUMN expires_at TO valid_until;
+ALTER TABLE user_access_grants ADD COLUMN IF NOT EXISTS valid_from TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
+ALTER TABLE user_access_grants ADD COLUMN IF NOT EXISTS notified_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE user_access_grants ADD COLUMN IF NOT EXISTS expired_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE user_access_grants ADD CONSTRAINT chk_user_access_grants_period
+    CHECK (valid_until IS NULL OR valid_until > valid_from);
+
+-- Истёкшие доступы остаются для истории и не мешают выдать доступ заново
+DROP INDEX IF EXISTS idx_user_access_grants_user;
+DROP INDEX IF EXISTS idx_user_access_grants_department;
+DROP INDEX IF EXISTS idx_user_access_grants_organization;
+CREATE UNIQUE INDEX idx_user_access_grants_user ON user_access_grants(grantee_id, user_id)
+    WHERE scope = 'user' AND expired_at IS NULL;
+CREATE UNIQUE INDEX idx_user_access_grants_department ON user_access_grants(grantee_id, LOWER(department))
+    WHERE scope = 'department' AND expired_at IS NULL;
+CREATE UNIQUE INDEX idx_user_access_grants_organization ON user_access_grants(grantee_id, organization_id)
+    WHERE scope = 'organization' AND expired_at IS NULL;
+CREATE INDEX idx_user_access_grants_valid_until ON user_access_grants(valid_until)
+    WHERE valid_until IS NOT NULL AND expired_at IS NULL;
+
+-- Временный доступ пользователя к организации (аудиторы, замещающие бухгалтеры)
+CREATE TABLE IF NOT EXISTS organization_grants (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    valid_from TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    valid_until TIMESTAMP WITH TIME ZONE NOT NULL,
+    reason TEXT,
+    granted_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    notified_at TIMESTAMP WITH TIME ZONE,
+    expired_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CONSTRAINT chk_organization_grants_period CHECK (valid_until > valid_from)
+);
+
+CREATE INDEX idx_organization_grants_user_id ON organization_grants(user_id);
+CREATE INDEX idx_organization_grants_valid_until ON organization_grants(valid_until) WHERE expired_at IS NULL;
+
+-- Комментарии
+COMMENT ON COLUMN user_access_grants.valid_from IS 'Начало действия доступа';
+COMMENT ON COLUMN user_access_grants.valid_until IS 'Окончание действия (NULL - бессрочно)';
+COMMENT ON COLUMN user_access_grants.notified_at IS 'Когда отправлено уведомление о скором окончании';
+COMMENT ON COLUMN user_access_grants.expired_at IS 'Когда фоновая задача зафиксировала окончание доступа';
+COMMENT ON TABLE organization_grants IS 'Временный доступ пользователя к организации сверх available_organizations';
+COMMENT ON COLUMN organization_grants.reason IS 'Основание (приказ, замещение)';
+COMMENT ON COLUMN organization_grants.notified_at IS 'Когда отправлено уведомление о скором окончании';
+COMMENT ON COLUMN organization_grants.expired_at IS 'Когда фоновая задача зафиксировала окончание доступа';
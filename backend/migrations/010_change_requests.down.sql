@@ -0,0 +1,7 @@
+-- ==============================================
+-- Откат миграции 010: Подтверждение чувствительных изменений
+-- Неподтверждённые изменения теряются
+-- ==============================================
+
+DROP TABLE IF EXISTS user_change_requests CASCADE;
+DELETE FROM permissions WHERE code = 'users.approve_changes';
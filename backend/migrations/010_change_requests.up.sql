@@ -0,0 +1,37 @@
+-- ==============================================
+-- Миграция 010: Подтверждение чувствительных изменений
+-- Повышение до admin, разблокировка и новые организации ждут подтверждения второго администратора
+-- ==============================================
+
+INSERT INTO permissions (code, description) VALUES
+    ('users.approve_changes', 'Подтверждение и отклонение изменений пользователей, требующих второго администратора')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_code)
+SELECT r.id, 'users.approve_changes' FROM roles r WHERE r.name = 'admin'
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS user_change_requests (
+    id SERIAL PRIMARY KEY,
+    target_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    requested_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    rules TEXT[] NOT NULL,
+    changes JSONB NOT NULL,
+    diff JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'approved', 'rejected')),
+    reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    review_comment TEXT,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_user_change_requests_pending ON user_change_requests(created_at) WHERE status = 'pending';
+CREATE INDEX idx_user_change_requests_target ON user_change_requests(target_user_id);
+
+-- Комментарии
+COMMENT ON TABLE user_change_requests IS 'Изменения пользователей, ожидающие подтверждения второго администратора';
+COMMENT ON COLUMN user_change_requests.rules IS 'Сработавшие правила: role_admin, unblock, organizations';
+COMMENT ON COLUMN user_change_requests.changes IS 'Отложенная часть UpdateUserRequest, применяется через UserRepository.Update';
+COMMENT ON COLUMN user_change_requests.diff IS 'Значения полей до и после изменения на момент запроса';
+COMMENT ON COLUMN user_change_requests.status IS 'pending, approved или rejected';
@@ -0,0 +1,6 @@
+-- ==============================================
+-- Откат миграции 011: Просмотр журнала аудита
+-- ==============================================
+
+DROP INDEX IF EXISTS idx_audit_log_ip_address;
+DELETE FROM permissions WHERE code = 'audit.read';
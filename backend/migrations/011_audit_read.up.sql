@@ -0,0 +1,15 @@
+-- ==============================================
+-- Миграция 011: Просмотр журнала аудита
+-- Право audit.read и индекс для фильтра по IP
+-- ==============================================
+
+INSERT INTO permissions (code, description) VALUES
+    ('audit.read', 'Просмотр и выгрузка журнала аудита')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_code)
+SELECT r.id, 'audit.read' FROM roles r WHERE r.name = 'admin'
+ON CONFLICT DO NOTHING;
+
+-- Фильтр ip_address <<= подсеть
+CREATE INDEX IF NOT EXISTS idx_audit_log_ip_address ON audit_log USING GIST (ip_address inet_ops);
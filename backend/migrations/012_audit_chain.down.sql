@@ -0,0 +1,23 @@
+-- ==============================================
+-- Откат миграции 012: Защита журнала аудита от изменений
+-- ==============================================
+
+DROP TABLE IF EXISTS audit_log_checkpoints;
+
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+DROP TRIGGER IF EXISTS audit_log_chain ON audit_log;
+DROP FUNCTION IF EXISTS audit_log_append_only();
+DROP FUNCTION IF EXISTS audit_log_chain();
+DROP FUNCTION IF EXISTS audit_hash_field(TEXT);
+
+-- Записи могут ссылаться на уже удалённых пользователей
+ALTER TABLE audit_log ADD CONSTRAINT audit_log_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL NOT VALID;
+ALTER TABLE audit_log ADD CONSTRAINT audit_log_target_user_id_fkey
+    FOREIGN KEY (target_user_id) REFERENCES users(id) ON DELETE SET NULL NOT VALID;
+ALTER TABLE audit_log ADD CONSTRAINT audit_log_impersonator_id_fkey
+    FOREIGN KEY (impersonator_id) REFERENCES users(id) ON DELETE SET NULL NOT VALID;
+
+ALTER TABLE audit_log DROP COLUMN IF EXISTS hash;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS prev_hash;
@@ -0,0 +1,95 @@
+-- ==============================================
+-- Миграция 012: Защита журнала аудита от изменений
+-- Каждая запись хранит хеш своего содержимого и хеш предыдущей записи (цепочка);
+-- изменение и удаление записей запрещены; подписанные контрольные точки цепочки
+-- ==============================================
+
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS prev_hash VARCHAR(64);
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS hash VARCHAR(64);
+
+-- ON DELETE SET NULL изменял бы записи при удалении пользователя:
+-- журнал хранит ID и после удаления пользователя
+ALTER TABLE audit_log DROP CONSTRAINT IF EXISTS audit_log_user_id_fkey;
+ALTER TABLE audit_log DROP CONSTRAINT IF EXISTS audit_log_target_user_id_fkey;
+ALTER TABLE audit_log DROP CONSTRAINT IF EXISTS audit_log_impersonator_id_fkey;
+
+-- Поле в содержимом хеша: "длина в байтах:значение", NULL - "-"
+-- (тот же расчёт в Go: repositories.AuditChainRow.ComputeHash)
+CREATE OR REPLACE FUNCTION audit_hash_field(value TEXT)
+RETURNS TEXT AS $$
+    SELECT CASE WHEN value IS NULL THEN '-' ELSE octet_length(value)::text || ':' || value END
+$$ LANGUAGE sql IMMUTABLE;
+
+-- Добавление записи в цепочку
+CREATE OR REPLACE FUNCTION audit_log_chain()
+RETURNS TRIGGER AS $$
+DECLARE
+    prev TEXT;
+BEGIN
+    -- Записи добавляются в цепочку по одной; ID выдаётся под блокировкой,
+    -- чтобы порядок ID совпадал с порядком цепочки при параллельных вставках
+    PERFORM pg_advisory_xact_lock(hashtext('audit_log_chain'));
+    NEW.id := nextval(pg_get_serial_sequence('audit_log', 'id'));
+    NEW.created_at := COALESCE(NEW.created_at, NOW());
+
+    SELECT hash INTO prev FROM audit_log ORDER BY id DESC LIMIT 1;
+
+    NEW.prev_hash := prev;
+    NEW.hash := encode(sha256(convert_to(
+        audit_hash_field(prev) ||
+        audit_hash_field(NEW.id::text) ||
+        audit_hash_field(NEW.user_id::text) ||
+        audit_hash_field(NEW.action) ||
+        audit_hash_field(NEW.target_user_id::text) ||
+        audit_hash_field(NEW.impersonator_id::text) ||
+        audit_hash_field(NEW.details::text) ||
+        audit_hash_field(NEW.ip_address::text) ||
+        audit_hash_field(NEW.user_agent) ||
+        audit_hash_field((extract(epoch FROM NEW.created_at) * 1000000)::bigint::text),
+        'UTF8')), 'hex');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION audit_log_append_only()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION '% is not allowed on %: audit records are append-only', TG_OP, TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_chain
+    BEFORE INSERT ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_chain();
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+-- Подписанные контрольные точки: фиксируют хеш последней записи на момент подписи,
+-- чтобы нельзя было незаметно пересчитать цепочку или удалить её конец
+CREATE TABLE IF NOT EXISTS audit_log_checkpoints (
+    id SERIAL PRIMARY KEY,
+    last_entry_id INTEGER NOT NULL,
+    last_hash VARCHAR(64) NOT NULL,
+    key_id VARCHAR(32) NOT NULL,
+    signature TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_log_checkpoints_last_entry_id ON audit_log_checkpoints(last_entry_id);
+
+CREATE TRIGGER audit_log_checkpoints_append_only
+    BEFORE UPDATE OR DELETE ON audit_log_checkpoints
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+-- Комментарии
+COMMENT ON COLUMN audit_log.prev_hash IS 'Хеш предыдущей записи (NULL - первая запись цепочки)';
+COMMENT ON COLUMN audit_log.hash IS 'SHA-256 содержимого записи и prev_hash в hex; NULL у записей до включения цепочки';
+COMMENT ON TABLE audit_log_checkpoints IS 'Подписанные контрольные точки цепочки журнала аудита';
+COMMENT ON COLUMN audit_log_checkpoints.key_id IS 'Отпечаток публичного ключа Ed25519 (AUDIT_SIGNING_KEY)';
+COMMENT ON COLUMN audit_log_checkpoints.signature IS 'Подпись Ed25519 в base64 (repositories.AuditCheckpoint.SignedMessage)';
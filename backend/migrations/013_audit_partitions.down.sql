@@ -0,0 +1,56 @@
+-- ==============================================
+-- Откат миграции 013: Месячные секции журнала аудита и архивы
+-- Записи удалённых секций остаются только в файлах архива
+-- ==============================================
+
+DROP TABLE IF EXISTS audit_log_archives;
+
+ALTER TABLE audit_log RENAME TO audit_log_partitioned;
+ALTER SEQUENCE audit_log_id_seq OWNED BY NONE;
+
+CREATE TABLE audit_log (
+    id INTEGER PRIMARY KEY DEFAULT nextval('audit_log_id_seq'),
+    user_id INTEGER,
+    action VARCHAR(50) NOT NULL,
+    target_user_id INTEGER,
+    details JSONB DEFAULT '{}'::jsonb,
+    ip_address INET,
+    user_agent TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    impersonator_id INTEGER,
+    prev_hash VARCHAR(64),
+    hash VARCHAR(64)
+);
+
+ALTER SEQUENCE audit_log_id_seq OWNED BY audit_log.id;
+
+INSERT INTO audit_log (id, user_id, action, target_user_id, details, ip_address, user_agent, created_at,
+                       impersonator_id, prev_hash, hash)
+SELECT id, user_id, action, target_user_id, details, ip_address, user_agent, created_at,
+       impersonator_id, prev_hash, hash
+FROM audit_log_partitioned;
+
+DROP TABLE audit_log_partitioned;
+
+CREATE INDEX idx_audit_log_user_id ON audit_log(user_id);
+CREATE INDEX idx_audit_log_action ON audit_log(action);
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at DESC);
+CREATE INDEX idx_audit_log_target_user_id ON audit_log(target_user_id);
+CREATE INDEX idx_audit_log_user_action ON audit_log(user_id, action, created_at DESC);
+CREATE INDEX idx_audit_log_impersonator_id ON audit_log(impersonator_id) WHERE impersonator_id IS NOT NULL;
+CREATE INDEX idx_audit_log_ip_address ON audit_log USING GIST (ip_address inet_ops);
+
+CREATE TRIGGER audit_log_chain
+    BEFORE INSERT ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_chain();
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+DROP FUNCTION IF EXISTS audit_log_create_partition(DATE);
+DROP FUNCTION IF EXISTS audit_log_now();
@@ -0,0 +1,126 @@
+-- ==============================================
+-- Миграция 013: Месячные секции журнала аудита и архивы
+-- audit_log секционируется по created_at: устаревшие месяцы выгружаются в архив
+-- и удаляются целиком (DROP секции) вместо удаления строк
+-- ==============================================
+
+-- Время записи берётся под той же блокировкой, под которой audit_log_chain выдаёт ID:
+-- порядок created_at совпадает с порядком цепочки, и месячные секции не пересекаются по ID
+CREATE OR REPLACE FUNCTION audit_log_now()
+RETURNS TIMESTAMP WITH TIME ZONE AS $$
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext('audit_log_chain'));
+    RETURN clock_timestamp();
+END;
+$$ LANGUAGE plpgsql VOLATILE;
+
+-- Создает секцию месяца (если её нет) и возвращает её имя: audit_log_y2025m01
+CREATE OR REPLACE FUNCTION audit_log_create_partition(month DATE)
+RETURNS TEXT AS $$
+DECLARE
+    month_start DATE := date_trunc('month', month)::date;
+    partition_name TEXT := 'audit_log_' || to_char(month_start, '"y"YYYY"m"MM');
+BEGIN
+    EXECUTE format(
+        'CREATE TABLE IF NOT EXISTS %I PARTITION OF audit_log FOR VALUES FROM (%L) TO (%L)',
+        partition_name, month_start, (month_start + INTERVAL '1 month')::date
+    );
+    RETURN partition_name;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Перенос записей в секционированную таблицу (триггеры новой таблицы создаются после переноса,
+-- ID и хеши записей сохраняются)
+ALTER TABLE audit_log RENAME TO audit_log_unpartitioned;
+ALTER SEQUENCE audit_log_id_seq OWNED BY NONE;
+
+CREATE TABLE audit_log (
+    id INTEGER NOT NULL DEFAULT nextval('audit_log_id_seq'),
+    user_id INTEGER,
+    action VARCHAR(50) NOT NULL,
+    target_user_id INTEGER,
+    details JSONB DEFAULT '{}'::jsonb,
+    ip_address INET,
+    user_agent TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT audit_log_now(),
+    impersonator_id INTEGER,
+    prev_hash VARCHAR(64),
+    hash VARCHAR(64),
+    PRIMARY KEY (id, created_at)
+) PARTITION BY RANGE (created_at);
+
+ALTER SEQUENCE audit_log_id_seq OWNED BY audit_log.id;
+
+-- Секции от первой записи до трёх месяцев вперёд (дальше их создает фоновая задача обслуживания)
+DO $$
+DECLARE
+    month DATE;
+BEGIN
+    FOR month IN
+        SELECT generate_series(
+            date_trunc('month', COALESCE((SELECT MIN(created_at) FROM audit_log_unpartitioned), NOW())),
+            date_trunc('month', NOW()) + INTERVAL '3 months',
+            INTERVAL '1 month'
+        )::date
+    LOOP
+        PERFORM audit_log_create_partition(month);
+    END LOOP;
+END $$;
+
+INSERT INTO audit_log (id, user_id, action, target_user_id, details, ip_address, user_agent, created_at,
+                       impersonator_id, prev_hash, hash)
+SELECT id, user_id, action, target_user_id, details, ip_address, user_agent, COALESCE(created_at, NOW()),
+       impersonator_id, prev_hash, hash
+FROM audit_log_unpartitioned;
+
+DROP TABLE audit_log_unpartitioned;
+
+-- Индексы для audit_log
+CREATE INDEX idx_audit_log_user_id ON audit_log(user_id);
+CREATE INDEX idx_audit_log_action ON audit_log(action);
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at DESC);
+CREATE INDEX idx_audit_log_target_user_id ON audit_log(target_user_id);
+CREATE INDEX idx_audit_log_user_action ON audit_log(user_id, action, created_at DESC);
+CREATE INDEX idx_audit_log_impersonator_id ON audit_log(impersonator_id) WHERE impersonator_id IS NOT NULL;
+CREATE INDEX idx_audit_log_ip_address ON audit_log USING GIST (ip_address inet_ops);
+
+CREATE TRIGGER audit_log_chain
+    BEFORE INSERT ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_chain();
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+-- Выгруженные и удалённые секции; последняя запись архива - начало оставшейся цепочки
+CREATE TABLE IF NOT EXISTS audit_log_archives (
+    id SERIAL PRIMARY KEY,
+    partition_name VARCHAR(63) NOT NULL UNIQUE,
+    month DATE NOT NULL,
+    entries INTEGER NOT NULL,
+    first_entry_id INTEGER,
+    last_entry_id INTEGER,
+    last_hash VARCHAR(64),
+    file_path TEXT NOT NULL,
+    file_sha256 VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER audit_log_archives_append_only
+    BEFORE UPDATE OR DELETE ON audit_log_archives
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+-- Комментарии
+COMMENT ON TABLE audit_log IS 'Журнал всех действий пользователей в системе (месячные секции audit_log_yYYYYmMM)';
+COMMENT ON COLUMN audit_log.action IS 'Тип действия: login, logout, create_user, update_user, delete_user, change_password и т.д.';
+COMMENT ON COLUMN audit_log.details IS 'Дополнительная информация о действии в формате JSON';
+COMMENT ON COLUMN audit_log.impersonator_id IS 'Администратор, выполнивший действие от имени user_id (вход под пользователем)';
+COMMENT ON COLUMN audit_log.prev_hash IS 'Хеш предыдущей записи (NULL - первая запись цепочки)';
+COMMENT ON COLUMN audit_log.hash IS 'SHA-256 содержимого записи и prev_hash в hex; NULL у записей до включения цепочки';
+COMMENT ON TABLE audit_log_archives IS 'Секции журнала аудита, выгруженные в архив NDJSON.gz и удалённые';
+COMMENT ON COLUMN audit_log_archives.last_hash IS 'Хеш последней записи секции: на него ссылается prev_hash первой оставшейся записи';
+COMMENT ON COLUMN audit_log_archives.file_sha256 IS 'SHA-256 файла архива в hex';
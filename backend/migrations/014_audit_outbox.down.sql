@@ -0,0 +1,5 @@
+-- ==============================================
+-- Откат миграции 014: Очередь доставки журнала аудита
+-- ==============================================
+
+DROP TABLE IF EXISTS audit_outbox;
@@ -0,0 +1,28 @@
+-- ==============================================
+-- Миграция 014: Очередь доставки журнала аудита во внешние системы
+-- Запись журнала и строки очереди для каждого получателя (syslog, webhook) добавляются
+-- одной командой; фоновая задача доставляет их с повторами, не задерживая запросы
+-- ==============================================
+
+CREATE TABLE IF NOT EXISTS audit_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    audit_log_id INTEGER NOT NULL,
+    sink TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_error TEXT,
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_outbox_pending ON audit_outbox(sink, next_attempt_at) WHERE delivered_at IS NULL;
+CREATE INDEX idx_audit_outbox_created_at ON audit_outbox(created_at);
+
+-- Комментарии
+COMMENT ON TABLE audit_outbox IS 'Очередь доставки записей журнала аудита получателям (SIEM)';
+COMMENT ON COLUMN audit_outbox.audit_log_id IS 'ID записи audit_log (без внешнего ключа: журнал секционирован и архивируется)';
+COMMENT ON COLUMN audit_outbox.sink IS 'Имя получателя: syslog:host:port или webhook:URL';
+COMMENT ON COLUMN audit_outbox.attempts IS 'Число попыток доставки';
+COMMENT ON COLUMN audit_outbox.next_attempt_at IS 'Время следующей попытки (во время доставки - срок аренды строки)';
+COMMENT ON COLUMN audit_outbox.last_error IS 'Ошибка последней неудачной попытки';
+COMMENT ON COLUMN audit_outbox.delivered_at IS 'Время успешной доставки (NULL - ещё не доставлено)';
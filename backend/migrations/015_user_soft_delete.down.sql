@@ -0,0 +1,10 @@
+-- ==============================================
+-- Откат миграции 015: Мягкое удаление пользователей
+-- Пользователи из корзины удаляются окончательно, иначе после отката они снова станут активными
+-- ==============================================
+
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_users_deleted_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
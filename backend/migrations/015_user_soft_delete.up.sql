@@ -0,0 +1,16 @@
+-- ==============================================
+-- Миграция 015: Мягкое удаление пользователей
+-- Удалённый пользователь остаётся в таблице (корзина) и может быть восстановлен;
+-- окончательно удаляется по истечении RETENTION_DELETED_USERS_DAYS.
+-- Логин удалённого пользователя остаётся занятым до окончательного удаления (UNIQUE username)
+-- ==============================================
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+-- Корзина и окончательное удаление по сроку
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Комментарии
+COMMENT ON COLUMN users.deleted_at IS 'Когда пользователь удалён (NULL - не удалён); удалённые исключаются из всех выборок';
+COMMENT ON COLUMN users.deleted_by IS 'Кто удалил пользователя';
@@ -0,0 +1,8 @@
+-- ==============================================
+-- Откат миграции 016: Персональные данные уволенных сотрудников
+-- Обезличенные данные не восстанавливаются
+-- ==============================================
+
+ALTER TABLE users DROP COLUMN IF EXISTS anonymized_by;
+ALTER TABLE users DROP COLUMN IF EXISTS anonymized_at;
+DELETE FROM permissions WHERE code = 'users.personal_data';
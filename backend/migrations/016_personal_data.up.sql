@@ -0,0 +1,21 @@
+-- ==============================================
+-- Миграция 016: Персональные данные уволенных сотрудников
+-- Право users.personal_data (выгрузка всех данных пользователя и обезличивание)
+-- и отметка об обезличивании. Обезличивание необратимо: ФИО, контакты, дата рождения,
+-- адрес, соцсети и аватар стираются, ID и ссылки журнала аудита сохраняются
+-- ==============================================
+
+INSERT INTO permissions (code, description) VALUES
+    ('users.personal_data', 'Выгрузка и обезличивание персональных данных пользователей')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_code)
+SELECT r.id, 'users.personal_data' FROM roles r WHERE r.name = 'admin'
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS anonymized_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+-- Комментарии
+COMMENT ON COLUMN users.anonymized_at IS 'Когда персональные данные пользователя обезличены (NULL - не обезличены)';
+COMMENT ON COLUMN users.anonymized_by IS 'Кто обезличил персональные данные';
@@ -0,0 +1,8 @@
+-- ==============================================
+-- Откат миграции 017: Типизированные дополнительные поля пользователей
+-- Значения в users.custom_fields сохраняются без описаний
+-- ==============================================
+
+DROP INDEX IF EXISTS idx_users_custom_fields;
+DROP TABLE IF EXISTS custom_field_definitions CASCADE;
+DELETE FROM permissions WHERE code = 'custom_fields.manage';
@@ -0,0 +1,41 @@
+-- ==============================================
+-- Миграция 017: Типизированные дополнительные поля пользователей
+-- Администратор описывает ключи users.custom_fields (тип, обязательность, допустимые значения,
+-- видимость по ролям); создание и изменение пользователей проверяются по этим описаниям
+-- ==============================================
+
+INSERT INTO permissions (code, description) VALUES
+    ('custom_fields.manage', 'Настройка дополнительных полей профиля пользователей')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_code)
+SELECT r.id, 'custom_fields.manage' FROM roles r WHERE r.name = 'admin'
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS custom_field_definitions (
+    id SERIAL PRIMARY KEY,
+    key VARCHAR(64) NOT NULL UNIQUE,
+    label VARCHAR(255) NOT NULL,
+    type VARCHAR(16) NOT NULL CHECK (type IN ('string', 'number', 'date', 'enum', 'bool')),
+    required BOOLEAN NOT NULL DEFAULT false,
+    allowed_values TEXT[] NOT NULL DEFAULT '{}',
+    visible_to TEXT[] NOT NULL DEFAULT '{}',
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TRIGGER update_custom_field_definitions_updated_at
+    BEFORE UPDATE ON custom_field_definitions
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Фильтр списка пользователей по значениям дополнительных полей (custom_fields @> ...)
+CREATE INDEX IF NOT EXISTS idx_users_custom_fields ON users USING GIN (custom_fields jsonb_path_ops);
+
+-- Комментарии
+COMMENT ON TABLE custom_field_definitions IS 'Описания дополнительных полей профиля (ключей users.custom_fields)';
+COMMENT ON COLUMN custom_field_definitions.key IS 'Ключ в users.custom_fields; не меняется после создания';
+COMMENT ON COLUMN custom_field_definitions.type IS 'string, number, date (YYYY-MM-DD), enum или bool';
+COMMENT ON COLUMN custom_field_definitions.allowed_values IS 'Допустимые значения для типа enum';
+COMMENT ON COLUMN custom_field_definitions.visible_to IS 'Роли, которым поле видно и доступно для заполнения (пусто - всем)';
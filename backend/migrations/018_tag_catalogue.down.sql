@@ -0,0 +1,6 @@
+-- ==============================================
+-- Откат миграции 018: Каталог тегов пользователей
+-- ==============================================
+
+DELETE FROM permissions WHERE code = 'tags.manage';
+COMMENT ON COLUMN users.tags IS NULL;
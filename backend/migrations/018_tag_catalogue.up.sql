@@ -0,0 +1,16 @@
+-- ==============================================
+-- Миграция 018: Каталог тегов пользователей
+-- Право tags.manage: переименование, слияние и удаление тегов сразу у всех пользователей.
+-- Фильтр списка по тегам использует существующий GIN индекс idx_users_tags (операторы ?| и ?&)
+-- ==============================================
+
+INSERT INTO permissions (code, description) VALUES
+    ('tags.manage', 'Переименование, слияние и удаление тегов пользователей')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_code)
+SELECT r.id, 'tags.manage' FROM roles r WHERE r.name = 'admin'
+ON CONFLICT DO NOTHING;
+
+-- Комментарии
+COMMENT ON COLUMN users.tags IS 'Теги пользователя (JSON массив строк); каталог - GET /api/tags';
@@ -0,0 +1,14 @@
+-- ==============================================
+-- Откат миграции 019: Полнотекстовый и нечёткий поиск пользователей
+-- Расширение pg_trgm не удаляется: его могут использовать другие объекты базы
+-- ==============================================
+
+DROP TRIGGER IF EXISTS users_search_update ON users;
+DROP FUNCTION IF EXISTS users_search_update();
+DROP INDEX IF EXISTS idx_users_phone_digits_trgm;
+DROP INDEX IF EXISTS idx_users_search_text_trgm;
+DROP INDEX IF EXISTS idx_users_search_vector;
+ALTER TABLE users DROP COLUMN IF EXISTS phone_digits;
+ALTER TABLE users DROP COLUMN IF EXISTS search_text;
+ALTER TABLE users DROP COLUMN IF EXISTS search_vector;
+DROP FUNCTION IF EXISTS translit_kk_ru(TEXT);
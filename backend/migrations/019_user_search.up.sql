@@ -0,0 +1,67 @@
+-- ==============================================
+-- Миграция 019: Полнотекстовый и нечёткий поиск пользователей
+-- search_vector (tsvector) - поиск по словам и их началу, search_text - поиск подстроки и
+-- опечаток через pg_trgm (с транслитерацией ФИО: "Асылбек" находится по "Asylbek" и наоборот),
+-- phone_digits - телефоны только цифрами. Поля заполняются триггером при изменении
+-- ФИО, логина, email и телефонов
+-- ==============================================
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Транслитерация кириллицы (русский и казахский алфавиты) в латиницу, в нижнем регистре
+CREATE OR REPLACE FUNCTION translit_kk_ru(value TEXT)
+RETURNS TEXT AS $$
+    SELECT translate(
+        replace(replace(replace(replace(replace(replace(replace(replace(replace(
+            lower(value),
+            'щ', 'shch'), 'ж', 'zh'), 'ч', 'ch'), 'ш', 'sh'), 'ю', 'yu'), 'я', 'ya'), 'х', 'kh'), 'ц', 'ts'), 'ё', 'e'),
+        'абвгдезийклмнопрстуфыэәғқңөұүһіъь',
+        'abvgdeziiklmnoprstufyeagknouuhi'
+    )
+$$ LANGUAGE sql IMMUTABLE;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector TSVECTOR;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search_text TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_digits TEXT;
+
+CREATE OR REPLACE FUNCTION users_search_update()
+RETURNS TRIGGER AS $$
+DECLARE
+    emails_text TEXT;
+BEGIN
+    SELECT string_agg(e, ' ') INTO emails_text
+    FROM jsonb_array_elements_text(COALESCE(NEW.emails, '[]'::jsonb)) AS e;
+
+    NEW.search_vector :=
+        setweight(to_tsvector('simple', COALESCE(NEW.full_name, '')), 'A') ||
+        setweight(to_tsvector('simple', translit_kk_ru(COALESCE(NEW.full_name, ''))), 'A') ||
+        setweight(to_tsvector('simple', COALESCE(NEW.username, '')), 'A') ||
+        setweight(to_tsvector('simple', COALESCE(emails_text, '')), 'B');
+    NEW.search_text := lower(concat_ws(' ', NEW.full_name, NEW.username, emails_text, translit_kk_ru(NEW.full_name)));
+    NEW.phone_digits := (
+        SELECT string_agg(regexp_replace(p, '\D', '', 'g'), ' ')
+        FROM jsonb_array_elements_text(COALESCE(NEW.phones, '[]'::jsonb)) AS p
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_search_update
+    BEFORE INSERT OR UPDATE OF full_name, username, emails, phones ON users
+    FOR EACH ROW EXECUTE FUNCTION users_search_update();
+
+-- Заполнение для существующих пользователей (без изменения updated_at)
+ALTER TABLE users DISABLE TRIGGER update_users_updated_at;
+UPDATE users SET full_name = full_name;
+ALTER TABLE users ENABLE TRIGGER update_users_updated_at;
+
+CREATE INDEX IF NOT EXISTS idx_users_search_vector ON users USING GIN(search_vector);
+CREATE INDEX IF NOT EXISTS idx_users_search_text_trgm ON users USING GIN(search_text gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_phone_digits_trgm ON users USING GIN(phone_digits gin_trgm_ops);
+
+-- Комментарии
+COMMENT ON FUNCTION translit_kk_ru(TEXT) IS 'Транслитерация русской и казахской кириллицы в латиницу (нижний регистр)';
+COMMENT ON COLUMN users.search_vector IS 'Слова ФИО (и его транслитерации), логина и email для полнотекстового поиска; заполняется триггером';
+COMMENT ON COLUMN users.search_text IS 'ФИО, логин, email и транслитерация ФИО в нижнем регистре для поиска подстроки и опечаток (pg_trgm); заполняется триггером';
+COMMENT ON COLUMN users.phone_digits IS 'Телефоны только цифрами через пробел; заполняется триггером';
+COMMENT ON INDEX idx_users_search_text_trgm IS 'Триграммный индекс для LIKE и нечёткого поиска (<%)';